@@ -0,0 +1,77 @@
+// Go Release Tour Runner - Standalone execution process
+//
+// The runner builds and runs code snippets for the web server so that the
+// Go toolchains and the sandbox can live on separate hosts. The web server
+// dispatches executions to one or more runners listed in its RUNNER_URLS;
+// several runners can also run side by side on localhost.
+//
+// API Endpoints (see app/internal/version/runner.go for the protocol):
+// - GET /v1/info: Sandbox, scheduler state and installed Go versions
+// - POST /v1/execute: Execute a request (newline-delimited JSON, full duplex for stdin)
+//
+// Environment Variables:
+// - RUNNER_HOST: Listen address (default: 127.0.0.1; other than loopback requires RUNNER_TOKEN)
+// - RUNNER_PORT: Listen port (default: 9090)
+// - RUNNER_TOKEN: Bearer token required from the web server (default: none)
+// - SANDBOX_MODE / MAX_OUTPUT_BYTES / CODE_POLICY_FILE: same as the web server
+// - GO_TOOLCHAIN_DIRS / TOOLCHAIN_RESCAN_INTERVAL: toolchains of this runner, rescanned on SIGHUP
+// - TOOLCHAIN_PROVISION / TOOLCHAIN_GOPROXY / TOOLCHAIN_DIR / TOOLCHAIN_SUMS: download missing toolchains (see the web server)
+// - BUILD_CACHE_DIR / BUILD_CACHE_MAX_BYTES: compiled binary cache of this runner
+// - EXEC_WORKERS / EXEC_QUEUE_SIZE / EXEC_QUEUE_PER_CLIENT: executions this runner accepts at once and queues
+//
+// Usage:
+//
+//	RUNNER_PORT=9001 go run ./app/cmd/runner &
+//	RUNNER_PORT=9002 go run ./app/cmd/runner &
+//	RUNNER_URLS=http://localhost:9001,http://localhost:9002 go run ./app/cmd/server
+//
+// Author: Go Release Tour Project
+// License: MIT
+// Go Version: 1.24+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go-release-tour/app/internal/version"
+)
+
+func main() {
+	// サンドボックスinitとして再実行された場合はここで処理を引き継ぐ
+	version.RunSandboxInitIfRequested()
+
+	host := os.Getenv("RUNNER_HOST")
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port := os.Getenv("RUNNER_PORT")
+	if port == "" {
+		port = "9090"
+	}
+	// 認証なしでコードを実行できるランナーを外部に公開しない
+	if err := version.CheckRunnerListenHost(host); err != nil {
+		log.Fatalf("runner: %v", err)
+	}
+	addr := net.JoinHostPort(host, port)
+
+	// SIGHUP（と TOOLCHAIN_RESCAN_INTERVAL）でツールチェーンを再スキャン
+	version.WatchToolchains()
+
+	// ランナー自身は RUNNER_URLS を見ず、常にこのプロセスで実行する
+	executor := version.NewExecutorWithSandbox(version.GetSandbox())
+	fmt.Printf("Go Release Tour runner starting on %s (versions: %v)\n", addr, executor.GetSupportedVersions())
+
+	httpServer := &http.Server{
+		Addr:    addr,
+		Handler: version.NewRunnerHandler(executor),
+		// 実行中は標準入力と出力が双方向に流れ続けるため、本文の読み書きにはタイムアウトを設けない
+		ReadHeaderTimeout: 15 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	log.Fatal(httpServer.ListenAndServe())
+}
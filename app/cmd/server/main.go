@@ -17,8 +17,26 @@
 //
 // API Endpoints:
 // - GET /api/versions: Available Go versions
-// - GET /api/lessons?version=X.XX: Lessons for specific version
-// - POST /api/run: Execute Go code snippets
+// - GET /api/lessons?version=X.XX: Lessons for specific version, with the patch each was validated against
+// - POST /api/run: Execute Go code snippets ("version" is a minor version like 1.22 or a patch release like 1.22.7)
+// - GET /api/run/ws: Execute Go code over WebSocket (streaming output, stdin, stop)
+// - POST /api/run/matrix: Execute Go code on several versions / env presets and diff the outputs
+// - POST /api/run/bench: Compare Benchmark* functions across versions / env presets with statistics
+// - POST /api/run/wasm: Build the code for GOOS=js GOARCH=wasm to run it in the browser (or report why it must run on the server)
+// - GET /api/wasm/exec.js?version=X.XX.X: The wasm_exec.js of that toolchain's GOROOT
+// - POST /api/analyze/version: Minimum Go version required by each construct of the code
+// - POST /api/format: Format the code with the selected version's gofmt (optionally -s)
+// - POST /api/vet: Run the selected version's go vet (optionally -fix) and return structured findings
+// - POST /api/compile/insight: Assembly, inlining / escape analysis and bounds checks per source line, optionally compared between two toolchains
+// - POST /api/build/size: Binary size, section sizes and largest symbols / packages per version, diffed against the first version
+// - POST /api/share: Store a snippet with its pinned toolchain; GET /api/share/{id} returns it
+// - GET /api/trace/{id}: Summary of an execution trace captured with "trace" in /api/run (goroutines, GC, blocking, per-P timeline)
+// - GET /api/profile/{id}: Top functions and flame graph tree of a CPU / heap profile captured with "profile" in /api/run or /api/run/matrix
+// - POST /api/version-info/rescan: Reload config/versions.json and search the toolchain directories again
+// - GET /api/artifacts/{id}: Download a file captured by an execution (trace.out for go tool trace, cpu.pprof / heap.pprof for go tool pprof)
+//
+// Pages:
+// - /s/{id}: Open the tour with a shared snippet and its toolchain preselected
 //
 // Static Assets:
 // - /static/: CSS, JS, images, and other static resources
@@ -26,6 +44,19 @@
 // Environment Variables:
 // - APP_PORT: Server port (default: 8080)
 // - GO_VERSION: Go version for display purposes
+// - SANDBOX_MODE: auto (default), namespace (required) or none (unsandboxed dev)
+// - MAX_OUTPUT_BYTES: cap on stdout+stderr per execution (default: 1MiB)
+// - BUILD_CACHE_DIR / BUILD_CACHE_MAX_BYTES: compiled binary cache location and size
+// - EXEC_WORKERS / EXEC_QUEUE_SIZE / EXEC_QUEUE_PER_CLIENT: concurrent executions and queue limits
+// - TRUSTED_PROXIES: reverse proxies whose X-Forwarded-For identifies the client for queues and rate limits (default: none)
+// - CODE_POLICY_FILE: code policy JSON (default: config/policy.json, built-in policy if missing)
+// - SHARE_DIR: shared snippet store (default: data/shares)
+// - ARTIFACT_DIR / ARTIFACT_TTL: stored execution traces and profiles (default: data/artifacts, 1h)
+// - GO_TOOLCHAIN_DIRS: directories searched for go* GOROOTs besides config/versions.json (default: /opt and $HOME/sdk)
+// - TOOLCHAIN_RESCAN_INTERVAL: periodic toolchain rescan (default: startup, SIGHUP and /api/version-info/rescan only)
+// - TOOLCHAIN_PROVISION / TOOLCHAIN_GOPROXY / TOOLCHAIN_DIR / TOOLCHAIN_SUMS: download missing configured toolchains as golang.org/toolchain modules (default: off)
+// - RUNNER_URLS: runner processes (app/cmd/runner) executing /api/run, /api/run/ws, matrix and benchmark cells (default: in-process)
+// - RUNNER_TOKEN: bearer token shared with the runners
 //
 // Usage:
 //
@@ -49,6 +80,7 @@ import (
 	"go-release-tour/app/internal/lessons"
 	"go-release-tour/app/internal/templates"
 	"go-release-tour/app/internal/types"
+	"go-release-tour/app/internal/version"
 )
 
 // addNoCacheHeaders は開発環境でキャッシュを無効化するミドルウェア
@@ -62,6 +94,12 @@ func addNoCacheHeaders(next http.Handler) http.Handler {
 }
 
 func main() {
+	// サンドボックスinitとして再実行された場合はここで処理を引き継ぐ
+	version.RunSandboxInitIfRequested()
+
+	// SIGHUP（と TOOLCHAIN_RESCAN_INTERVAL）でツールチェーンを再スキャン
+	version.WatchToolchains()
+
 	appServer := &types.Server{
 		Lessons: make(map[string][]types.Lesson),
 	}
@@ -78,7 +116,26 @@ func main() {
 	http.HandleFunc("/api/versions", handlers.HandleVersions(appServer))
 	http.HandleFunc("/api/lessons", handlers.HandleLessons(appServer))
 	http.HandleFunc("/api/run", handlers.HandleRun)
+	http.HandleFunc("/api/run/ws", handlers.HandleRunStream)
+	http.HandleFunc("/api/run/matrix", handlers.HandleRunMatrix)
+	http.HandleFunc("/api/run/bench", handlers.HandleRunBenchmark)
+	http.HandleFunc("/api/run/wasm", handlers.HandleRunWasm)
+	http.HandleFunc("/api/wasm/exec.js", handlers.HandleWasmExec)
+	http.HandleFunc("/api/analyze/version", handlers.HandleAnalyzeVersion)
+	http.HandleFunc("/api/format", handlers.HandleFormat)
+	http.HandleFunc("/api/vet", handlers.HandleVet)
+	http.HandleFunc("/api/compile/insight", handlers.HandleCompilerInsight)
+	http.HandleFunc("/api/build/size", handlers.HandleBinarySize)
+	http.HandleFunc("/api/share", handlers.HandleShare)
+	http.HandleFunc("/api/share/", handlers.HandleShare)
+	http.HandleFunc("/api/artifacts/", handlers.HandleArtifact)
+	http.HandleFunc("/api/trace/", handlers.HandleTraceSummary)
+	http.HandleFunc("/api/profile/", handlers.HandleProfileSummary)
 	http.HandleFunc("/api/version-info", handlers.HandleVersionInfo)
+	http.HandleFunc("/api/version-info/rescan", handlers.HandleRescanVersions)
+
+	// 共有コードのページ
+	http.HandleFunc("/s/", handlers.HandleSharePage)
 
 	// メインページ
 	http.HandleFunc("/", templates.HandleIndex)
@@ -100,7 +157,7 @@ func main() {
 	httpServer := &http.Server{
 		Addr:         ":" + port,
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: 2 * time.Minute, // /api/run は実行待ち＋実行（最大30秒）の完了まで応答を返さない
 		IdleTimeout:  60 * time.Second,
 	}
 	log.Fatal(httpServer.ListenAndServe())
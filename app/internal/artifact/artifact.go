@@ -0,0 +1,193 @@
+// Package artifact - Temporary store of files produced by executions
+//
+// Executions can produce files that are too large to return inline, such as
+// execution traces. They are stored here under a random ID and can be
+// downloaded (or summarized) until they expire. Each artifact is a data file
+// with a JSON metadata file next to it; expired artifacts are removed when
+// new ones are stored.
+//
+// Environment variables:
+// - ARTIFACT_DIR: artifact directory (default: data/artifacts)
+// - ARTIFACT_TTL: how long artifacts are kept (default: 1h)
+package artifact
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultArtifactDir = "data/artifacts"
+	defaultTTL         = time.Hour
+	idBytes            = 8 // 16進数16文字
+)
+
+// ErrNotFound is returned when no (unexpired) artifact exists for an ID
+var ErrNotFound = errors.New("ファイルが見つかりません（有効期限切れの可能性があります）")
+
+// idPattern matches a valid artifact ID
+var idPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Artifact describes a stored file
+type Artifact struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // 例: "trace"
+	Name      string    `json:"name"` // ダウンロード時のファイル名（例: "trace.out"）
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Store keeps artifacts on disk for a limited time
+type Store struct {
+	dir   string
+	ttl   time.Duration
+	mutex sync.Mutex
+}
+
+// NewStore creates a store in dir keeping artifacts for ttl
+func NewStore(dir string, ttl time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("成果物ディレクトリ作成エラー: %w", err)
+	}
+	return &Store{dir: dir, ttl: ttl}, nil
+}
+
+// ValidID reports whether id has the form of an artifact ID
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+func (s *Store) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *Store) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Put stores data and returns its metadata
+func (s *Store) Put(kind, name string, data []byte) (*Artifact, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("ID生成エラー: %w", err)
+	}
+	now := time.Now().UTC()
+	artifact := &Artifact{
+		ID:        hex.EncodeToString(b),
+		Kind:      kind,
+		Name:      name,
+		Size:      int64(len(data)),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	meta, err := json.Marshal(artifact)
+	if err != nil {
+		return nil, fmt.Errorf("成果物のエンコードエラー: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.removeExpired(now)
+
+	// データを先に書き込み、メタデータがあるものだけを有効とする
+	if err := os.WriteFile(s.dataPath(artifact.ID), data, 0o600); err != nil {
+		return nil, fmt.Errorf("成果物の保存エラー: %w", err)
+	}
+	if err := os.WriteFile(s.metaPath(artifact.ID), meta, 0o600); err != nil {
+		os.Remove(s.dataPath(artifact.ID))
+		return nil, fmt.Errorf("成果物の保存エラー: %w", err)
+	}
+	return artifact, nil
+}
+
+// Get loads the metadata and data of an artifact
+func (s *Store) Get(id string) (*Artifact, []byte, error) {
+	if !ValidID(id) {
+		return nil, nil, ErrNotFound
+	}
+	meta, err := os.ReadFile(s.metaPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("成果物の読み込みエラー: %w", err)
+	}
+	var artifact Artifact
+	if err := json.Unmarshal(meta, &artifact); err != nil {
+		return nil, nil, fmt.Errorf("成果物の読み込みエラー: %w", err)
+	}
+	if time.Now().After(artifact.ExpiresAt) {
+		return nil, nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.dataPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("成果物の読み込みエラー: %w", err)
+	}
+	return &artifact, data, nil
+}
+
+// removeExpired deletes artifacts older than the TTL (called with the mutex held)
+func (s *Store) removeExpired(now time.Time) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("[WARN] ArtifactStore: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".bin")
+		if !ok || !ValidID(id) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) <= s.ttl {
+			continue
+		}
+		os.Remove(s.metaPath(id))
+		os.Remove(s.dataPath(id))
+	}
+}
+
+// Global store instance
+var (
+	globalStore     *Store
+	globalStoreErr  error
+	globalStoreOnce sync.Once
+)
+
+// GetStore returns the process-wide artifact store configured by ARTIFACT_DIR and ARTIFACT_TTL
+func GetStore() (*Store, error) {
+	globalStoreOnce.Do(func() {
+		dir := os.Getenv("ARTIFACT_DIR")
+		if dir == "" {
+			dir = defaultArtifactDir
+		}
+		ttl := defaultTTL
+		if value := os.Getenv("ARTIFACT_TTL"); value != "" {
+			if d, err := time.ParseDuration(value); err == nil && d > 0 {
+				ttl = d
+			}
+		}
+		globalStore, globalStoreErr = NewStore(dir, ttl)
+		if globalStoreErr != nil {
+			log.Printf("[WARN] ArtifactStore: disabled: %v", globalStoreErr)
+			return
+		}
+		log.Printf("ArtifactStore: %s (ttl %v)", dir, ttl)
+	})
+	return globalStore, globalStoreErr
+}
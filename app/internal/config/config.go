@@ -15,14 +15,16 @@ import (
 
 // LessonInfo represents metadata about a single lesson
 type LessonInfo struct {
-	Title string `json:"title"`
-	Stars int    `json:"stars"`
+	Title         string `json:"title"`
+	Stars         int    `json:"stars"`
+	ValidatedWith string `json:"validated_with,omitempty"` // 動作を確認したパッチバージョン（省略時は full_version）
 }
 
 // VersionConfig represents configuration for a specific Go version
 type VersionConfig struct {
 	FullVersion string                `json:"full_version"`
 	Path        string                `json:"path"`
+	Patches     map[string]string     `json:"patches,omitempty"` // 追加のパッチバージョン -> go コマンドのパス（空ならダウンロード対象）
 	Lessons     map[string]LessonInfo `json:"lessons"`
 }
 
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-release-tour/app/internal/artifact"
+	"go-release-tour/app/internal/version"
+)
+
+// ArtifactInfo points to a file stored for an execution (an execution trace or a profile)
+type ArtifactInfo struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"` // "trace" / "cpu" / "heap"
+	Size       int64  `json:"size"`
+	Truncated  bool   `json:"truncated,omitempty"`   // サイズ上限により途中までか
+	URL        string `json:"url"`                   // ダウンロード先（例: "/api/artifacts/0123456789abcdef"）
+	SummaryURL string `json:"summary_url,omitempty"` // 要約の取得先（/api/trace/{id} または /api/profile/{id}）
+}
+
+// TraceSummaryResponse is the response of GET /api/trace/{id}
+type TraceSummaryResponse struct {
+	*version.TraceSummary
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// ProfileSummaryResponse is the response of GET /api/profile/{id}
+type ProfileSummaryResponse struct {
+	*version.ProfileSummary
+	ID    string `json:"id"`
+	Kind  string `json:"kind,omitempty"` // "cpu" / "heap"
+	Error string `json:"error,omitempty"`
+}
+
+// captureFileNames are the download names of each capture kind
+var captureFileNames = map[string]string{
+	version.CaptureTrace: "trace.out",
+	version.ProfileCPU:   "cpu.pprof",
+	version.ProfileHeap:  "heap.pprof",
+}
+
+// storeCaptures stores the files an execution captured and returns where to get them
+func storeCaptures(captures []version.Capture) []ArtifactInfo {
+	if len(captures) == 0 {
+		return nil
+	}
+	store, err := artifact.GetStore()
+	if err != nil {
+		return nil
+	}
+
+	infos := make([]ArtifactInfo, 0, len(captures))
+	for _, capture := range captures {
+		name := captureFileNames[capture.Kind]
+		if name == "" {
+			name = capture.Kind
+		}
+		stored, err := store.Put(capture.Kind, name, capture.Data)
+		if err != nil {
+			log.Printf("[WARN] storeCaptures: %v", err)
+			continue
+		}
+		info := ArtifactInfo{
+			ID:        stored.ID,
+			Kind:      stored.Kind,
+			Size:      stored.Size,
+			Truncated: capture.Truncated,
+			URL:       "/api/artifacts/" + stored.ID,
+		}
+		switch capture.Kind {
+		case version.CaptureTrace:
+			info.SummaryURL = "/api/trace/" + stored.ID
+		case version.ProfileCPU, version.ProfileHeap:
+			info.SummaryURL = "/api/profile/" + stored.ID
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// HandleArtifact downloads a stored artifact (GET /api/artifacts/{id})
+func HandleArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stored, data, status, err := loadArtifact(strings.TrimPrefix(r.URL.Path, "/api/artifacts/"))
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	contentType := "application/octet-stream"
+	if stored.Kind == version.CaptureWasm {
+		contentType = "application/wasm" // WebAssembly.instantiateStreaming に必要
+	}
+	w.Header().Set("Content-Type", contentType)
+	if stored.Kind != version.CaptureWasm {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", stored.Name))
+	}
+	http.ServeContent(w, r, stored.Name, stored.CreatedAt, bytes.NewReader(data))
+}
+
+// HandleTraceSummary returns the summary of a stored execution trace (GET /api/trace/{id})
+func HandleTraceSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/trace/")
+	writeError := func(status int, message string) {
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(TraceSummaryResponse{ID: id, Error: message}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+	}
+
+	stored, data, status, err := loadArtifact(id)
+	if err != nil {
+		writeError(status, err.Error())
+		return
+	}
+	if stored.Kind != version.CaptureTrace {
+		writeError(http.StatusBadRequest, "実行トレースではありません")
+		return
+	}
+
+	summary, err := version.SummarizeTrace(data)
+	if err != nil {
+		log.Printf("[DEBUG] HandleTraceSummary: %v", err)
+		writeError(http.StatusUnprocessableEntity, fmt.Sprintf("トレースの解析エラー: %v", err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(TraceSummaryResponse{TraceSummary: summary, ID: id}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// HandleProfileSummary returns the top functions and flame graph of a stored profile
+// (GET /api/profile/{id}?sample_type=alloc_space&top=20)
+func HandleProfileSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/profile/")
+	writeError := func(status int, message string) {
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(ProfileSummaryResponse{ID: id, Error: message}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+	}
+
+	stored, data, status, err := loadArtifact(id)
+	if err != nil {
+		writeError(status, err.Error())
+		return
+	}
+	if stored.Kind != version.ProfileCPU && stored.Kind != version.ProfileHeap {
+		writeError(http.StatusBadRequest, "プロファイルではありません")
+		return
+	}
+
+	top, _ := strconv.Atoi(r.URL.Query().Get("top"))
+	summary, err := version.SummarizeProfile(data, r.URL.Query().Get("sample_type"), top)
+	if err != nil {
+		log.Printf("[DEBUG] HandleProfileSummary: %v", err)
+		writeError(http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := json.NewEncoder(w).Encode(ProfileSummaryResponse{ProfileSummary: summary, ID: id, Kind: stored.Kind}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// loadArtifact reads an artifact, returning the HTTP status to use on error
+func loadArtifact(id string) (*artifact.Artifact, []byte, int, error) {
+	store, err := artifact.GetStore()
+	if err != nil {
+		return nil, nil, http.StatusServiceUnavailable, err
+	}
+	stored, data, err := store.Get(id)
+	if errors.Is(err, artifact.ErrNotFound) {
+		return nil, nil, http.StatusNotFound, err
+	}
+	if err != nil {
+		log.Printf("[WARN] loadArtifact: %v", err)
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	return stored, data, http.StatusOK, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go-release-tour/app/internal/version"
+)
+
+// BenchmarkRunRequest compares the code's Benchmark* functions across versions and env presets
+type BenchmarkRunRequest struct {
+	CodeRunRequest
+	Versions   []string            `json:"versions"` // 例: ["1.21", "1.22"]
+	EnvPresets []version.EnvPreset `json:"env_presets,omitempty"`
+	Bench      string              `json:"bench,omitempty"`     // -bench 正規表現（デフォルト "."）
+	Benchtime  string              `json:"benchtime,omitempty"` // -benchtime（デフォルト "100ms"）
+	Count      int                 `json:"count,omitempty"`     // 構成ごとの実行回数（デフォルト 6）
+}
+
+// BenchmarkRunResponse is the response of /api/run/bench
+type BenchmarkRunResponse struct {
+	*version.BenchmarkComparison
+	Error string `json:"error,omitempty"`
+}
+
+// HandleRunBenchmark runs benchmarks on several Go versions and returns benchstat-style statistics
+func HandleRunBenchmark(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BenchmarkRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleRunBenchmark: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleRunBenchmark: Versions=%v, presets=%d, count=%d", req.Versions, len(req.EnvPresets), req.Count)
+
+	// 各実行は通常の実行と同じスケジューラで実行枠を確保する
+	client := clientKey(r)
+	acquire := func(ctx context.Context) (func(), error) {
+		release, _, err := version.GetScheduler().Acquire(ctx, client, nil)
+		return release, err
+	}
+
+	execReq := newExecutionRequest(req.CodeRunRequest)
+	execReq.Timeout = 0 // 比較全体の上限から決める1回ごとのタイムアウトを使用
+
+	executor := version.NewExecutor()
+	comparison, err := executor.ExecuteBenchmarkComparison(r.Context(), version.BenchmarkRequest{
+		ExecutionRequest: execReq,
+		Versions:         req.Versions,
+		EnvPresets:       req.EnvPresets,
+		Bench:            req.Bench,
+		Benchtime:        req.Benchtime,
+		Count:            req.Count,
+	}, acquire)
+	if err != nil {
+		log.Printf("[DEBUG] HandleRunBenchmark: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(BenchmarkRunResponse{Error: err.Error()}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(BenchmarkRunResponse{BenchmarkComparison: comparison}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
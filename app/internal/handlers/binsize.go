@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go-release-tour/app/internal/version"
+)
+
+// SizeRunRequest compares the binary size of the code across versions
+type SizeRunRequest struct {
+	CodeRunRequest
+	Versions []string `json:"versions"`      // 例: ["1.21", "1.25"]（先頭が比較基準）
+	Top      int      `json:"top,omitempty"` // シンボル・パッケージの表示件数（デフォルト 20）
+}
+
+// SizeRunResponse is the response of /api/build/size
+type SizeRunResponse struct {
+	*version.SizeComparison
+	Error string `json:"error,omitempty"`
+}
+
+// HandleBinarySize builds the code with several Go versions and returns size breakdowns and their diffs
+func HandleBinarySize(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SizeRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleBinarySize: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleBinarySize: Versions=%v, top=%d", req.Versions, req.Top)
+
+	// 各ビルドは通常の実行と同じスケジューラで実行枠を確保する
+	client := clientKey(r)
+	acquire := func(ctx context.Context) (func(), error) {
+		release, _, err := version.GetScheduler().Acquire(ctx, client, nil)
+		return release, err
+	}
+
+	executor := version.NewExecutor()
+	comparison, err := executor.CompareBinarySizes(r.Context(), version.SizeRequest{
+		ExecutionRequest: newExecutionRequest(req.CodeRunRequest),
+		Versions:         req.Versions,
+		Top:              req.Top,
+	}, acquire)
+	if err != nil {
+		log.Printf("[DEBUG] HandleBinarySize: %v", err)
+		writeToolError(w, SizeRunResponse{Error: err.Error()})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(SizeRunResponse{SizeComparison: comparison}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
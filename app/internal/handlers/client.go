@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Client identification for fair scheduling and rate limits
+//
+// Behind a reverse proxy every request comes from the proxy's address, so all
+// users would share one queue slot and one share limit. TRUSTED_PROXIES lists
+// the proxies whose X-Forwarded-For header is believed:
+//
+// - TRUSTED_PROXIES: comma separated IP addresses or CIDR ranges of reverse proxies (default: none, the connection's address is used)
+//
+// The header is read from the right, skipping trusted proxies; the first
+// address not in the list is the client. Entries left of it can be forged by
+// the client and are ignored.
+
+var (
+	trustedProxiesOnce  sync.Once
+	trustedProxiesValue []netip.Prefix
+)
+
+// trustedProxies returns the ranges from TRUSTED_PROXIES
+func trustedProxies() []netip.Prefix {
+	trustedProxiesOnce.Do(func() {
+		trustedProxiesValue = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	})
+	return trustedProxiesValue
+}
+
+// parseTrustedProxies parses a comma separated list of addresses and CIDR ranges, skipping invalid entries
+func parseTrustedProxies(value string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		log.Printf("[WARN] TRUSTED_PROXIES: 不正なアドレスを無視します: %q", entry)
+	}
+	return prefixes
+}
+
+// clientKey identifies the client for fair scheduling
+func clientKey(r *http.Request) string {
+	return forwardedClient(r, trustedProxies())
+}
+
+// forwardedClient returns the client address, following X-Forwarded-For through trusted proxies
+func forwardedClient(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	client, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(client, trusted) {
+		return host
+	}
+
+	// 右端が直前のプロキシが追加したアドレス（複数のヘッダー行は順に連結されたものとして扱う）
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseForwardedAddr(hops[i])
+		if !ok {
+			break // 解釈できない値は信頼済みのプロキシが追加したものではない
+		}
+		client = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// parseForwardedAddr parses an X-Forwarded-For entry, which some proxies write with a port
+func parseForwardedAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedClient(t *testing.T) {
+	trusted := parseTrustedProxies("10.0.0.0/8, 192.0.2.1, ::1, invalid")
+	if len(trusted) != 3 {
+		t.Fatalf("trusted = %v, want 3 entries", trusted)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{name: "direct client", remote: "198.51.100.7:5000", want: "198.51.100.7"},
+		{name: "untrusted peer header ignored", remote: "198.51.100.7:5000", forwarded: []string{"203.0.113.9"}, want: "198.51.100.7"},
+		{name: "trusted proxy", remote: "10.1.2.3:5000", forwarded: []string{"203.0.113.9"}, want: "203.0.113.9"},
+		{name: "trusted proxy without header", remote: "192.0.2.1:5000", want: "192.0.2.1"},
+		{name: "forged entries left of the client", remote: "10.1.2.3:5000", forwarded: []string{"1.1.1.1, 203.0.113.9"}, want: "203.0.113.9"},
+		{name: "chain of proxies", remote: "10.1.2.3:5000", forwarded: []string{"203.0.113.9, 192.0.2.1", "10.9.9.9"}, want: "203.0.113.9"},
+		{name: "all hops trusted", remote: "10.1.2.3:5000", forwarded: []string{"10.5.5.5"}, want: "10.5.5.5"},
+		{name: "entry with port", remote: "10.1.2.3:5000", forwarded: []string{"203.0.113.9:443"}, want: "203.0.113.9"},
+		{name: "IPv6 client", remote: "[::1]:5000", forwarded: []string{"2001:db8::1"}, want: "2001:db8::1"},
+		{name: "IPv4-mapped proxy", remote: "[::ffff:10.1.2.3]:5000", forwarded: []string{"203.0.113.9"}, want: "203.0.113.9"},
+		{name: "unparsable entry", remote: "10.1.2.3:5000", forwarded: []string{"203.0.113.9, unknown"}, want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/run", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := forwardedClient(r, trusted); got != tt.want {
+				t.Errorf("forwardedClient = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
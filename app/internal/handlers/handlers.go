@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"go-release-tour/app/internal/types"
@@ -52,20 +56,68 @@ func HandleLessons(s *types.Server) http.HandlerFunc {
 
 // CodeRunRequest represents a code execution request with version support
 type CodeRunRequest struct {
-	Code    string `json:"code"`
-	Version string `json:"version"`  // 実行するGoバージョン（フロントエンドで決定済み）
-	EnvVars string `json:"env_vars"` // 環境変数（例: "GOEXPERIMENT=jsonv2"）
+	Code     string               `json:"code"`
+	Version  string               `json:"version"`             // 実行するGoバージョン（"auto" ならコードが必要とする最小バージョン以上で最も古いもの）
+	EnvVars  string               `json:"env_vars"`            // 環境変数（例: "GOEXPERIMENT=jsonv2"）
+	Files    map[string]string    `json:"files,omitempty"`     // 複数ファイル（相対パス -> 内容）
+	Package  string               `json:"package,omitempty"`   // 実行するパッケージ（例: "./cmd/app"）
+	Mode     string               `json:"mode,omitempty"`      // "run"（デフォルト）/ "test"
+	Test     *version.TestOptions `json:"test,omitempty"`      // テストモードのオプション（-run, -bench など）
+	FakeTime bool                 `json:"fake_time,omitempty"` // 仮想時間で実行（time.Sleep が即座に進み、出力は仮想時刻付きで返す）
+	Trace    string               `json:"trace,omitempty"`     // 実行トレースの取得: "trace"（全体）/ "flight"（フライトレコーダー。Go 1.25以降）
+	Profile  []string             `json:"profile,omitempty"`   // 取得するプロファイル: "cpu" / "heap"
 }
 
 // CodeRunResponse represents a code execution response with version info
 type CodeRunResponse struct {
-	Output          string `json:"output"`
-	Error           string `json:"error,omitempty"`
-	GoVersion       string `json:"go_version,omitempty"`       // 使用されたGoの完全バージョン
-	UsedVersion     string `json:"used_version,omitempty"`     // 使用されたGoバージョン（例: 1.18）
-	DetectedVersion string `json:"detected_version,omitempty"` // 検出されたバージョン
-	ExecutionTime   string `json:"execution_time,omitempty"`   // 実行時間
-	VersionPath     string `json:"version_path,omitempty"`     // 使用されたGoバイナリのパス
+	Output          string                    `json:"output"`
+	Stdout          string                    `json:"stdout"`
+	Stderr          string                    `json:"stderr"`
+	Events          []version.OutputEvent     `json:"events,omitempty"`    // 出力順を保持したstdout/stderrのチャンク
+	Truncated       bool                      `json:"truncated,omitempty"` // 出力上限により切り詰められたか
+	Error           string                    `json:"error,omitempty"`
+	GoVersion       string                    `json:"go_version,omitempty"`       // 使用されたGoの完全バージョン
+	UsedVersion     string                    `json:"used_version,omitempty"`     // 使用されたGoバージョン（例: 1.18）
+	DetectedVersion string                    `json:"detected_version,omitempty"` // 検出されたバージョン
+	ExecutionTime   string                    `json:"execution_time,omitempty"`   // 実行時間
+	VersionPath     string                    `json:"version_path,omitempty"`     // 使用されたGoバイナリのパス
+	Sandbox         string                    `json:"sandbox,omitempty"`          // 使用されたサンドボックス
+	Status          string                    `json:"status,omitempty"`           // success / error / timeout / canceled
+	ExitCode        int                       `json:"exit_code"`                  // 終了コード
+	CacheHit        bool                      `json:"cache_hit"`                  // ビルドキャッシュを利用したか
+	CompileTime     string                    `json:"compile_time,omitempty"`     // コンパイル時間
+	RunTime         string                    `json:"run_time,omitempty"`         // 実行時間
+	QueuePosition   int                       `json:"queue_position,omitempty"`   // 実行待ちキューでの順番（待ちなしは省略）
+	QueueWait       string                    `json:"queue_wait,omitempty"`       // 実行待ち時間
+	Test            *version.TestReport       `json:"test,omitempty"`             // テストモードの結果（テスト・ベンチマーク別）
+	Violations      []version.PolicyViolation `json:"violations,omitempty"`       // コードポリシー違反（ファイル・行・列付き）
+	VersionAnalysis *version.VersionAnalysis  `json:"version_analysis,omitempty"` // "auto" 指定時の最小バージョン解析結果
+	BuildOutput     string                    `json:"build_output,omitempty"`     // ビルド（go build / go test -c）の出力
+	Diagnostics     []version.Diagnostic      `json:"diagnostics,omitempty"`      // ビルドエラーの位置付きメッセージ
+	TimedEvents     []version.TimedEvent      `json:"timed_events,omitempty"`     // 仮想時間モードの出力（offset は開始からの仮想時間のナノ秒）
+	VirtualTime     string                    `json:"virtual_time,omitempty"`     // 仮想時間モードで経過した仮想時間
+	Artifacts       []ArtifactInfo            `json:"artifacts,omitempty"`        // 実行トレース・プロファイルのダウンロード先
+}
+
+// maxQueueWait bounds how long a non-streaming request waits for an execution slot
+const maxQueueWait = 60 * time.Second
+
+// newExecutionRequest converts an API request into an executor request
+func newExecutionRequest(req CodeRunRequest) version.ExecutionRequest {
+	return version.ExecutionRequest{
+		Code:       req.Code,
+		Version:    req.Version,
+		AutoDetect: false, // フロントエンドで決定済みなので自動検出不要
+		Timeout:    30 * time.Second,
+		EnvVars:    req.EnvVars, // 環境変数を追加
+		Files:      req.Files,
+		Package:    req.Package,
+		Mode:       req.Mode,
+		Test:       req.Test,
+		FakeTime:   req.FakeTime,
+		Trace:      req.Trace,
+		Profile:    req.Profile,
+	}
 }
 
 // HandleRun executes Go code with appropriate version and returns the result
@@ -80,7 +132,7 @@ func HandleRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("[DEBUG] HandleRun: Received request - Version=%q", req.Version)
-	log.Printf("[DEBUG] HandleRun: Code length=%d characters", len(req.Code))
+	log.Printf("[DEBUG] HandleRun: Code length=%d characters, files=%d", len(req.Code), len(req.Files))
 
 	if req.Version == "" {
 		log.Printf("[DEBUG] HandleRun: No version specified")
@@ -97,22 +149,31 @@ func HandleRun(w http.ResponseWriter, r *http.Request) {
 	executor := version.NewExecutor()
 
 	// 実行リクエストを構築
-	execReq := version.ExecutionRequest{
-		Code:       req.Code,
-		Version:    req.Version,
-		AutoDetect: false, // フロントエンドで決定済みなので自動検出不要
-		Timeout:    30 * time.Second,
-		EnvVars:    req.EnvVars, // 環境変数を追加
+	execReq := newExecutionRequest(req)
+
+	// "auto" はコードを解析してバージョンを選択
+	analysis, err := resolveAutoVersion(executor, &req, &execReq)
+	if err != nil {
+		log.Printf("[DEBUG] HandleRun: Version selection failed: %v", err)
+		response := CodeRunResponse{
+			Error:           fmt.Sprintf("バージョン選択エラー: %v", err),
+			VersionAnalysis: analysis,
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+		return
 	}
 
 	log.Printf("[DEBUG] HandleRun: Using version: %s", req.Version)
 
 	// コード検証
 	log.Printf("[DEBUG] HandleRun: Validating code for version %s", req.Version)
-	if err := executor.ValidateCode(req.Code, req.Version); err != nil {
+	if err := executor.ValidateRequest(execReq); err != nil {
 		log.Printf("[DEBUG] HandleRun: Code validation failed: %v", err)
 		response := CodeRunResponse{
-			Error: fmt.Sprintf("コード検証エラー: %v", err),
+			Error:      fmt.Sprintf("コード検証エラー: %v", err),
+			Violations: policyViolations(err),
 		}
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			log.Printf("Failed to encode response: %v", err)
@@ -121,21 +182,26 @@ func HandleRun(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("[DEBUG] HandleRun: Code validation passed")
 
-	// コードを実行
+	// 実行スロットを確保（満杯なら429で再試行を促す）
+	waitCtx, cancelWait := context.WithTimeoutCause(r.Context(), maxQueueWait, &version.QueueFullError{RetryAfter: maxQueueWait / 2})
+	release, slot, err := version.GetScheduler().Acquire(waitCtx, clientKey(r), nil)
+	cancelWait()
+	if err != nil {
+		writeSchedulerError(w, err)
+		return
+	}
+	defer release()
+
+	// コードを実行（クライアント切断時はr.Context()がキャンセルされ、プロセスグループごと停止）
 	log.Printf("[DEBUG] HandleRun: Starting code execution")
-	result, err := executor.Execute(execReq)
+	result, err := executor.Runner().Execute(r.Context(), execReq)
 	log.Printf("[DEBUG] HandleRun: Execution completed - err=%v, result.Error=%q", err, result.Error)
 	log.Printf("[DEBUG] HandleRun: Execution result - GoVersion=%q, UsedVersion=%q", result.GoVersion, result.UsedVersion)
 
 	// レスポンスを構築
-	response := CodeRunResponse{
-		Output:          result.Output,
-		GoVersion:       result.GoVersion,
-		UsedVersion:     result.UsedVersion,
-		DetectedVersion: req.Version, // フロントエンドで決定されたバージョンをそのまま返す
-		ExecutionTime:   result.ExecutionTime.String(),
-		VersionPath:     result.VersionPath,
-	}
+	response := newCodeRunResponse(req, result)
+	setQueueInfo(&response, slot)
+	response.VersionAnalysis = analysis
 
 	if err != nil || result.Error != "" {
 		errorMsg := ""
@@ -161,14 +227,178 @@ func HandleRun(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// newCodeRunResponse converts an execution result into an API response
+func newCodeRunResponse(req CodeRunRequest, result *version.ExecutionResult) CodeRunResponse {
+	return CodeRunResponse{
+		Output:          result.Output,
+		Stdout:          result.Stdout,
+		Stderr:          result.Stderr,
+		Events:          result.Events,
+		Truncated:       result.Truncated,
+		GoVersion:       result.GoVersion,
+		UsedVersion:     result.UsedVersion,
+		DetectedVersion: req.Version, // フロントエンドで決定されたバージョンをそのまま返す
+		ExecutionTime:   result.ExecutionTime.String(),
+		VersionPath:     result.VersionPath,
+		Sandbox:         result.Sandbox,
+		Status:          result.Status,
+		ExitCode:        result.ExitCode,
+		CacheHit:        result.CacheHit,
+		CompileTime:     result.CompileTime.String(),
+		RunTime:         result.RunTime.String(),
+		Test:            result.Test,
+		Violations:      result.Violations,
+		BuildOutput:     result.BuildOutput,
+		Diagnostics:     result.Diagnostics,
+		TimedEvents:     result.TimedEvents,
+		VirtualTime:     virtualTime(result),
+		Artifacts:       storeCaptures(result.Captures),
+	}
+}
+
+// virtualTime formats the virtual time elapsed in a faketime execution
+func virtualTime(result *version.ExecutionResult) string {
+	if result.TimedEvents == nil {
+		return ""
+	}
+	return result.VirtualTime.String()
+}
+
+// resolveAutoVersion replaces the "auto" version with the oldest installed version able to run the code
+func resolveAutoVersion(executor *version.Executor, req *CodeRunRequest, execReq *version.ExecutionRequest) (*version.VersionAnalysis, error) {
+	if req.Version != version.VersionAuto {
+		return nil, nil
+	}
+	analysis, err := executor.SelectVersion(*execReq)
+	if err != nil {
+		return analysis, err
+	}
+	req.Version = analysis.Selected
+	execReq.Version = analysis.Selected
+	return analysis, nil
+}
+
+// HandleAnalyzeVersion reports the minimum Go version each construct of the code needs
+func HandleAnalyzeVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CodeRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleAnalyzeVersion: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	executor := version.NewExecutor()
+	analysis, err := executor.SelectVersion(newExecutionRequest(req))
+	if analysis == nil {
+		log.Printf("[DEBUG] HandleAnalyzeVersion: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+	// 対応するバージョンがインストールされていなくても解析結果は返す（selected は空）
+	if err := json.NewEncoder(w).Encode(analysis); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// policyViolations returns the positioned violations of a validation error, if any
+func policyViolations(err error) []version.PolicyViolation {
+	var policyErr *version.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Violations
+	}
+	return nil
+}
+
 // HandleVersionInfo returns detailed version information
 func HandleVersionInfo(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	manager := version.GetManager()
 	versionInfo := manager.Status()
+	versionInfo["provisioning"] = manager.ProvisionStatus()
+
+	sandbox := version.GetSandbox()
+	versionInfo["sandbox"] = map[string]interface{}{
+		"name":     sandbox.Name(),
+		"isolated": sandbox.Isolated(),
+	}
+	if cache := version.GetBuildCache(); cache != nil {
+		versionInfo["build_cache"] = cache.Stats()
+	}
+	versionInfo["scheduler"] = version.GetScheduler().Stats()
+	if remote := version.GetRemoteRunner(); remote != nil {
+		versionInfo["runners"] = remote.Status()
+	}
 
 	if err := json.NewEncoder(w).Encode(versionInfo); err != nil {
 		log.Printf("Failed to encode version info: %v", err)
 	}
 }
+
+// minRescanInterval limits how often POST /api/version-info/rescan runs the go commands
+const minRescanInterval = 5 * time.Second
+
+// HandleRescanVersions rescans the configured and discovered toolchains (POST /api/version-info/rescan)
+func HandleRescanVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manager := version.GetManager()
+	if last := manager.LastScan(); last != nil && time.Since(last.Time) < minRescanInterval {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil((minRescanInterval - time.Since(last.Time)).Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		if err := json.NewEncoder(w).Encode(last); err != nil {
+			log.Printf("Failed to encode scan result: %v", err)
+		}
+		return
+	}
+
+	result := manager.Rescan()
+	log.Printf("[DEBUG] HandleRescanVersions: added=%v removed=%v changed=%v", result.Added, result.Removed, result.Changed)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Failed to encode scan result: %v", err)
+	}
+}
+
+// writeSchedulerError reports a failure to obtain an execution slot
+func writeSchedulerError(w http.ResponseWriter, err error) {
+	var queueFull *version.QueueFullError
+	if !errors.As(err, &queueFull) {
+		// クライアント切断などで待機が中断された
+		log.Printf("[DEBUG] HandleRun: Waiting for execution slot aborted: %v", err)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleRun: Rejected - %v", err)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(queueFull.RetryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	response := CodeRunResponse{
+		Error:  fmt.Sprintf("%v。しばらくしてから再実行してください", err),
+		Status: "rejected",
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// setQueueInfo copies scheduler wait information into a response
+func setQueueInfo(response *CodeRunResponse, slot version.SlotInfo) {
+	if slot.QueuePosition > 0 {
+		response.QueuePosition = slot.QueuePosition
+		response.QueueWait = slot.Waited.String()
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go-release-tour/app/internal/version"
+)
+
+// InsightRunRequest asks what the compiler does with the code
+type InsightRunRequest struct {
+	CodeRunRequest
+	CompareVersion string `json:"compare_version,omitempty"` // 比較するもう一方のGoバージョン（例: "1.21"）
+	Function       string `json:"function,omitempty"`        // 対象の関数（例: "sum"。省略時は全関数）
+}
+
+// InsightRunResponse is the response of /api/compile/insight
+type InsightRunResponse struct {
+	*version.InsightComparison
+	Error      string                    `json:"error,omitempty"`
+	Violations []version.PolicyViolation `json:"violations,omitempty"`
+}
+
+// HandleCompilerInsight returns assembly, inlining / escape analysis decisions and bounds checks per source line
+func HandleCompilerInsight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req InsightRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleCompilerInsight: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleCompilerInsight: Version=%q, compare=%q, function=%q", req.Version, req.CompareVersion, req.Function)
+
+	if req.Version == "" {
+		writeToolError(w, InsightRunResponse{Error: "バージョンが指定されていません"})
+		return
+	}
+
+	executor := version.NewExecutor()
+	execReq := newExecutionRequest(req.CodeRunRequest)
+	if _, err := resolveAutoVersion(executor, &req.CodeRunRequest, &execReq); err != nil {
+		writeToolError(w, InsightRunResponse{Error: fmt.Sprintf("バージョン選択エラー: %v", err)})
+		return
+	}
+
+	// ビルドはホスト上で行うため、実行と同じポリシーを適用する
+	if err := executor.ValidateRequest(execReq); err != nil {
+		log.Printf("[DEBUG] HandleCompilerInsight: Code validation failed: %v", err)
+		writeToolError(w, InsightRunResponse{
+			Error:      fmt.Sprintf("コード検証エラー: %v", err),
+			Violations: policyViolations(err),
+		})
+		return
+	}
+
+	// 実行スロットを確保（満杯なら429で再試行を促す）
+	waitCtx, cancelWait := context.WithTimeoutCause(r.Context(), maxQueueWait, &version.QueueFullError{RetryAfter: maxQueueWait / 2})
+	release, _, err := version.GetScheduler().Acquire(waitCtx, clientKey(r), nil)
+	cancelWait()
+	if err != nil {
+		writeSchedulerError(w, err)
+		return
+	}
+	defer release()
+
+	insight, err := executor.CompilerInsight(r.Context(), version.InsightRequest{
+		ExecutionRequest: execReq,
+		CompareVersion:   req.CompareVersion,
+		Function:         req.Function,
+	})
+	if err != nil {
+		log.Printf("[DEBUG] HandleCompilerInsight: %v", err)
+		writeToolError(w, InsightRunResponse{Error: err.Error(), Violations: policyViolations(err)})
+		return
+	}
+
+	response := InsightRunResponse{InsightComparison: insight}
+	if len(insight.Base.Diagnostics) > 0 {
+		response.Error = fmt.Sprintf("ビルドエラー: %s", insight.Base.Diagnostics[0])
+	} else if insight.Compare != nil && len(insight.Compare.Diagnostics) > 0 {
+		response.Error = fmt.Sprintf("ビルドエラー（Go %s）: %s", insight.Compare.UsedVersion, insight.Compare.Diagnostics[0])
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go-release-tour/app/internal/version"
+)
+
+// MatrixRunRequest runs the same code on several versions and env presets
+type MatrixRunRequest struct {
+	CodeRunRequest
+	Versions   []string            `json:"versions"`              // 例: ["1.21", "1.22"]
+	EnvPresets []version.EnvPreset `json:"env_presets,omitempty"` // 例: [{"name":"off"},{"name":"on","env_vars":"GOEXPERIMENT=loopvar"}]
+}
+
+// MatrixCellResponse is the result of one version x preset combination
+type MatrixCellResponse struct {
+	Version        string             `json:"version"`
+	Preset         string             `json:"preset"`
+	EnvVars        string             `json:"env_vars,omitempty"`
+	Result         CodeRunResponse    `json:"result"`
+	Group          int                `json:"group"` // 正規化後の出力が同じセルは同じ番号
+	SameAsBaseline bool               `json:"same_as_baseline"`
+	Diff           []version.DiffLine `json:"diff,omitempty"` // ベースライン（最初のセル）との差分
+}
+
+// MatrixRunResponse is the response of /api/run/matrix
+type MatrixRunResponse struct {
+	Cells     []MatrixCellResponse `json:"cells,omitempty"`
+	Baseline  string               `json:"baseline,omitempty"`
+	Groups    int                  `json:"groups,omitempty"`
+	Identical bool                 `json:"identical"`
+	Error     string               `json:"error,omitempty"`
+}
+
+// HandleRunMatrix executes code on several Go versions and returns outputs with diffs
+func HandleRunMatrix(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MatrixRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleRunMatrix: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleRunMatrix: Versions=%v, presets=%d", req.Versions, len(req.EnvPresets))
+
+	execReq := newExecutionRequest(req.CodeRunRequest)
+	execReq.Timeout = 0 // マトリクスのデフォルト（セルごと）を使用
+
+	// 各セルは通常の実行と同じスケジューラで実行枠を確保する
+	client := clientKey(r)
+	acquire := func(ctx context.Context) (func(), error) {
+		release, _, err := version.GetScheduler().Acquire(ctx, client, nil)
+		return release, err
+	}
+
+	executor := version.NewExecutor()
+	matrix, err := executor.ExecuteMatrix(r.Context(), version.MatrixRequest{
+		ExecutionRequest: execReq,
+		Versions:         req.Versions,
+		EnvPresets:       req.EnvPresets,
+	}, acquire)
+	if err != nil {
+		log.Printf("[DEBUG] HandleRunMatrix: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(MatrixRunResponse{Error: err.Error()}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	response := MatrixRunResponse{
+		Cells:     make([]MatrixCellResponse, 0, len(matrix.Cells)),
+		Baseline:  matrix.Baseline,
+		Groups:    matrix.Groups,
+		Identical: matrix.Identical,
+	}
+	for _, cell := range matrix.Cells {
+		result := newCodeRunResponse(CodeRunRequest{Version: cell.Version}, cell.Result)
+		result.Error = cell.Result.Error
+		response.Cells = append(response.Cells, MatrixCellResponse{
+			Version:        cell.Version,
+			Preset:         cell.Preset,
+			EnvVars:        cell.EnvVars,
+			Result:         result,
+			Group:          cell.Group,
+			SameAsBaseline: cell.SameAsBaseline,
+			Diff:           cell.Diff,
+		})
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
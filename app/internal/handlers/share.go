@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-release-tour/app/internal/share"
+	"go-release-tour/app/internal/templates"
+	"go-release-tour/app/internal/version"
+)
+
+// ShareResponse is the response of POST /api/share
+type ShareResponse struct {
+	ID        string `json:"id,omitempty"`
+	URL       string `json:"url,omitempty"`        // 例: "/s/0123456789abcdef"
+	Version   string `json:"version,omitempty"`    // 固定されたGoバージョン（"auto" は解決済み）
+	GoVersion string `json:"go_version,omitempty"` // 固定されたツールチェーンの完全バージョン
+	Error     string `json:"error,omitempty"`
+}
+
+// SharedSnippetResponse is the response of GET /api/share/{id}
+type SharedSnippetResponse struct {
+	*share.Snippet
+	ID                 string    `json:"id"`
+	CreatedAt          time.Time `json:"created_at"`
+	InstalledGoVersion string    `json:"installed_go_version,omitempty"` // 開くと使われるツールチェーンの完全バージョン（共有時のパッチがあればそれ）
+	ToolchainChanged   bool      `json:"toolchain_changed,omitempty"`    // 共有時とツールチェーンが異なるか
+	Error              string    `json:"error,omitempty"`
+}
+
+// sharePageURL returns the permalink of a snippet
+func sharePageURL(id string) string {
+	return "/s/" + id
+}
+
+// HandleShare stores a snippet (POST /api/share) or returns a stored one (GET /api/share/{id})
+func HandleShare(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	store, err := share.GetStore()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(ShareResponse{Error: err.Error()}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/share"), "/")
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		createShare(w, r, store)
+	case r.Method == http.MethodGet && id != "":
+		getShare(w, store, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createShare pins the snippet's toolchain and stores it
+func createShare(w http.ResponseWriter, r *http.Request, store *share.Store) {
+	writeError := func(status int, message string) {
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(ShareResponse{Error: message}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+	}
+
+	if err := store.Allow(clientKey(r)); err != nil {
+		var rateLimit *share.RateLimitError
+		if errors.As(err, &rateLimit) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateLimit.RetryAfter.Seconds()))))
+		}
+		log.Printf("[DEBUG] HandleShare: Rejected %s - %v", clientKey(r), err)
+		writeError(http.StatusTooManyRequests, fmt.Sprintf("%v。しばらくしてから再度共有してください", err))
+		return
+	}
+
+	var snippet share.Snippet
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, share.MaxSnippetBytes)).Decode(&snippet); err != nil {
+		log.Printf("[DEBUG] HandleShare: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleShare: Version=%q, files=%d", snippet.Version, len(snippet.Files))
+
+	if strings.TrimSpace(snippet.Code) == "" && len(snippet.Files) == 0 {
+		writeError(http.StatusBadRequest, "空のコードは共有できません")
+		return
+	}
+	if snippet.Version == "" {
+		writeError(http.StatusBadRequest, "バージョンが指定されていません")
+		return
+	}
+
+	// "auto" は共有時に解決し、開いた人が同じツールチェーンで実行できるようにする
+	executor := version.NewExecutor()
+	if snippet.Version == version.VersionAuto {
+		analysis, err := executor.SelectVersion(snippet.Request())
+		if err != nil {
+			writeError(http.StatusBadRequest, fmt.Sprintf("バージョン選択エラー: %v", err))
+			return
+		}
+		snippet.Version = analysis.Selected
+	}
+	config, err := version.GetManager().GetVersionConfig(snippet.Version)
+	if err != nil {
+		writeError(http.StatusBadRequest, fmt.Sprintf("バージョン設定エラー: %v", err))
+		return
+	}
+	snippet.GoVersion = config.FullVersion
+
+	id, err := store.Put(snippet)
+	if err != nil {
+		log.Printf("[WARN] HandleShare: %v", err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, share.ErrQuotaExceeded):
+			status = http.StatusInsufficientStorage
+		case errors.Is(err, share.ErrCollision):
+			status = http.StatusConflict
+		}
+		writeError(status, err.Error())
+		return
+	}
+
+	response := ShareResponse{
+		ID:        id,
+		URL:       sharePageURL(id),
+		Version:   snippet.Version,
+		GoVersion: snippet.GoVersion,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// getShare returns a stored snippet together with the currently installed toolchain
+func getShare(w http.ResponseWriter, store *share.Store, id string) {
+	snippet, createdAt, err := store.Get(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, share.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(SharedSnippetResponse{ID: id, Error: err.Error()}); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+
+	response := SharedSnippetResponse{Snippet: snippet, ID: id, CreatedAt: createdAt}
+	// 共有時のパッチがまだインストールされていればそのパッチ、なければ同じマイナーバージョンの既定のツールチェーン
+	manager := version.GetManager()
+	for _, candidate := range []string{snippet.GoVersion, snippet.Version, version.MinorVersion(snippet.Version)} {
+		if candidate == "" {
+			continue
+		}
+		if config, err := manager.GetVersionConfig(candidate); err == nil {
+			response.InstalledGoVersion = config.FullVersion
+			response.ToolchainChanged = snippet.GoVersion != "" && snippet.GoVersion != config.FullVersion
+			break
+		}
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// HandleSharePage serves the tour for /s/{id}; the page loads the snippet from /api/share/{id}
+func HandleSharePage(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/s/")
+	store, err := share.GetStore()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if _, _, err := store.Get(id); err != nil {
+		log.Printf("[DEBUG] HandleSharePage: %s: %v", id, err)
+		http.NotFound(w, r)
+		return
+	}
+	templates.HandleIndex(w, r)
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go-release-tour/app/internal/version"
+	"go-release-tour/app/internal/websocket"
+)
+
+// Streaming protocol message types
+//
+// Client -> server:
+//   - run:       first message, carries CodeRunRequest fields
+//   - stdin:     data is written to the program's standard input
+//   - stdin_eof: closes the program's standard input
+//   - stop:      cancels the execution
+//
+// Server -> client:
+//   - queued: position is the place in the execution queue (sent while waiting)
+//   - status: phase is "compiling" or "running"
+//   - stdout / stderr: output chunk in data
+//   - exit:   final result (status, exit_code, error, version info)
+//   - error:  request could not be started
+const (
+	streamTypeRun      = "run"
+	streamTypeStdin    = "stdin"
+	streamTypeStdinEOF = "stdin_eof"
+	streamTypeStop     = "stop"
+	streamTypeQueued   = "queued"
+	streamTypeStatus   = "status"
+	streamTypeExit     = "exit"
+	streamTypeError    = "error"
+)
+
+const (
+	// stdinQueueSize bounds buffered stdin messages not yet consumed by the program
+	stdinQueueSize = 64
+	// streamRunMessageTimeout bounds the wait for the first (run) message after the upgrade
+	streamRunMessageTimeout = 10 * time.Second
+)
+
+// errStoppedByClient is the cancellation cause for an explicit stop message
+var errStoppedByClient = errors.New("stopped by client")
+
+// StreamClientMessage is a message sent by the browser over the WebSocket
+type StreamClientMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	CodeRunRequest
+}
+
+// StreamServerMessage is a message sent to the browser over the WebSocket
+type StreamServerMessage struct {
+	Type       string                    `json:"type"`
+	Data       string                    `json:"data,omitempty"`
+	Phase      string                    `json:"phase,omitempty"`
+	Position   int                       `json:"position,omitempty"`
+	Error      string                    `json:"error,omitempty"`
+	Violations []version.PolicyViolation `json:"violations,omitempty"` // error: コードポリシー違反
+	Exit       *CodeRunResponse          `json:"result,omitempty"`
+}
+
+// HandleRunStream executes Go code over a WebSocket, streaming output and accepting stdin
+func HandleRunStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Printf("[DEBUG] HandleRunStream: Upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	// /api/run と同じ合計サイズのファイルを受け付ける（JSONのエスケープと他のフィールドの分として2倍）
+	conn.MaxMessageLen = 2 * version.MaxRequestBytes
+
+	// Upgrade はhttp.Serverのデッドラインを解除するため、runを送らない接続が残らないよう期限を設ける
+	if err := conn.SetReadDeadline(time.Now().Add(streamRunMessageTimeout)); err != nil {
+		log.Printf("[DEBUG] HandleRunStream: Failed to set read deadline: %v", err)
+		return
+	}
+	var first StreamClientMessage
+	if err := conn.ReadJSON(&first); err != nil {
+		log.Printf("[DEBUG] HandleRunStream: Failed to read run message: %v", err)
+		return
+	}
+	if first.Type != streamTypeRun {
+		sendStreamError(conn, fmt.Sprintf("最初のメッセージは %q である必要があります", streamTypeRun))
+		return
+	}
+	req := first.CodeRunRequest
+
+	log.Printf("[DEBUG] HandleRunStream: Received request - Version=%q, Code length=%d, files=%d", req.Version, len(req.Code), len(req.Files))
+
+	if req.Version == "" {
+		sendStreamError(conn, "バージョンが指定されていません")
+		return
+	}
+
+	executor := version.NewExecutor()
+	execReq := newExecutionRequest(req)
+	analysis, err := resolveAutoVersion(executor, &req, &execReq)
+	if err != nil {
+		sendStreamError(conn, fmt.Sprintf("バージョン選択エラー: %v", err))
+		return
+	}
+	if err := executor.ValidateRequest(execReq); err != nil {
+		sendStreamMessage(conn, StreamServerMessage{
+			Type:       streamTypeError,
+			Error:      fmt.Sprintf("コード検証エラー: %v", err),
+			Violations: policyViolations(err),
+		})
+		return
+	}
+
+	// 実行を受け付けた後は、順番待ちや長い実行の間も標準入力・stopを待ち続ける
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("[DEBUG] HandleRunStream: Failed to clear read deadline: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	stdinReader, stdinWriter := io.Pipe()
+	defer stdinReader.Close()
+	stdinQueue := make(chan string, stdinQueueSize)
+
+	// ブラウザからのメッセージ受信ループ
+	go func() {
+		stdinOpen := true
+		closeStdin := func() {
+			if stdinOpen {
+				stdinOpen = false
+				close(stdinQueue)
+			}
+		}
+		defer closeStdin()
+		for {
+			var msg StreamClientMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				// 切断時は実行を停止
+				cancel(fmt.Errorf("client disconnected: %w", err))
+				return
+			}
+			switch msg.Type {
+			case streamTypeStdin:
+				if !stdinOpen {
+					continue
+				}
+				select {
+				case stdinQueue <- msg.Data:
+				default:
+					_ = conn.WriteJSON(StreamServerMessage{Type: streamTypeError, Error: "標準入力のバッファが一杯です"})
+				}
+			case streamTypeStdinEOF:
+				closeStdin()
+			case streamTypeStop:
+				cancel(errStoppedByClient)
+				return
+			}
+		}
+	}()
+
+	// 標準入力の書き込み（プログラムが読まない場合でも受信ループを塞がない）
+	go func() {
+		for data := range stdinQueue {
+			if _, err := stdinWriter.Write([]byte(data)); err != nil {
+				return
+			}
+		}
+		stdinWriter.Close()
+	}()
+
+	// 実行スロットを確保（待機中は順番を通知し、stopで待機を取り消せる）
+	positions := make(chan int, 1)
+	positionsDone := make(chan struct{})
+	go func() {
+		defer close(positionsDone)
+		for position := range positions {
+			_ = conn.WriteJSON(StreamServerMessage{Type: streamTypeQueued, Position: position})
+		}
+	}()
+	release, slot, err := version.GetScheduler().Acquire(ctx, clientKey(r), func(position int) {
+		// スケジューラのロック中に呼ばれるため、ブロックせず最新の順番だけを残す
+		select {
+		case <-positions:
+		default:
+		}
+		positions <- position
+	})
+	close(positions)
+	<-positionsDone
+	if err != nil {
+		if errors.Is(err, version.ErrQueueFull) {
+			sendStreamError(conn, fmt.Sprintf("%v。しばらくしてから再実行してください", err))
+		} else if errors.Is(err, errStoppedByClient) {
+			sendStreamError(conn, "ユーザーにより停止されました")
+		} else {
+			log.Printf("[DEBUG] HandleRunStream: Waiting for execution slot aborted: %v", err)
+		}
+		return
+	}
+	defer release()
+
+	result, err := executor.Runner().ExecuteStream(ctx, execReq, version.StreamHandlers{
+		Stdin: stdinReader,
+		OnOutput: func(stream string, data []byte) {
+			if err := conn.WriteJSON(StreamServerMessage{Type: stream, Data: string(data)}); err != nil {
+				cancel(fmt.Errorf("write failed: %w", err))
+			}
+		},
+		OnPhase: func(phase string) {
+			_ = conn.WriteJSON(StreamServerMessage{Type: streamTypeStatus, Phase: phase})
+		},
+	})
+
+	// 出力はストリーミング済みのため最終結果には含めない
+	exit := newCodeRunResponse(req, result)
+	exit.Output, exit.Stdout, exit.Stderr, exit.Events = "", "", "", nil
+	exit.Error = result.Error
+	response := &exit
+	response.VersionAnalysis = analysis
+	setQueueInfo(response, slot)
+	if err != nil && response.Error == "" {
+		response.Error = err.Error()
+	}
+	if errors.Is(context.Cause(ctx), errStoppedByClient) {
+		response.Error = "ユーザーにより停止されました"
+	}
+
+	log.Printf("[DEBUG] HandleRunStream: Execution finished - status=%s, exit=%d", result.Status, result.ExitCode)
+	if err := conn.WriteJSON(StreamServerMessage{Type: streamTypeExit, Exit: response}); err != nil {
+		log.Printf("[DEBUG] HandleRunStream: Failed to send exit message: %v", err)
+		return
+	}
+	_ = conn.WriteClose(websocket.CloseNormalClosure, "")
+}
+
+// sendStreamError sends an error message and closes the stream
+func sendStreamError(conn *websocket.Conn, message string) {
+	sendStreamMessage(conn, StreamServerMessage{Type: streamTypeError, Error: message})
+}
+
+// sendStreamMessage sends a final error message and closes the connection
+func sendStreamMessage(conn *websocket.Conn, msg StreamServerMessage) {
+	log.Printf("[DEBUG] HandleRunStream: %s", msg.Error)
+	if err := conn.WriteJSON(msg); err != nil {
+		return
+	}
+	_ = conn.WriteClose(websocket.CloseNormalClosure, "")
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go-release-tour/app/internal/version"
+)
+
+// FormatRequest formats the code with the selected version's gofmt
+type FormatRequest struct {
+	Code     string            `json:"code"`
+	Version  string            `json:"version"`            // 使用するGoバージョン（"auto" 可）
+	Files    map[string]string `json:"files,omitempty"`    // 複数ファイル（相対パス -> 内容）
+	Simplify bool              `json:"simplify,omitempty"` // gofmt -s
+}
+
+// FormatResponse is the response of /api/format
+type FormatResponse struct {
+	*version.FormatResult
+	Error string `json:"error,omitempty"`
+}
+
+// VetRequest runs go vet with the selected version
+type VetRequest struct {
+	CodeRunRequest
+	Fix bool `json:"fix,omitempty"` // go vet -fix で修正を適用（Go 1.26以降）
+}
+
+// VetResponse is the response of /api/vet
+type VetResponse struct {
+	*version.VetResult
+	Error      string                    `json:"error,omitempty"`
+	Violations []version.PolicyViolation `json:"violations,omitempty"`
+}
+
+// HandleFormat returns the source rewritten by gofmt of the selected toolchain
+func HandleFormat(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FormatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleFormat: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleFormat: Version=%q, files=%d, simplify=%t", req.Version, len(req.Files), req.Simplify)
+
+	if req.Version == "" {
+		writeToolError(w, FormatResponse{Error: "バージョンが指定されていません"})
+		return
+	}
+
+	executor := version.NewExecutor()
+	result, err := executor.Format(r.Context(), version.ExecutionRequest{
+		Code:    req.Code,
+		Version: req.Version,
+		Files:   req.Files,
+	}, req.Simplify)
+	if err != nil {
+		log.Printf("[DEBUG] HandleFormat: %v", err)
+		writeToolError(w, FormatResponse{Error: err.Error()})
+		return
+	}
+
+	// 構文エラーがあれば位置付きで返す（そのファイルは変更しない）
+	response := FormatResponse{FormatResult: result}
+	if len(result.Diagnostics) > 0 {
+		response.Error = fmt.Sprintf("構文エラー: %s", result.Diagnostics[0])
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// HandleVet returns the findings of go vet of the selected toolchain, optionally applying its fixes
+func HandleVet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req VetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleVet: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleVet: Version=%q, files=%d, fix=%t", req.Version, len(req.Files), req.Fix)
+
+	if req.Version == "" {
+		writeToolError(w, VetResponse{Error: "バージョンが指定されていません"})
+		return
+	}
+
+	executor := version.NewExecutor()
+	execReq := newExecutionRequest(req.CodeRunRequest)
+	if _, err := resolveAutoVersion(executor, &req.CodeRunRequest, &execReq); err != nil {
+		writeToolError(w, VetResponse{Error: fmt.Sprintf("バージョン選択エラー: %v", err)})
+		return
+	}
+
+	// go vet はパッケージをビルドする（cgo を含む）ため、実行と同じポリシーを適用する
+	if err := executor.ValidateRequest(execReq); err != nil {
+		log.Printf("[DEBUG] HandleVet: Code validation failed: %v", err)
+		writeToolError(w, VetResponse{
+			Error:      fmt.Sprintf("コード検証エラー: %v", err),
+			Violations: policyViolations(err),
+		})
+		return
+	}
+
+	// 実行スロットを確保（満杯なら429で再試行を促す）
+	waitCtx, cancelWait := context.WithTimeoutCause(r.Context(), maxQueueWait, &version.QueueFullError{RetryAfter: maxQueueWait / 2})
+	release, _, err := version.GetScheduler().Acquire(waitCtx, clientKey(r), nil)
+	cancelWait()
+	if err != nil {
+		writeSchedulerError(w, err)
+		return
+	}
+	defer release()
+
+	result, err := executor.Vet(r.Context(), execReq, req.Fix)
+	if err != nil {
+		log.Printf("[DEBUG] HandleVet: %v", err)
+		writeToolError(w, VetResponse{Error: err.Error()})
+		return
+	}
+
+	response := VetResponse{VetResult: result}
+	if len(result.Diagnostics) > 0 {
+		response.Error = fmt.Sprintf("ビルドエラー: %s", result.Diagnostics[0])
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// writeToolError writes a format / vet response that failed before the tool produced a result
+func writeToolError(w http.ResponseWriter, response interface{}) {
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
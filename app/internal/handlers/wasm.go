@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go-release-tour/app/internal/artifact"
+	"go-release-tour/app/internal/version"
+)
+
+// WasmRunResponse is the response of /api/run/wasm
+type WasmRunResponse struct {
+	*version.WasmBuild
+	WasmURL     string                    `json:"wasm_url,omitempty"`     // ビルドした main.wasm（例: "/api/artifacts/0123456789abcdef"）
+	ExecURL     string                    `json:"exec_url,omitempty"`     // 同じツールチェーンの wasm_exec.js（例: "/api/wasm/exec.js?version=1.25.1"）
+	UsedVersion string                    `json:"used_version,omitempty"` // 使用されたGoバージョン（例: 1.25）
+	Error       string                    `json:"error,omitempty"`
+	Violations  []version.PolicyViolation `json:"violations,omitempty"`
+}
+
+// HandleRunWasm builds the code for GOOS=js GOARCH=wasm so that the browser can run it.
+// Code the browser cannot run is answered with supported=false and the reasons; the client then uses /api/run.
+func HandleRunWasm(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CodeRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[DEBUG] HandleRunWasm: Failed to decode JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[DEBUG] HandleRunWasm: Version=%q, files=%d", req.Version, len(req.Files))
+
+	if req.Version == "" {
+		writeToolError(w, WasmRunResponse{Error: "バージョンが指定されていません"})
+		return
+	}
+
+	executor := version.NewExecutor()
+	execReq := newExecutionRequest(req)
+	if _, err := resolveAutoVersion(executor, &req, &execReq); err != nil {
+		writeToolError(w, WasmRunResponse{Error: fmt.Sprintf("バージョン選択エラー: %v", err)})
+		return
+	}
+
+	// ビルドはホスト上で行うため、実行と同じポリシーを適用する
+	if err := executor.ValidateRequest(execReq); err != nil {
+		log.Printf("[DEBUG] HandleRunWasm: Code validation failed: %v", err)
+		writeToolError(w, WasmRunResponse{
+			Error:      fmt.Sprintf("コード検証エラー: %v", err),
+			Violations: policyViolations(err),
+		})
+		return
+	}
+
+	// 実行スロットを確保（満杯なら429で再試行を促す）
+	waitCtx, cancelWait := context.WithTimeoutCause(r.Context(), maxQueueWait, &version.QueueFullError{RetryAfter: maxQueueWait / 2})
+	release, _, err := version.GetScheduler().Acquire(waitCtx, clientKey(r), nil)
+	cancelWait()
+	if err != nil {
+		writeSchedulerError(w, err)
+		return
+	}
+	defer release()
+
+	build, err := executor.BuildWasm(r.Context(), execReq)
+	if err != nil {
+		log.Printf("[DEBUG] HandleRunWasm: %v", err)
+		writeToolError(w, WasmRunResponse{Error: err.Error()})
+		return
+	}
+
+	response := WasmRunResponse{WasmBuild: build, UsedVersion: build.Version, Error: build.Error}
+	if build.Supported && build.Error == "" {
+		store, err := artifact.GetStore()
+		if err != nil {
+			writeToolError(w, WasmRunResponse{Error: err.Error()})
+			return
+		}
+		stored, err := store.Put(version.CaptureWasm, "main.wasm", build.Wasm)
+		if err != nil {
+			log.Printf("[WARN] HandleRunWasm: %v", err)
+			writeToolError(w, WasmRunResponse{Error: err.Error()})
+			return
+		}
+		response.WasmURL = "/api/artifacts/" + stored.ID
+		response.ExecURL = "/api/wasm/exec.js?version=" + build.GoVersion
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// HandleWasmExec serves the wasm_exec.js of the toolchain of a Go version (GET /api/wasm/exec.js?version=1.25).
+// The script must match the toolchain that built the .wasm file.
+func HandleWasmExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	script, err := version.NewExecutor().WasmExecScript(r.URL.Query().Get("version"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	http.ServeFile(w, r, script)
+}
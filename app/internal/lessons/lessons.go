@@ -43,11 +43,12 @@ func loadVersionLessons(s *types.Server, version string, configManager *config.C
 	}
 
 	// 設定ファイルからレッスンデータを取得
-	lessonData, err := configManager.GetAllLessonsForVersion(version)
+	versionConfig, err := configManager.GetVersionConfig(version)
 	if err != nil {
 		log.Printf("Error getting lesson data for version %s: %v", version, err)
 		return
 	}
+	lessonData := versionConfig.Lessons
 
 	var lessons []types.Lesson
 	for i, file := range files {
@@ -64,6 +65,12 @@ func loadVersionLessons(s *types.Server, version string, configManager *config.C
 			continue
 		}
 
+		// 検証したパッチが指定されていなければ、設定の完全バージョンで検証したものとする
+		validatedWith := data.ValidatedWith
+		if validatedWith == "" {
+			validatedWith = versionConfig.FullVersion
+		}
+
 		// コメントから説明を抽出
 		lines := strings.Split(string(content), "\n")
 		var description string
@@ -75,15 +82,16 @@ func loadVersionLessons(s *types.Server, version string, configManager *config.C
 		}
 
 		lesson := types.Lesson{
-			ID:          i + 1,
-			Title:       data.Title,
-			Description: description,
-			Code:        string(content),
-			Filename:    filename,
-			FilePath:    file, // ファイルパスを追加
-			Stars:       data.Stars,
-			Version:     version,
-			EnvPresets:  parseEnvPresets(string(content)), // 環境変数プリセットを解析
+			ID:            i + 1,
+			Title:         data.Title,
+			Description:   description,
+			Code:          string(content),
+			Filename:      filename,
+			FilePath:      file, // ファイルパスを追加
+			Stars:         data.Stars,
+			Version:       version,
+			ValidatedWith: validatedWith,
+			EnvPresets:    parseEnvPresets(string(content)), // 環境変数プリセットを解析
 		}
 		lessons = append(lessons, lesson)
 	}
@@ -0,0 +1,387 @@
+// Package share - Content-addressed store of shared snippets
+//
+// A shared snippet records the code together with everything needed to run it
+// the same way again: the Go version, the full toolchain version it was shared
+// with, environment variables, build and execution options. The ID is derived
+// from the content, so sharing the same snippet twice yields the same
+// permalink; an ID whose stored content differs is reported as a collision.
+// Snippets are stored as JSON files below the share directory, bounded by a
+// total size quota, an optional expiry and a per-client rate limit.
+//
+// Environment variables:
+// - SHARE_DIR: share directory (default: data/shares)
+// - SHARE_MAX_BYTES: total size of stored snippets (default: 256MiB, 0: unlimited)
+// - SHARE_TTL: how long snippets are kept, e.g. "2160h" (default: 0, kept forever)
+// - SHARE_RATE_LIMIT: shares per client and hour (default: 30, 0: unlimited)
+package share
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-release-tour/app/internal/version"
+)
+
+const (
+	defaultShareDir = "data/shares"
+	idLength        = 16 // SHA-256 の先頭64ビット（16進数）
+
+	// MaxSnippetBytes limits the encoded size of a shared snippet
+	MaxSnippetBytes = 256 << 10
+
+	defaultMaxBytes   = 256 << 20
+	defaultRateLimit  = 30
+	rateWindow        = time.Hour
+	maxTrackedClients = 1024 // これを超えたら期限切れのレート制限の記録を削除
+)
+
+var (
+	// ErrNotFound is returned when no (unexpired) snippet exists for an ID
+	ErrNotFound = errors.New("共有コードが見つかりません")
+	// ErrQuotaExceeded is returned when the share directory is full
+	ErrQuotaExceeded = errors.New("共有コードの保存容量の上限に達しました")
+	// ErrCollision is returned when a different snippet is stored under the same ID
+	ErrCollision = errors.New("共有コードのIDが既存の内容と衝突しました")
+)
+
+// RateLimitError is returned when a client shares too often
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "共有の回数が多すぎます"
+}
+
+// idPattern matches a valid snippet ID
+var idPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Snippet is the shared content. Every field is part of the content address.
+type Snippet struct {
+	Code      string               `json:"code"`
+	Version   string               `json:"version"`              // 例: "1.22"
+	GoVersion string               `json:"go_version,omitempty"` // 共有時のツールチェーンの完全バージョン（例: "1.22.7"）
+	EnvVars   string               `json:"env_vars,omitempty"`   // 例: "GOEXPERIMENT=jsonv2"
+	Files     map[string]string    `json:"files,omitempty"`      // 複数ファイル（相対パス -> 内容）
+	Package   string               `json:"package,omitempty"`    // 実行するパッケージ（例: "./cmd/app"）
+	Mode      string               `json:"mode,omitempty"`       // "run" / "test"
+	Test      *version.TestOptions `json:"test,omitempty"`       // テストモードのオプション
+
+	Environment map[string]string `json:"environment,omitempty"` // 環境変数（env_vars と併用可）
+	FakeTime    bool              `json:"fake_time,omitempty"`   // 仮想時間で実行
+	Trace       string            `json:"trace,omitempty"`       // 実行トレースの取得: "trace" / "flight"
+	Profile     []string          `json:"profile,omitempty"`     // 取得するプロファイル: "cpu" / "heap"
+}
+
+// Request returns the execution request that reproduces the snippet
+func (s *Snippet) Request() version.ExecutionRequest {
+	return version.ExecutionRequest{
+		Code:        s.Code,
+		Version:     s.Version,
+		EnvVars:     s.EnvVars,
+		Environment: s.Environment,
+		Files:       s.Files,
+		Package:     s.Package,
+		Mode:        s.Mode,
+		Test:        s.Test,
+		FakeTime:    s.FakeTime,
+		Trace:       s.Trace,
+		Profile:     s.Profile,
+	}
+}
+
+// storedSnippet is the file format of a snippet
+type storedSnippet struct {
+	Snippet
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Limits bounds the storage and the share rate of a store. Zero values disable a limit.
+type Limits struct {
+	MaxBytes  int64         // 保存する共有コードの合計サイズ
+	TTL       time.Duration // 共有コードの保存期間
+	RateLimit int           // クライアントごとの1時間あたりの共有回数
+}
+
+// Store keeps shared snippets on disk
+type Store struct {
+	dir    string
+	limits Limits
+	mutex  sync.Mutex
+	used   int64 // 保存済みの共有コードの合計サイズ
+
+	rateMutex sync.Mutex
+	clients   map[string]*clientRate
+}
+
+// clientRate counts the shares of a client in the current window
+type clientRate struct {
+	start time.Time
+	count int
+}
+
+// NewStore creates a store in dir. Expired snippets are removed and the size of the others is counted.
+func NewStore(dir string, limits Limits) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("共有ディレクトリ作成エラー: %w", err)
+	}
+	s := &Store{dir: dir, limits: limits, clients: make(map[string]*clientRate)}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.scan(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ValidID reports whether id has the form of a snippet ID
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// snippetID returns the content address of a snippet
+func snippetID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:idLength]
+}
+
+// path returns the file of a snippet (IDs are spread over subdirectories by their first two characters)
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id[:2], id+".json")
+}
+
+// Allow counts a share of client and reports a *RateLimitError when it exceeds the rate limit
+func (s *Store) Allow(client string) error {
+	if s.limits.RateLimit <= 0 {
+		return nil
+	}
+	now := time.Now()
+
+	s.rateMutex.Lock()
+	defer s.rateMutex.Unlock()
+
+	if len(s.clients) >= maxTrackedClients {
+		for key, rate := range s.clients {
+			if now.Sub(rate.start) >= rateWindow {
+				delete(s.clients, key)
+			}
+		}
+	}
+	rate := s.clients[client]
+	if rate == nil || now.Sub(rate.start) >= rateWindow {
+		rate = &clientRate{start: now}
+		s.clients[client] = rate
+	}
+	if rate.count >= s.limits.RateLimit {
+		return &RateLimitError{RetryAfter: rate.start.Add(rateWindow).Sub(now)}
+	}
+	rate.count++
+	return nil
+}
+
+// Put stores a snippet and returns its ID. Storing the same content again returns the existing ID;
+// a different snippet stored under the same ID is reported as ErrCollision.
+func (s *Store) Put(snippet Snippet) (string, error) {
+	// encoding/json はマップのキーを整列して出力するため、同じ内容は同じバイト列になる
+	content, err := json.Marshal(snippet)
+	if err != nil {
+		return "", fmt.Errorf("共有コードのエンコードエラー: %w", err)
+	}
+	if len(content) > MaxSnippetBytes {
+		return "", fmt.Errorf("共有コードが大きすぎます（%dバイト、上限%dバイト）", len(content), MaxSnippetBytes)
+	}
+	id := snippetID(content)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	path := s.path(id)
+	var replaced int64 // 期限切れで置き換える既存ファイルのサイズ
+	if existing, info, err := s.load(path); err == nil {
+		stored, err := json.Marshal(existing.Snippet)
+		if err != nil || !bytes.Equal(stored, content) {
+			log.Printf("[WARN] ShareStore: ID collision for %s", id)
+			return "", ErrCollision
+		}
+		if !s.expired(existing.CreatedAt, now) {
+			return id, nil
+		}
+		replaced = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(storedSnippet{Snippet: snippet, CreatedAt: now.UTC()}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("共有コードのエンコードエラー: %w", err)
+	}
+	if s.limits.MaxBytes > 0 && s.used-replaced+int64(len(data)) > s.limits.MaxBytes {
+		// 期限切れの共有コードを削除してから再確認
+		if s.limits.TTL > 0 {
+			if err := s.scan(now); err != nil {
+				return "", err
+			}
+			if _, err := os.Stat(path); err != nil {
+				replaced = 0
+			}
+		}
+		if s.used-replaced+int64(len(data)) > s.limits.MaxBytes {
+			return "", ErrQuotaExceeded
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("共有ディレクトリ作成エラー: %w", err)
+	}
+
+	// 一時ファイルに書き込んでからリネーム（読み込み中に不完全なファイルが見えないように）
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("共有コードの保存エラー: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("共有コードの保存エラー: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("共有コードの保存エラー: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("共有コードの保存エラー: %w", err)
+	}
+	s.used += int64(len(data)) - replaced
+	return id, nil
+}
+
+// Get loads the snippet with the given ID and the time it was first shared
+func (s *Store) Get(id string) (*Snippet, time.Time, error) {
+	if !ValidID(id) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	stored, _, err := s.load(s.path(id))
+	if errors.Is(err, os.ErrNotExist) || (err == nil && s.expired(stored.CreatedAt, time.Now())) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return &stored.Snippet, stored.CreatedAt, nil
+}
+
+// load reads a snippet file; a missing file is reported as os.ErrNotExist
+func (s *Store) load(path string) (*storedSnippet, os.FileInfo, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("共有コードの読み込みエラー: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("共有コードの読み込みエラー: %w", err)
+	}
+	var stored storedSnippet
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, nil, fmt.Errorf("共有コードの読み込みエラー: %w", err)
+	}
+	return &stored, info, nil
+}
+
+// expired reports whether a snippet created at createdAt is past the TTL
+func (s *Store) expired(createdAt, now time.Time) bool {
+	return s.limits.TTL > 0 && now.Sub(createdAt) > s.limits.TTL
+}
+
+// scan removes expired snippets and recounts the size of the others (called with the mutex held).
+// The file modification time is the creation time, as snippets are never rewritten before they expire.
+func (s *Store) scan(now time.Time) error {
+	var used int64
+	err := filepath.WalkDir(s.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !ValidID(strings.TrimSuffix(entry.Name(), ".json")) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil // 走査中に削除された
+		}
+		if s.expired(info.ModTime(), now) {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("[WARN] ShareStore: failed to remove %s: %v", path, err)
+				used += info.Size()
+			}
+			return nil
+		}
+		used += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("共有ディレクトリの走査エラー: %w", err)
+	}
+	s.used = used
+	return nil
+}
+
+// Global store instance
+var (
+	globalStore     *Store
+	globalStoreErr  error
+	globalStoreOnce sync.Once
+)
+
+// GetStore returns the process-wide share store configured by SHARE_DIR, SHARE_MAX_BYTES, SHARE_TTL and SHARE_RATE_LIMIT
+func GetStore() (*Store, error) {
+	globalStoreOnce.Do(func() {
+		dir := os.Getenv("SHARE_DIR")
+		if dir == "" {
+			dir = defaultShareDir
+		}
+		limits := Limits{MaxBytes: defaultMaxBytes, RateLimit: defaultRateLimit}
+		if value := os.Getenv("SHARE_MAX_BYTES"); value != "" {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+				limits.MaxBytes = n
+			} else {
+				log.Printf("[WARN] ShareStore: invalid SHARE_MAX_BYTES %q", value)
+			}
+		}
+		if value := os.Getenv("SHARE_TTL"); value != "" {
+			if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+				limits.TTL = d
+			} else {
+				log.Printf("[WARN] ShareStore: invalid SHARE_TTL %q", value)
+			}
+		}
+		if value := os.Getenv("SHARE_RATE_LIMIT"); value != "" {
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				limits.RateLimit = n
+			} else {
+				log.Printf("[WARN] ShareStore: invalid SHARE_RATE_LIMIT %q", value)
+			}
+		}
+		globalStore, globalStoreErr = NewStore(dir, limits)
+		if globalStoreErr != nil {
+			log.Printf("[WARN] ShareStore: disabled: %v", globalStoreErr)
+			return
+		}
+		log.Printf("ShareStore: %s (max %d bytes, ttl %v, rate limit %d/h)", dir, limits.MaxBytes, limits.TTL, limits.RateLimit)
+	})
+	return globalStore, globalStoreErr
+}
@@ -0,0 +1,176 @@
+package share
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutGet(t *testing.T) {
+	store, err := NewStore(t.TempDir(), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippet := Snippet{
+		Code:        "package main\nfunc main() {}\n",
+		Version:     "1.25",
+		GoVersion:   "1.25.1",
+		EnvVars:     "GOEXPERIMENT=jsonv2",
+		Environment: map[string]string{"TZ": "Asia/Tokyo"},
+		FakeTime:    true,
+		Trace:       "trace",
+		Profile:     []string{"cpu"},
+	}
+	id, err := store.Put(snippet)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !ValidID(id) {
+		t.Fatalf("Put returned invalid ID %q", id)
+	}
+	if again, err := store.Put(snippet); err != nil || again != id {
+		t.Errorf("Put of the same snippet = %q, %v; want %q", again, err, id)
+	}
+
+	got, _, err := store.Get(id)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	req := got.Request()
+	if req.Code != snippet.Code || req.EnvVars != snippet.EnvVars || req.Environment["TZ"] != "Asia/Tokyo" ||
+		!req.FakeTime || req.Trace != "trace" || len(req.Profile) != 1 {
+		t.Errorf("Request() = %+v, want the shared options", req)
+	}
+
+	other := snippet
+	other.FakeTime = false
+	if otherID, err := store.Put(other); err != nil || otherID == id {
+		t.Errorf("Put with different options = %q, %v; want a new ID", otherID, err)
+	}
+
+	if _, _, err := store.Get("0123456789abcdef"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an unknown ID = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPutCollision(t *testing.T) {
+	store, err := NewStore(t.TempDir(), Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet := Snippet{Code: "package main\nfunc main() {}\n", Version: "1.25"}
+	content, _ := json.Marshal(snippet)
+	id := snippetID(content)
+
+	// 同じIDで別の内容が保存されている
+	stored, _ := json.Marshal(storedSnippet{Snippet: Snippet{Code: "other", Version: "1.25"}, CreatedAt: time.Now()})
+	if err := os.MkdirAll(filepath.Dir(store.path(id)), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.path(id), stored, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put(snippet); !errors.Is(err, ErrCollision) {
+		t.Errorf("Put = %v, want ErrCollision", err)
+	}
+	if got, _, err := store.Get(id); err != nil || got.Code != "other" {
+		t.Errorf("stored snippet was replaced: %+v, %v", got, err)
+	}
+}
+
+func TestPutQuota(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, Limits{MaxBytes: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(Snippet{Code: "package main // 1", Version: "1.25"}); err != nil {
+		t.Fatalf("first Put: %v", err)
+	}
+	if _, err := store.Put(Snippet{Code: "package main // 2", Version: "1.25"}); err != nil {
+		t.Fatalf("second Put: %v", err)
+	}
+	if _, err := store.Put(Snippet{Code: "package main // 3", Version: "1.25"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("third Put = %v, want ErrQuotaExceeded", err)
+	}
+
+	// 再起動後も使用量を数え直す
+	reopened, err := NewStore(dir, Limits{MaxBytes: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.used != store.used {
+		t.Errorf("reopened store uses %d bytes, want %d", reopened.used, store.used)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, Limits{MaxBytes: 150, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := store.Put(Snippet{Code: "package main // old", Version: "1.25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 作成日時と更新日時を期限切れにする
+	path := store.path(old)
+	data, _ := os.ReadFile(path)
+	var stored storedSnippet
+	json.Unmarshal(data, &stored)
+	past := time.Now().Add(-2 * time.Hour)
+	stored.CreatedAt = past
+	data, _ = json.Marshal(stored)
+	os.WriteFile(path, data, 0o600)
+	os.Chtimes(path, past, past)
+
+	if _, _, err := store.Get(old); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an expired snippet = %v, want ErrNotFound", err)
+	}
+	// 容量が足りなければ期限切れの共有コードを削除して保存する
+	if _, err := store.Put(Snippet{Code: "package main // new", Version: "1.25"}); err != nil {
+		t.Fatalf("Put after expiry: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired snippet was not removed: %v", err)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	store, err := NewStore(t.TempDir(), Limits{RateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if err := store.Allow("192.0.2.1"); err != nil {
+			t.Fatalf("share %d: %v", i, err)
+		}
+	}
+	var rateLimit *RateLimitError
+	if err := store.Allow("192.0.2.1"); !errors.As(err, &rateLimit) || rateLimit.RetryAfter <= 0 || rateLimit.RetryAfter > rateWindow {
+		t.Errorf("third share = %v, want *RateLimitError", err)
+	}
+	if err := store.Allow("192.0.2.2"); err != nil {
+		t.Errorf("another client: %v", err)
+	}
+
+	// 期限切れのウィンドウは新しいウィンドウになる
+	store.clients["192.0.2.1"].start = time.Now().Add(-rateWindow)
+	if err := store.Allow("192.0.2.1"); err != nil {
+		t.Errorf("share after the window: %v", err)
+	}
+
+	unlimited, _ := NewStore(t.TempDir(), Limits{})
+	for range 100 {
+		if err := unlimited.Allow("192.0.2.1"); err != nil {
+			t.Fatalf("unlimited store: %v", err)
+		}
+	}
+}
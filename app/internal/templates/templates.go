@@ -48,6 +48,9 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
                         <option value="1.19">Go 1.19</option>
                         <option value="1.18">Go 1.18 (Generics)</option>
                     </select>
+                    <select id="patch-select" title="実行に使うパッチバージョン（インストール済みのもの）">
+                        <option value="">既定のパッチ</option>
+                    </select>
                 </div>
                 <h3>レッスン一覧</h3>
                 <div id="lesson-list"></div>
@@ -243,6 +246,7 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
                             <div class="lesson-title">
                                 <h2 id="current-lesson-title"></h2>
                                 <div id="current-lesson-stars"></div>
+                                <div id="current-lesson-validated" class="lesson-validated"></div>
                             </div>
                         </div>
                         <div id="lesson-description"></div>
@@ -274,6 +278,24 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
                                 <option value="dracula">Dracula</option>
                             </select>
                             <button id="run-btn">▶ 実行</button>
+                            <button id="compare-btn" title="インストール済みの全バージョンで実行して出力を比較">⇄ バージョン比較</button>
+                            <button id="format-btn" class="tool-btn" title="選択中のバージョンの gofmt -s で整形">整形</button>
+                            <button id="vet-btn" class="tool-btn" title="選択中のバージョンの go vet で検査">vet</button>
+                            <button id="insight-btn" class="tool-btn" title="アセンブリ・インライン化・エスケープ解析・境界チェックを表示">コンパイラ</button>
+                            <button id="size-btn" class="tool-btn" title="インストール済みの全バージョンでビルドし、バイナリサイズを比較">サイズ</button>
+                            <button id="profile-btn" class="tool-btn" title="インストール済みの全バージョンでCPU・ヒーププロファイルを取得">プロファイル</button>
+                            <button id="share-btn" class="tool-btn" title="コードとバージョンを固定した共有URLを作成">共有</button>
+                            <label class="fake-time-toggle" title="time.Sleep を待たずに仮想時間で実行し、出力を元の間隔で再生">
+                                <input type="checkbox" id="fake-time"> 仮想時間
+                            </label>
+                            <label class="fake-time-toggle" title="WebAssembly にビルドしてブラウザ内で実行（対応していないコードはサーバーで実行）">
+                                <input type="checkbox" id="wasm-mode"> ブラウザで実行
+                            </label>
+                            <select id="trace-mode" title="runtime/trace の実行トレースを取得し、タイムラインを表示">
+                                <option value="">トレースなし</option>
+                                <option value="trace">トレース</option>
+                                <option value="flight">フライトレコーダー (1.25+)</option>
+                            </select>
                         </div>
                     </div>
                     <div class="env-controls">
@@ -298,7 +320,13 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
 
                 <div class="output-section">
                     <h4>実行結果</h4>
+                    <div class="stream-controls">
+                        <input type="text" id="stdin-input" placeholder="標準入力（Enterで送信）" disabled />
+                        <button id="stop-btn" disabled>■ 停止</button>
+                    </div>
                     <pre id="output"></pre>
+                    <div id="trace-viewer" hidden></div>
+                    <div id="profile-viewer" hidden></div>
                 </div>
             </main>
         </div>
@@ -307,6 +335,14 @@ func HandleIndex(w http.ResponseWriter, r *http.Request) {
     <!-- JavaScript modules -->
     <script src="/static/js/components/GoReleaseTour.js"></script>
     <script src="/static/js/modules/ApiClient.js"></script>
+    <script src="/static/js/modules/StreamRunner.js"></script>
+    <script src="/static/js/modules/WasmRunner.js"></script>
+    <script src="/static/js/modules/MatrixRunner.js"></script>
+    <script src="/static/js/modules/ToolsRunner.js"></script>
+    <script src="/static/js/modules/ShareManager.js"></script>
+    <script src="/static/js/modules/PatchSelector.js"></script>
+    <script src="/static/js/modules/TraceViewer.js"></script>
+    <script src="/static/js/modules/ProfileViewer.js"></script>
     <script src="/static/js/modules/EditorManager.js"></script>
     <script src="/static/js/modules/NavigationManager.js"></script>
     <script src="/static/js/modules/WelcomeScreen.js"></script>
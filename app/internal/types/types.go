@@ -9,15 +9,16 @@ type EnvPreset struct {
 
 // Lesson represents a single tutorial lesson
 type Lesson struct {
-	ID          int         `json:"id"`
-	Title       string      `json:"title"`
-	Description string      `json:"description"`
-	Code        string      `json:"code"`
-	Filename    string      `json:"filename"`
-	FilePath    string      `json:"file_path"` // Full path for version detection
-	Stars       int         `json:"stars"`
-	Version     string      `json:"version"`
-	EnvPresets  []EnvPreset `json:"env_presets,omitempty"` // 環境変数プリセット
+	ID            int         `json:"id"`
+	Title         string      `json:"title"`
+	Description   string      `json:"description"`
+	Code          string      `json:"code"`
+	Filename      string      `json:"filename"`
+	FilePath      string      `json:"file_path"` // Full path for version detection
+	Stars         int         `json:"stars"`
+	Version       string      `json:"version"`
+	ValidatedWith string      `json:"validated_with,omitempty"` // 動作を確認したパッチバージョン（例: "1.22.7"）
+	EnvPresets    []EnvPreset `json:"env_presets,omitempty"`    // 環境変数プリセット
 }
 
 // Server represents the HTTP server with lesson data
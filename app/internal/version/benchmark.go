@@ -0,0 +1,307 @@
+// Package version - Cross-version benchmark comparison
+//
+// The user's Benchmark* functions are run in test mode on several toolchains
+// and env presets. Runs are interleaved round by round (one -count=1 run per
+// configuration per round) so that drifting machine load affects every
+// configuration alike; the build cache makes repeated runs cheap. The
+// samples are summarized with the benchstat-style statistics in stats.go.
+//
+// The whole comparison, including the waits for execution slots, has to
+// finish within maxBenchmarkDuration so the result is returned before the
+// server's WriteTimeout; runs x per-run timeout is checked up front.
+package version
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	defaultBenchmarkCount     = 6
+	defaultBenchmarkBenchtime = "100ms"
+	// maxBenchmarkRuns limits configurations x rounds
+	maxBenchmarkRuns = 32
+	// maxBenchmarkDuration bounds a whole comparison (the server's WriteTimeout is 2 minutes)
+	maxBenchmarkDuration = 100 * time.Second
+	// maxBenchmarkRunTimeout is the per-run timeout when there are few runs
+	maxBenchmarkRunTimeout = 30 * time.Second
+)
+
+// errBenchmarkDeadline is the cause when a comparison exceeds maxBenchmarkDuration
+var errBenchmarkDeadline = errors.New("ベンチマーク比較が時間の上限を超えました")
+
+// BenchmarkRequest compares benchmarks across versions and env presets
+type BenchmarkRequest struct {
+	ExecutionRequest
+	Versions   []string    `json:"versions"`
+	EnvPresets []EnvPreset `json:"env_presets,omitempty"`
+	Bench      string      `json:"bench,omitempty"`     // -bench（デフォルト "."）
+	Benchtime  string      `json:"benchtime,omitempty"` // -benchtime（デフォルト "100ms"）
+	Count      int         `json:"count,omitempty"`     // 構成ごとの実行回数（デフォルト 6）
+}
+
+// BenchmarkConfig is one compared configuration (version x env preset)
+type BenchmarkConfig struct {
+	Version   string `json:"version"`
+	Preset    string `json:"preset"`
+	EnvVars   string `json:"env_vars,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+	Runs      int    `json:"runs"`            // 成功した実行回数
+	Error     string `json:"error,omitempty"` // ビルド・実行エラー（以降の実行は中止）
+}
+
+// BenchmarkStats summarizes the samples of one benchmark metric in one configuration
+type BenchmarkStats struct {
+	N            int       `json:"n"`
+	Samples      []float64 `json:"samples"`
+	Median       *float64  `json:"median,omitempty"`
+	CILow        *float64  `json:"ci_low,omitempty"`
+	CIHigh       *float64  `json:"ci_high,omitempty"`
+	CIConfidence float64   `json:"ci_confidence,omitempty"` // 区間の実際の信頼水準
+	DeltaPercent *float64  `json:"delta_percent,omitempty"` // ベースラインの中央値からの変化率
+	PValue       *float64  `json:"p_value,omitempty"`       // Mann-Whitney U検定
+	Significant  bool      `json:"significant"`             // p < alpha（benchstat の "~" でないもの）
+}
+
+// BenchmarkSeries is one benchmark metric across all configurations
+type BenchmarkSeries struct {
+	Name  string           `json:"name"`
+	Unit  string           `json:"unit"`  // "ns/op", "B/op", "allocs/op" または独自の単位
+	Stats []BenchmarkStats `json:"stats"` // Configs と同じ順序
+}
+
+// BenchmarkComparison is the result of a benchmark comparison
+type BenchmarkComparison struct {
+	Configs    []BenchmarkConfig `json:"configs"`
+	Baseline   int               `json:"baseline"` // 比較基準となる Configs のインデックス
+	Alpha      float64           `json:"alpha"`
+	Confidence float64           `json:"confidence"`
+	Benchmarks []BenchmarkSeries `json:"benchmarks"`
+}
+
+// ExecuteBenchmarkComparison runs the benchmarks of req on every configuration and compares them.
+// acquire (optional) is called before each run so comparisons share the execution scheduler.
+func (e *Executor) ExecuteBenchmarkComparison(ctx context.Context, req BenchmarkRequest, acquire SlotAcquirer) (*BenchmarkComparison, error) {
+	if len(req.Versions) == 0 {
+		return nil, fmt.Errorf("比較するバージョンを指定してください")
+	}
+	presets := req.EnvPresets
+	if len(presets) == 0 {
+		presets = []EnvPreset{{Name: "default"}}
+	}
+	if req.Count == 0 {
+		req.Count = defaultBenchmarkCount
+	}
+	if req.Bench == "" {
+		req.Bench = "."
+	}
+	if req.Benchtime == "" {
+		req.Benchtime = defaultBenchmarkBenchtime
+	}
+	runs := len(req.Versions) * len(presets) * req.Count
+	if req.Count < 0 || runs > maxBenchmarkRuns {
+		return nil, fmt.Errorf("実行回数が多すぎます（%d回、上限%d回）", runs, maxBenchmarkRuns)
+	}
+	seen := make(map[string]bool)
+	for _, v := range req.Versions {
+		if seen[v] {
+			return nil, fmt.Errorf("バージョンが重複しています: %s", v)
+		}
+		seen[v] = true
+	}
+	// 全実行がタイムアウトしても上限内に収まるように1回のタイムアウトを決める
+	if req.Timeout == 0 {
+		req.Timeout = min(maxBenchmarkDuration/time.Duration(runs), maxBenchmarkRunTimeout)
+	}
+	if total := req.Timeout * time.Duration(runs); total > maxBenchmarkDuration {
+		return nil, fmt.Errorf("実行時間の合計が上限を超えます（%d回 × %v、上限%v）", runs, req.Timeout, maxBenchmarkDuration)
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, maxBenchmarkDuration, errBenchmarkDeadline)
+	defer cancel()
+
+	base := req.ExecutionRequest
+	base.Mode = ModeTest
+	base.AutoDetect = false
+	base.FakeTime = false // 仮想時間では計測時間が意味を持たない
+	base.Trace = ""       // トレース・プロファイルの記録はベンチマークの計測に影響する
+	base.Profile = nil
+	base.Test = &TestOptions{Run: "^$", Bench: req.Bench, Benchtime: req.Benchtime, Count: 1, Benchmem: true}
+	if err := validateTestOptions(base.Test); err != nil {
+		return nil, err
+	}
+
+	comparison := &BenchmarkComparison{Alpha: benchmarkAlpha, Confidence: benchmarkConfidence}
+	for _, v := range req.Versions {
+		for _, preset := range presets {
+			comparison.Configs = append(comparison.Configs, BenchmarkConfig{
+				Version: v,
+				Preset:  preset.Name,
+				EnvVars: joinEnvVars(req.EnvVars, preset.EnvVars),
+			})
+		}
+	}
+
+	// 構成ごとの実行結果（ベンチマーク名 -> 単位 -> サンプル）
+	samples := make([]map[string]map[string][]float64, len(comparison.Configs))
+	for i := range samples {
+		samples[i] = make(map[string]map[string][]float64)
+	}
+	var order []string // ベンチマークの初出順
+	known := make(map[string]bool)
+
+	// 計測の公平性のため、構成を交互に1回ずつ実行する
+	for round := 0; round < req.Count; round++ {
+		for i := range comparison.Configs {
+			config := &comparison.Configs[i]
+			if config.Error != "" {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, context.Cause(ctx)
+			}
+
+			cellReq := base
+			cellReq.Version = config.Version
+			cellReq.EnvVars = config.EnvVars
+			result, err := e.executeBenchmarkRun(ctx, cellReq, acquire, round == 0)
+			if err != nil {
+				config.Error = err.Error()
+				continue
+			}
+			config.GoVersion = result.GoVersion
+			config.Runs++
+
+			for _, bench := range result.Test.Benchmarks {
+				if !known[bench.Name] {
+					known[bench.Name] = true
+					order = append(order, bench.Name)
+				}
+				addBenchmarkSamples(samples[i], bench)
+			}
+		}
+	}
+
+	comparison.Benchmarks = compareBenchmarks(order, samples)
+	return comparison, nil
+}
+
+// executeBenchmarkRun performs one -count=1 run and reports failures as errors
+func (e *Executor) executeBenchmarkRun(ctx context.Context, req ExecutionRequest, acquire SlotAcquirer, validate bool) (*ExecutionResult, error) {
+	if validate {
+		if err := e.ValidateRequest(req); err != nil {
+			return nil, fmt.Errorf("コード検証エラー: %w", err)
+		}
+	}
+	if acquire != nil {
+		release, err := acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	result, err := e.Runner().Execute(ctx, req)
+	switch {
+	case err != nil:
+		return nil, err
+	case result.Error != "":
+		return nil, fmt.Errorf("%s\n%s", result.Error, result.Output)
+	case result.Test == nil || len(result.Test.Benchmarks) == 0:
+		return nil, fmt.Errorf("ベンチマーク（Benchmark*）が実行されませんでした")
+	}
+	return result, nil
+}
+
+// addBenchmarkSamples records every metric of a benchmark result line
+func addBenchmarkSamples(dst map[string]map[string][]float64, bench BenchmarkResult) {
+	units := dst[bench.Name]
+	if units == nil {
+		units = make(map[string][]float64)
+		dst[bench.Name] = units
+	}
+	units["ns/op"] = append(units["ns/op"], bench.NsPerOp)
+	if bench.BytesPerOp != nil {
+		units["B/op"] = append(units["B/op"], *bench.BytesPerOp)
+	}
+	if bench.AllocsPerOp != nil {
+		units["allocs/op"] = append(units["allocs/op"], *bench.AllocsPerOp)
+	}
+	for unit, value := range bench.Metrics {
+		units[unit] = append(units[unit], value)
+	}
+}
+
+// compareBenchmarks builds one series per benchmark and unit, comparing every configuration with the first
+func compareBenchmarks(order []string, samples []map[string]map[string][]float64) []BenchmarkSeries {
+	series := []BenchmarkSeries{}
+	for _, name := range order {
+		for _, unit := range benchmarkUnits(name, samples) {
+			s := BenchmarkSeries{Name: name, Unit: unit, Stats: make([]BenchmarkStats, len(samples))}
+			baseline := samples[0][name][unit]
+			baseSummary := summarizeSample(baseline)
+
+			for i := range samples {
+				values := samples[i][name][unit]
+				stats := BenchmarkStats{N: len(values), Samples: values}
+				if len(values) == 0 {
+					stats.Samples = []float64{}
+					s.Stats[i] = stats
+					continue
+				}
+				summary := summarizeSample(values)
+				stats.Median = floatPtr(summary.Median)
+				stats.CILow = floatPtr(summary.Low)
+				stats.CIHigh = floatPtr(summary.High)
+				stats.CIConfidence = summary.Confidence
+
+				if i > 0 && len(baseline) > 0 {
+					if baseSummary.Median != 0 {
+						stats.DeltaPercent = floatPtr((summary.Median - baseSummary.Median) / baseSummary.Median * 100)
+					}
+					if p := mannWhitneyUTest(baseline, values); !math.IsNaN(p) {
+						stats.PValue = floatPtr(p)
+						stats.Significant = p < benchmarkAlpha
+					}
+				}
+				s.Stats[i] = stats
+			}
+			series = append(series, s)
+		}
+	}
+	return series
+}
+
+// benchmarkUnits returns the units measured for a benchmark in any configuration, ns/op first
+func benchmarkUnits(name string, samples []map[string]map[string][]float64) []string {
+	seen := make(map[string]bool)
+	for _, config := range samples {
+		for unit := range config[name] {
+			seen[unit] = true
+		}
+	}
+	units := make([]string, 0, len(seen))
+	for _, unit := range []string{"ns/op", "B/op", "allocs/op"} {
+		if seen[unit] {
+			units = append(units, unit)
+			delete(seen, unit)
+		}
+	}
+	extra := make([]string, 0, len(seen))
+	for unit := range seen {
+		extra = append(extra, unit)
+	}
+	sort.Strings(extra)
+	return append(units, extra...)
+}
+
+// floatPtr returns a pointer to a finite value, or nil for NaN/Inf (not representable in JSON)
+func floatPtr(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
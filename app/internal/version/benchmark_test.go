@@ -0,0 +1,58 @@
+package version
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteBenchmarkComparisonLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     BenchmarkRequest
+		wantErr string
+	}{
+		{"no versions", BenchmarkRequest{}, "バージョンを指定"},
+		{"duplicate versions", BenchmarkRequest{Versions: []string{"1.22", "1.23", "1.22"}}, "重複"},
+		{"too many runs", BenchmarkRequest{Versions: []string{"1.22", "1.23"}, Count: 17}, "実行回数"},
+		{"timeout over the budget", BenchmarkRequest{
+			ExecutionRequest: ExecutionRequest{Timeout: 30 * time.Second},
+			Versions:         []string{"1.22", "1.23"},
+		}, "実行時間"},
+	}
+	e := &Executor{policy: &Policy{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.ExecuteBenchmarkComparison(context.Background(), tt.req, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecuteBenchmarkComparisonDeadline(t *testing.T) {
+	// 実行枠の待ちも比較全体の上限に含まれる
+	var deadline time.Time
+	acquire := func(ctx context.Context) (func(), error) {
+		deadline, _ = ctx.Deadline()
+		return nil, errors.New("no slot")
+	}
+	e := &Executor{policy: &Policy{}}
+	comparison, err := e.ExecuteBenchmarkComparison(context.Background(), BenchmarkRequest{
+		ExecutionRequest: ExecutionRequest{Code: "package main\n"},
+		Versions:         []string{"1.22"},
+		Count:            1,
+	}, acquire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deadline.IsZero() || deadline.After(time.Now().Add(maxBenchmarkDuration)) {
+		t.Errorf("slot wait deadline = %v, want within %v", deadline, maxBenchmarkDuration)
+	}
+	if comparison.Configs[0].Error != "no slot" {
+		t.Errorf("config error = %q", comparison.Configs[0].Error)
+	}
+}
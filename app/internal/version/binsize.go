@@ -0,0 +1,470 @@
+// Package version - Binary size breakdown across toolchains
+//
+// The request is built with every selected toolchain. For each binary the
+// file size (also with -ldflags="-s -w"), the sizes of the sections stored in
+// the file and the symbol sizes reported by `go tool nm -size` are collected.
+// Symbols are summed up per package, and every version is diffed against the
+// first one so size regressions between releases are easy to spot.
+package version
+
+import (
+	"bufio"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSizeTop = 20
+	maxSizeTop     = 200
+	// maxSizeVersions limits the builds of one comparison
+	maxSizeVersions = 8
+
+	// otherPackage collects symbols that do not belong to a Go package (linker generated data, cgo)
+	otherPackage = "(other)"
+)
+
+// SizeRequest builds the request with several toolchains and compares the binaries
+type SizeRequest struct {
+	ExecutionRequest
+	Versions []string `json:"versions"`
+	Top      int      `json:"top,omitempty"` // シンボル・パッケージの表示件数（デフォルト 20）
+}
+
+// SectionSize is the size of one section stored in the binary file
+type SectionSize struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// SymbolSize is one symbol reported by go tool nm
+type SymbolSize struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // T: text, R: rodata, D: data, B: bss ...
+	Size    int64  `json:"size"`
+	Package string `json:"package"`
+}
+
+// PackageSize is the total size of a package's symbols
+type PackageSize struct {
+	Package string `json:"package"`
+	Size    int64  `json:"size"`
+	Symbols int    `json:"symbols"`
+}
+
+// SizeReport is the size breakdown of one toolchain's binary
+type SizeReport struct {
+	Version     string            `json:"version"`
+	GoVersion   string            `json:"go_version,omitempty"`
+	Format      string            `json:"format,omitempty"`   // "elf" / "macho" / "pe"
+	Total       int64             `json:"total"`              // バイナリのファイルサイズ
+	Stripped    int64             `json:"stripped,omitempty"` // -ldflags="-s -w" でのファイルサイズ
+	Sections    []SectionSize     `json:"sections"`
+	Packages    []PackageSize     `json:"packages"` // サイズの大きい順（上位 Top 件）
+	Symbols     []SymbolSize      `json:"symbols"`  // サイズの大きい順（上位 Top 件）
+	Diagnostics []Diagnostic      `json:"diagnostics,omitempty"`
+	Violations  []PolicyViolation `json:"violations,omitempty"`
+	Error       string            `json:"error,omitempty"`
+
+	// 差分計算用の全パッケージ・全シンボル
+	packages map[string]PackageSize
+	symbols  map[string]int64
+}
+
+// SizeDelta is the change of one size from the baseline
+type SizeDelta struct {
+	Name         string   `json:"name"`
+	Base         int64    `json:"base"`
+	Size         int64    `json:"size"`
+	Delta        int64    `json:"delta"`
+	DeltaPercent *float64 `json:"delta_percent,omitempty"` // 基準側が 0 の場合は省略
+}
+
+// SizeDiff compares one version's binary with the baseline
+type SizeDiff struct {
+	Version  string      `json:"version"`
+	Total    SizeDelta   `json:"total"`
+	Stripped SizeDelta   `json:"stripped"`
+	Sections []SizeDelta `json:"sections"`
+	Packages []SizeDelta `json:"packages"` // 変化の大きい順（上位 Top 件）
+	Symbols  []SizeDelta `json:"symbols"`  // 変化の大きい順（上位 Top 件）
+}
+
+// SizeComparison is the result of a binary size comparison
+type SizeComparison struct {
+	Arch     string       `json:"arch"`
+	Reports  []SizeReport `json:"reports"`  // Versions と同じ順序
+	Baseline string       `json:"baseline"` // 比較基準のバージョン（最初のバージョン）
+	Diffs    []SizeDiff   `json:"diffs,omitempty"`
+}
+
+// CompareBinarySizes builds req with every version and breaks down the binary sizes.
+// acquire (optional) is called before each build so comparisons share the execution scheduler.
+func (e *Executor) CompareBinarySizes(ctx context.Context, req SizeRequest, acquire SlotAcquirer) (*SizeComparison, error) {
+	if len(req.Versions) == 0 {
+		return nil, fmt.Errorf("比較するバージョンを指定してください")
+	}
+	if len(req.Versions) > maxSizeVersions {
+		return nil, fmt.Errorf("比較できるバージョンは最大 %d 個です", maxSizeVersions)
+	}
+	top := req.Top
+	if top <= 0 {
+		top = defaultSizeTop
+	}
+	top = min(top, maxSizeTop)
+
+	comparison := &SizeComparison{
+		Arch:     targetArch(userEnvironment(req.ExecutionRequest)),
+		Reports:  make([]SizeReport, 0, len(req.Versions)),
+		Baseline: req.Versions[0],
+	}
+	for _, v := range req.Versions {
+		build := req.ExecutionRequest
+		build.Version = v
+		build.AutoDetect = false
+
+		report, err := e.binarySize(ctx, build, acquire)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			report = &SizeReport{Sections: []SectionSize{}, Symbols: []SymbolSize{}, Error: err.Error()}
+			var policyErr *PolicyError
+			if errors.As(err, &policyErr) {
+				report.Violations = policyErr.Violations
+			}
+		}
+		report.Version = v
+		comparison.Reports = append(comparison.Reports, *report)
+	}
+
+	base := comparison.Reports[0]
+	if base.Error == "" {
+		for _, report := range comparison.Reports[1:] {
+			if report.Error != "" {
+				continue
+			}
+			comparison.Diffs = append(comparison.Diffs, diffSizes(base, report, top))
+		}
+	}
+	for i := range comparison.Reports {
+		report := &comparison.Reports[i]
+		report.Packages = topPackages(report.packages, top)
+		if len(report.Symbols) > top {
+			report.Symbols = report.Symbols[:top]
+		}
+	}
+	return comparison, nil
+}
+
+// binarySize validates and builds one version and analyzes the binary
+func (e *Executor) binarySize(ctx context.Context, req ExecutionRequest, acquire SlotAcquirer) (*SizeReport, error) {
+	// バージョン固有の検証もバージョンごとに行う
+	if err := e.ValidateRequest(req); err != nil {
+		return nil, fmt.Errorf("コード検証エラー: %w", err)
+	}
+	config, err := e.toolConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := requestWorkspace(req, config.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if acquire != nil {
+		release, err := acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	workDir, err := os.MkdirTemp("", "gosize_")
+	if err != nil {
+		return nil, fmt.Errorf("作業ディレクトリ作成エラー: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Printf("[WARN] binarySize: failed to remove temp dir %s: %v", workDir, err)
+		}
+	}()
+	srcDir := sourceDir(workDir)
+	if err := writeWorkspace(srcDir, ws.Files); err != nil {
+		return nil, fmt.Errorf("コードファイル作成エラー: %w", err)
+	}
+
+	if req.Timeout == 0 {
+		req.Timeout = defaultToolTimeout
+	}
+	if req.MaxOutputBytes <= 0 {
+		req.MaxOutputBytes = defaultOutputLimit()
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, req.Timeout, errExecutionTimeout)
+	defer cancel()
+
+	env := buildEnvironment(userEnvironment(req), ws)
+	report := &SizeReport{GoVersion: config.FullVersion, Sections: []SectionSize{}, Packages: []PackageSize{}, Symbols: []SymbolSize{}}
+
+	binary := filepath.Join(workDir, "main.bin")
+	output, err := sizeBuild(ctx, config.Path, srcDir, env, ws, binary, req.MaxOutputBytes)
+	if err != nil {
+		if errors.Is(err, errExecutionTimeout) {
+			return nil, fmt.Errorf("ビルドがタイムアウトしました (%v)", req.Timeout)
+		}
+		report.Diagnostics = parseDiagnostics(output, srcDir, DiagnosticBuild, config.FullVersion)
+		if len(report.Diagnostics) == 0 {
+			return nil, fmt.Errorf("ビルドエラー: %v: %s", err, strings.TrimSpace(output))
+		}
+		report.Error = fmt.Sprintf("ビルドエラー: %s", report.Diagnostics[0])
+		return report, nil
+	}
+
+	info, err := os.Stat(binary)
+	if err != nil {
+		return nil, fmt.Errorf("バイナリ読み込みエラー: %w", err)
+	}
+	report.Total = info.Size()
+	if report.Format, report.Sections, err = binarySections(binary); err != nil {
+		return nil, err
+	}
+
+	// シンボル表はストリップしていないバイナリから読む
+	// #nosec G204 - config.Path is from trusted configuration and the binary is in a private temp dir
+	nm := exec.CommandContext(ctx, config.Path, "tool", "nm", "-size", "-sort", "size", binary)
+	nm.Env = env
+	listing, err := nm.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go tool nm エラー: %w", err)
+	}
+	report.Symbols, report.symbols, report.packages = parseNMSizes(string(listing))
+
+	// ストリップ版はリンクのやり直しのみ（ビルドキャッシュを利用）
+	stripped := filepath.Join(workDir, "main.stripped")
+	if output, err := sizeBuild(ctx, config.Path, srcDir, env, ws, stripped, req.MaxOutputBytes, "-ldflags=-s -w"); err != nil {
+		log.Printf("[WARN] binarySize: stripped build failed: %v: %s", err, output)
+	} else if info, err := os.Stat(stripped); err == nil {
+		report.Stripped = info.Size()
+	}
+	return report, nil
+}
+
+// sizeBuild builds the workspace target (or its test binary) into binary
+func sizeBuild(ctx context.Context, goPath, srcDir string, env []string, ws *workspace, binary string, limit int64, flags ...string) (string, error) {
+	args := append([]string{"build", "-o", binary}, flags...)
+	if ws.Test {
+		args = append([]string{"test", "-c", "-o", binary}, flags...)
+	}
+	// #nosec G204 - goPath is from trusted configuration and paths are in a private temp dir
+	cmd := exec.Command(goPath, append(args, ws.Target)...)
+	cmd.Dir = srcDir
+	cmd.Env = env
+
+	rec := newOutputRecorder(limit, nil)
+	build := runCommand(ctx, cmd, nil, rec)
+	output := rec.Snapshot().Combined
+	if build.Status == StatusTimeout {
+		return output, errExecutionTimeout
+	}
+	return output, build.Err
+}
+
+// binarySections returns the file format and the sections that occupy space in the file, largest first.
+// Zero-fill sections (.bss, .noptrbss) only exist in memory and are left out.
+func binarySections(path string) (string, []SectionSize, error) {
+	var format string
+	var sections []SectionSize
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		format = "elf"
+		for _, s := range f.Sections {
+			if s.Type != elf.SHT_NOBITS && s.Type != elf.SHT_NULL && s.Size > 0 {
+				sections = append(sections, SectionSize{Name: s.Name, Size: int64(s.Size)})
+			}
+		}
+	} else if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		format = "macho"
+		const zeroFill = 0x1 // S_ZEROFILL
+		for _, s := range f.Sections {
+			if s.Flags&0xff != zeroFill && s.Size > 0 {
+				sections = append(sections, SectionSize{Name: s.Seg + "," + s.Name, Size: int64(s.Size)})
+			}
+		}
+	} else if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		format = "pe"
+		for _, s := range f.Sections {
+			if s.Size > 0 {
+				sections = append(sections, SectionSize{Name: s.Name, Size: int64(s.Size)})
+			}
+		}
+	} else {
+		return "", nil, fmt.Errorf("未対応のバイナリ形式です: %s", filepath.Base(path))
+	}
+
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].Size > sections[j].Size })
+	return format, sections, nil
+}
+
+// parseNMSizes parses `go tool nm -size -sort size` output ("  addr size type name").
+// It returns the symbols largest first and the size per symbol and per package.
+// Undefined symbols and bss (no space in the file) are not counted.
+func parseNMSizes(output string) ([]SymbolSize, map[string]int64, map[string]PackageSize) {
+	symbols := []SymbolSize{}
+	bySymbol := make(map[string]int64)
+	byPackage := make(map[string]PackageSize)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+		kind := fields[2]
+		if kind == "U" || strings.EqualFold(kind, "B") {
+			continue
+		}
+		// シンボル名には空白を含むものがある（例: 型名の struct { ... }）
+		name := strings.Join(fields[3:], " ")
+		symbol := SymbolSize{Name: name, Type: kind, Size: size, Package: symbolPackage(name)}
+		symbols = append(symbols, symbol)
+		bySymbol[name] += size
+		pkg := byPackage[symbol.Package]
+		pkg.Package = symbol.Package
+		pkg.Size += size
+		pkg.Symbols++
+		byPackage[symbol.Package] = pkg
+	}
+	sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].Size > symbols[j].Size })
+	return symbols, bySymbol, byPackage
+}
+
+// symbolPackage returns the import path a symbol belongs to:
+// "net/http.(*Client).Do" -> "net/http", "type:*main.T" -> "main", "go:string.*" -> "(other)"
+func symbolPackage(name string) string {
+	for _, prefix := range []string{"type:", "go:itab.", "go:info."} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	name = strings.TrimLeft(name, "*")
+	if strings.HasPrefix(name, "go:") || strings.HasPrefix(name, "_") {
+		return otherPackage
+	}
+
+	// 型引数・レシーバ内のパスは対象外（例: "main.F[net/http.Client]"）
+	path := name
+	if i := strings.IndexAny(path, "[(, "); i >= 0 {
+		path = path[:i]
+	}
+	slash := strings.LastIndex(path, "/")
+	dot := strings.Index(path[slash+1:], ".")
+	if dot <= 0 {
+		return otherPackage
+	}
+	return path[:slash+1+dot]
+}
+
+// topPackages returns the largest packages
+func topPackages(sizes map[string]PackageSize, top int) []PackageSize {
+	packages := make([]PackageSize, 0, len(sizes))
+	for _, pkg := range sizes {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Size != packages[j].Size {
+			return packages[i].Size > packages[j].Size
+		}
+		return packages[i].Package < packages[j].Package
+	})
+	if len(packages) > top {
+		packages = packages[:top]
+	}
+	return packages
+}
+
+// diffSizes compares a report with the baseline report
+func diffSizes(base, other SizeReport, top int) SizeDiff {
+	baseSections := make(map[string]int64, len(base.Sections))
+	for _, s := range base.Sections {
+		baseSections[s.Name] = s.Size
+	}
+	otherSections := make(map[string]int64, len(other.Sections))
+	for _, s := range other.Sections {
+		otherSections[s.Name] = s.Size
+	}
+
+	return SizeDiff{
+		Version:  other.Version,
+		Total:    sizeDelta("total", base.Total, other.Total),
+		Stripped: sizeDelta("stripped", base.Stripped, other.Stripped),
+		Sections: diffSizeMaps(baseSections, otherSections, 0),
+		Packages: diffSizeMaps(packageSizes(base.packages), packageSizes(other.packages), top),
+		Symbols:  diffSizeMaps(base.symbols, other.symbols, top),
+	}
+}
+
+// packageSizes returns the total size per package
+func packageSizes(packages map[string]PackageSize) map[string]int64 {
+	sizes := make(map[string]int64, len(packages))
+	for name, pkg := range packages {
+		sizes[name] = pkg.Size
+	}
+	return sizes
+}
+
+// diffSizeMaps returns the changed entries, largest change first (all of them when top is 0)
+func diffSizeMaps(base, other map[string]int64, top int) []SizeDelta {
+	deltas := []SizeDelta{}
+	for name, size := range base {
+		if other[name] != size {
+			deltas = append(deltas, sizeDelta(name, size, other[name]))
+		}
+	}
+	for name, size := range other {
+		if _, ok := base[name]; !ok {
+			deltas = append(deltas, sizeDelta(name, 0, size))
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		a, b := abs64(deltas[i].Delta), abs64(deltas[j].Delta)
+		if a != b {
+			return a > b
+		}
+		return deltas[i].Name < deltas[j].Name
+	})
+	if top > 0 && len(deltas) > top {
+		deltas = deltas[:top]
+	}
+	return deltas
+}
+
+func sizeDelta(name string, base, size int64) SizeDelta {
+	delta := SizeDelta{Name: name, Base: base, Size: size, Delta: size - base}
+	if base != 0 {
+		percent := float64(delta.Delta) / float64(base) * 100
+		delta.DeltaPercent = &percent
+	}
+	return delta
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,342 @@
+// Package version - Content-addressed cache of compiled snippet binaries
+//
+// Binaries are stored under a key derived from the source files, the
+// toolchain (path and full version), the user environment and the build
+// flags, so pressing Run on an unmodified lesson skips compilation.
+// The cache is bounded by total size and evicts least recently used
+// entries; entries in use by a running execution are never evicted.
+//
+// Environment variables:
+// - BUILD_CACHE_DIR: cache directory (default: <user cache dir>/go-release-tour/builds)
+// - BUILD_CACHE_MAX_BYTES: maximum total size (default: 512MiB)
+package version
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBuildCacheMaxBytes = 512 << 20
+	cachedBinaryName          = "main"
+)
+
+// buildKeyInput describes everything that influences a compiled binary
+type buildKeyInput struct {
+	Files       map[string][]byte
+	Target      string
+	Test        bool
+	GoPath      string
+	FullVersion string
+	Env         []string
+	Flags       []string
+}
+
+// buildCacheKey returns the content address for a build
+func buildCacheKey(in buildKeyInput) string {
+	h := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			fmt.Fprintf(h, "%d:%s;", len(part), part)
+		}
+	}
+
+	write("toolchain", in.GoPath, in.FullVersion, runtime.GOOS, runtime.GOARCH)
+
+	names := make([]string, 0, len(in.Files))
+	for name := range in.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write("file", name, string(in.Files[name]))
+	}
+	write("target", in.Target, strconv.FormatBool(in.Test))
+
+	env := append([]string(nil), in.Env...)
+	sort.Strings(env)
+	write(append([]string{"env"}, env...)...)
+	write(append([]string{"flags"}, in.Flags...)...)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// buildCacheEntry is a cached binary
+type buildCacheEntry struct {
+	size     int64
+	lastUsed time.Time
+	inUse    int
+}
+
+// BuildCache stores compiled binaries on disk
+type BuildCache struct {
+	dir      string
+	maxBytes int64
+
+	mutex    sync.Mutex
+	entries  map[string]*buildCacheEntry
+	total    int64
+	building map[string]*buildLock
+}
+
+// buildLock serializes the builds of one key
+type buildLock struct {
+	sync.Mutex
+	refs int // ロックを保持または待機している数（c.mutex で保護）
+}
+
+// NewBuildCache creates a cache in dir bounded by maxBytes and indexes existing entries
+func NewBuildCache(dir string, maxBytes int64) (*BuildCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("ビルドキャッシュディレクトリ作成エラー: %w", err)
+	}
+
+	c := &BuildCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*buildCacheEntry),
+		building: make(map[string]*buildLock),
+	}
+
+	// 既存のエントリを読み込み（更新時刻をLRUの基準にする）
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ビルドキャッシュ読み込みエラー: %w", err)
+	}
+	for _, d := range dirEntries {
+		if !d.IsDir() {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, d.Name(), cachedBinaryName))
+		if err != nil {
+			// 不完全なエントリは削除
+			_ = os.RemoveAll(filepath.Join(dir, d.Name()))
+			continue
+		}
+		c.entries[d.Name()] = &buildCacheEntry{size: info.Size(), lastUsed: info.ModTime()}
+		c.total += info.Size()
+	}
+
+	c.mutex.Lock()
+	c.evictLocked()
+	c.mutex.Unlock()
+
+	return c, nil
+}
+
+// binaryPath returns where the binary for key is stored
+func (c *BuildCache) binaryPath(key string) string {
+	return filepath.Join(c.dir, key, cachedBinaryName)
+}
+
+// lockKey serializes builds of the same key so concurrent identical requests compile once.
+// The lock is removed when its last holder unlocks, so failed builds leave nothing behind.
+func (c *BuildCache) lockKey(key string) func() {
+	c.mutex.Lock()
+	l, ok := c.building[key]
+	if !ok {
+		l = &buildLock{}
+		c.building[key] = l
+	}
+	l.refs++
+	c.mutex.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		c.mutex.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(c.building, key)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// Acquire returns the cached binary for key and pins it until release is called
+func (c *BuildCache) Acquire(key string) (string, func(), bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", nil, false
+	}
+	entry.inUse++
+	entry.lastUsed = time.Now()
+	path := c.binaryPath(key)
+	_ = os.Chtimes(path, entry.lastUsed, entry.lastUsed)
+
+	return path, c.releaseFunc(key), true
+}
+
+// Put copies a freshly built binary into the cache and pins it like Acquire.
+// The work directory is usually on another filesystem (tmpfs), so the binary
+// is copied into the entry directory and renamed there.
+func (c *BuildCache) Put(key, builtBinary string) (string, func(), error) {
+	info, err := os.Stat(builtBinary)
+	if err != nil {
+		return "", nil, fmt.Errorf("ビルド成果物が見つかりません: %w", err)
+	}
+
+	entryDir := filepath.Join(c.dir, key)
+	if err := os.MkdirAll(entryDir, 0o700); err != nil {
+		return "", nil, fmt.Errorf("キャッシュエントリ作成エラー: %w", err)
+	}
+	path := c.binaryPath(key)
+	if err := copyBinary(builtBinary, path); err != nil {
+		// 不完全なエントリを残さない
+		_ = os.RemoveAll(entryDir)
+		return "", nil, fmt.Errorf("キャッシュへの保存エラー: %w", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	inUse := 1
+	if old, ok := c.entries[key]; ok {
+		c.total -= old.size
+		inUse += old.inUse
+	}
+	c.entries[key] = &buildCacheEntry{size: info.Size(), lastUsed: time.Now(), inUse: inUse}
+	c.total += info.Size()
+	c.evictLocked()
+
+	return path, c.releaseFunc(key), nil
+}
+
+// copyBinary copies src to dst through a synced temporary file in the directory of dst,
+// so dst is either absent or complete even after a crash
+func copyBinary(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), cachedBinaryName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, in)
+	if err == nil {
+		err = tmp.Chmod(0o700)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// releaseFunc unpins an entry
+func (c *BuildCache) releaseFunc(key string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			if entry, ok := c.entries[key]; ok && entry.inUse > 0 {
+				entry.inUse--
+			}
+			c.evictLocked()
+		})
+	}
+}
+
+// evictLocked removes least recently used, unpinned entries until the cache fits
+func (c *BuildCache) evictLocked() {
+	if c.maxBytes <= 0 || c.total <= c.maxBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastUsed.Before(c.entries[keys[j]].lastUsed)
+	})
+
+	for _, key := range keys {
+		if c.total <= c.maxBytes {
+			return
+		}
+		entry := c.entries[key]
+		if entry.inUse > 0 {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.dir, key)); err != nil {
+			log.Printf("BuildCache: failed to evict %s: %v", key, err)
+			continue
+		}
+		c.total -= entry.size
+		delete(c.entries, key)
+	}
+}
+
+// Stats returns cache usage for status reporting
+func (c *BuildCache) Stats() map[string]interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return map[string]interface{}{
+		"dir":         c.dir,
+		"entries":     len(c.entries),
+		"total_bytes": c.total,
+		"max_bytes":   c.maxBytes,
+	}
+}
+
+var (
+	globalBuildCache     *BuildCache
+	globalBuildCacheOnce sync.Once
+)
+
+// GetBuildCache returns the process-wide build cache, or nil if it cannot be created
+func GetBuildCache() *BuildCache {
+	globalBuildCacheOnce.Do(func() {
+		dir := os.Getenv("BUILD_CACHE_DIR")
+		if dir == "" {
+			base, err := os.UserCacheDir()
+			if err != nil {
+				base = os.TempDir()
+			}
+			dir = filepath.Join(base, "go-release-tour", "builds")
+		}
+
+		maxBytes := int64(defaultBuildCacheMaxBytes)
+		if value := os.Getenv("BUILD_CACHE_MAX_BYTES"); value != "" {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				maxBytes = n
+			}
+		}
+
+		cache, err := NewBuildCache(dir, maxBytes)
+		if err != nil {
+			log.Printf("[WARN] BuildCache: disabled: %v", err)
+			return
+		}
+		globalBuildCache = cache
+		log.Printf("BuildCache: %s (max %d bytes)", dir, maxBytes)
+	})
+	return globalBuildCache
+}
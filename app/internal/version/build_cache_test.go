@@ -0,0 +1,83 @@
+package version
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildCacheWorkDir returns a work directory on another filesystem than the cache when possible,
+// like a work directory on a tmpfs /tmp and a cache in the user cache dir
+func buildCacheWorkDir(t *testing.T) string {
+	t.Helper()
+	if dir, err := os.MkdirTemp("/dev/shm", workDirPrefix); err == nil {
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		return dir
+	}
+	return t.TempDir()
+}
+
+func TestBuildCachePut(t *testing.T) {
+	workDir := buildCacheWorkDir(t)
+	cacheDir := t.TempDir()
+	cache, err := NewBuildCache(cacheDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	built := filepath.Join(workDir, "main")
+	if err := os.WriteFile(built, []byte("binary"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	path, release, err := cache.Put("key", built)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	release()
+
+	if data, err := os.ReadFile(path); err != nil || string(data) != "binary" {
+		t.Fatalf("cached binary = %q, %v", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("cached binary is not executable: %v, %v", info.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("entry directory has %d files, want only the binary", len(entries))
+	}
+
+	if _, release, ok := cache.Acquire("key"); !ok {
+		t.Error("Acquire after Put missed")
+	} else {
+		release()
+	}
+
+	// 再起動後もキャッシュが残る
+	reopened, err := NewBuildCache(cacheDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, release, ok := reopened.Acquire("key"); !ok {
+		t.Error("Acquire after reopening missed")
+	} else {
+		release()
+	}
+}
+
+func TestBuildCachePutFailure(t *testing.T) {
+	cacheDir := t.TempDir()
+	cache, err := NewBuildCache(cacheDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ディレクトリはコピーできない
+	if _, _, err := cache.Put("key", t.TempDir()); err == nil {
+		t.Fatal("Put of a directory succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "key")); !os.IsNotExist(err) {
+		t.Errorf("failed Put left the entry directory: %v", err)
+	}
+	if _, _, ok := cache.Acquire("key"); ok {
+		t.Error("Acquire after a failed Put hit")
+	}
+}
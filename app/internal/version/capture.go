@@ -0,0 +1,212 @@
+// Package version - Files captured from the running program (traces, profiles)
+//
+// Some execution options need data that only the program itself can produce,
+// such as an execution trace. For these the request's main function is
+// renamed and a generated file in the same package provides a new main that
+// sets up each capture, calls the original main and finishes the captures
+// when it returns (or panics). Every capture is written to an inherited file
+// descriptor (3, 4, ...) backed by a file in the host's work directory, so it
+// also works inside the namespace sandbox, whose filesystem is private.
+package version
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// captureMainName is the new name of the request's main function
+	captureMainName = "tourUserMain"
+	// captureWrapperFile is the generated file providing the wrapping main
+	captureWrapperFile = "zz_tour_capture.go"
+	// captureFirstFD is the file descriptor of the first capture (after stdin, stdout and stderr)
+	captureFirstFD = 3
+	// maxCaptureBytes limits the size of one capture read back from the program
+	maxCaptureBytes = 32 << 20
+)
+
+// Capture is a file the program produced for an execution option.
+// The data is not part of the JSON result; the API stores it and returns a download URL instead.
+type Capture struct {
+	Kind      string `json:"kind"` // CaptureTrace, ProfileCPU, ProfileHeap
+	Data      []byte `json:"-"`
+	Size      int64  `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"` // maxCaptureBytes を超えたため途中までか
+}
+
+// captureHook is the code one capture adds to the generated main.
+// Setup runs before the request's main with f (*os.File) open for writing the capture;
+// it may defer the code that finishes the capture.
+type captureHook struct {
+	Kind    string
+	Imports []string
+	Setup   string
+}
+
+// captureHooks returns the captures requested by the execution options
+func captureHooks(req ExecutionRequest, config *VersionConfig) ([]captureHook, error) {
+	var hooks []captureHook
+	if req.Trace != "" {
+		hook, err := traceHook(req.Trace, config)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	seen := make(map[string]bool)
+	for _, kind := range req.Profile {
+		if seen[kind] {
+			continue
+		}
+		seen[kind] = true
+		hook, err := profileHook(kind)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// instrumentMain renames the main function of the workspace target and adds the wrapping main
+func instrumentMain(ws *workspace, hooks []captureHook) error {
+	if ws.Test {
+		return fmt.Errorf("トレース・プロファイルは実行モード（mode: run）でのみ取得できます")
+	}
+
+	dir := path.Clean(strings.TrimPrefix(ws.Target, "./"))
+	names := make([]string, 0, len(ws.Files))
+	for name := range ws.Files {
+		if isGoSource(name) && path.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	renamed := false
+	for _, name := range names {
+		if source, ok := renameMain(name, ws.Files[name]); ok {
+			ws.Files[name] = source
+			renamed = true
+			break
+		}
+	}
+	if !renamed {
+		// main がない・構文エラーの場合はそのままビルドし、位置付きのビルドエラーとして報告する
+		return nil
+	}
+
+	wrapper, err := captureWrapper(hooks)
+	if err != nil {
+		return err
+	}
+	ws.Files[path.Join(dir, captureWrapperFile)] = wrapper
+	return nil
+}
+
+// renameMain renames func main in source. Only the identifier is replaced,
+// so every other position in the file (and its diagnostics) stays the same.
+func renameMain(name string, source []byte) ([]byte, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, source, parser.SkipObjectResolution)
+	if err != nil || file.Name.Name != "main" {
+		return nil, false
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != "main" {
+			continue
+		}
+		offset := fset.Position(fn.Name.Pos()).Offset
+		var renamed bytes.Buffer
+		renamed.Write(source[:offset])
+		renamed.WriteString(captureMainName)
+		renamed.Write(source[offset+len("main"):])
+		return renamed.Bytes(), true
+	}
+	return nil, false
+}
+
+// captureWrapper generates the main that runs the hooks around the request's main
+func captureWrapper(hooks []captureHook) ([]byte, error) {
+	imports := map[string]bool{"os": true}
+	for _, hook := range hooks {
+		for _, imp := range hook.Imports {
+			imports[imp] = true
+		}
+	}
+	paths := make([]string, 0, len(imports))
+	for imp := range imports {
+		paths = append(paths, imp)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	b.WriteString("// Code generated by go-release-tour for execution captures. DO NOT EDIT.\n\npackage main\n\nimport (\n")
+	for _, imp := range paths {
+		fmt.Fprintf(&b, "\t%q\n", imp)
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+	for i, hook := range hooks {
+		fmt.Fprintf(&b, "\t{\n\t\tf := os.NewFile(%d, %q)\n%s\n\t}\n", captureFirstFD+i, hook.Kind, hook.Setup)
+	}
+	fmt.Fprintf(&b, "\t%s()\n}\n", captureMainName)
+
+	source, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("キャプチャ用コードの生成エラー: %w", err)
+	}
+	return source, nil
+}
+
+// openCaptures creates the host files behind the capture file descriptors, in hook order
+func openCaptures(workDir string, hooks []captureHook) ([]*os.File, error) {
+	files := make([]*os.File, 0, len(hooks))
+	for _, hook := range hooks {
+		f, err := os.OpenFile(filepath.Join(workDir, "capture-"+hook.Kind), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o600)
+		if err != nil {
+			closeCaptures(files)
+			return nil, fmt.Errorf("キャプチャファイル作成エラー: %w", err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// readCaptures reads back what the program wrote. Empty captures (e.g. the program called os.Exit) are left out.
+func readCaptures(hooks []captureHook, files []*os.File) []Capture {
+	captures := make([]Capture, 0, len(files))
+	for i, f := range files {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxCaptureBytes+1))
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		capture := Capture{Kind: hooks[i].Kind, Data: data}
+		if len(data) > maxCaptureBytes {
+			capture.Data = data[:maxCaptureBytes]
+			capture.Truncated = true
+		}
+		capture.Size = int64(len(capture.Data))
+		captures = append(captures, capture)
+	}
+	return captures
+}
+
+func closeCaptures(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,96 @@
+// Package version - Structured compiler diagnostics
+//
+// Output of the go command ("./main.go:5:2: undefined: x") is parsed into
+// diagnostics whose file names are the request's own relative paths, so the
+// editor can mark the exact lines. Indented continuation lines (e.g. the
+// have/want lines of a type error) are appended to the preceding message.
+package version
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic sources
+const (
+	DiagnosticBuild = "build"
+	DiagnosticVet   = "vet"
+)
+
+// Diagnostic is a compiler or vet message with its position
+type Diagnostic struct {
+	File      string `json:"file"` // リクエスト内の相対パス（例: "main.go", "greet/greet.go"）
+	Line      int    `json:"line"`
+	Column    int    `json:"column,omitempty"`
+	Message   string `json:"message"`
+	Source    string `json:"source"`             // "build" / "vet"
+	Category  string `json:"category,omitempty"` // vet のアナライザー名（例: "printf"）
+	Toolchain string `json:"toolchain"`          // 診断を出力したGoの完全バージョン
+}
+
+// String formats the diagnostic like the go command
+func (d Diagnostic) String() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
+
+// diagnosticPattern matches "file.go:line[:col]: message" (optionally prefixed by "vet: ")
+var diagnosticPattern = regexp.MustCompile(`^(?:vet: )?(\S+?\.(?:go|mod|work|s)):(\d+)(?::(\d+))?: (.*)$`)
+
+// parseDiagnostics extracts positioned messages from go command output.
+// Paths below srcDir are reported relative to it, matching the request's file names.
+func parseDiagnostics(output, srcDir, source, toolchain string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		m := diagnosticPattern.FindStringSubmatch(line)
+		if m == nil {
+			// 型エラーの have/want などの継続行
+			if len(diagnostics) > 0 && (strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ")) {
+				last := &diagnostics[len(diagnostics)-1]
+				last.Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		diagnostics = append(diagnostics, Diagnostic{
+			File:      requestFileName(m[1], srcDir),
+			Line:      lineNo,
+			Column:    column,
+			Message:   m[4],
+			Source:    source,
+			Toolchain: toolchain,
+		})
+	}
+	return diagnostics
+}
+
+// requestFileName maps a path printed by the go command to the request's relative file name
+func requestFileName(name, srcDir string) string {
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(srcDir, name)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return name // GOROOT などリクエスト外のファイル
+		}
+		name = rel
+	}
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// buildErrorMessage summarizes failed build diagnostics for ExecutionResult.Error
+func buildErrorMessage(diagnostics []Diagnostic) string {
+	message := "ビルドエラー: " + diagnostics[0].String()
+	if first, _, found := strings.Cut(message, "\n"); found {
+		message = first
+	}
+	if len(diagnostics) > 1 {
+		message += fmt.Sprintf("（他%d件）", len(diagnostics)-1)
+	}
+	return message
+}
@@ -5,63 +5,158 @@
 package version
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
 
 // ExecutionRequest represents a code execution request
 type ExecutionRequest struct {
-	Code          string            `json:"code"`
-	Version       string            `json:"version,omitempty"`        // 明示的なバージョン指定
-	AutoDetect    bool              `json:"auto_detect,omitempty"`    // コードからバージョン自動検出
-	Timeout       time.Duration     `json:"timeout,omitempty"`        // 実行タイムアウト
-	Environment   map[string]string `json:"environment,omitempty"`    // 環境変数
-	EnvVars       string            `json:"env_vars,omitempty"`       // 環境変数文字列（例: "GOEXPERIMENT=jsonv2"）
-	WorkingDir    string            `json:"working_dir,omitempty"`    // 作業ディレクトリ
-	StrictVersion bool              `json:"strict_version,omitempty"` // 厳密なバージョンチェック
+	Code           string            `json:"code"`
+	Version        string            `json:"version,omitempty"`          // 明示的なバージョン指定
+	AutoDetect     bool              `json:"auto_detect,omitempty"`      // コードからバージョン自動検出
+	Timeout        time.Duration     `json:"timeout,omitempty"`          // 実行タイムアウト
+	Environment    map[string]string `json:"environment,omitempty"`      // 環境変数
+	EnvVars        string            `json:"env_vars,omitempty"`         // 環境変数文字列（例: "GOEXPERIMENT=jsonv2"）
+	WorkingDir     string            `json:"working_dir,omitempty"`      // 作業ディレクトリ
+	StrictVersion  bool              `json:"strict_version,omitempty"`   // 厳密なバージョンチェック
+	MaxOutputBytes int64             `json:"max_output_bytes,omitempty"` // stdout+stderrの合計上限（0ならMAX_OUTPUT_BYTES）
+	Files          map[string]string `json:"files,omitempty"`            // 複数ファイル（相対パス -> 内容。go.mod/go.work/データファイルも可）
+	Package        string            `json:"package,omitempty"`          // 実行するパッケージ（例: "./cmd/app"。省略時はmainパッケージを自動選択）
+	Mode           string            `json:"mode,omitempty"`             // "run"（デフォルト）/ "test"
+	Test           *TestOptions      `json:"test,omitempty"`             // テストモードのオプション
+	FakeTime       bool              `json:"fake_time,omitempty"`        // 仮想時間で実行（-tags=faketime。time.Sleep が即座に進む）
+	Trace          string            `json:"trace,omitempty"`            // 実行トレースの取得: "trace"（全体）/ "flight"（フライトレコーダー。Go 1.25以降）
+	Profile        []string          `json:"profile,omitempty"`          // 取得するプロファイル: "cpu" / "heap"
 }
 
 // ExecutionResult represents the result of code execution
 type ExecutionResult struct {
-	Output          string        `json:"output"`
-	Error           string        `json:"error,omitempty"`
-	ExitCode        int           `json:"exit_code"`
-	ExecutionTime   time.Duration `json:"execution_time"`
-	GoVersion       string        `json:"go_version"`
-	UsedVersion     string        `json:"used_version"`               // 実際に使用されたバージョン
-	DetectedVersion string        `json:"detected_version,omitempty"` // 検出されたバージョン
-	VersionPath     string        `json:"version_path,omitempty"`     // 使用されたGoバイナリのパス
+	Output          string            `json:"output"` // stdoutとstderrを出力順に結合したもの
+	Stdout          string            `json:"stdout"`
+	Stderr          string            `json:"stderr"`
+	Events          []OutputEvent     `json:"events,omitempty"`    // 出力順を保持したstdout/stderrのチャンク
+	Truncated       bool              `json:"truncated,omitempty"` // 出力上限により切り詰められたか
+	Error           string            `json:"error,omitempty"`
+	ExitCode        int               `json:"exit_code"`
+	ExecutionTime   time.Duration     `json:"execution_time"`
+	GoVersion       string            `json:"go_version"`
+	UsedVersion     string            `json:"used_version"`               // 実際に使用されたバージョン
+	DetectedVersion string            `json:"detected_version,omitempty"` // 検出されたバージョン
+	VersionPath     string            `json:"version_path,omitempty"`     // 使用されたGoバイナリのパス
+	Sandbox         string            `json:"sandbox,omitempty"`          // 使用されたサンドボックス
+	Status          string            `json:"status"`                     // success / error / timeout / canceled
+	CacheHit        bool              `json:"cache_hit"`                  // ビルドキャッシュを利用したか
+	CompileTime     time.Duration     `json:"compile_time"`               // コンパイル時間（キャッシュ参照を含む）
+	RunTime         time.Duration     `json:"run_time"`                   // 実行時間
+	Test            *TestReport       `json:"test,omitempty"`             // テストモードの構造化された結果
+	Violations      []PolicyViolation `json:"violations,omitempty"`       // コードポリシー違反（位置付き）
+	BuildOutput     string            `json:"build_output,omitempty"`     // go build / go test -c の出力（Output には含まない）
+	Diagnostics     []Diagnostic      `json:"diagnostics,omitempty"`      // BuildOutput から抽出した位置付きのメッセージ
+	TimedEvents     []TimedEvent      `json:"timed_events,omitempty"`     // 仮想時間モードの出力（仮想時刻付き。再生用）
+	VirtualTime     time.Duration     `json:"virtual_time,omitempty"`     // 仮想時間モードで最後の出力までに経過した仮想時間
+	Captures        []Capture         `json:"captures,omitempty"`         // プログラムが書き出した実行トレース・プロファイル（データはJSONに含まない）
 }
 
+// StreamHandlers receives incremental events of a streaming execution
+type StreamHandlers struct {
+	Stdin    io.Reader                        // 実行中プログラムの標準入力（nil可）
+	OnOutput func(stream string, data []byte) // "stdout" / "stderr" の出力チャンク（呼び出し中のみ有効）
+	OnPhase  func(phase string)               // "compiling" / "running"
+}
+
+// Execution phases reported to StreamHandlers.OnPhase
+const (
+	PhaseCompiling = "compiling"
+	PhaseRunning   = "running"
+)
+
+// workDirPrefix is the name prefix of the per-execution temporary directories
+const workDirPrefix = "gocode_"
+
 // Executor handles Go code execution with version management
 type Executor struct {
 	manager *Manager
+	sandbox Sandbox
+	cache   *BuildCache
+	policy  *Policy
+	remote  *RemoteRunner // nil なら実行はこのプロセスで行う
 }
 
-// NewExecutor creates a new code executor
+// NewExecutor creates a new code executor using the process-wide sandbox.
+// Executions are dispatched to the runner processes of RUNNER_URLS, if set.
 func NewExecutor() *Executor {
+	e := NewExecutorWithSandbox(GetSandbox())
+	e.remote = GetRemoteRunner()
+	return e
+}
+
+// NewExecutorWithSandbox creates a code executor that runs binaries through the given sandbox
+func NewExecutorWithSandbox(sandbox Sandbox) *Executor {
 	return &Executor{
 		manager: GetManager(),
+		sandbox: sandbox,
+		cache:   GetBuildCache(),
+		policy:  GetPolicy(),
 	}
 }
 
-// Execute runs Go code with the appropriate version
-func (e *Executor) Execute(req ExecutionRequest) (*ExecutionResult, error) {
+// Execute runs Go code with the appropriate version.
+// Cancelling ctx (e.g. when the HTTP client disconnects) kills the whole process group.
+func (e *Executor) Execute(ctx context.Context, req ExecutionRequest) (*ExecutionResult, error) {
+	return e.execute(ctx, req, nil)
+}
+
+// Runner returns where executions run: the remote runners if configured, otherwise the executor itself.
+// Tools such as Format and Vet always run in-process.
+func (e *Executor) Runner() Runner {
+	if e.remote != nil {
+		return e.remote
+	}
+	return e
+}
+
+// ExecuteStream runs Go code like Execute but delivers output as it is produced
+// and feeds the program's standard input from handlers.Stdin.
+func (e *Executor) ExecuteStream(ctx context.Context, req ExecutionRequest, handlers StreamHandlers) (*ExecutionResult, error) {
+	return e.execute(ctx, req, &handlers)
+}
+
+// execute is the shared implementation of Execute and ExecuteStream
+func (e *Executor) execute(ctx context.Context, req ExecutionRequest, stream *StreamHandlers) (*ExecutionResult, error) {
 	startTime := time.Now()
 
 	// デフォルト値の設定
 	if req.Timeout == 0 {
 		req.Timeout = 30 * time.Second
 	}
+	if req.MaxOutputBytes <= 0 {
+		req.MaxOutputBytes = defaultOutputLimit()
+	}
 
-	result := &ExecutionResult{}
+	result := &ExecutionResult{Status: StatusError}
+
+	// 実行モードの検証
+	switch req.Mode {
+	case "", ModeRun:
+	case ModeTest:
+		if err := validateTestOptions(req.Test); err != nil {
+			result.Error = err.Error()
+			return result, err
+		}
+	default:
+		err := fmt.Errorf("不明な実行モードです: %q", req.Mode)
+		result.Error = err.Error()
+		return result, err
+	}
 
 	// バージョンの決定
 	targetVersion, err := e.determineVersion(req)
@@ -88,6 +183,7 @@ func (e *Executor) Execute(req ExecutionRequest) (*ExecutionResult, error) {
 
 	result.VersionPath = versionConfig.Path
 	result.GoVersion = versionConfig.FullVersion
+	result.Sandbox = e.sandbox.Name()
 
 	// 厳密なバージョンチェック
 	if req.StrictVersion && req.Version != "" && req.Version != targetVersion {
@@ -96,15 +192,62 @@ func (e *Executor) Execute(req ExecutionRequest) (*ExecutionResult, error) {
 		return result, err
 	}
 
-	// コードの実行
-	output, exitCode, err := e.executeCode(req.Code, versionConfig, req)
-
-	result.Output = output
-	result.ExitCode = exitCode
+	// コードの実行（タイムアウトはキャンセルと区別できるようにcauseを設定）
+	execCtx, cancel := context.WithTimeoutCause(ctx, req.Timeout, errExecutionTimeout)
+	defer cancel()
+	var onOutput outputFunc
+	if stream != nil {
+		onOutput = stream.OnOutput
+	}
+	if req.FakeTime {
+		// 出力には仮想時刻のヘッダーが付くため、デコードしてから配信する
+		onOutput = playbackOutput(onOutput)
+	}
+	rec := newOutputRecorder(req.MaxOutputBytes, onOutput)
+	run, timing := e.executeCode(execCtx, versionConfig, req, stream, rec)
+
+	output := rec.Snapshot()
+	if req.FakeTime && timing.Ran {
+		output, result.TimedEvents = playbackSnapshot(output)
+		if n := len(result.TimedEvents); n > 0 {
+			result.VirtualTime = result.TimedEvents[n-1].Offset
+		}
+	}
+	result.Output = output.Combined
+	result.Stdout = output.Stdout
+	result.Stderr = output.Stderr
+	result.Events = output.Events
+	result.Truncated = output.Truncated
+	result.ExitCode = run.ExitCode
+	result.Status = run.Status
 	result.ExecutionTime = time.Since(startTime)
+	result.CacheHit = timing.CacheHit
+	result.CompileTime = timing.CompileTime
+	result.RunTime = timing.RunTime
+	result.BuildOutput = timing.BuildOutput
+	result.Diagnostics = timing.Diagnostics
+	result.Captures = timing.Captures
+
+	if run.Err != nil {
+		result.Error = run.Err.Error()
+		if run.Status == StatusTimeout {
+			result.Error = fmt.Sprintf("%s (%v)", result.Error, req.Timeout)
+		}
+	}
 
-	if err != nil {
-		result.Error = err.Error()
+	// テストバイナリの出力を構造化（タイムアウト後も途中までの結果を返す）
+	if req.Mode == ModeTest && timing.Ran {
+		parseCtx, cancelParse := context.WithTimeout(ctx, testParseTimeout)
+		report, err := parseTestOutput(parseCtx, versionConfig, output.Stdout)
+		cancelParse()
+		if err != nil {
+			log.Printf("[WARN] Execute: %v", err)
+		} else {
+			result.Test = report
+			if run.Status == StatusError && report.Summary.Fail > 0 {
+				result.Error = fmt.Sprintf("%d件のテストが失敗しました (%s)", report.Summary.Fail, result.Error)
+			}
+		}
 	}
 
 	return result, nil
@@ -116,13 +259,22 @@ func (e *Executor) determineVersion(req ExecutionRequest) (string, error) {
 	log.Printf("[DEBUG] determineVersion: Request params - Version=%q, WorkingDir=%q, AutoDetect=%t", req.Version, req.WorkingDir, req.AutoDetect)
 	log.Printf("[DEBUG] determineVersion: Code length=%d characters", len(req.Code))
 
-	// 1. 明示的なバージョン指定がある場合
+	// 1. 自動選択（コードが必要とする最小バージョン以上で最も古いもの）
+	if req.Version == VersionAuto {
+		analysis, err := e.SelectVersion(req)
+		if err != nil {
+			return "", err
+		}
+		return analysis.Selected, nil
+	}
+
+	// 2. 明示的なバージョン指定がある場合
 	if req.Version != "" {
 		log.Printf("[DEBUG] determineVersion: Using explicit version: %s", req.Version)
 		return req.Version, nil
 	}
 
-	// 2. ワーキングディレクトリからパス判定（優先）
+	// 3. ワーキングディレクトリからパス判定（優先）
 	if req.WorkingDir != "" {
 		log.Printf("[DEBUG] determineVersion: Attempting path-based detection from WorkingDir: %s", req.WorkingDir)
 		if version, err := ExtractVersionFromPath(req.WorkingDir); err == nil {
@@ -135,7 +287,7 @@ func (e *Executor) determineVersion(req ExecutionRequest) (string, error) {
 		log.Printf("[DEBUG] determineVersion: No WorkingDir provided")
 	}
 
-	// 3. 自動検出が有効な場合（コードとパス両方）
+	// 4. 自動検出が有効な場合（コードとパス両方）
 	if req.AutoDetect {
 		log.Printf("[DEBUG] determineVersion: AutoDetect enabled, attempting code-based detection")
 		// 3a. コードからパス情報を抽出
@@ -150,7 +302,7 @@ func (e *Executor) determineVersion(req ExecutionRequest) (string, error) {
 		log.Printf("[DEBUG] determineVersion: AutoDetect disabled")
 	}
 
-	// 4. バージョンが特定できない場合はエラー
+	// 5. バージョンが特定できない場合はエラー
 	log.Printf("[DEBUG] determineVersion: All detection methods failed")
 	return "", fmt.Errorf("バージョンを特定できませんでした。明示的なバージョン指定またはレッスンパスが必要です")
 }
@@ -163,151 +315,287 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
-// executeCode executes the Go code with the specified version
-func (e *Executor) executeCode(code string, config *VersionConfig, req ExecutionRequest) (string, int, error) {
-	// 一時ファイルの作成（常にシステム一時ディレクトリを使用）
-	tempDir := os.TempDir()
-	filename := filepath.Join(tempDir, fmt.Sprintf("gocode_%d_%d.go", time.Now().Unix(), time.Now().Nanosecond()))
+// executionTiming reports where the time of an execution was spent and what the build printed
+type executionTiming struct {
+	CacheHit    bool
+	CompileTime time.Duration
+	RunTime     time.Duration
+	Ran         bool // ビルドに成功しバイナリを起動したか
+	BuildOutput string
+	Diagnostics []Diagnostic
+	Captures    []Capture
+}
 
-	// コードをファイルに書き込み
-	if err := os.WriteFile(filename, []byte(code), 0600); err != nil {
-		return "", 1, fmt.Errorf("コードファイル作成エラー: %w", err)
+// executeCode builds the request's files with the specified version and runs the binary in the sandbox
+func (e *Executor) executeCode(ctx context.Context, config *VersionConfig, req ExecutionRequest, stream *StreamHandlers, rec *outputRecorder) (commandResult, executionTiming) {
+	var (
+		stdin   io.Reader
+		onPhase = func(string) {}
+		timing  executionTiming
+	)
+	if stream != nil {
+		stdin = stream.Stdin
+		if stream.OnPhase != nil {
+			onPhase = stream.OnPhase
+		}
 	}
 
-	// 実行後にファイルを削除
+	ws, err := requestWorkspace(req, config.Version)
+	if err != nil {
+		return commandResult{ExitCode: 1, Status: StatusError, Err: err}, timing
+	}
+
+	// トレース・プロファイルの取得は main をラップして行う（ファイルが変わるためビルドキャッシュも別になる）
+	hooks, err := captureHooks(req, config)
+	if err != nil {
+		return commandResult{ExitCode: 1, Status: StatusError, Err: err}, timing
+	}
+	if len(hooks) > 0 {
+		if err := instrumentMain(ws, hooks); err != nil {
+			return commandResult{ExitCode: 1, Status: StatusError, Err: err}, timing
+		}
+	}
+
+	// 一時ディレクトリの作成（常にシステム一時ディレクトリを使用）
+	workDir, err := os.MkdirTemp("", workDirPrefix)
+	if err != nil {
+		return commandResult{ExitCode: 1, Status: StatusError, Err: fmt.Errorf("作業ディレクトリ作成エラー: %w", err)}, timing
+	}
+
+	// 実行後にディレクトリを削除
 	defer func() {
-		if err := os.Remove(filename); err != nil {
+		if err := os.RemoveAll(workDir); err != nil {
 			// ログに記録するが、エラーは無視
-			fmt.Printf("Warning: failed to remove temp file %s: %v\n", filename, err)
+			fmt.Printf("Warning: failed to remove temp dir %s: %v\n", workDir, err)
 		}
 	}()
 
-	// Go実行コマンドの作成
-	// #nosec G204 - config.Path is from trusted configuration and filename is sanitized temp file
-	cmd := exec.Command(config.Path, "run", filename)
-
-	// 環境変数の設定
-	cmd.Env = os.Environ()
-	if req.Environment != nil {
-		for key, value := range req.Environment {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
-		}
+	// ソースファイルとデータファイルを書き込み（キャッシュヒット時も実行時に参照される）
+	if err := writeWorkspace(sourceDir(workDir), ws.Files); err != nil {
+		return commandResult{ExitCode: 1, Status: StatusError, Err: fmt.Errorf("コードファイル作成エラー: %w", err)}, timing
 	}
 
-	// EnvVars文字列の処理（例: "GOEXPERIMENT=jsonv2"）
-	if req.EnvVars != "" {
-		envPairs := strings.Split(req.EnvVars, ",")
-		for _, pair := range envPairs {
-			if pair = strings.TrimSpace(pair); pair != "" {
-				cmd.Env = append(cmd.Env, pair)
-				log.Printf("[DEBUG] Execute: Added environment variable: %s", pair)
-			}
+	userEnv := userEnvironment(req)
+
+	// ビルドの出力はプログラムの出力と分けて記録し、診断メッセージとして解析する
+	compileStart := time.Now()
+	buildRec := newOutputRecorder(req.MaxOutputBytes, nil)
+	binaryPath, release, cacheHit, build := e.buildBinary(ctx, config, workDir, ws, userEnv, buildFlags(req), buildRec, onPhase)
+	timing.CacheHit = cacheHit
+	timing.CompileTime = time.Since(compileStart)
+	timing.BuildOutput = buildRec.Snapshot().Combined
+	timing.Diagnostics = parseDiagnostics(timing.BuildOutput, sourceDir(workDir), DiagnosticBuild, config.FullVersion)
+	if build.Err != nil {
+		if build.Status == StatusError && len(timing.Diagnostics) > 0 {
+			build.Err = errors.New(buildErrorMessage(timing.Diagnostics))
 		}
+		return build, timing
+	}
+	defer release()
+
+	// コンパイル済みバイナリをサンドボックス内で実行
+	spec := RunSpec{Binary: binaryPath, Env: userEnv, Dir: sourceDir(workDir)}
+	if ws.Test {
+		// go test と同様にパッケージディレクトリで実行（testdata を参照できるように）
+		spec.Args = testBinaryArgs(req.Test)
+		spec.Dir = filepath.Join(spec.Dir, filepath.FromSlash(ws.Target))
+	}
+	captures, err := openCaptures(workDir, hooks)
+	if err != nil {
+		return commandResult{ExitCode: 1, Status: StatusError, Err: err}, timing
+	}
+	defer closeCaptures(captures)
+	spec.ExtraFiles = captures
+	runCmd, err := e.sandbox.Command(spec)
+	if err != nil {
+		return commandResult{ExitCode: 1, Status: StatusError, Err: err}, timing
 	}
 
-	// 作業ディレクトリの設定
-	// WorkingDirはバージョン検出のみに使用し、実行時の作業ディレクトリは設定しない
-	// これにより、コードは一時ディレクトリで実行される
+	onPhase(PhaseRunning)
+	runStart := time.Now()
+	timing.Ran = true
+	run := runCommand(ctx, runCmd, stdin, rec)
+	timing.RunTime = time.Since(runStart)
+	timing.Captures = readCaptures(hooks, captures)
+	return run, timing
+}
 
-	// タイムアウト付きでコマンド実行
-	done := make(chan struct{})
-	var output []byte
-	var err error
-	var exitCode int
+// buildFlags returns the extra go build flags of a request
+func buildFlags(req ExecutionRequest) []string {
+	if req.FakeTime {
+		return []string{"-tags=" + fakeTimeBuildTag}
+	}
+	return nil
+}
 
-	go func() {
-		defer close(done)
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			var exitError *exec.ExitError
-			if errors.As(err, &exitError) {
-				exitCode = exitError.ExitCode()
-			} else {
-				exitCode = 1
-			}
-		}
-	}()
+// sourceDir is where the request's files are written inside workDir.
+// It is also the program's working directory so that data files can be read.
+func sourceDir(workDir string) string {
+	return filepath.Join(workDir, "src")
+}
 
-	// タイムアウト処理
-	select {
-	case <-done:
-		// 正常終了
-		return string(output), exitCode, err
-	case <-time.After(req.Timeout):
-		// タイムアウト
-		if cmd.Process != nil {
-			if killErr := cmd.Process.Kill(); killErr != nil {
-				log.Printf("Failed to kill process: %v", killErr)
-			}
+// buildBinary compiles the workspace written to sourceDir(workDir) with the given toolchain, reusing the build cache when possible.
+// The returned release function unpins the cached binary and must be called after running it.
+func (e *Executor) buildBinary(ctx context.Context, config *VersionConfig, workDir string, ws *workspace, env, flags []string, rec *outputRecorder, onPhase func(string)) (string, func(), bool, commandResult) {
+	noRelease := func() {}
+
+	var key string
+	if e.cache != nil {
+		key = buildCacheKey(buildKeyInput{
+			Files:       ws.Files,
+			Target:      ws.Target,
+			Test:        ws.Test,
+			GoPath:      config.Path,
+			FullVersion: config.FullVersion,
+			Env:         env,
+			Flags:       flags,
+		})
+		unlock := e.cache.lockKey(key)
+		defer unlock()
+
+		if path, release, ok := e.cache.Acquire(key); ok {
+			log.Printf("[DEBUG] buildBinary: cache hit %s", key[:12])
+			return path, release, true, commandResult{Status: StatusSuccess}
 		}
-		return "", 124, fmt.Errorf("実行タイムアウト (%v)", req.Timeout)
 	}
-}
 
-// ValidateCode performs basic validation on the Go code before execution
-func (e *Executor) ValidateCode(code string, version string) error {
-	// 基本的なGoコードの検証
-	if code == "" {
-		return fmt.Errorf("空のコードは実行できません")
+	// ビルドはホスト上で選択されたツールチェーンを使用
+	binaryPath := filepath.Join(workDir, "main")
+	args := []string{"build", "-o", binaryPath}
+	if ws.Test {
+		args = []string{"test", "-c", "-o", binaryPath}
 	}
-
-	// 危険なコードパターンの検出
-	dangerousPatterns := []string{
-		"os.RemoveAll",
-		"os.Remove",
-		"exec.Command",
-		"syscall",
-		"unsafe",
-		"//go:linkname",
+	args = append(append(args, flags...), ws.Target)
+	// #nosec G204 - config.Path is from trusted configuration and paths are in a private temp dir
+	buildCmd := exec.Command(config.Path, args...)
+	buildCmd.Dir = sourceDir(workDir)
+	buildCmd.Env = buildEnvironment(env, ws)
+
+	onPhase(PhaseCompiling)
+	build := runCommand(ctx, buildCmd, nil, rec)
+	if build.Err != nil || e.cache == nil {
+		return binaryPath, noRelease, false, build
 	}
 
-	for _, pattern := range dangerousPatterns {
-		if contains(code, pattern) {
-			return fmt.Errorf("セキュリティ上の理由により、'%s' を含むコードは実行できません", pattern)
-		}
+	cachedPath, release, err := e.cache.Put(key, binaryPath)
+	if err != nil {
+		log.Printf("[WARN] buildBinary: failed to store binary in cache: %v", err)
+		return binaryPath, noRelease, false, build
 	}
+	return cachedPath, release, false, build
+}
 
-	// バージョン固有の検証
-	if version != "" {
-		if err := e.validateVersionSpecificFeatures(code, version); err != nil {
+// writeWorkspace writes files below dir, creating parent directories
+func writeWorkspace(dir string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, files[name], 0600); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-// validateVersionSpecificFeatures validates version-specific Go features
-func (e *Executor) validateVersionSpecificFeatures(code string, version string) error {
-	// Go 1.18未満でのジェネリクス使用チェック
-	versionFloat := e.manager.parseVersion(version)
-
-	if versionFloat < 1.18 {
-		genericPatterns := []string{
-			"[T any]",
-			"[T comparable]",
-			"[T constraint",
-			"type.*\\[.*\\]",
+// buildEnvAllowlist lists the user supplied variables given to the host-side go command.
+// The other variables of a request only reach the sandboxed program.
+var buildEnvAllowlist = map[string]bool{
+	"GOEXPERIMENT": true,
+	"GODEBUG":      true,
+	"GOOS":         true,
+	"GOARCH":       true,
+	"GOAMD64":      true,
+	"GOARM":        true,
+	"GOARM64":      true,
+	"GO386":        true,
+}
+
+// buildEnvironment returns the environment of a go command run on the host for a request.
+// Only the allowed user variables are passed, and the toolchain is pinned to the selected
+// version and the request's own workspace: no toolchain or module downloads, no cgo, and
+// no GOFLAGS (-toolexec, -overlay, -modfile) from the request.
+func buildEnvironment(userEnv []string, ws *workspace) []string {
+	env := os.Environ()
+	for _, pair := range userEnv {
+		key, _, _ := strings.Cut(pair, "=")
+		if !buildEnvAllowlist[key] {
+			log.Printf("[DEBUG] buildEnvironment: %s is passed to the program only", key)
+			continue
 		}
+		env = append(env, pair)
+	}
+	// 後に指定した値が優先される
+	env = append(env, "GOTOOLCHAIN=local", "CGO_ENABLED=0", "GOPROXY=off", "GOFLAGS=-mod=readonly")
+	if !ws.HasWork {
+		// 上位ディレクトリの go.work を無効化する
+		env = append(env, "GOWORK=off")
+	}
+	return env
+}
+
+// userEnvironment collects user supplied environment variables as KEY=VALUE pairs
+func userEnvironment(req ExecutionRequest) []string {
+	var env []string
+	for key, value := range req.Environment {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
 
-		for _, pattern := range genericPatterns {
-			if matched, _ := regexp.MatchString(pattern, code); matched {
-				return fmt.Errorf("ジェネリクスはGo 1.18以降で利用可能です（現在: %s）", version)
+	// EnvVars文字列の処理（例: "GOEXPERIMENT=jsonv2"）
+	if req.EnvVars != "" {
+		envPairs := strings.Split(req.EnvVars, ",")
+		for _, pair := range envPairs {
+			if pair = strings.TrimSpace(pair); pair != "" {
+				env = append(env, pair)
+				log.Printf("[DEBUG] Execute: Added environment variable: %s", pair)
 			}
 		}
 	}
 
+	return env
+}
+
+// ValidateRequest checks every Go source file of a request against the code policy.
+// Policy violations are returned as a *PolicyError carrying their positions.
+func (e *Executor) ValidateRequest(req ExecutionRequest) error {
+	sources := goSources(req)
+	if len(sources) == 0 {
+		if len(req.Files) == 0 {
+			return fmt.Errorf("空のコードは実行できません")
+		}
+		return fmt.Errorf("Goのソースファイルが含まれていません")
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []PolicyViolation
+	for _, name := range names {
+		violations = append(violations, e.policy.Check(name, sources[name], req.Version)...)
+	}
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
 	return nil
 }
 
-// contains checks if a string contains a substring (case-insensitive)
-func contains(s, substr string) bool {
-	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+// ValidateCode checks a single Go source file against the code policy
+func (e *Executor) ValidateCode(code string, version string) error {
+	return e.ValidateRequest(ExecutionRequest{Code: code, Version: version})
 }
 
 // ExecuteWithVersion is a convenience method for executing code with a specific version
-func (e *Executor) ExecuteWithVersion(code, version string) (*ExecutionResult, error) {
-	return e.Execute(ExecutionRequest{
+func (e *Executor) ExecuteWithVersion(ctx context.Context, code, version string) (*ExecutionResult, error) {
+	return e.Execute(ctx, ExecutionRequest{
 		Code:          code,
 		Version:       version,
 		AutoDetect:    false,
@@ -317,8 +605,8 @@ func (e *Executor) ExecuteWithVersion(code, version string) (*ExecutionResult, e
 }
 
 // ExecuteWithAutoDetect is a convenience method for executing code with auto-detected version
-func (e *Executor) ExecuteWithAutoDetect(code string) (*ExecutionResult, error) {
-	return e.Execute(ExecutionRequest{
+func (e *Executor) ExecuteWithAutoDetect(ctx context.Context, code string) (*ExecutionResult, error) {
+	return e.Execute(ctx, ExecutionRequest{
 		Code:       code,
 		AutoDetect: true,
 		Timeout:    30 * time.Second,
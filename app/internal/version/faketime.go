@@ -0,0 +1,186 @@
+// Package version - Virtual time execution (faketime)
+//
+// Like the Go playground, a program can be built with -tags=faketime. The
+// runtime then starts at a fixed virtual time and advances it instantly
+// whenever all goroutines are blocked on timers, so time.Sleep costs no real
+// time. Every write to stdout/stderr is prefixed with a playback header
+// carrying the virtual time of the write:
+//
+//	0 0 'P' 'B' <8-byte time (ns since 1970)> <4-byte data length>  (big endian)
+//
+// The headers are decoded into timed events so the frontend can replay the
+// output with the original delays.
+package version
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// fakeTimeBuildTag enables the runtime's virtual clock
+	fakeTimeBuildTag = "faketime"
+
+	// fakeTimeEpoch is the virtual start time of a faketime program (2009-11-10 23:00:00 UTC)
+	fakeTimeEpoch = 1257894000000000000
+
+	playbackHeaderSize = 4 + 8 + 4
+)
+
+// playbackMagic starts every playback header
+var playbackMagic = []byte{0, 0, 'P', 'B'}
+
+// TimedEvent is an output chunk of a faketime execution with its virtual time
+type TimedEvent struct {
+	Stream string        `json:"stream"` // "stdout" / "stderr"
+	Data   string        `json:"data"`
+	Offset time.Duration `json:"offset"` // プログラム開始からの仮想時間（ナノ秒）
+}
+
+// playbackDecoder incrementally decodes the playback headers of one output stream
+type playbackDecoder struct {
+	stream string
+	buf    []byte
+	last   int64 // 直前の書き込みの仮想時間
+}
+
+// newPlaybackDecoder creates a decoder for the named stream
+func newPlaybackDecoder(stream string) *playbackDecoder {
+	return &playbackDecoder{stream: stream, last: fakeTimeEpoch}
+}
+
+// Write consumes p and returns the events whose data is complete
+func (d *playbackDecoder) Write(p []byte) []TimedEvent {
+	d.buf = append(d.buf, p...)
+
+	var events []TimedEvent
+	for len(d.buf) > 0 {
+		// ヘッダーのない出力（通常は発生しない）はそのまま直前の時刻で扱う
+		start := bytes.Index(d.buf, playbackMagic)
+		if start != 0 {
+			raw := len(d.buf)
+			if start > 0 {
+				raw = start
+			} else if keep := partialMagic(d.buf); keep > 0 {
+				raw -= keep // ヘッダーの先頭が分割された可能性がある
+			}
+			if raw == 0 {
+				break
+			}
+			events = append(events, d.event(d.last, d.buf[:raw]))
+			d.buf = d.buf[raw:]
+			continue
+		}
+
+		if len(d.buf) < playbackHeaderSize {
+			break
+		}
+		t := int64(binary.BigEndian.Uint64(d.buf[4:12]))
+		n := int(binary.BigEndian.Uint32(d.buf[12:16]))
+		if len(d.buf) < playbackHeaderSize+n {
+			break
+		}
+		d.last = t
+		if n > 0 {
+			events = append(events, d.event(t, d.buf[playbackHeaderSize:playbackHeaderSize+n]))
+		}
+		d.buf = d.buf[playbackHeaderSize+n:]
+	}
+	return events
+}
+
+// Flush returns the undecodable remainder (e.g. a frame cut by the output cap) as a final event
+func (d *playbackDecoder) Flush() []TimedEvent {
+	data := d.buf
+	d.buf = nil
+	// 残りはデータが途中で切れたフレームか、途中で切れたヘッダーのみ
+	if !bytes.HasPrefix(data, playbackMagic) || len(data) <= playbackHeaderSize {
+		return nil
+	}
+	t := int64(binary.BigEndian.Uint64(data[4:12]))
+	return []TimedEvent{d.event(t, data[playbackHeaderSize:])}
+}
+
+func (d *playbackDecoder) event(t int64, data []byte) TimedEvent {
+	return TimedEvent{Stream: d.stream, Data: string(data), Offset: time.Duration(t - fakeTimeEpoch)}
+}
+
+// partialMagic returns how many trailing bytes of b could start a playback header
+func partialMagic(b []byte) int {
+	for n := len(playbackMagic) - 1; n > 0; n-- {
+		if len(b) >= n && bytes.Equal(b[len(b)-n:], playbackMagic[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// decodePlayback decodes the stdout and stderr of a faketime program and merges them by virtual time.
+// The runtime increments the time whenever the written fd changes, so the order is preserved.
+func decodePlayback(stdout, stderr string) []TimedEvent {
+	var events []TimedEvent
+	for _, s := range []struct{ stream, data string }{{StreamStdout, stdout}, {StreamStderr, stderr}} {
+		d := newPlaybackDecoder(s.stream)
+		events = append(events, d.Write([]byte(s.data))...)
+		events = append(events, d.Flush()...)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Offset < events[j].Offset })
+
+	// 同じ時刻・同じストリームの連続した書き込みは1つにまとめる
+	merged := make([]TimedEvent, 0, len(events))
+	for i := 0; i < len(events); {
+		event := events[i]
+		j := i + 1
+		for j < len(events) && events[j].Stream == event.Stream && events[j].Offset == event.Offset {
+			j++
+		}
+		if j-i > 1 {
+			var data strings.Builder
+			for _, e := range events[i:j] {
+				data.WriteString(e.Data)
+			}
+			event.Data = data.String()
+		}
+		merged = append(merged, event)
+		i = j
+	}
+	return merged
+}
+
+// playbackSnapshot replaces the framed output of a faketime program with the decoded output
+func playbackSnapshot(output outputSnapshot) (outputSnapshot, []TimedEvent) {
+	timed := decodePlayback(output.Stdout, output.Stderr)
+
+	// デコード済みの出力を上限なしのレコーダーに記録し直す
+	rec := newOutputRecorder(0, nil)
+	for _, event := range timed {
+		rec.record(event.Stream, []byte(event.Data))
+	}
+	decoded := rec.Snapshot()
+	decoded.Truncated = output.Truncated
+	return decoded, timed
+}
+
+// playbackOutput wraps onOutput so that streamed chunks are decoded before delivery
+func playbackOutput(onOutput outputFunc) outputFunc {
+	if onOutput == nil {
+		return nil
+	}
+	decoders := map[string]*playbackDecoder{
+		StreamStdout: newPlaybackDecoder(StreamStdout),
+		StreamStderr: newPlaybackDecoder(StreamStderr),
+	}
+	return func(stream string, data []byte) {
+		d, ok := decoders[stream]
+		if !ok {
+			onOutput(stream, data)
+			return
+		}
+		for _, event := range d.Write(data) {
+			onOutput(event.Stream, []byte(event.Data))
+		}
+	}
+}
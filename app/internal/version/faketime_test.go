@@ -0,0 +1,146 @@
+package version
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+// playbackFrame encodes a write of a faketime program at virtual offset d
+func playbackFrame(d time.Duration, data string) string {
+	b := append([]byte(nil), playbackMagic...)
+	b = binary.BigEndian.AppendUint64(b, uint64(fakeTimeEpoch+int64(d)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return string(append(b, data...))
+}
+
+// decodeChunks writes the chunks to a decoder and returns the events including the flushed remainder
+func decodeChunks(chunks ...string) []TimedEvent {
+	d := newPlaybackDecoder(StreamStdout)
+	var events []TimedEvent
+	for _, chunk := range chunks {
+		events = append(events, d.Write([]byte(chunk))...)
+	}
+	return append(events, d.Flush()...)
+}
+
+func timedEventsString(events []TimedEvent) string {
+	var parts []string
+	for _, event := range events {
+		parts = append(parts, event.Offset.String()+"="+event.Data)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestPlaybackDecoder(t *testing.T) {
+	frames := playbackFrame(0, "a") + playbackFrame(time.Second, "bc") + playbackFrame(2*time.Second, "") + playbackFrame(3*time.Second, "d")
+	const want = "0s=a 1s=bc 3s=d"
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"whole", []string{frames}, want},
+		{"header split in the magic", []string{frames[:2], frames[2:]}, want},
+		{"header split in the time", []string{frames[:7], frames[7:]}, want},
+		{"data split", []string{frames[:17], frames[17:]}, want},
+		{"raw output", []string{"raw"}, "0s=raw"},
+		{"raw output before a header", []string{"raw" + playbackFrame(time.Second, "x")}, "0s=raw 1s=x"},
+		{"raw output after a header", []string{playbackFrame(time.Second, "x") + "raw"}, "1s=x 1s=raw"},
+		{"raw output ending like a header", []string{"raw\x00", "tail"}, "0s=raw 0s=\x00tail"},
+		{"frame cut by the output cap", []string{playbackFrame(time.Second, "complete")[:20]}, "1s=comp"},
+		{"header cut by the output cap", []string{playbackFrame(0, "a") + playbackFrame(time.Second, "b")[:10]}, "0s=a"},
+		{"magic cut by the output cap", []string{playbackFrame(0, "a") + "\x00\x00P"}, "0s=a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timedEventsString(decodeChunks(tt.chunks...)); got != tt.want {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// どの位置で分割しても、1バイトずつ書き込んでも同じ結果になる
+	for i := range frames {
+		if got := timedEventsString(decodeChunks(frames[:i], frames[i:])); got != want {
+			t.Errorf("split at %d: events = %q", i, got)
+		}
+	}
+	bytewise := make([]string, len(frames))
+	for i := range frames {
+		bytewise[i] = frames[i : i+1]
+	}
+	if got := timedEventsString(decodeChunks(bytewise...)); got != want {
+		t.Errorf("byte by byte: events = %q", got)
+	}
+}
+
+func TestPartialMagic(t *testing.T) {
+	tests := map[string]int{
+		"":            0,
+		"abc":         0,
+		"abc\x00":     1,
+		"abc\x00\x00": 2,
+		"\x00\x00P":   3,
+		"\x00\x00PB":  0, // 完全なマジックは bytes.Index で見つかる
+		"abc\x00P":    0,
+	}
+	for input, want := range tests {
+		if got := partialMagic([]byte(input)); got != want {
+			t.Errorf("partialMagic(%q) = %d, want %d", input, got, want)
+		}
+	}
+}
+
+func TestPlaybackSnapshot(t *testing.T) {
+	output := outputSnapshot{
+		Stdout:    playbackFrame(0, "a") + playbackFrame(0, "b") + playbackFrame(2*time.Second, "c"),
+		Stderr:    playbackFrame(time.Second, "E"),
+		Truncated: true,
+	}
+	decoded, timed := playbackSnapshot(output)
+
+	// 同じ時刻・同じストリームの書き込みはまとめ、ストリームをまたいで仮想時刻順に並べる
+	if got := timedEventsString(timed); got != "0s=ab 1s=E 2s=c" {
+		t.Errorf("timed events = %q", got)
+	}
+	if decoded.Combined != "abEc" || decoded.Stdout != "abc" || decoded.Stderr != "E" || !decoded.Truncated {
+		t.Errorf("decoded = %+v", decoded)
+	}
+	want := []OutputEvent{{StreamStdout, "ab"}, {StreamStderr, "E"}, {StreamStdout, "c"}}
+	if len(decoded.Events) != len(want) {
+		t.Fatalf("events = %v, want %v", decoded.Events, want)
+	}
+	for i := range want {
+		if decoded.Events[i] != want[i] {
+			t.Errorf("events[%d] = %v, want %v", i, decoded.Events[i], want[i])
+		}
+	}
+
+	if empty, timed := playbackSnapshot(outputSnapshot{}); empty.Events == nil || len(timed) != 0 {
+		t.Errorf("snapshot of no output = %+v, %v", empty, timed)
+	}
+}
+
+func TestPlaybackOutput(t *testing.T) {
+	var got []string
+	onOutput := playbackOutput(func(stream string, data []byte) {
+		got = append(got, stream+":"+string(data))
+	})
+	frames := playbackFrame(0, "hello") + playbackFrame(time.Second, "world")
+	onOutput(StreamStdout, []byte(frames[:10]))
+	onOutput(StreamStderr, []byte(playbackFrame(0, "E")))
+	onOutput(StreamStdout, []byte(frames[10:30]))
+	onOutput(StreamStdout, []byte(frames[30:]))
+	onOutput("other", []byte("raw"))
+
+	want := "stderr:E stdout:hello stdout:world other:raw"
+	if strings.Join(got, " ") != want {
+		t.Errorf("delivered %q, want %q", strings.Join(got, " "), want)
+	}
+	if playbackOutput(nil) != nil {
+		t.Error("playbackOutput(nil) != nil")
+	}
+}
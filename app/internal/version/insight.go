@@ -0,0 +1,365 @@
+// Package version - Compiler insight (assembly, inlining, escape analysis, bounds checks)
+//
+// The request's packages are compiled with
+//
+//	-gcflags=./...=-S -m -d=ssa/check_bce/debug=1
+//
+// and the compiler's output is split into the assembly of each function and
+// positioned optimization notes (inlining decisions, escape analysis results
+// and remaining bounds checks). Both are mapped back to the request's source
+// lines. The same function can be compared between two toolchains.
+package version
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// insightGCFlags are the compiler flags of an insight build (only the request's own packages)
+const insightGCFlags = "-gcflags=./...=-S -m -d=ssa/check_bce/debug=1"
+
+// Compiler note kinds
+const (
+	NoteInline      = "inline"       // インライン化可能 / インライン展開された
+	NoteNoInline    = "no_inline"    // インライン化できない（理由付き）
+	NoteEscape      = "escape"       // ヒープへエスケープ
+	NoteNoEscape    = "no_escape"    // エスケープしない
+	NoteBoundsCheck = "bounds_check" // 除去されなかった境界チェック
+	NoteOther       = "other"
+)
+
+// InsightRequest builds a request to inspect what the compiler does with it
+type InsightRequest struct {
+	ExecutionRequest
+	CompareVersion string `json:"compare_version,omitempty"` // 比較するもう一方のGoバージョン
+	Function       string `json:"function,omitempty"`        // 対象の関数（例: "sum", "(*T).M"。省略時は全関数）
+}
+
+// AsmInstruction is one instruction of a function with its source position
+type AsmInstruction struct {
+	Offset int    `json:"offset"` // 関数先頭からのバイトオフセット
+	File   string `json:"file"`   // リクエスト内の相対パス（インライン展開された標準ライブラリはそのパス）
+	Line   int    `json:"line"`
+	Text   string `json:"text"` // 例: "ADDQ (AX)(CX*8), DX"
+}
+
+// AsmFunction is the assembly of one function
+type AsmFunction struct {
+	Name         string           `json:"name"` // 例: "main.sum"
+	File         string           `json:"file"`
+	Line         int              `json:"line"`
+	Size         int              `json:"size"` // 機械語のバイト数
+	Instructions []AsmInstruction `json:"instructions"`
+}
+
+// CompilerNote is a positioned optimization decision reported by the compiler
+type CompilerNote struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Kind    string `json:"kind"` // NoteInline など
+	Message string `json:"message"`
+}
+
+// InsightResult is what one toolchain's compiler did with the request
+type InsightResult struct {
+	GoVersion   string         `json:"go_version"`
+	UsedVersion string         `json:"used_version"`
+	Arch        string         `json:"arch"` // アセンブリのGOARCH
+	Functions   []AsmFunction  `json:"functions"`
+	Notes       []CompilerNote `json:"notes"`
+	Diagnostics []Diagnostic   `json:"diagnostics,omitempty"`  // ビルドエラー
+	BuildOutput string         `json:"build_output,omitempty"` // ビルドに失敗した場合の出力
+	Truncated   bool           `json:"truncated,omitempty"`    // 出力上限によりアセンブリが途中で切れたか
+}
+
+// FunctionComparison compares the assembly of one function between two toolchains
+type FunctionComparison struct {
+	Name        string     `json:"name"`
+	BaseSize    int        `json:"base_size"`    // 0 なら基準側に存在しない（インライン化などで）
+	CompareSize int        `json:"compare_size"` // 0 なら比較側に存在しない
+	Identical   bool       `json:"identical"`
+	Diff        []DiffLine `json:"diff,omitempty"` // 命令列（オフセットを除く）の差分
+}
+
+// InsightComparison is the result of a compiler insight request
+type InsightComparison struct {
+	Base      *InsightResult       `json:"base"`
+	Compare   *InsightResult       `json:"compare,omitempty"`
+	Functions []FunctionComparison `json:"functions,omitempty"`
+}
+
+var (
+	// asmFunctionPattern matches the header of a text symbol: "main.sum STEXT nosplit size=52 ..."
+	asmFunctionPattern = regexp.MustCompile(`^(\S+) STEXT\b.* size=(\d+)`)
+	// asmInstructionPattern matches "\t0x000f 00015 (/path/main.go:10)\tADDQ\t(AX)(CX*8), DX"
+	asmInstructionPattern = regexp.MustCompile(`^\t0x[0-9a-f]+ (\d+) \(([^)]*):(\d+)\)\t(.*)$`)
+)
+
+// CompilerInsight compiles the request with the selected toolchain (and optionally a second one)
+// and returns assembly and optimization notes mapped to source lines
+func (e *Executor) CompilerInsight(ctx context.Context, req InsightRequest) (*InsightComparison, error) {
+	base, err := e.compilerInsight(ctx, req.ExecutionRequest, req.Function)
+	if err != nil {
+		return nil, err
+	}
+	comparison := &InsightComparison{Base: base}
+	if req.CompareVersion == "" {
+		return comparison, nil
+	}
+
+	other := req.ExecutionRequest
+	other.Version = req.CompareVersion
+	comparison.Compare, err = e.compilerInsight(ctx, other, req.Function)
+	if err != nil {
+		return nil, fmt.Errorf("比較バージョン %s: %w", req.CompareVersion, err)
+	}
+	comparison.Functions = compareFunctions(base.Functions, comparison.Compare.Functions)
+	return comparison, nil
+}
+
+// compilerInsight validates and performs one insight build
+func (e *Executor) compilerInsight(ctx context.Context, req ExecutionRequest, function string) (*InsightResult, error) {
+	// バージョン固有の検証も比較するバージョンごとに行う（ビルドはホスト上で行うため）
+	if err := e.ValidateRequest(req); err != nil {
+		return nil, fmt.Errorf("コード検証エラー: %w", err)
+	}
+	config, err := e.toolConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := requestWorkspace(req, config.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := os.MkdirTemp("", "goinsight_")
+	if err != nil {
+		return nil, fmt.Errorf("作業ディレクトリ作成エラー: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Printf("[WARN] compilerInsight: failed to remove temp dir %s: %v", workDir, err)
+		}
+	}()
+	srcDir := sourceDir(workDir)
+	if err := writeWorkspace(srcDir, ws.Files); err != nil {
+		return nil, fmt.Errorf("コードファイル作成エラー: %w", err)
+	}
+
+	if req.Timeout == 0 {
+		req.Timeout = defaultToolTimeout
+	}
+	if req.MaxOutputBytes <= 0 {
+		req.MaxOutputBytes = defaultOutputLimit()
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, req.Timeout, errExecutionTimeout)
+	defer cancel()
+
+	userEnv := userEnvironment(req)
+	args := []string{"build", "-o", os.DevNull, insightGCFlags, ws.Target}
+	if ws.Test {
+		args = []string{"test", "-c", "-o", os.DevNull, insightGCFlags, ws.Target}
+	}
+	// #nosec G204 - config.Path is from trusted configuration and paths are in a private temp dir
+	cmd := exec.Command(config.Path, args...)
+	cmd.Dir = srcDir
+	cmd.Env = buildEnvironment(userEnv, ws)
+
+	rec := newOutputRecorder(req.MaxOutputBytes, nil)
+	build := runCommand(ctx, cmd, nil, rec)
+	output := rec.Snapshot()
+
+	result := &InsightResult{
+		GoVersion:   config.FullVersion,
+		UsedVersion: config.Version,
+		Arch:        targetArch(userEnv),
+		Functions:   []AsmFunction{},
+		Notes:       []CompilerNote{},
+		Truncated:   output.Truncated,
+	}
+	if build.Err != nil && !output.Truncated {
+		if build.Status == StatusTimeout {
+			return nil, fmt.Errorf("ビルドがタイムアウトしました (%v)", req.Timeout)
+		}
+		result.BuildOutput = output.Combined
+		result.Diagnostics = parseDiagnostics(output.Combined, srcDir, DiagnosticBuild, config.FullVersion)
+		if len(result.Diagnostics) == 0 {
+			return nil, fmt.Errorf("ビルドエラー: %v: %s", build.Err, strings.TrimSpace(output.Combined))
+		}
+		return result, nil
+	}
+
+	result.Functions, result.Notes = parseCompilerOutput(output.Combined, srcDir)
+	if function != "" {
+		result.Functions = filterFunctions(result.Functions, function)
+	}
+	return result, nil
+}
+
+// targetArch returns the GOARCH the assembly was generated for
+func targetArch(env []string) string {
+	arch := runtime.GOARCH
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "GOARCH="); ok && value != "" {
+			arch = value
+		}
+	}
+	return arch
+}
+
+// parseCompilerOutput splits the compiler output into function assembly and optimization notes.
+// Functions that do not originate from the request's files (e.g. generated equality functions) are skipped.
+func parseCompilerOutput(output, srcDir string) ([]AsmFunction, []CompilerNote) {
+	var (
+		functions []AsmFunction
+		notes     []CompilerNote
+		current   *AsmFunction
+	)
+	flush := func() {
+		if current != nil && current.File != "" && !isExternalFile(current.File) {
+			functions = append(functions, *current)
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if m := asmFunctionPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			size, _ := strconv.Atoi(m[2])
+			current = &AsmFunction{Name: m[1], Size: size, Instructions: []AsmInstruction{}}
+			continue
+		}
+		// "./main.go:12:14: Found IsInBounds" などの最適化メッセージ
+		if m := diagnosticPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			lineNo, _ := strconv.Atoi(m[2])
+			column, _ := strconv.Atoi(m[3])
+			notes = append(notes, CompilerNote{
+				File:    requestFileName(m[1], srcDir),
+				Line:    lineNo,
+				Column:  column,
+				Kind:    noteKind(m[4]),
+				Message: m[4],
+			})
+			continue
+		}
+		if m := asmInstructionPattern.FindStringSubmatch(line); m != nil {
+			if current == nil {
+				continue
+			}
+			offset, _ := strconv.Atoi(m[1])
+			lineNo, _ := strconv.Atoi(m[3])
+			file := requestFileName(m[2], srcDir)
+			text := strings.Join(strings.Fields(m[4]), " ")
+			op, _, _ := strings.Cut(text, " ")
+			switch op {
+			case "TEXT":
+				// 関数の定義位置
+				current.File, current.Line = file, lineNo
+				continue
+			case "FUNCDATA", "PCDATA":
+				continue // GC・スタック用の疑似命令
+			}
+			current.Instructions = append(current.Instructions, AsmInstruction{Offset: offset, File: file, Line: lineNo, Text: text})
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			continue // 機械語の16進ダンプと再配置情報
+		}
+		// データシンボルやパッケージ見出しで関数が終わる
+		flush()
+	}
+	flush()
+	return functions, notes
+}
+
+// isExternalFile reports whether a mapped file name lies outside the request (GOROOT, <autogenerated>)
+func isExternalFile(name string) bool {
+	return strings.HasPrefix(name, "/") || strings.HasPrefix(name, "<")
+}
+
+// noteKind classifies a -m / check_bce message
+func noteKind(message string) string {
+	switch {
+	case strings.HasPrefix(message, "Found Is"):
+		return NoteBoundsCheck
+	case strings.HasPrefix(message, "cannot inline"):
+		return NoteNoInline
+	case strings.HasPrefix(message, "can inline"), strings.HasPrefix(message, "inlining call to"):
+		return NoteInline
+	case strings.HasSuffix(message, "does not escape"):
+		return NoteNoEscape
+	case strings.Contains(message, "escapes to heap"), strings.HasPrefix(message, "moved to heap"), strings.HasPrefix(message, "leaking param"):
+		return NoteEscape
+	}
+	return NoteOther
+}
+
+// filterFunctions keeps the functions matching name ("sum" matches "main.sum", "(*T).M" matches "main.(*T).M")
+func filterFunctions(functions []AsmFunction, name string) []AsmFunction {
+	filtered := []AsmFunction{}
+	for _, f := range functions {
+		if functionMatches(f.Name, name) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+func functionMatches(symbol, name string) bool {
+	return symbol == name || strings.HasSuffix(symbol, "."+name)
+}
+
+// compareFunctions diffs the instructions of functions with the same name
+func compareFunctions(base, other []AsmFunction) []FunctionComparison {
+	index := make(map[string]int, len(other))
+	for i, f := range other {
+		index[f.Name] = i
+	}
+
+	var comparisons []FunctionComparison
+	seen := make(map[string]bool)
+	for _, f := range base {
+		seen[f.Name] = true
+		c := FunctionComparison{Name: f.Name, BaseSize: f.Size}
+		baseText := instructionText(f)
+		otherText := ""
+		if i, ok := index[f.Name]; ok {
+			c.CompareSize = other[i].Size
+			otherText = instructionText(other[i])
+		}
+		c.Identical = baseText == otherText
+		if !c.Identical {
+			c.Diff = DiffLines(baseText, otherText)
+		}
+		comparisons = append(comparisons, c)
+	}
+	for _, f := range other {
+		if !seen[f.Name] {
+			comparisons = append(comparisons, FunctionComparison{
+				Name:        f.Name,
+				CompareSize: f.Size,
+				Diff:        DiffLines("", instructionText(f)),
+			})
+		}
+	}
+	return comparisons
+}
+
+// instructionText renders the instructions without offsets so that only code changes show up in a diff
+func instructionText(f AsmFunction) string {
+	lines := make([]string, len(f.Instructions))
+	for i, inst := range f.Instructions {
+		lines[i] = fmt.Sprintf("%s:%d\t%s", inst.File, inst.Line, inst.Text)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,25 @@
+package version
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCompilerInsightValidatesEachVersion(t *testing.T) {
+	// 1.22 でのみ拒否されるパッケージ
+	e := &Executor{policy: &Policy{Versions: map[string]PolicyRules{"1.22": {DeniedPackages: []string{"iter"}}}}}
+	req := ExecutionRequest{
+		Code:    "package main\nimport \"iter\"\nfunc main() { var _ iter.Seq[int] }\n",
+		Version: "1.22",
+	}
+
+	_, err := e.compilerInsight(context.Background(), req, "")
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("compilerInsight = %v, want *PolicyError", err)
+	}
+	if len(policyErr.Violations) != 1 || policyErr.Violations[0].Target != "iter" {
+		t.Errorf("violations = %v", policyErr.Violations)
+	}
+}
@@ -12,9 +12,9 @@ package version
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
+	goversion "go/version"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -25,12 +25,21 @@ type VersionConfig struct {
 	Path        string `json:"path"`         // e.g., "/opt/go1.18/bin/go"
 	FullVersion string `json:"full_version"` // e.g., "1.18.10"
 	Available   bool   `json:"available"`    // Whether this version is actually available
+	Source      string `json:"source"`       // ToolchainSourceConfig, ToolchainSourceDiscovered or ToolchainSourceProvisioned
 }
 
 // Manager handles Go version management
 type Manager struct {
-	versions map[string]*VersionConfig
-	mutex    sync.RWMutex
+	versions  map[string]*VersionConfig // マイナーバージョン -> 既定のツールチェーン
+	patches   map[string]*VersionConfig // 完全バージョン -> ツールチェーン
+	lastScan  *ScanResult
+	mutex     sync.RWMutex
+	scanMutex sync.Mutex // 再スキャンを直列化する
+
+	provisions     map[string]*ProvisionStatus // 完全バージョン -> ダウンロード状況
+	provisionQueue []string
+	provisioning   bool // ダウンロード用のgoroutineが動いているか
+	provisionMutex sync.Mutex
 }
 
 // Global manager instance
@@ -50,95 +59,71 @@ func GetManager() *Manager {
 func NewManager() *Manager {
 	return &Manager{
 		versions: make(map[string]*VersionConfig),
+		patches:  make(map[string]*VersionConfig),
 	}
 }
 
-// Initialize sets up the version manager with predefined Go versions
+// Initialize loads the toolchains from the configuration and the toolchain directories
 func (m *Manager) Initialize() {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	// 対応するGoバージョンの定義
-	supportedVersions := map[string]string{
-		"1.18": "/opt/go1.18/bin/go",
-		"1.19": "/opt/go1.19/bin/go",
-		"1.20": "/opt/go1.20/bin/go",
-		"1.21": "/opt/go1.21/bin/go",
-		"1.22": "/opt/go1.22/bin/go",
-		"1.23": "/opt/go1.23/bin/go",
-		"1.24": "/opt/go1.24/bin/go",
-		"1.25": "/opt/go1.25/bin/go",
-	}
-
-	// 各バージョンを初期化し、利用可能性をチェック
-	for version, path := range supportedVersions {
-		config := &VersionConfig{
-			Version:   version,
-			Path:      path,
-			Available: m.checkVersionAvailability(path),
-		}
-
-		// 実際のバージョン情報を取得
-		if config.Available {
-			if fullVersion, err := m.getFullVersion(path); err == nil {
-				config.FullVersion = fullVersion
-			}
-		}
-
-		m.versions[version] = config
-	}
-}
-
-// checkVersionAvailability checks if a Go version is available at the given path
-func (m *Manager) checkVersionAvailability(goPath string) bool {
-	if _, err := os.Stat(goPath); os.IsNotExist(err) {
-		return false
-	}
-
-	// 実際にバージョン確認を実行
-	cmd := exec.Command(goPath, "version")
-	if err := cmd.Run(); err != nil {
-		return false
-	}
-
-	return true
-}
-
-// getFullVersion retrieves the full version string from a Go binary
-func (m *Manager) getFullVersion(goPath string) (string, error) {
-	cmd := exec.Command(goPath, "version")
-	output, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-
-	// "go version go1.18.10 linux/amd64" から "1.18.10" を抽出
-	versionPattern := regexp.MustCompile(`go(\d+\.\d+\.\d+)`)
-	matches := versionPattern.FindStringSubmatch(string(output))
-	if len(matches) >= 2 {
-		return matches[1], nil
-	}
-
-	return "", fmt.Errorf("バージョン情報を解析できませんでした: %s", string(output))
+	m.Rescan()
 }
 
-// GetVersionConfig returns the configuration for a specific Go version
+// GetVersionConfig returns the configuration for a specific Go version.
+// A minor version ("1.22") selects its default toolchain, a full version
+// ("1.22.7") that exact patch release. The minor version wins when both
+// match, as for "1.20" (releases before Go 1.21 had no ".0").
 func (m *Manager) GetVersionConfig(version string) (*VersionConfig, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	config, exists := m.versions[version]
 	if !exists {
+		config, exists = m.patches[version]
+	}
+	if !exists {
+		if patches := m.patchVersionsLocked(MinorVersion(version)); len(patches) > 0 {
+			return nil, fmt.Errorf("Goバージョン %s はインストールされていません（利用可能なパッチ: %s）", version, strings.Join(patches, ", "))
+		}
 		return nil, fmt.Errorf("サポートされていないGoバージョン: %s", version)
 	}
 
 	if !config.Available {
+		if patches := m.patchVersionsLocked(config.Version); len(patches) > 0 {
+			return nil, fmt.Errorf("Goバージョン %s はインストールされていません（利用可能なパッチ: %s）", version, strings.Join(patches, ", "))
+		}
 		return nil, fmt.Errorf("Goバージョン %s はインストールされていません", version)
 	}
 
 	return config, nil
 }
 
+// GetPatchVersions returns the installed patch releases of a minor version, oldest first
+func (m *Manager) GetPatchVersions(version string) []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.patchVersionsLocked(version)
+}
+
+// patchVersionsLocked lists the available patch releases of a minor version; m.mutex must be held
+func (m *Manager) patchVersionsLocked(version string) []string {
+	var patches []string
+	for fullVersion, config := range m.patches {
+		if config.Available && config.Version == version {
+			patches = append(patches, fullVersion)
+		}
+	}
+	sort.Slice(patches, func(i, j int) bool {
+		return compareGoVersions(patches[i], patches[j]) < 0
+	})
+	return patches
+}
+
+// MinorVersion returns the minor version of a Go version ("1.22.7" -> "1.22"), or "" if it is not valid
+func MinorVersion(version string) string {
+	return strings.TrimPrefix(goversion.Lang("go"+version), "go")
+}
+
 // GetAvailableVersions returns all available Go versions
 func (m *Manager) GetAvailableVersions() []string {
 	m.mutex.RLock()
@@ -159,15 +144,24 @@ func (m *Manager) GetAllVersionConfigs() map[string]*VersionConfig {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
+	return copyVersionConfigs(m.versions)
+}
+
+// GetAllPatchConfigs returns the configurations of every known patch release, keyed by full version
+func (m *Manager) GetAllPatchConfigs() map[string]*VersionConfig {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return copyVersionConfigs(m.patches)
+}
+
+// copyVersionConfigs copies a version table; m.mutex must be held
+func copyVersionConfigs(versions map[string]*VersionConfig) map[string]*VersionConfig {
 	// コピーを作成して返す
 	result := make(map[string]*VersionConfig)
-	for version, config := range m.versions {
-		result[version] = &VersionConfig{
-			Version:     config.Version,
-			Path:        config.Path,
-			FullVersion: config.FullVersion,
-			Available:   config.Available,
-		}
+	for version, config := range versions {
+		copied := *config
+		result[version] = &copied
 	}
 
 	return result
@@ -312,6 +306,8 @@ func (m *Manager) Status() map[string]interface{} {
 		"available_versions":        availableCount,
 		"multi_version_support":     true,
 		"explicit_version_required": true,
-		"versions":                  m.GetAllVersionConfigs(),
+		"versions":                  copyVersionConfigs(m.versions),
+		"patches":                   copyVersionConfigs(m.patches),
+		"last_scan":                 m.lastScan,
 	}
 }
@@ -0,0 +1,307 @@
+// Package version - Cross-version execution matrix
+//
+// A matrix runs the same request on several toolchains and, optionally,
+// several environment presets (e.g. GOEXPERIMENT on/off). Outputs are
+// normalized (temporary paths, pointer addresses, goroutine IDs) and
+// compared with the first cell as baseline using a line based LCS diff, so
+// behavior changes such as the Go 1.22 loop variable semantics stand out.
+package version
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMatrixCells limits versions x presets
+	maxMatrixCells = 16
+	// matrixParallelism is the number of cells of one matrix executed at once
+	matrixParallelism = 2
+	// defaultMatrixTimeout is the per-cell timeout when the request does not set one
+	defaultMatrixTimeout = 10 * time.Second
+	// maxDiffLines bounds the LCS table; longer outputs are compared as a whole
+	maxDiffLines = 2000
+)
+
+// EnvPreset is a named set of environment variables for a matrix column
+type EnvPreset struct {
+	Name    string `json:"name"`
+	EnvVars string `json:"env_vars"` // 例: "GOEXPERIMENT=loopvar"
+}
+
+// MatrixRequest runs one request on several versions and env presets
+type MatrixRequest struct {
+	ExecutionRequest
+	Versions   []string    `json:"versions"`
+	EnvPresets []EnvPreset `json:"env_presets,omitempty"` // 省略時は ExecutionRequest.EnvVars のみ
+}
+
+// DiffLine is one line of a diff against the baseline cell
+type DiffLine struct {
+	Op   string `json:"op"` // "equal" / "insert" / "delete"
+	Text string `json:"text"`
+}
+
+// MatrixCell is the result of one version x preset combination
+type MatrixCell struct {
+	Version          string           `json:"version"`
+	Preset           string           `json:"preset"`
+	EnvVars          string           `json:"env_vars,omitempty"`
+	Result           *ExecutionResult `json:"result"`
+	NormalizedOutput string           `json:"normalized_output"`
+	Group            int              `json:"group"` // 正規化後の出力が同じセルは同じグループ番号
+	SameAsBaseline   bool             `json:"same_as_baseline"`
+	Diff             []DiffLine       `json:"diff,omitempty"` // ベースラインとの差分（同一なら省略）
+}
+
+// MatrixResult is the outcome of a matrix execution
+type MatrixResult struct {
+	Cells     []MatrixCell `json:"cells"`
+	Baseline  string       `json:"baseline"`  // 比較基準のセル（"version / preset"）
+	Groups    int          `json:"groups"`    // 出力の種類数
+	Identical bool         `json:"identical"` // 全セルの出力が同一か
+}
+
+// SlotAcquirer obtains an execution slot; the returned release function frees it
+type SlotAcquirer func(ctx context.Context) (func(), error)
+
+// ExecuteMatrix runs req on every version and env preset.
+// acquire (optional) is called before each cell so matrices share the execution scheduler.
+func (e *Executor) ExecuteMatrix(ctx context.Context, req MatrixRequest, acquire SlotAcquirer) (*MatrixResult, error) {
+	if len(req.Versions) == 0 {
+		return nil, fmt.Errorf("比較するバージョンを指定してください")
+	}
+	presets := req.EnvPresets
+	if len(presets) == 0 {
+		presets = []EnvPreset{{Name: "default"}}
+	}
+	if n := len(req.Versions) * len(presets); n > maxMatrixCells {
+		return nil, fmt.Errorf("組み合わせが多すぎます（%d件、上限%d件）", n, maxMatrixCells)
+	}
+	seen := make(map[string]bool)
+	for _, v := range req.Versions {
+		if seen[v] {
+			return nil, fmt.Errorf("バージョンが重複しています: %s", v)
+		}
+		seen[v] = true
+	}
+	if req.Timeout == 0 {
+		req.Timeout = defaultMatrixTimeout
+	}
+
+	cells := make([]MatrixCell, 0, len(req.Versions)*len(presets))
+	for _, v := range req.Versions {
+		for _, preset := range presets {
+			cells = append(cells, MatrixCell{
+				Version: v,
+				Preset:  preset.Name,
+				EnvVars: joinEnvVars(req.EnvVars, preset.EnvVars),
+			})
+		}
+	}
+
+	// セルを並列数を制限して実行
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, matrixParallelism)
+	for i := range cells {
+		wg.Add(1)
+		go func(cell *MatrixCell) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			cell.Result = e.executeMatrixCell(ctx, req.ExecutionRequest, cell, acquire)
+		}(&cells[i])
+	}
+	wg.Wait()
+
+	// 正規化した出力でグループ分けし、ベースラインとの差分を計算
+	groups := make(map[string]int)
+	baseline := ""
+	for i := range cells {
+		cell := &cells[i]
+		cell.NormalizedOutput = NormalizeOutput(cellOutput(cell.Result))
+		group, ok := groups[cell.NormalizedOutput]
+		if !ok {
+			group = len(groups) + 1
+			groups[cell.NormalizedOutput] = group
+		}
+		cell.Group = group
+
+		if i == 0 {
+			baseline = cell.NormalizedOutput
+			cell.SameAsBaseline = true
+			continue
+		}
+		cell.SameAsBaseline = cell.NormalizedOutput == baseline
+		if !cell.SameAsBaseline {
+			cell.Diff = DiffLines(baseline, cell.NormalizedOutput)
+		}
+	}
+
+	return &MatrixResult{
+		Cells:     cells,
+		Baseline:  cells[0].Version + " / " + cells[0].Preset,
+		Groups:    len(groups),
+		Identical: len(groups) == 1,
+	}, nil
+}
+
+// executeMatrixCell validates and runs a single cell
+func (e *Executor) executeMatrixCell(ctx context.Context, base ExecutionRequest, cell *MatrixCell, acquire SlotAcquirer) *ExecutionResult {
+	req := base
+	req.Version = cell.Version
+	req.EnvVars = cell.EnvVars
+	req.AutoDetect = false
+
+	// バージョン固有の検証もセルごとに行う
+	if err := e.ValidateRequest(req); err != nil {
+		result := &ExecutionResult{UsedVersion: cell.Version, Status: StatusError, ExitCode: 1, Error: fmt.Sprintf("コード検証エラー: %v", err)}
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			result.Violations = policyErr.Violations
+		}
+		return result
+	}
+
+	if acquire != nil {
+		release, err := acquire(ctx)
+		if err != nil {
+			return &ExecutionResult{UsedVersion: cell.Version, Status: StatusError, ExitCode: 1, Error: err.Error()}
+		}
+		defer release()
+	}
+
+	result, err := e.Runner().Execute(ctx, req)
+	if err != nil && result.Error == "" {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// cellOutput is the text compared between cells: build output and output followed by the error, if any
+func cellOutput(result *ExecutionResult) string {
+	output := result.BuildOutput + result.Output
+	if result.Error == "" {
+		return output
+	}
+	if output = strings.TrimRight(output, "\n"); output != "" {
+		return output + "\n[error] " + result.Error
+	}
+	return "[error] " + result.Error
+}
+
+// joinEnvVars combines comma separated KEY=VALUE lists
+func joinEnvVars(lists ...string) string {
+	var parts []string
+	for _, list := range lists {
+		if list = strings.TrimSpace(list); list != "" {
+			parts = append(parts, list)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// outputNormalizers remove details that differ between runs but not between behaviors
+var outputNormalizers = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{workDirPattern(), ""},
+	{regexp.MustCompile(`/tmp/\.sandbox/main`), "main"},
+	{regexp.MustCompile(`0x[0-9a-f]{6,16}`), "0xADDR"},
+	{regexp.MustCompile(`goroutine [0-9]+ \[`), "goroutine N ["},
+	{regexp.MustCompile(`\+0x[0-9a-f]+$`), "+0xOFF"},
+	{regexp.MustCompile(`\([0-9]+\.[0-9]+s\)$`), "(Ns)"}, // テスト結果の所要時間
+}
+
+// workDirPattern matches the source directory of an execution ("<TMPDIR>/gocode_<N>/src/"),
+// also through the symlink-resolved temp dir (e.g. /private/var/... on macOS)
+func workDirPattern() *regexp.Regexp {
+	tempDirs := []string{filepath.Clean(os.TempDir())}
+	if resolved, err := filepath.EvalSymlinks(tempDirs[0]); err == nil && resolved != tempDirs[0] {
+		tempDirs = append(tempDirs, resolved)
+	}
+	alternatives := make([]string, len(tempDirs))
+	for i, dir := range tempDirs {
+		alternatives[i] = regexp.QuoteMeta(filepath.ToSlash(dir))
+	}
+	return regexp.MustCompile(`(?:` + strings.Join(alternatives, "|") + `)/` + regexp.QuoteMeta(workDirPrefix) + `[0-9]+/src/`)
+}
+
+// NormalizeOutput strips run specific noise so outputs of different toolchains can be compared
+func NormalizeOutput(output string) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		for _, n := range outputNormalizers {
+			line = n.pattern.ReplaceAllString(line, n.replacement)
+		}
+		lines[i] = line
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// DiffLines returns a line based diff from a to b using the longest common subsequence
+func DiffLines(a, b string) []DiffLine {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+
+	// 大きすぎる出力は全体を置き換えとして扱う
+	if len(aLines) > maxDiffLines || len(bLines) > maxDiffLines {
+		diff := make([]DiffLine, 0, len(aLines)+len(bLines))
+		for _, line := range aLines {
+			diff = append(diff, DiffLine{Op: "delete", Text: line})
+		}
+		for _, line := range bLines {
+			diff = append(diff, DiffLine{Op: "insert", Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i][j] は aLines[i:] と bLines[j:] の最長共通部分列の長さ
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, len(aLines)+len(bLines))
+	i, j := 0, 0
+	for i < len(aLines) && j < len(bLines) {
+		switch {
+		case aLines[i] == bLines[j]:
+			diff = append(diff, DiffLine{Op: "equal", Text: aLines[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "delete", Text: aLines[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "insert", Text: bLines[j]})
+			j++
+		}
+	}
+	for ; i < len(aLines); i++ {
+		diff = append(diff, DiffLine{Op: "delete", Text: aLines[i]})
+	}
+	for ; j < len(bLines); j++ {
+		diff = append(diff, DiffLine{Op: "insert", Text: bLines[j]})
+	}
+	return diff
+}
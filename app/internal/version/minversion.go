@@ -0,0 +1,559 @@
+// Package version - Minimum Go version analysis
+//
+// The sources of a request are type-checked against the standard library of
+// the newest installed toolchain. Every referenced standard library symbol is
+// looked up in the GOROOT/api/go1.N.txt files, which record the release that
+// introduced it, and language features (generics, range over int or func,
+// generic type aliases, min/max/clear) are detected from the typed AST. The
+// highest requirement is the minimum Go version able to build the code.
+package version
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	goversion "go/version"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VersionAuto selects the oldest installed toolchain that can run the code
+const VersionAuto = "auto"
+
+// Version requirement kinds
+const (
+	RequirementLanguage = "language" // 言語機能
+	RequirementAPI      = "api"      // 標準ライブラリのAPI
+	RequirementGoMod    = "go.mod"   // go.mod / go.work の go ディレクティブ
+)
+
+// VersionRequirement is a construct of the code that needs a minimum Go version
+type VersionRequirement struct {
+	Version   string `json:"version"` // 例: "1.22"
+	Kind      string `json:"kind"`
+	Construct string `json:"construct"` // 例: "range over int", "strings.CutPrefix"
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+}
+
+// VersionAnalysis is the result of the minimum version analysis
+type VersionAnalysis struct {
+	MinVersion   string               `json:"min_version,omitempty"` // 必要な最小バージョン（要件がなければ空）
+	Selected     string               `json:"selected,omitempty"`    // auto 指定時に選択されたバージョン
+	Requirements []VersionRequirement `json:"requirements"`          // 構成要素ごとの最初の出現（新しいバージョン順）
+	TypeErrors   []string             `json:"type_errors,omitempty"` // 型チェックエラー（要件が不完全な可能性あり）
+	Toolchain    string               `json:"toolchain"`             // 解析に使用した GOROOT のバージョン
+}
+
+// maxReportedTypeErrors bounds TypeErrors
+const maxReportedTypeErrors = 10
+
+// goDirectivePattern matches the go directive of go.mod / go.work
+var goDirectivePattern = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`)
+
+// versionAnalyzer type-checks code against one GOROOT.
+// Standard library packages are type-checked once and kept for later analyses.
+type versionAnalyzer struct {
+	mutex    sync.Mutex
+	goroot   string
+	api      map[string]string // "pkg.Name" / "pkg.Type.Member" -> 導入バージョン
+	importer *goSourceImporter
+}
+
+var (
+	analyzers     = make(map[string]*versionAnalyzer) // GOROOT -> analyzer
+	analyzersLock sync.Mutex
+)
+
+// getVersionAnalyzer returns the cached analyzer for the toolchain at goPath
+func getVersionAnalyzer(goPath string) (*versionAnalyzer, error) {
+	goroot, err := toolchainGOROOT(goPath)
+	if err != nil {
+		return nil, err
+	}
+
+	analyzersLock.Lock()
+	defer analyzersLock.Unlock()
+	if analyzer, ok := analyzers[goroot]; ok {
+		return analyzer, nil
+	}
+	api, err := loadAPIVersions(goroot)
+	if err != nil {
+		return nil, err
+	}
+	analyzer := &versionAnalyzer{goroot: goroot, api: api, importer: newGoSourceImporter(goroot)}
+	analyzers[goroot] = analyzer
+	return analyzer, nil
+}
+
+// toolchainGOROOT asks the go command for its GOROOT
+func toolchainGOROOT(goPath string) (string, error) {
+	// #nosec G204 - goPath is from trusted configuration
+	cmd := exec.Command(goPath, "env", "GOROOT")
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("GOROOTの取得に失敗しました (%s): %w", goPath, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// loadAPIVersions reads GOROOT/api/go1.N.txt into a symbol -> version map.
+// Symbols of go1.txt (Go 1.0) are omitted since every toolchain has them.
+func loadAPIVersions(goroot string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(goroot, "api", "go1.*.txt"))
+	if err != nil || len(files) == 0 {
+		return nil, fmt.Errorf("APIファイルが見つかりません: %s", filepath.Join(goroot, "api"))
+	}
+
+	api := make(map[string]string)
+	for _, file := range files {
+		version := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "go"), ".txt")
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("APIファイル読み込みエラー: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key := apiKeyFromLine(scanner.Text())
+			if key == "" {
+				continue
+			}
+			if current, ok := api[key]; !ok || compareGoVersions(version, current) < 0 {
+				api[key] = version
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("APIファイル読み込みエラー: %w", err)
+		}
+	}
+	return api, nil
+}
+
+// apiKeyFromLine converts a line such as
+//
+//	pkg time, method (Time) Compare(Time) int #50770
+//	pkg net/http, type Request struct, Pattern string #61410
+//
+// into the key "time.Time.Compare" / "net/http.Request.Pattern".
+func apiKeyFromLine(line string) string {
+	rest, ok := strings.CutPrefix(line, "pkg ")
+	if !ok {
+		return ""
+	}
+	pkgPart, decl, ok := strings.Cut(rest, ", ")
+	if !ok {
+		return ""
+	}
+	pkg, _, _ := strings.Cut(pkgPart, " ") // "syscall (linux-386)" -> "syscall"
+
+	kind, decl, _ := strings.Cut(decl, " ")
+	switch kind {
+	case "func", "const", "var":
+		return pkg + "." + identPrefix(decl)
+	case "method":
+		// "(*T[$0]) Name(...)"
+		recv, method, ok := strings.Cut(strings.TrimPrefix(decl, "("), ") ")
+		if !ok {
+			return ""
+		}
+		return pkg + "." + identPrefix(strings.TrimPrefix(recv, "*")) + "." + identPrefix(method)
+	case "type":
+		name := identPrefix(decl)
+		// "Name struct, Field T" / "Name interface, Method(...)"
+		if _, member, ok := strings.Cut(decl, ", "); ok {
+			if strings.HasPrefix(member, "embedded ") || strings.HasPrefix(member, "unexported ") {
+				return ""
+			}
+			return pkg + "." + name + "." + identPrefix(member)
+		}
+		return pkg + "." + name
+	}
+	return ""
+}
+
+// identPrefix returns the leading identifier of s
+func identPrefix(s string) string {
+	end := strings.IndexAny(s, " ([,")
+	if end < 0 {
+		return s
+	}
+	return s[:end]
+}
+
+// compareGoVersions compares "1.N" style versions
+func compareGoVersions(a, b string) int {
+	return goversion.Compare("go"+a, "go"+b)
+}
+
+// analyze type-checks the Go sources and files of a request
+func (a *versionAnalyzer) analyze(sources map[string]string, files map[string]string) *VersionAnalysis {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	analysis := &VersionAnalysis{Requirements: []VersionRequirement{}}
+	found := make(map[string]VersionRequirement)
+	add := func(r VersionRequirement) {
+		key := r.Kind + ":" + r.Construct
+		if existing, ok := found[key]; ok && (existing.File < r.File ||
+			existing.File == r.File && (existing.Line < r.Line || existing.Line == r.Line && existing.Column <= r.Column)) {
+			return
+		}
+		found[key] = r
+	}
+
+	// go.mod / go.work の go ディレクティブ
+	for _, name := range []string{"go.mod", "go.work"} {
+		if m := goDirectivePattern.FindStringSubmatchIndex(files[name]); m != nil {
+			line := strings.Count(files[name][:m[0]], "\n") + 1
+			add(VersionRequirement{Version: files[name][m[2]:m[3]], Kind: RequirementGoMod, Construct: "go " + files[name][m[2]:m[3]], File: name, Line: line, Column: 1})
+		}
+	}
+
+	fset := token.NewFileSet()
+	for _, pkgFiles := range groupSourcePackages(fset, sources) {
+		info := &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		}
+		conf := types.Config{
+			Importer: a.importer,
+			Error: func(err error) {
+				if len(analysis.TypeErrors) < maxReportedTypeErrors {
+					analysis.TypeErrors = append(analysis.TypeErrors, err.Error())
+				}
+			},
+		}
+		pkg, _ := conf.Check(pkgFiles[0].Name.Name, fset, pkgFiles, info)
+		for _, r := range a.requirements(fset, pkg, pkgFiles, info) {
+			add(r)
+		}
+	}
+
+	for _, r := range found {
+		analysis.Requirements = append(analysis.Requirements, r)
+		if analysis.MinVersion == "" || compareGoVersions(r.Version, analysis.MinVersion) > 0 {
+			analysis.MinVersion = r.Version
+		}
+	}
+	sort.Slice(analysis.Requirements, func(i, j int) bool {
+		ri, rj := analysis.Requirements[i], analysis.Requirements[j]
+		if c := compareGoVersions(ri.Version, rj.Version); c != 0 {
+			return c > 0
+		}
+		if ri.File != rj.File {
+			return ri.File < rj.File
+		}
+		if ri.Line != rj.Line {
+			return ri.Line < rj.Line
+		}
+		return ri.Column < rj.Column
+	})
+	return analysis
+}
+
+// groupSourcePackages parses the sources and groups them by directory and package name
+func groupSourcePackages(fset *token.FileSet, sources map[string]string) [][]*ast.File {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make(map[string][]*ast.File)
+	var order []string
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, name, sources[name], parser.SkipObjectResolution)
+		if err != nil && file == nil {
+			continue
+		}
+		key := path.Dir(name) + ":" + file.Name.Name
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], file)
+	}
+
+	packages := make([][]*ast.File, 0, len(order))
+	for _, key := range order {
+		packages = append(packages, groups[key])
+	}
+	return packages
+}
+
+// requirements lists the version requirements of one type-checked package
+func (a *versionAnalyzer) requirements(fset *token.FileSet, pkg *types.Package, files []*ast.File, info *types.Info) []VersionRequirement {
+	var reqs []VersionRequirement
+	add := func(node ast.Node, version, kind, construct string) {
+		position := fset.Position(node.Pos())
+		reqs = append(reqs, VersionRequirement{
+			Version:   version,
+			Kind:      kind,
+			Construct: construct,
+			File:      position.Filename,
+			Line:      position.Line,
+			Column:    position.Column,
+		})
+	}
+	api := func(node ast.Node, obj types.Object, member string) {
+		if obj == nil || obj.Pkg() == nil || obj.Pkg() == pkg {
+			return
+		}
+		key := obj.Pkg().Path() + "." + obj.Name()
+		if member != "" {
+			key += "." + member
+		}
+		if version, ok := a.api[key]; ok {
+			add(node, version, RequirementAPI, key)
+		}
+	}
+
+	// 言語機能
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.TypeSpec:
+				if node.TypeParams != nil && node.Assign.IsValid() {
+					add(node, "1.24", RequirementLanguage, "generic type alias")
+				} else if node.TypeParams != nil {
+					add(node.TypeParams, "1.18", RequirementLanguage, "generics")
+				}
+			case *ast.FuncType:
+				if node.TypeParams != nil {
+					add(node.TypeParams, "1.18", RequirementLanguage, "generics")
+				}
+			case *ast.RangeStmt:
+				if tv, ok := info.Types[node.X]; ok && tv.Type != nil {
+					switch t := tv.Type.Underlying().(type) {
+					case *types.Basic:
+						if t.Info()&types.IsInteger != 0 {
+							add(node, "1.22", RequirementLanguage, "range over int")
+						}
+					case *types.Signature:
+						add(node, "1.23", RequirementLanguage, "range over func")
+					}
+				}
+			case *ast.CompositeLit:
+				// 構造体リテラルのフィールド名
+				named := namedType(info.Types[node].Type)
+				if named == nil {
+					return true
+				}
+				for _, elt := range node.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						if key, ok := kv.Key.(*ast.Ident); ok {
+							if _, isField := info.Uses[key].(*types.Var); isField {
+								api(key, named.Obj(), key.Name)
+							}
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	// 参照されている識別子
+	for ident, obj := range info.Uses {
+		switch obj := obj.(type) {
+		case *types.Builtin:
+			switch obj.Name() {
+			case "min", "max", "clear":
+				add(ident, "1.21", RequirementLanguage, "builtin "+obj.Name())
+			}
+		case *types.TypeName:
+			if obj.Pkg() == nil && (obj.Name() == "any" || obj.Name() == "comparable") {
+				add(ident, "1.18", RequirementLanguage, obj.Name())
+				continue
+			}
+			if isPackageLevel(obj) {
+				api(ident, obj, "")
+			}
+		case *types.Func:
+			obj = obj.Origin()
+			sig, _ := obj.Type().(*types.Signature)
+			if sig != nil && sig.Recv() != nil {
+				if named := namedType(sig.Recv().Type()); named != nil {
+					api(ident, named.Obj(), obj.Name())
+				}
+				continue
+			}
+			api(ident, obj, "")
+		case *types.Var, *types.Const:
+			if isPackageLevel(obj) {
+				api(ident, obj, "")
+			}
+		}
+	}
+
+	// フィールドの参照（埋め込みによる昇格は除く）
+	for selector, selection := range info.Selections {
+		if selection.Kind() != types.FieldVal || len(selection.Index()) != 1 {
+			continue
+		}
+		if named := namedType(selection.Recv()); named != nil {
+			api(selector.Sel, named.Obj(), selection.Obj().Name())
+		}
+	}
+	return reqs
+}
+
+// isPackageLevel reports whether obj is declared at package scope
+func isPackageLevel(obj types.Object) bool {
+	return obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope()
+}
+
+// namedType returns the (generic origin of the) named type of t or *t
+func namedType(t types.Type) *types.Named {
+	if t == nil {
+		return nil
+	}
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return nil
+	}
+	return named.Origin()
+}
+
+// goSourceImporter type-checks standard library packages from GOROOT sources
+// (function bodies are skipped). It is used under versionAnalyzer.mutex.
+type goSourceImporter struct {
+	ctxt     build.Context
+	fset     *token.FileSet
+	packages map[string]*types.Package // nil は読み込み中（循環検出）
+}
+
+// newGoSourceImporter creates an importer for the standard library of goroot
+func newGoSourceImporter(goroot string) *goSourceImporter {
+	ctxt := build.Default
+	ctxt.GOROOT = goroot
+	ctxt.GOPATH = ""
+	ctxt.CgoEnabled = false
+	// JoinPath を設定すると go/build は go list を呼び出さない（標準ライブラリのみ対象）
+	ctxt.JoinPath = filepath.Join
+	return &goSourceImporter{
+		ctxt:     ctxt,
+		fset:     token.NewFileSet(),
+		packages: make(map[string]*types.Package),
+	}
+}
+
+// Import implements types.Importer
+func (s *goSourceImporter) Import(importPath string) (*types.Package, error) {
+	return s.ImportFrom(importPath, "", 0)
+}
+
+// ImportFrom implements types.ImporterFrom
+func (s *goSourceImporter) ImportFrom(importPath, dir string, _ types.ImportMode) (*types.Package, error) {
+	if importPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	// 標準ライブラリ以外（ドメイン付きのパス）は GOROOT 内の vendor のみ解決する
+	srcDir := dir
+	if !strings.HasPrefix(dir, s.ctxt.GOROOT) {
+		srcDir = ""
+		if first, _, _ := strings.Cut(importPath, "/"); strings.Contains(first, ".") {
+			return nil, fmt.Errorf("標準ライブラリ以外のパッケージは解析できません: %s", importPath)
+		}
+	}
+
+	bp, err := s.ctxt.Import(importPath, srcDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !bp.Goroot {
+		return nil, fmt.Errorf("標準ライブラリ以外のパッケージは解析できません: %s", importPath)
+	}
+	if pkg, ok := s.packages[bp.ImportPath]; ok {
+		if pkg == nil {
+			return nil, fmt.Errorf("importが循環しています: %s", bp.ImportPath)
+		}
+		return pkg, nil
+	}
+	s.packages[bp.ImportPath] = nil
+
+	files := make([]*ast.File, 0, len(bp.GoFiles))
+	for _, name := range bp.GoFiles {
+		file, err := parser.ParseFile(s.fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			delete(s.packages, bp.ImportPath)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	conf := types.Config{
+		Importer:         s,
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		Sizes:            types.SizesFor("gc", s.ctxt.GOARCH),
+		Error:            func(error) {}, // 標準ライブラリ内の警告は無視して続行
+	}
+	pkg, _ := conf.Check(bp.ImportPath, s.fset, files, nil)
+	s.packages[bp.ImportPath] = pkg
+	return pkg, nil
+}
+
+// AnalyzeVersion reports the minimum Go version required by the sources of req,
+// using the standard library and API files of the newest installed toolchain.
+func (e *Executor) AnalyzeVersion(req ExecutionRequest) (*VersionAnalysis, error) {
+	versions := e.installedVersions()
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("インストール済みのGoバージョンがありません")
+	}
+	newest, err := e.manager.GetVersionConfig(versions[len(versions)-1])
+	if err != nil {
+		return nil, err
+	}
+	analyzer, err := getVersionAnalyzer(newest.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := analyzer.analyze(goSources(req), req.Files)
+	analysis.Toolchain = newest.Version
+	return analysis, nil
+}
+
+// SelectVersion analyzes req and selects the oldest installed version that satisfies it
+func (e *Executor) SelectVersion(req ExecutionRequest) (*VersionAnalysis, error) {
+	analysis, err := e.AnalyzeVersion(req)
+	if err != nil {
+		return nil, err
+	}
+	versions := e.installedVersions()
+	for _, v := range versions {
+		if analysis.MinVersion == "" || compareGoVersions(v, analysis.MinVersion) >= 0 {
+			analysis.Selected = v
+			log.Printf("[DEBUG] SelectVersion: min=%q, selected=%s", analysis.MinVersion, v)
+			return analysis, nil
+		}
+	}
+	return analysis, fmt.Errorf("このコードにはGo %s 以上が必要です（インストール済み: %s）", analysis.MinVersion, strings.Join(versions, ", "))
+}
+
+// installedVersions returns the available versions, oldest first
+func (e *Executor) installedVersions() []string {
+	versions := e.manager.GetAvailableVersions()
+	sort.Slice(versions, func(i, j int) bool {
+		return compareGoVersions(versions[i], versions[j]) < 0
+	})
+	return versions
+}
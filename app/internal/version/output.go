@@ -0,0 +1,171 @@
+// Package version - Output capture with size limits
+//
+// This file implements the recorder that captures stdout and stderr of
+// toolchain and snippet processes separately while keeping the order in
+// which chunks arrived, and enforces a byte cap on the total output.
+package version
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Output stream names
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// defaultMaxOutputBytes is used when neither the request nor MAX_OUTPUT_BYTES sets a cap
+const defaultMaxOutputBytes = 1 << 20
+
+// OutputEvent is a chunk of output in the order it was produced
+type OutputEvent struct {
+	Stream string `json:"stream"` // "stdout" / "stderr"
+	Data   string `json:"data"`
+}
+
+// outputRecorder captures stdout/stderr separately and as ordered events
+type outputRecorder struct {
+	mu        sync.Mutex
+	limit     int64
+	written   int64
+	combined  strings.Builder
+	stdout    strings.Builder
+	stderr    strings.Builder
+	events    []OutputEvent   // 完了したイベント
+	open      strings.Builder // 最後のイベントのデータ（ストリームが変わるまで追記する）
+	stream    string          // 最後のイベントのストリーム
+	truncated bool
+	overflow  chan struct{}
+	onOutput  outputFunc
+}
+
+// newOutputRecorder creates a recorder capped at limit bytes (0 or less means unlimited)
+func newOutputRecorder(limit int64, onOutput outputFunc) *outputRecorder {
+	return &outputRecorder{
+		limit:    limit,
+		overflow: make(chan struct{}),
+		onOutput: onOutput,
+	}
+}
+
+// writer returns an io.Writer that records into the named stream
+func (r *outputRecorder) writer(stream string) recorderWriter {
+	return recorderWriter{recorder: r, stream: stream}
+}
+
+// Overflow is closed once the byte cap has been exceeded
+func (r *outputRecorder) Overflow() <-chan struct{} {
+	return r.overflow
+}
+
+// record appends p to stream, truncating at the cap.
+// Writes never fail so that the process is not disturbed by EPIPE; the
+// caller stops the process via Overflow instead.
+func (r *outputRecorder) record(stream string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.truncated {
+		return
+	}
+
+	data := p
+	if r.limit > 0 && r.written+int64(len(data)) > r.limit {
+		data = data[:r.limit-r.written]
+		r.truncated = true
+		close(r.overflow)
+	}
+	if len(data) == 0 {
+		return
+	}
+	r.written += int64(len(data))
+
+	r.combined.Write(data)
+	if stream == StreamStderr {
+		r.stderr.Write(data)
+	} else {
+		r.stdout.Write(data)
+	}
+
+	// 同じストリームの連続した書き込みは1つのイベントにまとめる（文字列にするのはストリームが変わったとき）
+	if stream != r.stream {
+		r.closeEvent()
+		r.stream = stream
+	}
+	r.open.Write(data)
+
+	if r.onOutput != nil {
+		r.onOutput(stream, data)
+	}
+}
+
+// closeEvent moves the open event to events; r.mu must be held
+func (r *outputRecorder) closeEvent() {
+	if r.open.Len() == 0 {
+		return
+	}
+	r.events = append(r.events, OutputEvent{Stream: r.stream, Data: r.open.String()})
+	r.open = strings.Builder{}
+}
+
+// outputSnapshot is a copy of everything recorded so far
+type outputSnapshot struct {
+	Combined  string
+	Stdout    string
+	Stderr    string
+	Events    []OutputEvent
+	Truncated bool
+}
+
+// Snapshot returns the recorded output
+func (r *outputRecorder) Snapshot() outputSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]OutputEvent, len(r.events), len(r.events)+1)
+	copy(events, r.events)
+	if r.open.Len() > 0 {
+		events = append(events, OutputEvent{Stream: r.stream, Data: r.open.String()})
+	}
+
+	return outputSnapshot{
+		Combined:  r.combined.String(),
+		Stdout:    r.stdout.String(),
+		Stderr:    r.stderr.String(),
+		Events:    events,
+		Truncated: r.truncated,
+	}
+}
+
+// recorderWriter is the io.Writer for one stream of an outputRecorder
+type recorderWriter struct {
+	recorder *outputRecorder
+	stream   string
+}
+
+func (w recorderWriter) Write(p []byte) (int, error) {
+	w.recorder.record(w.stream, p)
+	return len(p), nil
+}
+
+var (
+	maxOutputBytesOnce  sync.Once
+	maxOutputBytesValue int64
+)
+
+// defaultOutputLimit returns the cap from MAX_OUTPUT_BYTES or the built-in default
+func defaultOutputLimit() int64 {
+	maxOutputBytesOnce.Do(func() {
+		maxOutputBytesValue = defaultMaxOutputBytes
+		if value := os.Getenv("MAX_OUTPUT_BYTES"); value != "" {
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+				maxOutputBytesValue = n
+			}
+		}
+	})
+	return maxOutputBytesValue
+}
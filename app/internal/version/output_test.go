@@ -0,0 +1,72 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputRecorder(t *testing.T) {
+	var streamed strings.Builder
+	rec := newOutputRecorder(0, func(stream string, data []byte) {
+		streamed.Write(data)
+	})
+	rec.writer(StreamStdout).Write([]byte("a"))
+	rec.writer(StreamStdout).Write([]byte("b"))
+	rec.writer(StreamStderr).Write([]byte("E"))
+	rec.writer(StreamStdout).Write([]byte("c"))
+
+	// 記録中のスナップショットは後の書き込みの影響を受けない
+	before := rec.Snapshot()
+	rec.writer(StreamStdout).Write([]byte("d"))
+
+	got := rec.Snapshot()
+	want := []OutputEvent{{StreamStdout, "ab"}, {StreamStderr, "E"}, {StreamStdout, "cd"}}
+	if len(got.Events) != len(want) {
+		t.Fatalf("events = %v, want %v", got.Events, want)
+	}
+	for i := range want {
+		if got.Events[i] != want[i] {
+			t.Errorf("events[%d] = %v, want %v", i, got.Events[i], want[i])
+		}
+	}
+	if got.Combined != "abEcd" || got.Stdout != "abcd" || got.Stderr != "E" || got.Truncated {
+		t.Errorf("snapshot = %+v", got)
+	}
+	if before.Combined != "abEc" || len(before.Events) != 3 || before.Events[2].Data != "c" {
+		t.Errorf("earlier snapshot changed: %+v", before)
+	}
+	if streamed.String() != "abEcd" {
+		t.Errorf("streamed %q", streamed.String())
+	}
+}
+
+func TestOutputRecorderLimit(t *testing.T) {
+	rec := newOutputRecorder(5, nil)
+	rec.writer(StreamStdout).Write([]byte("abc"))
+	rec.writer(StreamStderr).Write([]byte("defg"))
+	rec.writer(StreamStdout).Write([]byte("h"))
+
+	select {
+	case <-rec.Overflow():
+	default:
+		t.Error("Overflow is not closed")
+	}
+	got := rec.Snapshot()
+	if got.Combined != "abcde" || got.Stdout != "abc" || got.Stderr != "de" || !got.Truncated || len(got.Events) != 2 {
+		t.Errorf("snapshot = %+v", got)
+	}
+}
+
+func TestOutputRecorderManyWrites(t *testing.T) {
+	// ループで1行ずつ出力するプログラム（上限の1MiBまで）
+	const lines = 1 << 17
+	rec := newOutputRecorder(defaultMaxOutputBytes, nil)
+	w := rec.writer(StreamStdout)
+	for range lines {
+		w.Write([]byte("0123456\n"))
+	}
+	got := rec.Snapshot()
+	if len(got.Events) != 1 || len(got.Events[0].Data) != lines*8 || got.Combined != got.Stdout || got.Truncated {
+		t.Errorf("snapshot = %d events, %d bytes, truncated %v", len(got.Events), len(got.Combined), got.Truncated)
+	}
+}
@@ -0,0 +1,352 @@
+// Package version - AST based code policy
+//
+// Submitted sources are parsed with go/parser and checked against a
+// per-deployment policy: imported packages, references to package level
+// functions (resolved through the file's imports, so aliases and comments
+// are handled correctly), compiler directives and language features that the
+// selected Go version does not support. Every violation carries its
+// position so the editor can point at the offending line.
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	goversion "go/version"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultPolicyFile is used when CODE_POLICY_FILE is not set
+const defaultPolicyFile = "config/policy.json"
+
+// Policy violation rules
+const (
+	RuleDeniedPackage     = "denied_package"
+	RulePackageNotAllowed = "package_not_allowed"
+	RuleDeniedFunc        = "denied_func"
+	RuleDeniedDirective   = "denied_directive"
+	RuleVersionFeature    = "version_feature"
+)
+
+// PolicyRules restricts imports, function references and directives
+type PolicyRules struct {
+	DeniedPackages   []string `json:"denied_packages,omitempty"`   // 例: "unsafe", "golang.org/x/sys/..."
+	AllowedPackages  []string `json:"allowed_packages,omitempty"`  // 空でなければ、これ以外の import を拒否
+	DeniedFuncs      []string `json:"denied_funcs,omitempty"`      // import パス.名前（例: "os.RemoveAll", "os.Remove*"）
+	AllowedFuncs     []string `json:"allowed_funcs,omitempty"`     // 拒否されたパッケージ・関数の例外（例: "unsafe.Sizeof"）
+	DeniedDirectives []string `json:"denied_directives,omitempty"` // 例: "go:linkname"
+}
+
+// Policy is the code policy of a deployment
+type Policy struct {
+	PolicyRules
+	Versions map[string]PolicyRules `json:"versions,omitempty"` // バージョン別の追加ルール（例: "1.21"）
+}
+
+// PolicyViolation is a single policy violation with its source position
+type PolicyViolation struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Target  string `json:"target"` // import パス・関数・ディレクティブ・機能名
+	Message string `json:"message"`
+}
+
+// String formats the violation like a compiler error
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", v.File, v.Line, v.Column, v.Message)
+}
+
+// PolicyError is returned when a request violates the code policy
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = v.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DefaultPolicy returns the policy used when no policy file is configured
+func DefaultPolicy() *Policy {
+	return &Policy{PolicyRules: PolicyRules{
+		DeniedPackages:   []string{"C", "os/exec", "plugin", "syscall", "unsafe", "golang.org/x/sys/..."},
+		DeniedFuncs:      []string{"os.Remove", "os.RemoveAll"},
+		DeniedDirectives: []string{"go:linkname"},
+	}}
+}
+
+// LoadPolicy reads a policy from a JSON file
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ポリシーファイル読み込みエラー: %w", err)
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("ポリシーファイル解析エラー: %w", err)
+	}
+	return &policy, nil
+}
+
+var (
+	globalPolicy     *Policy
+	globalPolicyOnce sync.Once
+)
+
+// GetPolicy returns the process-wide code policy (CODE_POLICY_FILE, config/policy.json or the default)
+func GetPolicy() *Policy {
+	globalPolicyOnce.Do(func() {
+		filename := os.Getenv("CODE_POLICY_FILE")
+		if filename == "" {
+			if _, err := os.Stat(defaultPolicyFile); err != nil {
+				globalPolicy = DefaultPolicy()
+				return
+			}
+			filename = defaultPolicyFile
+		}
+		policy, err := LoadPolicy(filename)
+		if err != nil {
+			log.Printf("[WARN] Policy: %v; using the default policy", err)
+			policy = DefaultPolicy()
+		} else {
+			log.Printf("Policy: %s", filename)
+		}
+		globalPolicy = policy
+	})
+	return globalPolicy
+}
+
+// rulesFor returns the base rules combined with the overrides of goVersion
+func (p *Policy) rulesFor(goVersion string) PolicyRules {
+	rules := p.PolicyRules
+	lang := goversion.Lang("go" + goVersion)
+	if lang == "" {
+		return rules
+	}
+	// キーは "1.22" のようなマイナーバージョン（パッチ指定でも一致）
+	for key, override := range p.Versions {
+		if goversion.Lang("go"+key) != lang {
+			continue
+		}
+		rules.DeniedPackages = append(append([]string(nil), rules.DeniedPackages...), override.DeniedPackages...)
+		rules.AllowedPackages = append(append([]string(nil), rules.AllowedPackages...), override.AllowedPackages...)
+		rules.DeniedFuncs = append(append([]string(nil), rules.DeniedFuncs...), override.DeniedFuncs...)
+		rules.AllowedFuncs = append(append([]string(nil), rules.AllowedFuncs...), override.AllowedFuncs...)
+		rules.DeniedDirectives = append(append([]string(nil), rules.DeniedDirectives...), override.DeniedDirectives...)
+	}
+	return rules
+}
+
+// Check evaluates a Go source file against the policy for goVersion.
+// Files that do not parse are checked as far as the parser got; the compiler reports the syntax errors.
+func (p *Policy) Check(filename, code, goVersion string) []PolicyViolation {
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, filename, code, parser.ParseComments|parser.AllErrors)
+	if file == nil {
+		return nil
+	}
+
+	rules := p.rulesFor(goVersion)
+	var violations []PolicyViolation
+	report := func(pos token.Pos, rule, target, message string) {
+		position := fset.Position(pos)
+		violations = append(violations, PolicyViolation{
+			File:    filename,
+			Line:    position.Line,
+			Column:  position.Column,
+			Rule:    rule,
+			Target:  target,
+			Message: message,
+		})
+	}
+
+	// コンパイラディレクティブ
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			for _, directive := range rules.DeniedDirectives {
+				if isDirective(comment.Text, directive) {
+					report(comment.Slash, RuleDeniedDirective, directive,
+						fmt.Sprintf("セキュリティ上の理由により、'//%s' ディレクティブは使用できません", directive))
+				}
+			}
+		}
+	}
+
+	// import（ローカル名 -> パス）
+	imports := make(map[string]string)
+	restricted := make(map[string]bool) // 例外の関数のみ使用できるパッケージ
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+
+		switch {
+		case len(rules.AllowedPackages) > 0 && !matchPackage(rules.AllowedPackages, importPath):
+			report(spec.Path.Pos(), RulePackageNotAllowed, importPath,
+				fmt.Sprintf("パッケージ '%s' は許可されていません", importPath))
+			continue
+		case matchPackage(rules.DeniedPackages, importPath):
+			// 例外の関数があれば参照ごとに検査する（ブランク・ドットimportは不可）
+			if name == "_" || name == "." || !hasFuncOf(rules.AllowedFuncs, importPath) {
+				report(spec.Path.Pos(), RuleDeniedPackage, importPath,
+					fmt.Sprintf("セキュリティ上の理由により、パッケージ '%s' は使用できません", importPath))
+				continue
+			}
+			restricted[importPath] = true
+		case name == "." && hasFuncOf(rules.DeniedFuncs, importPath):
+			report(spec.Path.Pos(), RuleDeniedFunc, importPath,
+				fmt.Sprintf("使用が制限された関数を含むパッケージ '%s' はドットimportできません", importPath))
+			continue
+		}
+		imports[name] = importPath
+	}
+
+	// パッケージの関数・変数の参照
+	ast.Inspect(file, func(n ast.Node) bool {
+		selector, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := selector.X.(*ast.Ident)
+		// ローカルに宣言された識別子（Obj != nil）はパッケージ名ではない
+		if !ok || ident.Obj != nil {
+			return true
+		}
+		importPath, ok := imports[ident.Name]
+		if !ok {
+			return true
+		}
+		target := importPath + "." + selector.Sel.Name
+		if matchFunc(rules.AllowedFuncs, target) {
+			return true
+		}
+		if restricted[importPath] || matchFunc(rules.DeniedFuncs, target) {
+			report(selector.Pos(), RuleDeniedFunc, target,
+				fmt.Sprintf("セキュリティ上の理由により、'%s' は使用できません", target))
+		}
+		return true
+	})
+
+	violations = append(violations, checkVersionFeatures(fset, file, filename, goVersion)...)
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].Line != violations[j].Line {
+			return violations[i].Line < violations[j].Line
+		}
+		return violations[i].Column < violations[j].Column
+	})
+	return violations
+}
+
+// checkVersionFeatures reports language features that goVersion does not support
+func checkVersionFeatures(fset *token.FileSet, file *ast.File, filename, goVersion string) []PolicyViolation {
+	lang := "go" + goVersion
+	if !goversion.IsValid(lang) || goversion.Compare(lang, "go1.18") >= 0 {
+		return nil
+	}
+
+	// Go 1.18未満でのジェネリクス（型パラメータ）
+	var violations []PolicyViolation
+	ast.Inspect(file, func(n ast.Node) bool {
+		var params *ast.FieldList
+		switch node := n.(type) {
+		case *ast.TypeSpec:
+			params = node.TypeParams
+		case *ast.FuncType:
+			params = node.TypeParams
+		}
+		if params == nil || len(params.List) == 0 {
+			return true
+		}
+		position := fset.Position(params.Pos())
+		violations = append(violations, PolicyViolation{
+			File:    filename,
+			Line:    position.Line,
+			Column:  position.Column,
+			Rule:    RuleVersionFeature,
+			Target:  "generics",
+			Message: fmt.Sprintf("ジェネリクスはGo 1.18以降で利用可能です（現在: %s）", goVersion),
+		})
+		return true
+	})
+	return violations
+}
+
+// isDirective reports whether a comment is the given directive (e.g. "//go:linkname a b")
+func isDirective(comment, directive string) bool {
+	rest, ok := strings.CutPrefix(comment, "//"+directive)
+	return ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t')
+}
+
+// importName guesses the package name of an import path (last element without a major version suffix)
+func importName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 && isMajorVersion(name[i+1:]) {
+		name = name[:i] // gopkg.in/yaml.v3
+	}
+	return name
+}
+
+// isMajorVersion reports whether s looks like "v2"
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+// matchPackage reports whether importPath matches one of the patterns ("pkg" or "pkg/...")
+func matchPackage(patterns []string, importPath string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+			if importPath == prefix || strings.HasPrefix(importPath, prefix+"/") {
+				return true
+			}
+		} else if importPath == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFunc reports whether target ("import/path.Name") matches one of the patterns
+func matchFunc(patterns []string, target string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, target); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFuncOf reports whether one of the function patterns refers to importPath
+func hasFuncOf(patterns []string, importPath string) bool {
+	for _, pattern := range patterns {
+		if i := strings.LastIndex(pattern, "."); i > 0 && pattern[:i] == importPath {
+			return true
+		}
+	}
+	return false
+}
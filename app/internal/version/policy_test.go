@@ -0,0 +1,203 @@
+package version
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *Policy
+		code    string
+		version string
+		want    []PolicyViolation // File・Message は比較しない
+	}{
+		{
+			name: "allowed imports",
+			code: "package main\nimport (\n\t\"fmt\"\n\t\"os\"\n)\nfunc main() { fmt.Println(os.Args) }\n",
+		},
+		{
+			name: "denied package",
+			code: "package main\nimport \"os/exec\"\nfunc main() { exec.Command(\"ls\") }\n",
+			want: []PolicyViolation{{Line: 2, Column: 8, Rule: RuleDeniedPackage, Target: "os/exec"}},
+		},
+		{
+			name: "denied package pattern",
+			code: "package main\nimport \"golang.org/x/sys/unix\"\nfunc main() { unix.Getpid() }\n",
+			want: []PolicyViolation{{Line: 2, Column: 8, Rule: RuleDeniedPackage, Target: "golang.org/x/sys/unix"}},
+		},
+		{
+			name: "aliased unsafe",
+			code: "package main\nimport u \"unsafe\"\nfunc main() { _ = u.Pointer(nil) }\n",
+			want: []PolicyViolation{{Line: 2, Column: 10, Rule: RuleDeniedPackage, Target: "unsafe"}},
+		},
+		{
+			name: "blank import of denied package",
+			code: "package main\nimport _ \"unsafe\"\nfunc main() {}\n",
+			want: []PolicyViolation{{Line: 2, Column: 10, Rule: RuleDeniedPackage, Target: "unsafe"}},
+		},
+		{
+			name: "dot import of denied package",
+			code: "package main\nimport . \"syscall\"\nfunc main() { Getpid() }\n",
+			want: []PolicyViolation{{Line: 2, Column: 10, Rule: RuleDeniedPackage, Target: "syscall"}},
+		},
+		{
+			name: "dot import of package with denied funcs",
+			code: "package main\nimport . \"os\"\nfunc main() { Remove(\"x\") }\n",
+			want: []PolicyViolation{{Line: 2, Column: 10, Rule: RuleDeniedFunc, Target: "os"}},
+		},
+		{
+			name: "blank import of package with denied funcs",
+			code: "package main\nimport _ \"os\"\nfunc main() {}\n",
+		},
+		{
+			name: "denied func",
+			code: "package main\nimport \"os\"\nfunc main() { os.RemoveAll(\"/\") }\n",
+			want: []PolicyViolation{{Line: 3, Column: 15, Rule: RuleDeniedFunc, Target: "os.RemoveAll"}},
+		},
+		{
+			name: "denied func through alias",
+			code: "package main\nimport files \"os\"\nfunc main() { files.Remove(\"x\") }\n",
+			want: []PolicyViolation{{Line: 3, Column: 15, Rule: RuleDeniedFunc, Target: "os.Remove"}},
+		},
+		{
+			name: "local identifier shadowing package name",
+			code: "package main\ntype T struct{}\nfunc (T) Remove(string) {}\nfunc main() { var os T; os.Remove(\"x\") }\n",
+		},
+		{
+			name: "linkname directive",
+			code: "package main\nimport _ \"embed\"\n//go:linkname now time.now\nfunc now() (int64, int32, int64)\nfunc main() {}\n",
+			want: []PolicyViolation{{Line: 3, Column: 1, Rule: RuleDeniedDirective, Target: "go:linkname"}},
+		},
+		{
+			name: "linkname mentioned in a comment",
+			code: "package main\n// go:linkname is not a directive with a space\n//go:linknamefoo\nfunc main() {}\n",
+		},
+		{
+			name:   "allowed func of denied package",
+			policy: &Policy{PolicyRules: PolicyRules{DeniedPackages: []string{"unsafe"}, AllowedFuncs: []string{"unsafe.Sizeof"}}},
+			code:   "package main\nimport \"unsafe\"\nfunc main() { _ = unsafe.Sizeof(0); _ = unsafe.Pointer(nil) }\n",
+			want:   []PolicyViolation{{Line: 3, Column: 41, Rule: RuleDeniedFunc, Target: "unsafe.Pointer"}},
+		},
+		{
+			name:   "allowed func does not permit dot import",
+			policy: &Policy{PolicyRules: PolicyRules{DeniedPackages: []string{"unsafe"}, AllowedFuncs: []string{"unsafe.Sizeof"}}},
+			code:   "package main\nimport . \"unsafe\"\nfunc main() { _ = Sizeof(0) }\n",
+			want:   []PolicyViolation{{Line: 2, Column: 10, Rule: RuleDeniedPackage, Target: "unsafe"}},
+		},
+		{
+			name:   "allowed packages",
+			policy: &Policy{PolicyRules: PolicyRules{AllowedPackages: []string{"fmt", "strings"}}},
+			code:   "package main\nimport (\n\t\"fmt\"\n\t\"net/http\"\n)\nfunc main() { fmt.Println(http.MethodGet) }\n",
+			want:   []PolicyViolation{{Line: 4, Column: 2, Rule: RulePackageNotAllowed, Target: "net/http"}},
+		},
+		{
+			name:    "version override",
+			policy:  &Policy{Versions: map[string]PolicyRules{"1.22": {DeniedPackages: []string{"iter"}}}},
+			code:    "package main\nimport \"iter\"\nfunc main() { var _ iter.Seq[int] }\n",
+			version: "1.22.5",
+			want:    []PolicyViolation{{Line: 2, Column: 8, Rule: RuleDeniedPackage, Target: "iter"}},
+		},
+		{
+			name:    "version override for another version",
+			policy:  &Policy{Versions: map[string]PolicyRules{"1.22": {DeniedPackages: []string{"iter"}}}},
+			code:    "package main\nimport \"iter\"\nfunc main() { var _ iter.Seq[int] }\n",
+			version: "1.23",
+		},
+		{
+			name:    "generics before go1.18",
+			code:    "package main\nfunc Map[T any](v T) T { return v }\nfunc main() {}\n",
+			version: "1.17",
+			want:    []PolicyViolation{{Line: 2, Column: 9, Rule: RuleVersionFeature, Target: "generics"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			if policy == nil {
+				policy = DefaultPolicy()
+			}
+			version := tt.version
+			if version == "" {
+				version = "1.24"
+			}
+
+			got := policy.Check("main.go", tt.code, version)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Check() = %v, want %d violations", got, len(tt.want))
+			}
+			for i, v := range got {
+				w := tt.want[i]
+				if v.File != "main.go" || v.Line != w.Line || v.Column != w.Column || v.Rule != w.Rule || v.Target != w.Target {
+					t.Errorf("violation %d = %+v, want %+v", i, v, w)
+				}
+				if v.Message == "" {
+					t.Errorf("violation %d has no message", i)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRequestChecksEveryFile(t *testing.T) {
+	e := &Executor{policy: DefaultPolicy()}
+
+	tests := []struct {
+		name  string
+		req   ExecutionRequest
+		files []string // 違反が報告されるファイル
+	}{
+		{
+			name: "cgo in a second file",
+			req: ExecutionRequest{Version: "1.24", Files: map[string]string{
+				"main.go":   "package main\nfunc main() { hello() }\n",
+				"hello.go":  "package main\n// #include <stdio.h>\nimport \"C\"\nfunc hello() {}\n",
+				"README.md": "import \"C\"\n",
+			}},
+			files: []string{"hello.go"},
+		},
+		{
+			name: "denied package in another package",
+			req: ExecutionRequest{Version: "1.24", Files: map[string]string{
+				"main.go":       "package main\nimport \"tour/inner\"\nfunc main() { inner.Run() }\n",
+				"inner/unix.go": "package inner\nimport _ \"unsafe\"\n//go:linkname Run runtime.nanotime\nfunc Run()\n",
+			}},
+			files: []string{"inner/unix.go", "inner/unix.go"},
+		},
+		{
+			name: "code and files",
+			req: ExecutionRequest{Version: "1.24", Code: "package main\nfunc main() { run() }\n", Files: map[string]string{
+				"run.go": "package main\nimport \"os/exec\"\nfunc run() { exec.Command(\"id\").Run() }\n",
+			}},
+			files: []string{"run.go"},
+		},
+		{
+			name: "test files are checked too",
+			req: ExecutionRequest{Version: "1.24", Files: map[string]string{
+				"main.go":      "package main\nfunc main() {}\n",
+				"main_test.go": "package main\nimport (\n\t\"os\"\n\t\"testing\"\n)\nfunc TestX(t *testing.T) { os.RemoveAll(t.TempDir()) }\n",
+			}},
+			files: []string{"main_test.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := e.ValidateRequest(tt.req)
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("ValidateRequest() = %v, want *PolicyError", err)
+			}
+			if len(policyErr.Violations) != len(tt.files) {
+				t.Fatalf("violations = %v, want %d", policyErr.Violations, len(tt.files))
+			}
+			for i, v := range policyErr.Violations {
+				if v.File != tt.files[i] {
+					t.Errorf("violation %d in %s, want %s", i, v.File, tt.files[i])
+				}
+			}
+		})
+	}
+}
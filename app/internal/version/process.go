@@ -0,0 +1,140 @@
+// Package version - Process lifecycle for toolchain and snippet commands
+//
+// Every command is started in its own process group so that a timeout or
+// a cancelled request kills the whole tree (go build workers, the compiled
+// snippet and anything it spawned), not just the direct child.
+package version
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Execution status values reported in ExecutionResult.Status
+const (
+	StatusSuccess  = "success"
+	StatusError    = "error"
+	StatusTimeout  = "timeout"
+	StatusCanceled = "canceled"
+)
+
+// Exit codes used when the process did not exit on its own
+const (
+	exitCodeTimeout  = 124
+	exitCodeCanceled = 130
+)
+
+// errExecutionTimeout is the context cause used for execution deadlines
+var errExecutionTimeout = errors.New("execution timeout")
+
+// processWaitDelay bounds how long Wait blocks on I/O after the process is gone
+const processWaitDelay = 2 * time.Second
+
+// commandResult is the outcome of a single command; output lives in the recorder
+type commandResult struct {
+	ExitCode int
+	Status   string
+	Err      error
+}
+
+// outputFunc receives an output chunk of the named stream ("stdout" / "stderr").
+// data is only valid for the duration of the call.
+type outputFunc func(stream string, data []byte)
+
+// runCommand runs cmd until it exits, ctx is done or the output cap is exceeded.
+// Output is captured by rec, so whatever was written before a timeout or
+// cancellation remains available. stdin is optional (streaming execution).
+func runCommand(ctx context.Context, cmd *exec.Cmd, stdin io.Reader, rec *outputRecorder) commandResult {
+	cmd.Stdout = rec.writer(StreamStdout)
+	cmd.Stderr = rec.writer(StreamStderr)
+	cmd.WaitDelay = processWaitDelay
+	setProcessGroup(cmd)
+
+	if ctx.Err() != nil {
+		return interruptedResult(ctx)
+	}
+
+	// 標準入力はos.Pipe経由で渡し、プロセス終了時に書き込み側を閉じる
+	var stdinWriter *os.File
+	if stdin != nil {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return commandResult{ExitCode: 1, Status: StatusError, Err: fmt.Errorf("標準入力パイプ作成エラー: %w", err)}
+		}
+		cmd.Stdin = pr
+		stdinWriter = pw
+		defer pr.Close()
+		defer pw.Close()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return commandResult{ExitCode: 1, Status: StatusError, Err: fmt.Errorf("プロセス起動エラー: %w", err)}
+	}
+
+	if stdinWriter != nil {
+		go func() {
+			_, _ = io.Copy(stdinWriter, stdin)
+			_ = stdinWriter.Close()
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		result := commandResult{Status: StatusSuccess, Err: err}
+		if err != nil {
+			result.Status = StatusError
+			var exitError *exec.ExitError
+			if errors.As(err, &exitError) {
+				result.ExitCode = exitError.ExitCode()
+			} else {
+				result.ExitCode = 1
+			}
+		}
+		return result
+	case <-ctx.Done():
+		// プロセスグループ全体を停止し、それまでの出力を回収
+		if err := killProcessGroup(cmd); err != nil {
+			log.Printf("Failed to kill process group: %v", err)
+		}
+		<-done
+		return interruptedResult(ctx)
+	case <-rec.Overflow():
+		// 出力上限を超えたら以降の出力は不要なので停止する
+		if err := killProcessGroup(cmd); err != nil {
+			log.Printf("Failed to kill process group: %v", err)
+		}
+		<-done
+		return commandResult{
+			ExitCode: 1,
+			Status:   StatusError,
+			Err:      fmt.Errorf("出力サイズの上限 (%d bytes) を超えたため実行を停止しました", rec.limit),
+		}
+	}
+}
+
+// interruptedResult builds the result for a command stopped by ctx
+func interruptedResult(ctx context.Context) commandResult {
+	if errors.Is(context.Cause(ctx), errExecutionTimeout) {
+		return commandResult{
+			ExitCode: exitCodeTimeout,
+			Status:   StatusTimeout,
+			Err:      fmt.Errorf("実行タイムアウト"),
+		}
+	}
+	return commandResult{
+		ExitCode: exitCodeCanceled,
+		Status:   StatusCanceled,
+		Err:      fmt.Errorf("実行がキャンセルされました: %w", context.Cause(ctx)),
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package version
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op where process groups are unavailable
+func setProcessGroup(*exec.Cmd) {}
+
+// killProcessGroup kills the direct child only
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	err := cmd.Process.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
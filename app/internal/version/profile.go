@@ -0,0 +1,503 @@
+// Package version - CPU and heap profiling
+//
+// A run can record runtime/pprof CPU and heap profiles of the whole program
+// through the main wrapper in capture.go. The raw profiles can be downloaded
+// for `go tool pprof`; SummarizeProfile decodes the profile.proto format
+// (gzip-compressed protocol buffers) with a small wire format reader and
+// returns the top functions by flat and cumulative value together with a
+// call tree that can be drawn as a flame graph.
+package version
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Profile kinds of ExecutionRequest.Profile (also the capture kinds)
+const (
+	ProfileCPU  = "cpu"  // runtime/pprof.StartCPUProfile（実行全体）
+	ProfileHeap = "heap" // runtime/pprof.WriteHeapProfile（main終了時。GC後のヒープ）
+)
+
+const (
+	// heapProfileRate is the runtime.MemProfileRate used for heap profiles.
+	// The default (512KiB) samples too few allocations of a short snippet.
+	heapProfileRate = 4096
+
+	// defaultProfileTop is the number of functions returned when not specified
+	defaultProfileTop = 20
+	// maxProfileTop limits the number of functions returned
+	maxProfileTop = 200
+	// maxFlameNodes limits the size of the flame graph tree
+	maxFlameNodes = 2000
+	// maxProfileBytes limits the decompressed size of a profile
+	maxProfileBytes = 64 << 20
+)
+
+// profileHook returns the main wrapper code recording a profile of the given kind
+func profileHook(kind string) (captureHook, error) {
+	switch kind {
+	case ProfileCPU:
+		return captureHook{Kind: ProfileCPU, Imports: []string{"runtime/pprof"}, Setup: `
+if err := pprof.StartCPUProfile(f); err != nil {
+	println("cpu profile:", err.Error())
+} else {
+	defer pprof.StopCPUProfile()
+}`}, nil
+	case ProfileHeap:
+		return captureHook{Kind: ProfileHeap, Imports: []string{"runtime", "runtime/pprof"}, Setup: fmt.Sprintf(`
+runtime.MemProfileRate = %d
+defer func() {
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		println("heap profile:", err.Error())
+	}
+}()`, heapProfileRate)}, nil
+	default:
+		return captureHook{}, fmt.Errorf("不明なプロファイルです: %q（%q または %q）", kind, ProfileCPU, ProfileHeap)
+	}
+}
+
+// ProfileSummary is the top-N report and flame graph of a profile
+type ProfileSummary struct {
+	SampleType  string         `json:"sample_type"`  // 集計した値の種類（例: "cpu", "inuse_space"）
+	Unit        string         `json:"unit"`         // 例: "nanoseconds", "bytes"
+	SampleTypes []string       `json:"sample_types"` // 選択可能な値の種類
+	Total       int64          `json:"total"`
+	Excluded    int64          `json:"excluded,omitempty"` // 計測用のラッパー（プロファイルの開始・書き出し）の値。Total には含まない
+	Samples     int            `json:"samples"`
+	Duration    time.Duration  `json:"duration,omitempty"` // プロファイルの記録時間（CPU）
+	Period      int64          `json:"period,omitempty"`   // サンプリング間隔（CPU はナノ秒、ヒープはバイト）
+	Functions   int            `json:"functions"`          // 値を持つ関数の総数
+	Top         []ProfileEntry `json:"top"`                // flat の大きい順
+	Flame       *FlameNode     `json:"flame"`              // 呼び出しツリー（ルートは "root"）
+	Truncated   bool           `json:"truncated,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+}
+
+// ProfileEntry is the value attributed to one function
+type ProfileEntry struct {
+	Function    string  `json:"function"`
+	File        string  `json:"file,omitempty"`
+	Flat        int64   `json:"flat"` // 関数自身
+	FlatPercent float64 `json:"flat_percent"`
+	Cum         int64   `json:"cum"` // 呼び出し先を含む
+	CumPercent  float64 `json:"cum_percent"`
+}
+
+// FlameNode is a node of the call tree: the value of all samples whose stack
+// goes through Name from the parent's call path
+type FlameNode struct {
+	Name     string       `json:"name"`
+	Value    int64        `json:"value"`
+	Children []*FlameNode `json:"children,omitempty"`
+	children map[string]*FlameNode
+}
+
+// pprofProfile is the decoded part of profile.proto used for the summary
+type pprofProfile struct {
+	sampleTypes   [][2]int64 // [type, unit] の文字列インデックス
+	samples       []pprofSample
+	locations     map[uint64][]uint64 // ロケーションID -> 関数ID（インライン展開の内側から）
+	functions     map[uint64]pprofFunction
+	strings       []string
+	durationNanos int64
+	period        int64
+	defaultType   int64
+}
+
+type pprofSample struct {
+	locations []uint64 // 葉から根の順
+	values    []int64
+}
+
+type pprofFunction struct {
+	name, file int64
+}
+
+// SummarizeProfile decodes a pprof profile and reports the top functions of the given sample type.
+// An empty sampleType selects the profile's default (the last one, as go tool pprof does).
+func SummarizeProfile(data []byte, sampleType string, top int) (*ProfileSummary, error) {
+	if top <= 0 {
+		top = defaultProfileTop
+	}
+	top = min(top, maxProfileTop)
+
+	raw, err := gunzipProfile(data)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decodeProfile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("プロファイルの解析エラー: %w", err)
+	}
+	if len(p.sampleTypes) == 0 {
+		return nil, errors.New("プロファイルに値の種類がありません")
+	}
+
+	summary := &ProfileSummary{
+		Duration:    time.Duration(p.durationNanos),
+		Period:      p.period,
+		SampleTypes: make([]string, len(p.sampleTypes)),
+	}
+	sampleIndex := make(map[string]int) // 値の種類 -> サンプルの値の位置
+	for i, st := range p.sampleTypes {
+		summary.SampleTypes[i] = p.str(st[0])
+		sampleIndex[summary.SampleTypes[i]] = i
+	}
+	index := len(p.sampleTypes) - 1
+	if p.defaultType != 0 {
+		if i, ok := sampleIndex[p.str(p.defaultType)]; ok {
+			index = i
+		}
+	}
+	if sampleType != "" {
+		i, ok := sampleIndex[sampleType]
+		if !ok {
+			return nil, fmt.Errorf("値の種類 %q はありません（%v）", sampleType, summary.SampleTypes)
+		}
+		index = i
+	}
+	summary.SampleType = summary.SampleTypes[index]
+	summary.Unit = p.str(p.sampleTypes[index][1])
+
+	flat := make(map[uint64]int64)
+	cum := make(map[uint64]int64)
+	root := &FlameNode{Name: "root"}
+	nodes := 1
+	for _, sample := range p.samples {
+		if index >= len(sample.values) || sample.values[index] == 0 {
+			continue
+		}
+		value := sample.values[index]
+
+		// 葉から根の順の関数列（インライン展開された関数も1フレームとして扱う）
+		var stack []uint64
+		for _, loc := range sample.locations {
+			stack = append(stack, p.locations[loc]...)
+		}
+		stack, ok := p.userStack(stack)
+		if !ok {
+			summary.Excluded += value
+			continue
+		}
+		summary.Total += value
+		summary.Samples++
+		if len(stack) == 0 {
+			continue
+		}
+		flat[stack[0]] += value
+		seen := make(map[uint64]bool, len(stack))
+		for _, fn := range stack {
+			if !seen[fn] {
+				seen[fn] = true // 再帰呼び出しは1回だけ数える
+				cum[fn] += value
+			}
+		}
+
+		node := root
+		node.Value += value
+		for i := len(stack) - 1; i >= 0; i-- {
+			name := p.funcName(stack[i])
+			child := node.children[name]
+			if child == nil {
+				if nodes >= maxFlameNodes {
+					summary.Truncated = true
+					break
+				}
+				if node.children == nil {
+					node.children = make(map[string]*FlameNode)
+				}
+				child = &FlameNode{Name: name}
+				node.children[name] = child
+				node.Children = append(node.Children, child)
+				nodes++
+			}
+			child.Value += value
+			node = child
+		}
+	}
+	sortFlame(root)
+	summary.Flame = root
+
+	entries := make([]ProfileEntry, 0, len(cum))
+	for fn, c := range cum {
+		function := p.functions[fn]
+		entries = append(entries, ProfileEntry{
+			Function:    p.funcName(fn),
+			File:        p.str(function.file),
+			Flat:        flat[fn],
+			FlatPercent: percentOf(flat[fn], summary.Total),
+			Cum:         c,
+			CumPercent:  percentOf(c, summary.Total),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Flat != entries[j].Flat {
+			return entries[i].Flat > entries[j].Flat
+		}
+		if entries[i].Cum != entries[j].Cum {
+			return entries[i].Cum > entries[j].Cum
+		}
+		return entries[i].Function < entries[j].Function
+	})
+	summary.Functions = len(entries)
+	if len(entries) > top {
+		entries = entries[:top]
+	}
+	summary.Top = entries
+
+	if summary.Samples == 0 {
+		summary.Warnings = append(summary.Warnings, "サンプルがありません（実行時間が短すぎるか、割り当てがありません）")
+	}
+	return summary, nil
+}
+
+// sortFlame orders children by value so the largest is drawn first
+func sortFlame(node *FlameNode) {
+	sort.SliceStable(node.Children, func(i, j int) bool { return node.Children[i].Value > node.Children[j].Value })
+	for _, child := range node.Children {
+		sortFlame(child)
+	}
+}
+
+func percentOf(value, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) * 100 / float64(total)
+}
+
+// gunzipProfile decompresses a profile (uncompressed profiles are accepted as well)
+func gunzipProfile(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("プロファイルの展開エラー: %w", err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(io.LimitReader(zr, maxProfileBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("プロファイルの展開エラー: %w", err)
+	}
+	if len(raw) > maxProfileBytes {
+		return nil, fmt.Errorf("プロファイルが大きすぎます（上限%dバイト）", maxProfileBytes)
+	}
+	return raw, nil
+}
+
+func (p *pprofProfile) str(i int64) string {
+	if i < 0 || int(i) >= len(p.strings) {
+		return ""
+	}
+	return p.strings[i]
+}
+
+func (p *pprofProfile) funcName(id uint64) string {
+	name := p.str(p.functions[id].name)
+	switch name {
+	case "":
+		return fmt.Sprintf("func#%d", id)
+	case "main." + captureMainName:
+		return "main.main" // 名前を変更したリクエストの main
+	}
+	return name
+}
+
+// userStack removes the generated main of the capture wrapper from a stack.
+// It reports false for samples of the wrapper itself (starting and writing the
+// profiles) and of the runtime/pprof writer goroutine.
+func (p *pprofProfile) userStack(stack []uint64) ([]uint64, bool) {
+	wrapper, user := -1, false
+	for i, id := range stack {
+		switch p.str(p.functions[id].name) {
+		case "main.main":
+			wrapper = i
+		case "main." + captureMainName:
+			user = true
+		case "runtime/pprof.profileWriter":
+			return nil, false
+		}
+	}
+	if wrapper < 0 {
+		return stack, true
+	}
+	if !user {
+		return nil, false
+	}
+	return append(stack[:wrapper:wrapper], stack[wrapper+1:]...), true
+}
+
+// decodeProfile reads the fields of profile.proto needed for the summary:
+// sample_type (1), sample (2), location (4), function (5), string_table (6),
+// duration_nanos (10), period (12) and default_sample_type (14)
+func decodeProfile(data []byte) (*pprofProfile, error) {
+	p := &pprofProfile{
+		locations: make(map[uint64][]uint64),
+		functions: make(map[uint64]pprofFunction),
+	}
+	err := readProtoFields(data, func(field int, wire int, value uint64, msg []byte) error {
+		switch field {
+		case 1:
+			var st [2]int64
+			err := readProtoFields(msg, func(field, _ int, value uint64, _ []byte) error {
+				if field == 1 || field == 2 {
+					st[field-1] = int64(value)
+				}
+				return nil
+			})
+			p.sampleTypes = append(p.sampleTypes, st)
+			return err
+		case 2:
+			var sample pprofSample
+			err := readProtoFields(msg, func(field, wire int, value uint64, b []byte) error {
+				switch field {
+				case 1:
+					return appendPacked(&sample.locations, wire, value, b)
+				case 2:
+					var values []uint64
+					if err := appendPacked(&values, wire, value, b); err != nil {
+						return err
+					}
+					for _, v := range values {
+						sample.values = append(sample.values, int64(v))
+					}
+				}
+				return nil
+			})
+			p.samples = append(p.samples, sample)
+			return err
+		case 4:
+			var id uint64
+			var funcs []uint64
+			err := readProtoFields(msg, func(field, _ int, value uint64, b []byte) error {
+				switch field {
+				case 1:
+					id = value
+				case 4: // Line: function_id (1), line (2)
+					return readProtoFields(b, func(field, _ int, value uint64, _ []byte) error {
+						if field == 1 {
+							funcs = append(funcs, value)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			p.locations[id] = funcs
+			return err
+		case 5:
+			var id uint64
+			var fn pprofFunction
+			err := readProtoFields(msg, func(field, _ int, value uint64, _ []byte) error {
+				switch field {
+				case 1:
+					id = value
+				case 2:
+					fn.name = int64(value)
+				case 4:
+					fn.file = int64(value)
+				}
+				return nil
+			})
+			p.functions[id] = fn
+			return err
+		case 6:
+			p.strings = append(p.strings, string(msg))
+		case 10:
+			p.durationNanos = int64(value)
+		case 12:
+			p.period = int64(value)
+		case 14:
+			p.defaultType = int64(value)
+		}
+		return nil
+	})
+	return p, err
+}
+
+// Protocol buffers wire types
+const (
+	protoVarint = 0
+	protoI64    = 1
+	protoLen    = 2
+	protoI32    = 5
+)
+
+var errProtoTruncated = errors.New("データが途中で切れています")
+
+// readProtoFields calls fn for each field of a protocol buffers message.
+// value is set for varint and fixed-size fields, bytes for length-delimited ones.
+func readProtoFields(data []byte, fn func(field, wire int, value uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		data = data[n:]
+		field, wire := int(key>>3), int(key&7)
+
+		var (
+			value uint64
+			b     []byte
+		)
+		switch wire {
+		case protoVarint:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errProtoTruncated
+			}
+			data = data[n:]
+		case protoI64:
+			if len(data) < 8 {
+				return errProtoTruncated
+			}
+			value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoI32:
+			if len(data) < 4 {
+				return errProtoTruncated
+			}
+			value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case protoLen:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errProtoTruncated
+			}
+			b = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return fmt.Errorf("未対応のワイヤータイプです: %d", wire)
+		}
+		if err := fn(field, wire, value, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendPacked appends a repeated varint field, which may be packed into one length-delimited field
+func appendPacked(values *[]uint64, wire int, value uint64, b []byte) error {
+	if wire != protoLen {
+		*values = append(*values, value)
+		return nil
+	}
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		*values = append(*values, v)
+		b = b[n:]
+	}
+	return nil
+}
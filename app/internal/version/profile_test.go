@@ -0,0 +1,249 @@
+package version
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Helpers encoding the subset of profile.proto read by decodeProfile
+
+func protoVarintField(field int, value uint64) []byte {
+	b := binary.AppendUvarint(nil, uint64(field)<<3|protoVarint)
+	return binary.AppendUvarint(b, value)
+}
+
+func protoBytesField(field int, data []byte) []byte {
+	b := binary.AppendUvarint(nil, uint64(field)<<3|protoLen)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func protoPacked(field int, values ...uint64) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, v)
+	}
+	return protoBytesField(field, packed)
+}
+
+// testProfile builds a CPU profile of a program run through the capture wrapper:
+//
+//	main.main (wrapper) -> main.tourUserMain -> main.work -> main.helper
+type testProfile struct {
+	strings []string
+	body    []byte
+}
+
+func (p *testProfile) str(s string) uint64 {
+	if i := slices.Index(p.strings, s); i >= 0 {
+		return uint64(i)
+	}
+	p.strings = append(p.strings, s)
+	return uint64(len(p.strings) - 1)
+}
+
+func (p *testProfile) sampleType(typ, unit string) {
+	p.body = append(p.body, protoBytesField(1, append(protoVarintField(1, p.str(typ)), protoVarintField(2, p.str(unit))...))...)
+}
+
+func (p *testProfile) function(id uint64, name, file string) {
+	fn := protoVarintField(1, id)
+	fn = append(fn, protoVarintField(2, p.str(name))...)
+	fn = append(fn, protoVarintField(4, p.str(file))...)
+	p.body = append(p.body, protoBytesField(5, fn)...)
+}
+
+// location adds a location whose lines call the given functions (innermost first)
+func (p *testProfile) location(id uint64, functions ...uint64) {
+	loc := protoVarintField(1, id)
+	for i, fn := range functions {
+		line := append(protoVarintField(1, fn), protoVarintField(2, uint64(10+i))...)
+		loc = append(loc, protoBytesField(4, line)...)
+	}
+	p.body = append(p.body, protoBytesField(4, loc)...)
+}
+
+// sample adds a sample; packed selects the packed or the repeated encoding
+func (p *testProfile) sample(packed bool, locations []uint64, values ...uint64) {
+	var sample []byte
+	if packed {
+		sample = append(protoPacked(1, locations...), protoPacked(2, values...)...)
+	} else {
+		for _, loc := range locations {
+			sample = append(sample, protoVarintField(1, loc)...)
+		}
+		for _, v := range values {
+			sample = append(sample, protoVarintField(2, v)...)
+		}
+	}
+	p.body = append(p.body, protoBytesField(2, sample)...)
+}
+
+func (p *testProfile) bytes() []byte {
+	data := append([]byte(nil), p.body...)
+	for _, s := range p.strings {
+		data = append(data, protoBytesField(6, []byte(s))...)
+	}
+	data = append(data, protoVarintField(10, uint64(time.Second))...)
+	data = append(data, protoVarintField(12, 10_000_000)...)
+	return data
+}
+
+func newTestProfile() []byte {
+	p := &testProfile{strings: []string{""}}
+	p.sampleType("samples", "count")
+	p.sampleType("cpu", "nanoseconds")
+
+	const (
+		fnMain = iota + 1
+		fnUser
+		fnWork
+		fnHelper
+		fnStart
+		fnWriter
+	)
+	p.function(fnMain, "main.main", "main.go")
+	p.function(fnUser, "main."+captureMainName, "main.go")
+	p.function(fnWork, "main.work", "main.go")
+	p.function(fnHelper, "main.helper", "main.go")
+	p.function(fnStart, "runtime/pprof.StartCPUProfile", "pprof.go")
+	p.function(fnWriter, "runtime/pprof.profileWriter", "pprof.go")
+	for id := uint64(fnMain); id <= fnWriter; id++ {
+		p.location(id, id)
+	}
+	p.location(10, fnHelper, fnWork) // main.work にインライン展開された main.helper
+
+	p.sample(true, []uint64{fnWork, fnUser, fnMain}, 1, 10)
+	p.sample(false, []uint64{fnHelper, fnWork, fnUser, fnMain}, 3, 30)
+	p.sample(true, []uint64{10, fnUser, fnMain}, 1, 5)
+	p.sample(false, []uint64{fnWork, fnWork, fnUser, fnMain}, 1, 7) // 再帰
+	p.sample(true, []uint64{fnStart, fnMain}, 10, 100)              // ラッパー自身
+	p.sample(true, []uint64{fnWriter}, 2, 20)                       // プロファイルの書き出し
+	p.sample(true, []uint64{fnHelper, fnWork, fnUser, fnMain}, 0, 0)
+	return p.bytes()
+}
+
+func TestSummarizeProfile(t *testing.T) {
+	data := newTestProfile()
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write(data)
+	zw.Close()
+
+	for name, input := range map[string][]byte{"raw": data, "gzip": gzipped.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			summary, err := SummarizeProfile(input, "", 0)
+			if err != nil {
+				t.Fatalf("SummarizeProfile: %v", err)
+			}
+			if summary.SampleType != "cpu" || summary.Unit != "nanoseconds" || !slices.Equal(summary.SampleTypes, []string{"samples", "cpu"}) {
+				t.Errorf("sample type = %q %q of %v, want the last one", summary.SampleType, summary.Unit, summary.SampleTypes)
+			}
+			if summary.Total != 52 || summary.Excluded != 120 || summary.Samples != 4 {
+				t.Errorf("total %d, excluded %d, samples %d; want 52, 120, 4", summary.Total, summary.Excluded, summary.Samples)
+			}
+			if summary.Duration != time.Second || summary.Period != 10_000_000 {
+				t.Errorf("duration %v, period %d", summary.Duration, summary.Period)
+			}
+
+			want := []ProfileEntry{
+				{Function: "main.helper", File: "main.go", Flat: 35, Cum: 35},
+				{Function: "main.work", File: "main.go", Flat: 17, Cum: 52},
+				{Function: "main.main", File: "main.go", Flat: 0, Cum: 52},
+			}
+			if summary.Functions != len(want) || len(summary.Top) != len(want) {
+				t.Fatalf("top = %+v, want %d functions", summary.Top, len(want))
+			}
+			for i, entry := range summary.Top {
+				w := want[i]
+				if entry.Function != w.Function || entry.File != w.File || entry.Flat != w.Flat || entry.Cum != w.Cum {
+					t.Errorf("top[%d] = %+v, want %+v", i, entry, w)
+				}
+				if got := percentOf(w.Cum, 52); entry.CumPercent != got {
+					t.Errorf("top[%d] cum%% = %v, want %v", i, entry.CumPercent, got)
+				}
+			}
+
+			// root -> main.main -> main.work -> {main.helper 35, main.work 7}
+			flame := summary.Flame
+			if flame.Name != "root" || flame.Value != 52 || len(flame.Children) != 1 {
+				t.Fatalf("flame root = %+v", flame)
+			}
+			mainNode := flame.Children[0]
+			if mainNode.Name != "main.main" || mainNode.Value != 52 || len(mainNode.Children) != 1 {
+				t.Fatalf("flame main = %+v", mainNode)
+			}
+			work := mainNode.Children[0]
+			if work.Name != "main.work" || work.Value != 52 || len(work.Children) != 2 {
+				t.Fatalf("flame work = %+v", work)
+			}
+			if c := work.Children; c[0].Name != "main.helper" || c[0].Value != 35 || c[1].Name != "main.work" || c[1].Value != 7 {
+				t.Errorf("flame work children = %+v, %+v", c[0], c[1])
+			}
+		})
+	}
+
+	t.Run("sample type", func(t *testing.T) {
+		summary, err := SummarizeProfile(data, "samples", 1)
+		if err != nil {
+			t.Fatalf("SummarizeProfile: %v", err)
+		}
+		if summary.Total != 6 || summary.Functions != 3 || len(summary.Top) != 1 || summary.Top[0].Function != "main.helper" {
+			t.Errorf("summary = total %d, functions %d, top %+v", summary.Total, summary.Functions, summary.Top)
+		}
+	})
+
+	t.Run("unknown sample type", func(t *testing.T) {
+		if _, err := SummarizeProfile(data, "alloc_space", 0); err == nil {
+			t.Error("SummarizeProfile succeeded for an unknown sample type")
+		}
+	})
+}
+
+func TestSummarizeProfileInvalid(t *testing.T) {
+	data := newTestProfile()
+	tests := map[string][]byte{
+		"truncated":        data[:len(data)-3],
+		"bad length":       {byte(2<<3 | protoLen), 0x7f, 1},
+		"bad wire type":    {byte(1<<3 | 3)},
+		"no sample types":  protoVarintField(10, 1),
+		"truncated gzip":   {0x1f, 0x8b, 8},
+		"truncated varint": {byte(10 << 3), 0x80},
+	}
+	for name, input := range tests {
+		if _, err := SummarizeProfile(input, "", 0); err == nil {
+			t.Errorf("%s: SummarizeProfile succeeded", name)
+		}
+	}
+}
+
+func TestSummarizeProfileRuntime(t *testing.T) {
+	// runtime/pprof が出力した実際のヒーププロファイル
+	keep := make([][]byte, 0, 64)
+	for range 64 {
+		keep = append(keep, make([]byte, 64<<10))
+	}
+	runtime.GC()
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	runtime.KeepAlive(keep)
+
+	summary, err := SummarizeProfile(buf.Bytes(), "alloc_space", 5)
+	if err != nil {
+		t.Fatalf("SummarizeProfile: %v", err)
+	}
+	if !slices.Equal(summary.SampleTypes, []string{"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"}) {
+		t.Errorf("sample types = %v", summary.SampleTypes)
+	}
+	if summary.Unit != "bytes" || summary.Total <= 0 || len(summary.Top) == 0 || len(summary.Top) > 5 {
+		t.Errorf("summary = unit %q, total %d, %d entries", summary.Unit, summary.Total, len(summary.Top))
+	}
+}
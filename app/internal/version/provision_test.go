@@ -0,0 +1,124 @@
+package version
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProvisionEnvironment(t *testing.T) {
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GONOSUMDB", "golang.org")
+	t.Setenv("GOPRIVATE", "golang.org/toolchain")
+	t.Setenv("GOINSECURE", "*")
+	t.Setenv("GOENV", "/home/user/.config/go/env")
+
+	// exec.Cmd は重複した変数のうち最後の値を使う
+	cmd := exec.Command("go")
+	cmd.Env = provisionEnvironment(provisionConfig{Proxy: "file:///srv/goproxy", Dir: "/data/toolchains"}, "sum.golang.org")
+	env := cmd.Environ()
+	lookup := func(key string) string {
+		value := ""
+		for _, kv := range env {
+			if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+				value = v
+			}
+		}
+		return value
+	}
+
+	want := map[string]string{
+		"GOSUMDB":    "sum.golang.org",
+		"GONOSUMDB":  "",
+		"GOPRIVATE":  "",
+		"GOINSECURE": "",
+		"GOENV":      "off",
+		"GOPROXY":    "file:///srv/goproxy",
+		"GOMODCACHE": "/data/toolchains",
+	}
+	for key, value := range want {
+		if got := lookup(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestHasZipSum(t *testing.T) {
+	const modVersion = "v0.0.1-go1.22.7.linux-amd64"
+	zip := toolchainModule + " " + modVersion + " h1:zip="
+	goMod := toolchainModule + " " + modVersion + "/go.mod h1:mod="
+	if !hasZipSum([]string{goMod, zip}, modVersion) {
+		t.Error("hasZipSum with the zip hash = false")
+	}
+	if hasZipSum([]string{goMod}, modVersion) {
+		t.Error("hasZipSum with only the go.mod hash = true")
+	}
+	if hasZipSum(nil, modVersion) {
+		t.Error("hasZipSum without sums = true")
+	}
+}
+
+func TestProvisionRetryDelay(t *testing.T) {
+	var delays []time.Duration
+	for failures := 1; failures <= 9; failures++ {
+		delays = append(delays, provisionRetryDelay(failures))
+	}
+	want := []time.Duration{
+		5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 40 * time.Minute, 80 * time.Minute,
+		160 * time.Minute, 320 * time.Minute, provisionRetryMax, provisionRetryMax,
+	}
+	if !slices.Equal(delays, want) {
+		t.Errorf("delays = %v, want %v", delays, want)
+	}
+}
+
+func TestProvisionMissingBackoff(t *testing.T) {
+	globalProvisionConfigOnce.Do(func() {})
+	saved := globalProvisionConfig
+	globalProvisionConfig = provisionConfig{Enabled: true, Dir: t.TempDir(), SumsFile: "/nonexistent"}
+	t.Cleanup(func() { globalProvisionConfig = saved })
+
+	// Go 1.21 より前は golang.org/toolchain がないため、ダウンロードせずにすぐ失敗する
+	m := NewManager()
+	m.patches = map[string]*VersionConfig{
+		"1.20.0": {Version: "1.20", FullVersion: "1.20.0", Source: ToolchainSourceConfig},
+	}
+	status := func() ProvisionStatus {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			m.provisionMutex.Lock()
+			provisioning, s := m.provisioning, *m.provisions["1.20.0"]
+			m.provisionMutex.Unlock()
+			if !provisioning {
+				return s
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("provisioning did not finish")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	m.provisionMissing()
+	first := status()
+	if first.State != ProvisionFailed || first.Failures != 1 || time.Until(first.RetryAt) < provisionRetryMin-time.Minute {
+		t.Fatalf("after the first attempt: %+v", first)
+	}
+
+	// 待ち時間の間は再スキャンしても再試行しない
+	m.provisionMissing()
+	if again := status(); again.Failures != 1 || !again.UpdatedAt.Equal(first.UpdatedAt) {
+		t.Errorf("rescan during the backoff retried: %+v", again)
+	}
+
+	m.provisionMutex.Lock()
+	m.provisions["1.20.0"].RetryAt = time.Now().Add(-time.Second)
+	m.provisionMutex.Unlock()
+	m.provisionMissing()
+	if second := status(); second.State != ProvisionFailed || second.Failures != 2 || time.Until(second.RetryAt) < provisionRetryDelay(2)-time.Minute {
+		t.Errorf("after the second attempt: %+v", second)
+	}
+}
@@ -0,0 +1,307 @@
+// Package version - Toolchain registry
+//
+// The Manager's toolchains come from two sources, scanned together at
+// startup and on every rescan: the "path" and "patches" of each version in
+// config/versions.json, and the GOROOTs in the toolchain directories. Every
+// go* directory there with a bin/go (e.g. /opt/go1.26, or $HOME/sdk/go1.26.0
+// installed with golang.org/dl) is registered under the patch version its go
+// command reports, as are the toolchains provisioned into TOOLCHAIN_DIR
+// (see provision.go).
+//
+// Every patch release can be selected by its full version ("1.22.0"), and
+// each minor version ("1.22") has a default toolchain: the configured "path",
+// which keeps its key whatever its binary reports, or, if it is not
+// configured or its binary is missing, the newest patch release found.
+// A configured patch whose binary reports another version is not used.
+//
+// Environment variables:
+// - GO_TOOLCHAIN_DIRS: directories searched for toolchains, separated by the OS path list separator (default: /opt and $HOME/sdk)
+// - TOOLCHAIN_RESCAN_INTERVAL: rescan periodically, e.g. "5m" (default: only at startup, on SIGHUP and POST /api/version-info/rescan)
+package version
+
+import (
+	"fmt"
+	goversion "go/version"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"go-release-tour/app/internal/config"
+)
+
+// Toolchain sources
+const (
+	ToolchainSourceConfig      = "config"      // config/versions.json の path
+	ToolchainSourceDiscovered  = "discovered"  // GO_TOOLCHAIN_DIRS で見つかったGOROOT
+	ToolchainSourceProvisioned = "provisioned" // TOOLCHAIN_DIR にダウンロードした golang.org/toolchain
+)
+
+// goVersionPattern extracts "1.22.7", "1.20" or "1.26rc1" from the output of go version
+var goVersionPattern = regexp.MustCompile(`go(\d+\.\d+(?:\.\d+)?(?:(?:rc|beta)\d+)?)\s`)
+
+// ScanResult reports what a rescan of the toolchains changed
+type ScanResult struct {
+	Time     time.Time `json:"time"`
+	Added    []string  `json:"added,omitempty"`    // 利用可能になったバージョン
+	Removed  []string  `json:"removed,omitempty"`  // 利用できなくなったバージョン
+	Changed  []string  `json:"changed,omitempty"`  // パスまたは完全バージョンが変わったバージョン
+	Warnings []string  `json:"warnings,omitempty"` // 読み込めなかった設定やツールチェーン
+}
+
+// Rescan reloads the configuration and searches the toolchain directories again,
+// then starts downloading missing toolchains if provisioning is enabled.
+// Executions already holding a VersionConfig keep using it.
+func (m *Manager) Rescan() *ScanResult {
+	result := m.scan()
+	m.provisionMissing()
+	return result
+}
+
+// scan rebuilds the version and patch tables
+func (m *Manager) scan() *ScanResult {
+	m.scanMutex.Lock()
+	defer m.scanMutex.Unlock()
+
+	// go version の実行はロックの外で行う
+	versions, patches, warnings := scanToolchains()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := &ScanResult{Time: time.Now(), Warnings: warnings}
+	diffVersions(result, m.versions, versions)
+	diffVersions(result, m.patches, patches)
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+
+	m.versions = versions
+	m.patches = patches
+	m.lastScan = result
+	for _, warning := range warnings {
+		log.Printf("[WARN] Manager: %s", warning)
+	}
+	log.Printf("Manager: %d toolchains, %d patch releases (added %v, removed %v, changed %v)", len(versions), len(patches), result.Added, result.Removed, result.Changed)
+	return result
+}
+
+// diffVersions records the differences between two version tables in result
+func diffVersions(result *ScanResult, before, after map[string]*VersionConfig) {
+	for version, entry := range after {
+		old, exists := before[version]
+		switch {
+		case entry.Available && (!exists || !old.Available):
+			result.Added = append(result.Added, version)
+		case !entry.Available && exists && old.Available:
+			result.Removed = append(result.Removed, version)
+		case entry.Available && (old.Path != entry.Path || old.FullVersion != entry.FullVersion):
+			result.Changed = append(result.Changed, version)
+		}
+	}
+	for version, old := range before {
+		if _, exists := after[version]; !exists && old.Available {
+			result.Removed = append(result.Removed, version)
+		}
+	}
+}
+
+// LastScan returns the result of the latest rescan
+func (m *Manager) LastScan() *ScanResult {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.lastScan
+}
+
+// WatchToolchains rescans the process-wide manager on SIGHUP and every TOOLCHAIN_RESCAN_INTERVAL
+func WatchToolchains() {
+	manager := GetManager()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if value := os.Getenv("TOOLCHAIN_RESCAN_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			log.Printf("[WARN] WatchToolchains: invalid TOOLCHAIN_RESCAN_INTERVAL %q", value)
+		} else {
+			tick = time.NewTicker(interval).C
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				log.Printf("Manager: rescanning toolchains (SIGHUP)")
+			case <-tick:
+			}
+			manager.Rescan()
+		}
+	}()
+}
+
+// scanToolchains builds the tables of default toolchains by minor version and of
+// patch releases by full version from the configuration and the toolchain directories
+func scanToolchains() (map[string]*VersionConfig, map[string]*VersionConfig, []string) {
+	versions := make(map[string]*VersionConfig)
+	patches := make(map[string]*VersionConfig)
+	registered := make(map[string]bool) // 登録済みの go コマンド（シンボリックリンク解決後）
+	var warnings []string
+
+	// 同じパッチが複数ある場合は利用可能なものを残す
+	addPatch := func(entry *VersionConfig) {
+		if existing := patches[entry.FullVersion]; existing == nil || !existing.Available && entry.Available {
+			patches[entry.FullVersion] = entry
+		}
+	}
+
+	configManager := config.NewConfigManager("")
+	if err := configManager.LoadConfig(); err != nil {
+		warnings = append(warnings, err.Error())
+	} else {
+		for _, version := range configManager.GetAvailableVersions() {
+			versionConfig, err := configManager.GetVersionConfig(version)
+			if err != nil || versionConfig.Path == "" {
+				warnings = append(warnings, fmt.Sprintf("バージョン %s に path が設定されていません", version))
+				continue
+			}
+			// 見つからない場合も設定の完全バージョンを残し、ダウンロード対象にする
+			entry := &VersionConfig{Version: version, Path: versionConfig.Path, FullVersion: versionConfig.FullVersion, Source: ToolchainSourceConfig}
+			if fullVersion, err := toolchainVersion(entry.Path); err == nil {
+				entry.FullVersion = fullVersion
+				entry.Available = true
+				registered[resolvedPath(entry.Path)] = true
+			}
+			versions[version] = entry
+			if entry.FullVersion != "" {
+				addPatch(entry)
+			}
+
+			for fullVersion, goPath := range versionConfig.Patches {
+				if !goversion.IsValid("go"+fullVersion) || MinorVersion(fullVersion) != version {
+					warnings = append(warnings, fmt.Sprintf("バージョン %s のパッチ %s は不正です", version, fullVersion))
+					continue
+				}
+				patch := &VersionConfig{Version: version, Path: goPath, FullVersion: fullVersion, Source: ToolchainSourceConfig}
+				if goPath != "" {
+					if reported, err := toolchainVersion(goPath); err != nil {
+						warnings = append(warnings, err.Error())
+					} else if reported != fullVersion {
+						warnings = append(warnings, fmt.Sprintf("パッチ %s の go コマンドは Go %s です (%s)", fullVersion, reported, goPath))
+					} else {
+						patch.Available = true
+						registered[resolvedPath(goPath)] = true
+					}
+				}
+				addPatch(patch)
+			}
+		}
+	}
+
+	provisioned := provisionedToolchainDir()
+	for _, dir := range append(toolchainDirs(), provisioned) {
+		source := ToolchainSourceDiscovered
+		if dir == provisioned {
+			source = ToolchainSourceProvisioned
+		}
+		for _, goPath := range findToolchains(dir) {
+			if registered[resolvedPath(goPath)] {
+				continue
+			}
+			registered[resolvedPath(goPath)] = true
+
+			fullVersion, err := toolchainVersion(goPath)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+				continue
+			}
+			addPatch(&VersionConfig{
+				Version:     MinorVersion(fullVersion),
+				Path:        goPath,
+				FullVersion: fullVersion,
+				Available:   true,
+				Source:      source,
+			})
+		}
+	}
+
+	// 設定されていない、または見つからないマイナーバージョンは最新のパッチで補う
+	for _, patch := range patches {
+		if !patch.Available {
+			continue
+		}
+		if existing := versions[patch.Version]; existing != nil && existing.Available &&
+			(existing.Source == ToolchainSourceConfig || compareGoVersions(patch.FullVersion, existing.FullVersion) <= 0) {
+			continue
+		}
+		versions[patch.Version] = patch
+	}
+	return versions, patches, warnings
+}
+
+// toolchainDirs returns the directories searched for toolchains
+func toolchainDirs() []string {
+	if value := os.Getenv("GO_TOOLCHAIN_DIRS"); value != "" {
+		return filepath.SplitList(value)
+	}
+	dirs := []string{"/opt"}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "sdk"))
+	}
+	return dirs
+}
+
+// findToolchains returns the go commands of the GOROOTs directly inside dir:
+// go* directories, and toolchain@* directories of the module cache
+func findToolchains(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var goPaths []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "go") && !strings.HasPrefix(entry.Name(), "toolchain@") {
+			continue
+		}
+		goPath := filepath.Join(dir, entry.Name(), "bin", "go")
+		if info, err := os.Stat(goPath); err == nil && !info.IsDir() {
+			goPaths = append(goPaths, goPath)
+		}
+	}
+	return goPaths
+}
+
+// toolchainVersion runs "go version" and returns the version without the go prefix (e.g. "1.22.7")
+func toolchainVersion(goPath string) (string, error) {
+	// #nosec G204 - goPath is from trusted configuration or toolchain directories
+	cmd := exec.Command(goPath, "version")
+	// go.mod の toolchain 行で別のツールチェーンに切り替わらないようにする
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ツールチェーンを実行できません (%s): %w", goPath, err)
+	}
+
+	// "go version go1.18.10 linux/amd64" から "1.18.10" を抽出
+	matches := goVersionPattern.FindStringSubmatch(string(output))
+	if len(matches) < 2 || !goversion.IsValid("go"+matches[1]) {
+		return "", fmt.Errorf("バージョン情報を解析できませんでした (%s): %s", goPath, strings.TrimSpace(string(output)))
+	}
+	return matches[1], nil
+}
+
+// resolvedPath resolves symbolic links so that one toolchain is registered once
+func resolvedPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,292 @@
+// Package version - Remote runner client
+//
+// RemoteRunner sends executions to runner processes using the protocol in
+// runner.go. Each execution goes to the reachable runner with the fewest
+// executions in flight; a runner that cannot be reached is skipped for a
+// while, and a runner with a full queue (503) passes the execution on to the
+// next one. Once a runner has accepted an execution it is never retried,
+// since the program may already have run.
+//
+// Environment variables:
+// - RUNNER_URLS: comma separated runner base URLs, unset to execute in-process (e.g. "http://localhost:9001,http://localhost:9002")
+// - RUNNER_TOKEN: shared bearer token sent to the runners
+package version
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runnerRetryDelay is how long an unreachable runner is skipped
+const runnerRetryDelay = 10 * time.Second
+
+// runnerEndpoint is one runner process
+type runnerEndpoint struct {
+	url       string
+	inFlight  atomic.Int64
+	downUntil atomic.Int64 // UnixNano。この時刻まで接続できなかったものとして後回しにする
+	lastError atomic.Value // string
+}
+
+// RunnerStatus describes a runner as seen by the web server
+type RunnerStatus struct {
+	URL       string `json:"url"`
+	InFlight  int64  `json:"in_flight"`
+	Healthy   bool   `json:"healthy"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// RemoteRunner dispatches executions to runner processes over HTTP
+type RemoteRunner struct {
+	endpoints []*runnerEndpoint
+	client    *http.Client
+	token     string
+	next      atomic.Uint64 // 負荷が同じランナーを順番に使うための開始位置
+}
+
+var (
+	globalRemoteRunner     *RemoteRunner
+	globalRemoteRunnerOnce sync.Once
+)
+
+// GetRemoteRunner returns the runners configured by RUNNER_URLS, or nil to execute in-process
+func GetRemoteRunner() *RemoteRunner {
+	globalRemoteRunnerOnce.Do(func() {
+		var urls []string
+		for _, url := range strings.Split(os.Getenv("RUNNER_URLS"), ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				urls = append(urls, url)
+			}
+		}
+		if len(urls) == 0 {
+			return
+		}
+		globalRemoteRunner = NewRemoteRunner(urls, runnerToken())
+		log.Printf("Runner: dispatching executions to %s", strings.Join(urls, ", "))
+	})
+	return globalRemoteRunner
+}
+
+// NewRemoteRunner creates a runner client for the given runner base URLs
+func NewRemoteRunner(urls []string, token string) *RemoteRunner {
+	r := &RemoteRunner{
+		// 実行時間はリクエストのタイムアウトとコンテキストで制御するため、全体のタイムアウトは設けない
+		client: &http.Client{},
+		token:  token,
+	}
+	for _, url := range urls {
+		r.endpoints = append(r.endpoints, &runnerEndpoint{url: strings.TrimRight(url, "/")})
+	}
+	return r
+}
+
+// Execute runs the request on a runner process
+func (r *RemoteRunner) Execute(ctx context.Context, req ExecutionRequest) (*ExecutionResult, error) {
+	return r.execute(ctx, req, nil)
+}
+
+// ExecuteStream runs the request on a runner process, relaying output and standard input
+func (r *RemoteRunner) ExecuteStream(ctx context.Context, req ExecutionRequest, handlers StreamHandlers) (*ExecutionResult, error) {
+	return r.execute(ctx, req, &handlers)
+}
+
+// Status reports every runner's load and reachability
+func (r *RemoteRunner) Status() []RunnerStatus {
+	now := time.Now().UnixNano()
+	statuses := make([]RunnerStatus, 0, len(r.endpoints))
+	for _, endpoint := range r.endpoints {
+		status := RunnerStatus{
+			URL:      endpoint.url,
+			InFlight: endpoint.inFlight.Load(),
+			Healthy:  endpoint.downUntil.Load() <= now,
+		}
+		status.LastError, _ = endpoint.lastError.Load().(string)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// candidates orders the runners: reachable ones by load first, then the ones recently unreachable.
+// Runners with the same load take turns.
+func (r *RemoteRunner) candidates() []*runnerEndpoint {
+	now := time.Now().UnixNano()
+	start := int(r.next.Add(1) % uint64(len(r.endpoints)))
+	endpoints := append(append([]*runnerEndpoint(nil), r.endpoints[start:]...), r.endpoints[:start]...)
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		downI, downJ := endpoints[i].downUntil.Load() > now, endpoints[j].downUntil.Load() > now
+		if downI != downJ {
+			return !downI
+		}
+		return endpoints[i].inFlight.Load() < endpoints[j].inFlight.Load()
+	})
+	return endpoints
+}
+
+// execute tries the runners in order until one accepts the execution
+func (r *RemoteRunner) execute(ctx context.Context, req ExecutionRequest, stream *StreamHandlers) (*ExecutionResult, error) {
+	var errs []error
+	for _, endpoint := range r.candidates() {
+		result, accepted, err := r.executeOn(ctx, endpoint, req, stream)
+		if accepted || ctx.Err() != nil {
+			return result, err
+		}
+		log.Printf("[WARN] RemoteRunner: %s: %v", endpoint.url, err)
+		errs = append(errs, err)
+	}
+	err := fmt.Errorf("利用できるランナーがありません: %w", errors.Join(errs...))
+	return &ExecutionResult{UsedVersion: req.Version, Status: StatusError, ExitCode: 1, Error: err.Error()}, err
+}
+
+// executeOn runs the request on one runner. accepted reports whether the runner took the execution.
+func (r *RemoteRunner) executeOn(ctx context.Context, endpoint *runnerEndpoint, req ExecutionRequest, stream *StreamHandlers) (*ExecutionResult, bool, error) {
+	failed := func(err error) (*ExecutionResult, bool, error) {
+		return &ExecutionResult{UsedVersion: req.Version, Status: StatusError, ExitCode: 1, Error: err.Error()}, false, err
+	}
+
+	endpoint.inFlight.Add(1)
+	defer endpoint.inFlight.Add(-1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 標準入力は実行が受け付けられてから読む（別のランナーで再試行しても入力を失わない）
+	bodyReader, bodyWriter := io.Pipe()
+	accepted := make(chan struct{})
+	go r.writeRequestBody(ctx, bodyWriter, req, stream, accepted)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.url+"/v1/execute", bodyReader)
+	if err != nil {
+		bodyReader.Close()
+		return failed(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-ndjson")
+	if r.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		bodyReader.CloseWithError(err)
+		endpoint.markDown(err)
+		return failed(fmt.Errorf("ランナーに接続できません: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("ランナーが実行を受け付けませんでした (%s): %s", resp.Status, strings.TrimSpace(string(message)))
+		bodyReader.CloseWithError(err)
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			endpoint.markDown(err)
+		}
+		return failed(err)
+	}
+	endpoint.lastError.Store("")
+	endpoint.downUntil.Store(0)
+	close(accepted)
+
+	result, err := readRunnerResponse(resp.Body, stream)
+	if result == nil {
+		// 終了メッセージの前に切断された
+		cause := err
+		if ctx.Err() != nil {
+			cause = context.Cause(ctx)
+		}
+		result = &ExecutionResult{UsedVersion: req.Version, Status: StatusError, ExitCode: 1}
+		if ctx.Err() != nil {
+			result.Status = StatusCanceled
+		}
+		err = fmt.Errorf("ランナーとの接続が切断されました: %w", cause)
+		result.Error = err.Error()
+	}
+	return result, true, err
+}
+
+// writeRequestBody sends the run message, then the standard input once the runner accepted the execution
+func (r *RemoteRunner) writeRequestBody(ctx context.Context, w *io.PipeWriter, req ExecutionRequest, stream *StreamHandlers, accepted <-chan struct{}) {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(RunnerMessage{Type: RunnerMessageRun, Request: &req, Stream: stream != nil && stream.OnOutput != nil}); err != nil {
+		return
+	}
+	if stream == nil || stream.Stdin == nil {
+		w.Close()
+		return
+	}
+	select {
+	case <-accepted:
+	case <-ctx.Done():
+		w.Close()
+		return
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Stdin.Read(buf)
+		if n > 0 {
+			if encoder.Encode(RunnerMessage{Type: RunnerMessageStdin, Data: buf[:n]}) != nil {
+				return
+			}
+		}
+		if err != nil {
+			if encoder.Encode(RunnerMessage{Type: RunnerMessageStdinEOF}) == nil {
+				w.Close()
+			}
+			return
+		}
+	}
+}
+
+// readRunnerResponse relays status and output messages and returns the result of the exit message.
+// The result is nil if the stream ended without one.
+func readRunnerResponse(body io.Reader, stream *StreamHandlers) (*ExecutionResult, error) {
+	decoder := json.NewDecoder(bufio.NewReader(body))
+	for {
+		var msg RunnerMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch msg.Type {
+		case RunnerMessageStatus:
+			if stream != nil && stream.OnPhase != nil {
+				stream.OnPhase(msg.Phase)
+			}
+		case RunnerMessageStdout, RunnerMessageStderr:
+			if stream != nil && stream.OnOutput != nil {
+				stream.OnOutput(msg.Type, msg.Data)
+			}
+		case RunnerMessageExit:
+			if msg.Result == nil {
+				return nil, fmt.Errorf("終了メッセージに結果がありません")
+			}
+			for i := range msg.Result.Captures {
+				if i < len(msg.CaptureData) {
+					msg.Result.Captures[i].Data = msg.CaptureData[i]
+				}
+			}
+			if msg.Error != "" {
+				return msg.Result, errors.New(msg.Error)
+			}
+			return msg.Result, nil
+		}
+	}
+}
+
+// markDown skips the runner for runnerRetryDelay
+func (e *runnerEndpoint) markDown(err error) {
+	e.lastError.Store(err.Error())
+	e.downUntil.Store(time.Now().Add(runnerRetryDelay).UnixNano())
+}
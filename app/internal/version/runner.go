@@ -0,0 +1,286 @@
+// Package version - Runner interface and the runner protocol
+//
+// A Runner executes requests. The Executor itself is the in-process runner;
+// a RemoteRunner sends executions to one or more runner processes
+// (app/cmd/runner) over HTTP, so the toolchains and the sandbox can live on
+// other hosts than the web server.
+//
+// Protocol (HTTP/1.1, newline-delimited JSON, one RunnerMessage per line):
+//
+//	GET  /v1/info     -> RunnerInfo
+//	POST /v1/execute  -> full-duplex message stream
+//
+// The request body of /v1/execute starts with a "run" message carrying the
+// ExecutionRequest (timeout in nanoseconds), optionally followed by "stdin"
+// messages and a "stdin_eof" message; the end of the body also closes the
+// program's standard input. The response body is a sequence of "status"
+// (phase) and, for stream=true, "stdout" / "stderr" (data) messages, ending
+// with exactly one "exit" message with the ExecutionResult, the data of its
+// captures and the execution error, if any. Byte fields are base64 encoded.
+// Closing the connection cancels the execution.
+//
+// Runners apply the code policy themselves, cap the requested timeout and
+// output size at their own limits and queue executions with their own
+// scheduler; a runner whose queue is full answers 503 before reading the body.
+// If RUNNER_TOKEN is set, requests must carry "Authorization: Bearer <token>";
+// a runner listening on a non-loopback address refuses to start without it.
+package version
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Runner executes code requests, in-process or in a runner process
+type Runner interface {
+	Execute(ctx context.Context, req ExecutionRequest) (*ExecutionResult, error)
+	ExecuteStream(ctx context.Context, req ExecutionRequest, handlers StreamHandlers) (*ExecutionResult, error)
+}
+
+// The Executor is the in-process Runner
+var _ Runner = (*Executor)(nil)
+
+// Runner protocol message types
+const (
+	RunnerMessageRun      = "run"       // client: 最初のメッセージ（request, stream）
+	RunnerMessageStdin    = "stdin"     // client: 標準入力のデータ
+	RunnerMessageStdinEOF = "stdin_eof" // client: 標準入力を閉じる
+	RunnerMessageStatus   = "status"    // runner: phase（"compiling" / "running"）
+	RunnerMessageStdout   = "stdout"    // runner: 標準出力のチャンク
+	RunnerMessageStderr   = "stderr"    // runner: 標準エラー出力のチャンク
+	RunnerMessageExit     = "exit"      // runner: 最終結果（result, capture_data, error）
+)
+
+// RunnerMessage is one line of the runner protocol
+type RunnerMessage struct {
+	Type        string            `json:"type"`
+	Request     *ExecutionRequest `json:"request,omitempty"`      // run
+	Stream      bool              `json:"stream,omitempty"`       // run: 出力を逐次送るか
+	Data        []byte            `json:"data,omitempty"`         // stdin / stdout / stderr
+	Phase       string            `json:"phase,omitempty"`        // status
+	Result      *ExecutionResult  `json:"result,omitempty"`       // exit
+	CaptureData [][]byte          `json:"capture_data,omitempty"` // exit: Result.Captures と同じ順のデータ
+	Error       string            `json:"error,omitempty"`        // exit: 実行エラー
+}
+
+// RunnerInfo describes a runner process (GET /v1/info)
+type RunnerInfo struct {
+	Sandbox   string                    `json:"sandbox"`
+	Isolated  bool                      `json:"isolated"`
+	Scheduler map[string]interface{}    `json:"scheduler"`
+	Versions  map[string]*VersionConfig `json:"versions"`
+	Patches   map[string]*VersionConfig `json:"patches"`
+}
+
+// runnerToken returns the shared secret between the web server and runners (RUNNER_TOKEN)
+func runnerToken() string {
+	return os.Getenv("RUNNER_TOKEN")
+}
+
+// CheckRunnerListenHost rejects listening on a non-loopback host without RUNNER_TOKEN,
+// which would let anyone who can reach the runner execute code
+func CheckRunnerListenHost(host string) error {
+	if runnerToken() != "" {
+		return nil
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("ループバック以外のアドレス（%q）で待ち受けるには RUNNER_TOKEN が必要です", host)
+}
+
+// runnerHandler serves the runner protocol with an in-process executor
+type runnerHandler struct {
+	executor *Executor
+	token    string
+}
+
+// NewRunnerHandler returns the HTTP handler of a runner process executing with executor
+func NewRunnerHandler(executor *Executor) http.Handler {
+	h := &runnerHandler{executor: executor, token: runnerToken()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/info", h.handleInfo)
+	mux.HandleFunc("/v1/execute", h.handleExecute)
+	return mux
+}
+
+// authorized checks the bearer token when RUNNER_TOKEN is set
+func (h *runnerHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.token == "" {
+		return true
+	}
+	// トークンの一致までの時間から推測されないように定数時間で比較する
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+h.token)) == 1 {
+		return true
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+func (h *runnerHandler) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sandbox := h.executor.sandbox
+	info := RunnerInfo{
+		Sandbox:   sandbox.Name(),
+		Isolated:  sandbox.Isolated(),
+		Scheduler: GetScheduler().Stats(),
+		Versions:  h.executor.GetVersionInfo(),
+		Patches:   h.executor.manager.GetAllPatchConfigs(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Printf("[DEBUG] runner: failed to encode info: %v", err)
+	}
+}
+
+// maxRunnerTimeout caps the timeout of a runner execution (the longest timeout the web server uses)
+const maxRunnerTimeout = 30 * time.Second
+
+// limitRunnerRequest caps the timeout and the output size requested by the caller at the runner's limits
+func limitRunnerRequest(req ExecutionRequest) ExecutionRequest {
+	if req.Timeout > maxRunnerTimeout {
+		req.Timeout = maxRunnerTimeout
+	}
+	// 0以下は実行時にMAX_OUTPUT_BYTESになる
+	if limit := defaultOutputLimit(); req.MaxOutputBytes > limit {
+		req.MaxOutputBytes = limit
+	}
+	return req
+}
+
+func (h *runnerHandler) handleExecute(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 満杯なら本文を読む前に503を返し、呼び出し側に別のランナーを選ばせる
+	release, _, err := GetScheduler().Acquire(r.Context(), r.RemoteAddr, nil)
+	if err != nil {
+		var queueFull *QueueFullError
+		if errors.As(err, &queueFull) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(queueFull.RetryAfter.Seconds()))))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+		return
+	}
+	defer release()
+
+	// 実行中も標準入力を受け取るため、応答の送信中にリクエスト本文を読む
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil {
+		log.Printf("[WARN] runner: full duplex unavailable: %v", err)
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(r.Body))
+	var run RunnerMessage
+	if err := decoder.Decode(&run); err != nil || run.Type != RunnerMessageRun || run.Request == nil {
+		http.Error(w, "最初のメッセージは run である必要があります", http.StatusBadRequest)
+		return
+	}
+	req := limitRunnerRequest(*run.Request)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	writer := &runnerWriter{controller: http.NewResponseController(w), encoder: json.NewEncoder(w)}
+
+	// ランナーは呼び出し側の検証に頼らず、自身でコードポリシーを適用する
+	if err := h.executor.ValidateRequest(req); err != nil {
+		result := &ExecutionResult{UsedVersion: req.Version, Status: StatusError, ExitCode: 1, Error: fmt.Sprintf("コード検証エラー: %v", err)}
+		var policyErr *PolicyError
+		if errors.As(err, &policyErr) {
+			result.Violations = policyErr.Violations
+		}
+		writer.send(RunnerMessage{Type: RunnerMessageExit, Result: result, Error: result.Error})
+		return
+	}
+
+	stdinReader, stdinWriter := io.Pipe()
+	defer stdinReader.Close()
+	go func() {
+		defer stdinWriter.Close()
+		for {
+			var msg RunnerMessage
+			if err := decoder.Decode(&msg); err != nil {
+				return // 本文の終わりも標準入力の終わりとして扱う
+			}
+			switch msg.Type {
+			case RunnerMessageStdin:
+				if _, err := stdinWriter.Write(msg.Data); err != nil {
+					return
+				}
+			case RunnerMessageStdinEOF:
+				return
+			}
+		}
+	}()
+
+	handlers := StreamHandlers{
+		Stdin: stdinReader,
+		OnPhase: func(phase string) {
+			writer.send(RunnerMessage{Type: RunnerMessageStatus, Phase: phase})
+		},
+	}
+	if run.Stream {
+		handlers.OnOutput = func(stream string, data []byte) {
+			writer.send(RunnerMessage{Type: stream, Data: data})
+		}
+	}
+
+	log.Printf("[DEBUG] runner: executing version=%q from %s", req.Version, r.RemoteAddr)
+	result, err := h.executor.ExecuteStream(r.Context(), req, handlers)
+	exit := RunnerMessage{Type: RunnerMessageExit, Result: result}
+	if err != nil {
+		exit.Error = err.Error()
+	}
+	for _, capture := range result.Captures {
+		exit.CaptureData = append(exit.CaptureData, capture.Data)
+	}
+	writer.send(exit)
+}
+
+// runnerWriter sends protocol messages from the executor's goroutines
+type runnerWriter struct {
+	controller *http.ResponseController
+	encoder    *json.Encoder
+	mutex      sync.Mutex
+	failed     bool
+}
+
+// send writes one message and flushes it to the client
+func (rw *runnerWriter) send(msg RunnerMessage) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	if rw.failed {
+		return
+	}
+	// 切断された場合はリクエストのコンテキストがキャンセルされ、実行も止まる
+	if err := rw.encoder.Encode(msg); err != nil {
+		rw.failed = true
+		return
+	}
+	if err := rw.controller.Flush(); err != nil {
+		rw.failed = true
+	}
+}
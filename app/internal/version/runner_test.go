@@ -0,0 +1,83 @@
+package version
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckRunnerListenHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		token   string
+		wantErr bool
+	}{
+		{host: "127.0.0.1"},
+		{host: "::1"},
+		{host: "localhost"},
+		{host: "", wantErr: true},
+		{host: "0.0.0.0", wantErr: true},
+		{host: "::", wantErr: true},
+		{host: "192.0.2.10", wantErr: true},
+		{host: "runner.example", wantErr: true},
+		{host: "0.0.0.0", token: "secret"},
+	}
+	for _, tt := range tests {
+		t.Setenv("RUNNER_TOKEN", tt.token)
+		if err := CheckRunnerListenHost(tt.host); (err != nil) != tt.wantErr {
+			t.Errorf("CheckRunnerListenHost(%q) with token %q = %v, want error %v", tt.host, tt.token, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRunnerAuthorized(t *testing.T) {
+	h := &runnerHandler{token: "secret"}
+	tests := map[string]bool{
+		"":               false,
+		"Bearer":         false,
+		"Bearer secre":   false,
+		"Bearer secret":  true,
+		"bearer secret":  false,
+		"Bearer secret ": false,
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/info", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		if got := h.authorized(w, r); got != want {
+			t.Errorf("authorized(%q) = %v, want %v", header, got, want)
+		}
+		if !want && w.Code != http.StatusUnauthorized {
+			t.Errorf("authorized(%q) status = %d, want 401", header, w.Code)
+		}
+	}
+
+	open := &runnerHandler{}
+	if !open.authorized(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/info", nil)) {
+		t.Error("runner without token rejected a request")
+	}
+}
+
+func TestLimitRunnerRequest(t *testing.T) {
+	limit := defaultOutputLimit()
+	tests := []struct {
+		name                 string
+		timeout, wantTimeout time.Duration
+		output, wantOutput   int64
+	}{
+		{name: "defaults"},
+		{name: "within the limits", timeout: 10 * time.Second, wantTimeout: 10 * time.Second, output: 1024, wantOutput: 1024},
+		{name: "at the limits", timeout: maxRunnerTimeout, wantTimeout: maxRunnerTimeout, output: limit, wantOutput: limit},
+		{name: "over the limits", timeout: time.Hour, wantTimeout: maxRunnerTimeout, output: limit + 1, wantOutput: limit},
+		{name: "negative output", output: -1, wantOutput: -1},
+	}
+	for _, tt := range tests {
+		got := limitRunnerRequest(ExecutionRequest{Version: "1.25", Timeout: tt.timeout, MaxOutputBytes: tt.output})
+		if got.Timeout != tt.wantTimeout || got.MaxOutputBytes != tt.wantOutput || got.Version != "1.25" {
+			t.Errorf("%s: timeout %v, output %d, want %v, %d", tt.name, got.Timeout, got.MaxOutputBytes, tt.wantTimeout, tt.wantOutput)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+//go:build linux
+
+// Package version - Linux namespace sandbox
+//
+// The server binary re-executes itself as a small init process inside new
+// user, mount, network, PID, IPC and UTS namespaces. The init process makes
+// every mount read-only, mounts a private tmpfs on /tmp, copies the snippet
+// binary and the working directory contents into it, installs a seccomp
+// filter and finally execs the snippet.
+package version
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	sandboxTmpfsOptions = "size=64m,mode=1777"
+	sandboxBinaryPath   = "/tmp/.sandbox/main" // 作業ディレクトリのファイルと衝突しない場所
+	sandboxHostname     = "sandbox"
+	sandboxInitFailure  = 125
+	// 作業ディレクトリから/tmpへコピーする内容の上限（tmpfsのサイズ内に収める）
+	sandboxWorkDirMaxBytes = 32 << 20
+	// プロセス・スレッド数の上限（fork爆弾対策。Goランタイムのスレッドも含む）
+	sandboxMaxProcs = 128
+	// 仮想メモリの上限。Goランタイムは起動時に数百MiBのアドレス空間を予約するため、
+	// ヒープとして使えるのはこれより数百MiB少ない
+	sandboxMaxAddressSpace = 1 << 30
+	// RLIMIT_NPROC（syscallパッケージに定義がない。サンドボックスが対応するamd64/arm64の値）
+	rlimitNproc = 6
+)
+
+// namespaceSandbox runs binaries inside Linux namespaces with a seccomp filter
+type namespaceSandbox struct {
+	self string
+}
+
+var (
+	namespaceProbeOnce sync.Once
+	namespaceProbeErr  error
+)
+
+// NewNamespaceSandbox returns the Linux namespace sandbox if the kernel supports it
+func NewNamespaceSandbox() (Sandbox, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("実行ファイルのパスを取得できません: %w", err)
+	}
+	sb := &namespaceSandbox{self: self}
+
+	namespaceProbeOnce.Do(func() {
+		namespaceProbeErr = sb.probe()
+	})
+	if namespaceProbeErr != nil {
+		return nil, namespaceProbeErr
+	}
+	return sb, nil
+}
+
+func (s *namespaceSandbox) Name() string   { return "linux-namespace" }
+func (s *namespaceSandbox) Isolated() bool { return true }
+
+// Command returns a command that starts sandbox init for the given binary.
+// The contents of spec.Dir are copied into the sandbox's /tmp, which is the program's working directory.
+// spec.ExtraFiles stay open across the init process's exec, so the program can write to host files through them.
+func (s *namespaceSandbox) Command(spec RunSpec) (*exec.Cmd, error) {
+	initArgs := append([]string{spec.Binary, spec.Dir, "--"}, spec.Args...)
+	cmd := s.initCommand(initArgs, sandboxEnv(spec.Env))
+	cmd.ExtraFiles = spec.ExtraFiles
+	return cmd, nil
+}
+
+// initCommand builds the re-exec command with namespace clone flags
+func (s *namespaceSandbox) initCommand(initArgs []string, env []string) *exec.Cmd {
+	// #nosec G204 - re-executes the server binary itself as sandbox init
+	cmd := exec.Command(s.self)
+	cmd.Args = append([]string{sandboxInitArg0}, initArgs...)
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return cmd
+}
+
+// probe checks that namespaces, mounts and seccomp can be set up on this host
+func (s *namespaceSandbox) probe() error {
+	if !seccompSupported() {
+		return fmt.Errorf("seccompフィルタが未対応のアーキテクチャです: %s", runtime.GOARCH)
+	}
+	cmd := s.initCommand([]string{"--probe"}, sandboxEnv(nil))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("名前空間サンドボックスの起動に失敗しました: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// sandboxEnv builds a minimal environment for sandboxed programs
+func sandboxEnv(userEnv []string) []string {
+	env := []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=/tmp",
+		"TMPDIR=/tmp",
+		"LANG=C.UTF-8",
+	}
+	return append(env, userEnv...)
+}
+
+// runSandboxInit runs inside the new namespaces as PID 1
+func runSandboxInit(args []string) {
+	// seccompとno_new_privsはスレッド単位のため、execまで同一スレッドで処理する
+	runtime.LockOSThread()
+
+	probe := len(args) == 1 && args[0] == "--probe"
+	if !probe && (len(args) < 3 || args[2] != "--") {
+		sandboxInitFail("invalid arguments", nil)
+	}
+
+	var (
+		src   *os.File
+		files []sandboxFile
+	)
+	if !probe {
+		// tmpfsで/tmpを覆う前にバイナリと作業ディレクトリの内容を読み込んでおく
+		f, err := os.Open(args[0])
+		if err != nil {
+			sandboxInitFail("open binary", err)
+		}
+		src = f
+		if args[1] != "" {
+			if files, err = readSandboxWorkDir(args[1]); err != nil {
+				sandboxInitFail("read working directory", err)
+			}
+		}
+	}
+
+	if err := setupSandboxMounts(); err != nil {
+		sandboxInitFail("mount setup", err)
+	}
+	if err := syscall.Sethostname([]byte(sandboxHostname)); err != nil {
+		sandboxInitFail("sethostname", err)
+	}
+	if probe {
+		if err := installSeccompFilter(); err != nil {
+			sandboxInitFail("seccomp", err)
+		}
+		os.Exit(0)
+	}
+
+	if err := writeSandboxWorkDir(files); err != nil {
+		sandboxInitFail("copy working directory", err)
+	}
+	if err := copySandboxBinary(src); err != nil {
+		sandboxInitFail("copy binary", err)
+	}
+	if err := os.Chdir("/tmp"); err != nil {
+		sandboxInitFail("chdir", err)
+	}
+	if err := setSandboxRlimits(); err != nil {
+		sandboxInitFail("rlimit", err)
+	}
+
+	if err := installSeccompFilter(); err != nil {
+		sandboxInitFail("seccomp", err)
+	}
+
+	argv := append([]string{"main"}, args[3:]...)
+	err := syscall.Exec(sandboxBinaryPath, argv, os.Environ())
+	sandboxInitFail("exec", err)
+}
+
+// sandboxInitFail reports an init failure on stderr and exits
+func sandboxInitFail(step string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %s: %v\n", step, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "sandbox: %s\n", step)
+	}
+	os.Exit(sandboxInitFailure)
+}
+
+// setupSandboxMounts makes the filesystem read-only and mounts a private /tmp
+func setupSandboxMounts() error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+
+	// PID名前空間に対応した/procを用意（コンテナ内では失敗することがあるため任意）
+	_ = syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+
+	mounts, err := readMountInfo()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if m.point == "/proc" || strings.HasPrefix(m.point, "/proc/") {
+			continue
+		}
+		// 1つでも書き込み可能なまま残る場合は実行しない
+		flags := uintptr(syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY) | m.lockedFlags
+		if err := syscall.Mount("", m.point, "", flags, ""); err != nil {
+			return fmt.Errorf("remount %s read-only: %w", m.point, err)
+		}
+	}
+
+	if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, sandboxTmpfsOptions); err != nil {
+		return fmt.Errorf("mount private /tmp: %w", err)
+	}
+	return nil
+}
+
+// mountEntry is a mount point with the flags that must be preserved on remount
+type mountEntry struct {
+	point       string
+	lockedFlags uintptr
+}
+
+// readMountInfo parses /proc/self/mountinfo
+func readMountInfo() ([]mountEntry, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("read mountinfo: %w", err)
+	}
+	defer f.Close()
+
+	var mounts []mountEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		mounts = append(mounts, mountEntry{
+			point:       unescapeMountPath(fields[4]),
+			lockedFlags: mountOptionFlags(fields[5]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// mountOptionFlags converts per-mount options to flags locked by user namespaces
+func mountOptionFlags(options string) uintptr {
+	var flags uintptr
+	for _, opt := range strings.Split(options, ",") {
+		switch opt {
+		case "nosuid":
+			flags |= syscall.MS_NOSUID
+		case "nodev":
+			flags |= syscall.MS_NODEV
+		case "noexec":
+			flags |= syscall.MS_NOEXEC
+		case "noatime":
+			flags |= syscall.MS_NOATIME
+		case "nodiratime":
+			flags |= syscall.MS_NODIRATIME
+		case "relatime":
+			flags |= syscall.MS_RELATIME
+		}
+	}
+	return flags
+}
+
+// unescapeMountPath decodes octal escapes (e.g. \040) used in mountinfo
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			var c byte
+			if _, err := fmt.Sscanf(s[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// copySandboxBinary copies the snippet binary into the private tmpfs
+func copySandboxBinary(src *os.File) error {
+	defer src.Close()
+	if err := os.Mkdir(filepath.Dir(sandboxBinaryPath), 0o700); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(sandboxBinaryPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o700)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// sandboxFile is a directory or regular file copied from the working directory
+type sandboxFile struct {
+	name string
+	mode os.FileMode
+	data []byte
+}
+
+// readSandboxWorkDir reads the working directory tree into memory (symlinks and special files are skipped)
+func readSandboxWorkDir(dir string) ([]sandboxFile, error) {
+	var (
+		files []sandboxFile
+		total int64
+	)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			files = append(files, sandboxFile{name: name, mode: os.ModeDir | 0o755})
+		case info.Mode().IsRegular():
+			total += info.Size()
+			if total > sandboxWorkDirMaxBytes {
+				return fmt.Errorf("working directory exceeds %d bytes", sandboxWorkDirMaxBytes)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, sandboxFile{name: name, mode: info.Mode().Perm(), data: data})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// writeSandboxWorkDir recreates the working directory contents under /tmp
+func writeSandboxWorkDir(files []sandboxFile) error {
+	for _, f := range files {
+		path := filepath.Join("/tmp", f.name)
+		if f.mode.IsDir() {
+			if err := os.Mkdir(path, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.WriteFile(path, f.data, f.mode|0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setSandboxRlimits applies conservative resource limits.
+// RLIMIT_NPROC counts the processes of the host user and is not enforced for
+// root (uid 0 on the host), so a container running as root also needs a pids
+// cgroup limit (see docker-compose.yml).
+func setSandboxRlimits() error {
+	limits := map[int]uint64{
+		syscall.RLIMIT_NOFILE: 256,
+		syscall.RLIMIT_FSIZE:  64 << 20,
+		syscall.RLIMIT_CORE:   0,
+		rlimitNproc:           sandboxMaxProcs,
+		syscall.RLIMIT_AS:     sandboxMaxAddressSpace,
+	}
+	for resource, value := range limits {
+		// 上限を下げる操作は権限なしで行えるため、失敗した場合は実行しない
+		if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value}); err != nil {
+			return fmt.Errorf("resource %d: %w", resource, err)
+		}
+	}
+	return nil
+}
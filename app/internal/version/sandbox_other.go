@@ -0,0 +1,16 @@
+//go:build !linux
+
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// NewNamespaceSandbox is only available on Linux
+func NewNamespaceSandbox() (Sandbox, error) {
+	return nil, fmt.Errorf("名前空間サンドボックスはLinuxのみ対応しています（現在: %s）", runtime.GOOS)
+}
+
+// runSandboxInit is never requested on non-Linux platforms
+func runSandboxInit([]string) {}
@@ -0,0 +1,281 @@
+// Package version - Execution scheduler with bounded workers and fair queueing
+//
+// Every execution must acquire a slot from the scheduler before spawning
+// toolchain processes. At most Workers executions run at once; further
+// requests wait in a bounded queue. Waiting requests are served round-robin
+// across clients so one user pressing Run repeatedly cannot starve a
+// classroom, and each client may only have a limited number of queued jobs.
+//
+// Environment variables:
+// - EXEC_WORKERS: concurrent executions (default: number of CPUs)
+// - EXEC_QUEUE_SIZE: maximum queued executions (default: 64)
+// - EXEC_QUEUE_PER_CLIENT: maximum queued executions per client (default: 4)
+package version
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize      = 64
+	defaultQueuePerClient = 4
+	initialJobDuration    = 2 * time.Second
+	jobDurationSmoothing  = 0.2
+)
+
+// ErrQueueFull is returned when no more executions can be queued
+var ErrQueueFull = errors.New("実行キューが満杯です")
+
+// QueueFullError carries a retry hint for a rejected execution
+type QueueFullError struct {
+	RetryAfter time.Duration
+	PerClient  bool
+}
+
+func (e *QueueFullError) Error() string {
+	if e.PerClient {
+		return "このクライアントの実行待ちが多すぎます"
+	}
+	return ErrQueueFull.Error()
+}
+
+// Is lets errors.Is(err, ErrQueueFull) match
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+// schedulerJob is a queued execution waiting for a slot
+type schedulerJob struct {
+	client     string
+	ready      chan struct{}
+	onPosition func(int)
+	position   int
+}
+
+// Scheduler limits concurrent executions and queues the rest fairly
+type Scheduler struct {
+	workers        int
+	maxQueue       int
+	maxPerClient   int
+	mutex          sync.Mutex
+	running        int
+	queued         int
+	queues         map[string][]*schedulerJob
+	clients        []string // ラウンドロビン順のクライアント
+	avgJobDuration time.Duration
+}
+
+// SlotInfo describes how an execution obtained its slot
+type SlotInfo struct {
+	QueuePosition int           // キュー投入時の順番（0なら待ちなし）
+	Waited        time.Duration // 待ち時間
+}
+
+// NewScheduler creates a scheduler
+func NewScheduler(workers, maxQueue, maxPerClient int) *Scheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Scheduler{
+		workers:        workers,
+		maxQueue:       maxQueue,
+		maxPerClient:   maxPerClient,
+		queues:         make(map[string][]*schedulerJob),
+		avgJobDuration: initialJobDuration,
+	}
+}
+
+// Acquire waits for an execution slot for clientID.
+// onPosition (optional) is called with the 1-based queue position whenever it changes.
+// The returned release function must be called when the execution finishes.
+func (s *Scheduler) Acquire(ctx context.Context, clientID string, onPosition func(int)) (func(), SlotInfo, error) {
+	start := time.Now()
+	s.mutex.Lock()
+
+	// 空きがあり待ちがなければ即実行
+	if s.running < s.workers && s.queued == 0 {
+		s.running++
+		s.mutex.Unlock()
+		return s.releaseFunc(start), SlotInfo{}, nil
+	}
+
+	if s.queued >= s.maxQueue {
+		retryAfter := s.retryAfterLocked()
+		s.mutex.Unlock()
+		return nil, SlotInfo{}, &QueueFullError{RetryAfter: retryAfter}
+	}
+	if s.maxPerClient > 0 && len(s.queues[clientID]) >= s.maxPerClient {
+		retryAfter := s.retryAfterLocked()
+		s.mutex.Unlock()
+		return nil, SlotInfo{}, &QueueFullError{RetryAfter: retryAfter, PerClient: true}
+	}
+
+	job := &schedulerJob{client: clientID, ready: make(chan struct{}), onPosition: onPosition}
+	if len(s.queues[clientID]) == 0 {
+		s.clients = append(s.clients, clientID)
+	}
+	s.queues[clientID] = append(s.queues[clientID], job)
+	s.queued++
+	s.updatePositionsLocked()
+	info := SlotInfo{QueuePosition: job.position}
+	s.mutex.Unlock()
+
+	select {
+	case <-job.ready:
+		info.Waited = time.Since(start)
+		return s.releaseFunc(time.Now()), info, nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		select {
+		case <-job.ready:
+			// キャンセルと同時にスロットが割り当てられた場合は返却する
+			s.running--
+			s.dispatchLocked()
+		default:
+			s.removeLocked(job)
+			s.updatePositionsLocked()
+		}
+		return nil, info, context.Cause(ctx)
+	}
+}
+
+// releaseFunc returns the slot and records the job duration
+func (s *Scheduler) releaseFunc(start time.Time) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			elapsed := time.Since(start)
+			s.avgJobDuration = time.Duration(float64(s.avgJobDuration)*(1-jobDurationSmoothing) + float64(elapsed)*jobDurationSmoothing)
+			s.running--
+			s.dispatchLocked()
+		})
+	}
+}
+
+// dispatchLocked hands free slots to queued jobs in round-robin client order
+func (s *Scheduler) dispatchLocked() {
+	for s.running < s.workers && s.queued > 0 {
+		client := s.clients[0]
+		s.clients = s.clients[1:]
+
+		queue := s.queues[client]
+		job := queue[0]
+		if len(queue) > 1 {
+			s.queues[client] = queue[1:]
+			s.clients = append(s.clients, client)
+		} else {
+			delete(s.queues, client)
+		}
+
+		s.queued--
+		s.running++
+		close(job.ready)
+	}
+	s.updatePositionsLocked()
+}
+
+// removeLocked drops a cancelled job from its client queue
+func (s *Scheduler) removeLocked(job *schedulerJob) {
+	queue := s.queues[job.client]
+	for i, queuedJob := range queue {
+		if queuedJob == job {
+			queue = append(queue[:i], queue[i+1:]...)
+			s.queued--
+			break
+		}
+	}
+	if len(queue) > 0 {
+		s.queues[job.client] = queue
+		return
+	}
+	delete(s.queues, job.client)
+	for i, client := range s.clients {
+		if client == job.client {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			break
+		}
+	}
+}
+
+// updatePositionsLocked recomputes the dispatch order and notifies changed positions
+func (s *Scheduler) updatePositionsLocked() {
+	position := 0
+	for depth := 0; position < s.queued; depth++ {
+		for _, client := range s.clients {
+			queue := s.queues[client]
+			if depth >= len(queue) {
+				continue
+			}
+			position++
+			job := queue[depth]
+			if job.position != position {
+				job.position = position
+				if job.onPosition != nil {
+					job.onPosition(position)
+				}
+			}
+		}
+	}
+}
+
+// retryAfterLocked estimates when a slot is likely to be available
+func (s *Scheduler) retryAfterLocked() time.Duration {
+	wait := s.avgJobDuration * time.Duration(s.queued+1) / time.Duration(s.workers)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait.Round(time.Second)
+}
+
+// Stats returns scheduler usage for status reporting
+func (s *Scheduler) Stats() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return map[string]interface{}{
+		"workers":          s.workers,
+		"running":          s.running,
+		"queued":           s.queued,
+		"max_queue":        s.maxQueue,
+		"max_per_client":   s.maxPerClient,
+		"clients_waiting":  len(s.clients),
+		"avg_job_duration": s.avgJobDuration.String(),
+	}
+}
+
+var (
+	globalScheduler     *Scheduler
+	globalSchedulerOnce sync.Once
+)
+
+// GetScheduler returns the process-wide execution scheduler
+func GetScheduler() *Scheduler {
+	globalSchedulerOnce.Do(func() {
+		workers := envInt("EXEC_WORKERS", runtime.NumCPU())
+		queueSize := envInt("EXEC_QUEUE_SIZE", defaultQueueSize)
+		perClient := envInt("EXEC_QUEUE_PER_CLIENT", defaultQueuePerClient)
+		globalScheduler = NewScheduler(workers, queueSize, perClient)
+		log.Printf("Scheduler: %d workers, queue %d (per client %d)", workers, queueSize, perClient)
+	})
+	return globalScheduler
+}
+
+// envInt reads a non-negative integer environment variable
+func envInt(name string, fallback int) int {
+	if value := os.Getenv(name); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return fallback
+}
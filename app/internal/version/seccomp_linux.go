@@ -0,0 +1,111 @@
+//go:build linux
+
+// Package version - seccomp filter for the namespace sandbox
+//
+// The filter is a deny list: syscalls that could be used to escape or
+// tamper with the sandbox fail with EPERM, everything else is allowed.
+// clone fails with EPERM when asked for new namespaces, and clone3, whose
+// flags are in memory the filter cannot read, fails with ENOSYS so that
+// callers fall back to clone. Syscalls for a foreign architecture kill the
+// process.
+package version
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetNoNewPrivs       = 38
+	prSetSeccomp          = 22
+	seccompModeFilter     = 2
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	// struct seccomp_data offsets（args[0] の下位32ビット。amd64/arm64 はリトルエンディアン）
+	seccompDataNrOffset   = 0
+	seccompDataArchOffset = 4
+	seccompDataArg0Offset = 16
+
+	// CLONE_NEWNS | CLONE_NEWCGROUP | CLONE_NEWUTS | CLONE_NEWIPC | CLONE_NEWUSER | CLONE_NEWPID | CLONE_NEWNET
+	cloneNamespaceFlags = 0x7e020000
+)
+
+// seccompSupported reports whether a deny list exists for this architecture
+func seccompSupported() bool {
+	return seccompAuditArch != 0 && len(seccompDeniedSyscalls) > 0
+}
+
+// buildSeccompProgram assembles the BPF deny-list program
+func buildSeccompProgram() []syscall.SockFilter {
+	stmt := func(code uint16, k uint32) syscall.SockFilter {
+		return syscall.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+		return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+
+	denied := seccompDeniedSyscalls
+	prog := []syscall.SockFilter{
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataArchOffset),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, seccompAuditArch, 1, 0),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKillProcess),
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataNrOffset),
+	}
+
+	// 末尾の命令の位置: ... clone3判定, clone判定, 引数の読み込み, フラグ判定, ALLOW, EPERM, ENOSYS
+	first := len(prog)
+	if seccompSyscallLimit > 0 {
+		first++
+	}
+	clone3Check := first + len(denied)
+	allow := clone3Check + 4
+	eperm := allow + 1
+	enosys := allow + 2
+	to := func(from, target int) uint8 {
+		return uint8(target - from - 1)
+	}
+
+	if seccompSyscallLimit > 0 {
+		// x32 ABIなど、番号範囲外のシステムコールを拒否
+		prog = append(prog, jump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, seccompSyscallLimit, to(len(prog), eperm), 0))
+	}
+	for _, nr := range denied {
+		// 一致したら末尾のEPERMへジャンプ
+		prog = append(prog, jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, to(len(prog), eperm), 0))
+	}
+	prog = append(prog,
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, seccompClone3Syscall, to(clone3Check, enosys), 0),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, seccompCloneSyscall, 0, to(clone3Check+1, allow)),
+		// 名前空間を作成する clone を拒否（入れ子のユーザー名前空間など）
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataArg0Offset),
+		jump(syscall.BPF_JMP|syscall.BPF_JSET|syscall.BPF_K, cloneNamespaceFlags, to(clone3Check+3, eperm), 0),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.ENOSYS)),
+	)
+	return prog
+}
+
+// installSeccompFilter sets no_new_privs and loads the filter for the current thread
+func installSeccompFilter() error {
+	if !seccompSupported() {
+		return fmt.Errorf("unsupported architecture")
+	}
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %w", errno)
+	}
+
+	prog := buildSeccompProgram()
+	fprog := syscall.SockFprog{
+		Len:    uint16(len(prog)),
+		Filter: &prog[0],
+	}
+	// #nosec G103 - passing the BPF program to the kernel requires unsafe.Pointer
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&fprog)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("prctl(PR_SET_SECCOMP): %w", errno)
+	}
+	return nil
+}
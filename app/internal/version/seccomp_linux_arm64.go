@@ -0,0 +1,54 @@
+package version
+
+// AUDIT_ARCH_AARCH64
+const seccompAuditArch = 0xc00000b7
+
+// arm64 has no alternate syscall ABI to reject
+const seccompSyscallLimit = 0
+
+// clone and clone3 are filtered separately (see buildSeccompProgram)
+const (
+	seccompCloneSyscall  = 220
+	seccompClone3Syscall = 435
+)
+
+// seccompDeniedSyscalls lists arm64 syscall numbers rejected with EPERM
+var seccompDeniedSyscalls = []uint32{
+	39,  // umount2
+	40,  // mount
+	41,  // pivot_root
+	51,  // chroot
+	60,  // quotactl
+	89,  // acct
+	97,  // unshare
+	104, // kexec_load
+	105, // init_module
+	106, // delete_module
+	117, // ptrace
+	142, // reboot
+	161, // sethostname
+	162, // setdomainname
+	217, // add_key
+	218, // request_key
+	219, // keyctl
+	224, // swapon
+	225, // swapoff
+	241, // perf_event_open
+	264, // name_to_handle_at
+	265, // open_by_handle_at
+	268, // setns
+	270, // process_vm_readv
+	271, // process_vm_writev
+	273, // finit_module
+	280, // bpf
+	282, // userfaultfd
+	294, // kexec_file_load
+	425, // io_uring_setup
+	426, // io_uring_enter
+	427, // io_uring_register
+	428, // open_tree
+	429, // move_mount
+	430, // fsopen
+	432, // fsmount
+	442, // mount_setattr
+}
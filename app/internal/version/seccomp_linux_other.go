@@ -0,0 +1,14 @@
+//go:build linux && !amd64 && !arm64
+
+package version
+
+// No deny list is maintained for this architecture; the namespace
+// sandbox reports itself as unavailable.
+const (
+	seccompAuditArch     = 0
+	seccompSyscallLimit  = 0
+	seccompCloneSyscall  = 0
+	seccompClone3Syscall = 0
+)
+
+var seccompDeniedSyscalls []uint32
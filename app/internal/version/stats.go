@@ -0,0 +1,188 @@
+// Package version - Statistics for benchmark comparison
+//
+// The methods follow benchstat: the center of a sample is its median with a
+// distribution-free confidence interval from order statistics, and two
+// samples are compared with the Mann-Whitney U test, reporting a change only
+// when the p-value is below alpha.
+package version
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// benchmarkConfidence is the target confidence of the median interval
+	benchmarkConfidence = 0.95
+	// benchmarkAlpha is the significance level of the U test
+	benchmarkAlpha = 0.05
+	// exactUTestLimit is the largest n1*n2 for which the exact U distribution is computed
+	exactUTestLimit = 2500
+)
+
+// sampleSummary is the median and its confidence interval
+type sampleSummary struct {
+	Median     float64
+	Low        float64
+	High       float64
+	Confidence float64 // 実際の信頼水準（サンプルが少ないと benchmarkConfidence 未満になる）
+}
+
+// summarizeSample computes the median and a confidence interval from order statistics
+func summarizeSample(values []float64) sampleSummary {
+	n := len(values)
+	if n == 0 {
+		return sampleSummary{Median: math.NaN(), Low: math.NaN(), High: math.NaN()}
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	summary := sampleSummary{Median: median(sorted)}
+	if n == 1 {
+		summary.Low, summary.High = sorted[0], sorted[0]
+		return summary
+	}
+
+	// 区間 [x(k), x(n-k+1)] の被覆確率は 1 - 2*P(B <= k-1)（B ~ Binomial(n, 1/2)）
+	k, confidence := 1, 1-2*binomialCDF(0, n)
+	for next := 2; next <= n/2; next++ {
+		c := 1 - 2*binomialCDF(next-1, n)
+		if c < benchmarkConfidence {
+			break
+		}
+		k, confidence = next, c
+	}
+	summary.Low = sorted[k-1]
+	summary.High = sorted[n-k]
+	summary.Confidence = confidence
+	return summary
+}
+
+// median returns the median of sorted values
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// binomialCDF returns P(B <= k) for B ~ Binomial(n, 1/2)
+func binomialCDF(k, n int) float64 {
+	sum := 0.0
+	for i := 0; i <= k; i++ {
+		sum += math.Exp(logChoose(n, i) - float64(n)*math.Ln2)
+	}
+	return sum
+}
+
+// logChoose returns log(n choose k)
+func logChoose(n, k int) float64 {
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
+
+// mannWhitneyUTest returns the two-sided p-value that x and y come from the same distribution
+func mannWhitneyUTest(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return math.NaN()
+	}
+
+	// 結合したサンプルに順位を付ける（同順位は平均順位）
+	type ranked struct {
+		value float64
+		fromX bool
+	}
+	all := make([]ranked, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, ranked{v, true})
+	}
+	for _, v := range y {
+		all = append(all, ranked{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	rankSumX := 0.0
+	tieCorrection := 0.0
+	hasTies := false
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // 1始まりの平均順位
+		for k := i; k < j; k++ {
+			if all[k].fromX {
+				rankSumX += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			hasTies = true
+			tieCorrection += t*t*t - t
+		}
+		i = j
+	}
+
+	u1 := rankSumX - float64(n1*(n1+1))/2
+	u := math.Min(u1, float64(n1*n2)-u1)
+
+	if !hasTies && n1*n2 <= exactUTestLimit {
+		return math.Min(1, 2*exactUCDF(int(u), n1, n2))
+	}
+
+	// 正規近似（同順位補正と連続性補正あり）
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// exactUCDF returns P(U <= u) under the null hypothesis without ties
+func exactUCDF(u, n1, n2 int) float64 {
+	// ways[j][s] は i 個の x と j 個の y の並びのうち U = s となるものの数。
+	// 最大の要素が x なら j 個すべての y を上回るため
+	// ways(i, j, s) = ways(i-1, j, s-j) + ways(i, j-1, s)
+	maxU := n1 * n2
+	ways := make([][]float64, n2+1)
+	for j := range ways {
+		ways[j] = make([]float64, maxU+1)
+		ways[j][0] = 1 // i = 0
+	}
+	for i := 1; i <= n1; i++ {
+		next := make([][]float64, n2+1)
+		for j := 0; j <= n2; j++ {
+			next[j] = make([]float64, maxU+1)
+			for s := 0; s <= maxU; s++ {
+				if j == 0 {
+					if s == 0 {
+						next[j][s] = 1
+					}
+					continue
+				}
+				v := next[j-1][s]
+				if s >= j {
+					v += ways[j][s-j]
+				}
+				next[j][s] = v
+			}
+		}
+		ways = next
+	}
+
+	total := math.Exp(logChoose(n1+n2, n1))
+	sum := 0.0
+	for s := 0; s <= u && s <= maxU; s++ {
+		sum += ways[n2][s]
+	}
+	return sum / total
+}
@@ -0,0 +1,149 @@
+package version
+
+import (
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestSummarizeSample(t *testing.T) {
+	tests := []struct {
+		name                    string
+		values                  []float64
+		median, low, high, conf float64
+	}{
+		{"single", []float64{7}, 7, 7, 7, 0},
+		{"odd", []float64{3, 1, 2}, 2, 1, 3, 0.75},
+		{"even", []float64{4, 1, 3, 2}, 2.5, 1, 4, 0.875},
+		// k=1: 1 - 2/64 = 0.96875、k=2 は 0.78125 で 0.95 未満
+		{"six", []float64{6, 5, 4, 3, 2, 1}, 3.5, 1, 6, 0.96875},
+		// k=2: 1 - 2*11/1024、k=3 は 0.89 で 0.95 未満
+		{"ten", []float64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, 5.5, 2, 9, 1 - 22.0/1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarizeSample(tt.values)
+			if !approxEqual(got.Median, tt.median) || got.Low != tt.low || got.High != tt.high || !approxEqual(got.Confidence, tt.conf) {
+				t.Errorf("summarizeSample(%v) = %+v, want median %v [%v, %v] at %v", tt.values, got, tt.median, tt.low, tt.high, tt.conf)
+			}
+		})
+	}
+
+	if got := summarizeSample(nil); !math.IsNaN(got.Median) || !math.IsNaN(got.Low) || !math.IsNaN(got.High) {
+		t.Errorf("summarizeSample(nil) = %+v, want NaN", got)
+	}
+
+	values := []float64{3, 1, 2}
+	summarizeSample(values)
+	if values[0] != 3 || values[1] != 1 || values[2] != 2 {
+		t.Errorf("summarizeSample modified its input: %v", values)
+	}
+}
+
+func TestBinomialCDF(t *testing.T) {
+	tests := []struct {
+		k, n int
+		want float64
+	}{
+		{0, 1, 0.5},
+		{2, 4, 11.0 / 16},
+		{4, 4, 1},
+		{1, 10, 11.0 / 1024},
+	}
+	for _, tt := range tests {
+		if got := binomialCDF(tt.k, tt.n); !approxEqual(got, tt.want) {
+			t.Errorf("binomialCDF(%d, %d) = %v, want %v", tt.k, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestExactUCDF(t *testing.T) {
+	tests := []struct {
+		u, n1, n2 int
+		want      float64
+	}{
+		{0, 3, 3, 1.0 / 20},
+		{1, 3, 3, 2.0 / 20},
+		{9, 3, 3, 1},
+		{0, 5, 5, 1.0 / 252},
+		{0, 1, 4, 1.0 / 5},
+		{0, 4, 1, 1.0 / 5},
+	}
+	for _, tt := range tests {
+		if got := exactUCDF(tt.u, tt.n1, tt.n2); !approxEqual(got, tt.want) {
+			t.Errorf("exactUCDF(%d, %d, %d) = %v, want %v", tt.u, tt.n1, tt.n2, got, tt.want)
+		}
+	}
+}
+
+func TestMannWhitneyUTest(t *testing.T) {
+	sequence := func(from, n int) []float64 {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = float64(from + i)
+		}
+		return values
+	}
+
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64 // R の wilcox.test(x, y, exact = n1*n2 <= 2500, correct = TRUE) と同じ値
+	}{
+		{"separated 3x3", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{"separated 5x5", sequence(1, 5), sequence(6, 5), 2.0 / 252},
+		{"interleaved", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{"identical", []float64{5, 5, 5}, []float64{5, 5, 5}, 1},
+		// 同順位あり: U = 2、同順位補正 (3^3-3)/(8*7) の正規近似
+		{"ties", []float64{1, 2, 2, 3}, []float64{2, 4, 5, 6}, math.Erfc((8 - 2 - 0.5) / math.Sqrt(16.0/12*(9-24.0/56)) / math.Sqrt2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mannWhitneyUTest(tt.x, tt.y); !approxEqual(got, tt.want) {
+				t.Errorf("mannWhitneyUTest(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+			}
+			if got, reversed := mannWhitneyUTest(tt.x, tt.y), mannWhitneyUTest(tt.y, tt.x); !approxEqual(got, reversed) {
+				t.Errorf("p-value depends on the order of the samples: %v vs %v", got, reversed)
+			}
+		})
+	}
+
+	if p := mannWhitneyUTest(nil, []float64{1}); !math.IsNaN(p) {
+		t.Errorf("mannWhitneyUTest with an empty sample = %v, want NaN", p)
+	}
+	// 正規近似（n1*n2 > exactUTestLimit）
+	if p := mannWhitneyUTest(sequence(0, 60), sequence(60, 60)); p <= 0 || p > 1e-15 {
+		t.Errorf("mannWhitneyUTest of separated large samples = %v", p)
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	samples := []map[string]map[string][]float64{
+		{"BenchmarkMap": {"ns/op": {100, 101, 99, 100, 102}, "B/op": {16, 16, 16, 16, 16}}},
+		{"BenchmarkMap": {"ns/op": {50, 51, 49, 50, 52}, "B/op": {16, 16, 16, 16, 16}}},
+		{},
+	}
+	series := compareBenchmarks([]string{"BenchmarkMap"}, samples)
+	if len(series) != 2 || series[0].Unit != "ns/op" || series[1].Unit != "B/op" {
+		t.Fatalf("series = %+v, want ns/op and B/op", series)
+	}
+
+	nsPerOp := series[0].Stats
+	if nsPerOp[0].PValue != nil || nsPerOp[0].DeltaPercent != nil {
+		t.Errorf("baseline has a comparison: %+v", nsPerOp[0])
+	}
+	if nsPerOp[1].DeltaPercent == nil || !approxEqual(*nsPerOp[1].DeltaPercent, -50) || !nsPerOp[1].Significant {
+		t.Errorf("ns/op of the second config = %+v, want a significant -50%%", nsPerOp[1])
+	}
+	if nsPerOp[2].N != 0 || nsPerOp[2].Median != nil || nsPerOp[2].Samples == nil {
+		t.Errorf("missing config = %+v, want empty stats", nsPerOp[2])
+	}
+
+	bytesPerOp := series[1].Stats[1]
+	if bytesPerOp.Significant || bytesPerOp.DeltaPercent == nil || *bytesPerOp.DeltaPercent != 0 {
+		t.Errorf("B/op of the second config = %+v, want an insignificant 0%%", bytesPerOp)
+	}
+}
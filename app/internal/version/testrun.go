@@ -0,0 +1,283 @@
+// Package version - go test execution mode
+//
+// In test mode the package is compiled with "go test -c" on the host and
+// the resulting test binary runs inside the sandbox like any other snippet.
+// Its verbose output is converted to structured per-test results with the
+// toolchain's own "go tool test2json", and benchmark lines are parsed into
+// per-benchmark measurements.
+package version
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Execution modes
+const (
+	ModeRun  = "run"
+	ModeTest = "test"
+)
+
+const (
+	// testCodeFileName is the file name used for Code in test mode
+	testCodeFileName = "main_test.go"
+	// maxTestCount limits -count
+	maxTestCount = 20
+	// testParseTimeout bounds the test2json conversion
+	testParseTimeout = 10 * time.Second
+)
+
+// TestOptions configures a go test execution (flags of the test binary)
+type TestOptions struct {
+	Run       string `json:"run,omitempty"`       // -run 正規表現
+	Bench     string `json:"bench,omitempty"`     // -bench 正規表現
+	Benchtime string `json:"benchtime,omitempty"` // -benchtime（例: "1s", "100x"）
+	Count     int    `json:"count,omitempty"`     // -count
+	Benchmem  bool   `json:"benchmem,omitempty"`  // -benchmem
+	Short     bool   `json:"short,omitempty"`     // -short
+}
+
+// TestResult is the outcome of a single test, subtest or example
+type TestResult struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`           // pass / fail / skip / running（終了前に停止）
+	Elapsed float64 `json:"elapsed"`          // 秒
+	Output  string  `json:"output,omitempty"` // このテストの出力
+}
+
+// BenchmarkResult is one result line of a benchmark
+type BenchmarkResult struct {
+	Name        string             `json:"name"`
+	Procs       int                `json:"procs,omitempty"` // GOMAXPROCS（名前の -N サフィックス）
+	Iterations  int64              `json:"iterations"`
+	NsPerOp     float64            `json:"ns_per_op"`
+	BytesPerOp  *float64           `json:"bytes_per_op,omitempty"`
+	AllocsPerOp *float64           `json:"allocs_per_op,omitempty"`
+	Metrics     map[string]float64 `json:"metrics,omitempty"` // その他の単位（b.ReportMetric など）
+}
+
+// TestReport is the structured result of a go test execution
+type TestReport struct {
+	Passed     bool              `json:"passed"`
+	Tests      []TestResult      `json:"tests"`
+	Benchmarks []BenchmarkResult `json:"benchmarks,omitempty"`
+	Summary    TestSummary       `json:"summary"`
+}
+
+// TestSummary counts test outcomes
+type TestSummary struct {
+	Pass int `json:"pass"`
+	Fail int `json:"fail"`
+	Skip int `json:"skip"`
+}
+
+var benchtimePattern = regexp.MustCompile(`^(\d+x|\d+(\.\d+)?(ns|us|µs|ms|s|m|h))$`)
+
+// validateTestOptions checks user supplied test flags
+func validateTestOptions(opts *TestOptions) error {
+	if opts == nil {
+		return nil
+	}
+	for flag, expr := range map[string]string{"run": opts.Run, "bench": opts.Bench} {
+		if expr == "" {
+			continue
+		}
+		// go test と同様に "/" 区切りの各要素を正規表現として検証
+		for _, part := range strings.Split(expr, "/") {
+			if _, err := regexp.Compile(part); err != nil {
+				return fmt.Errorf("-%s の正規表現が不正です: %w", flag, err)
+			}
+		}
+	}
+	if opts.Benchtime != "" && !benchtimePattern.MatchString(opts.Benchtime) {
+		return fmt.Errorf("-benchtime の形式が不正です: %q（例: 1s, 100x）", opts.Benchtime)
+	}
+	if opts.Count < 0 || opts.Count > maxTestCount {
+		return fmt.Errorf("-count は0〜%dで指定してください", maxTestCount)
+	}
+	return nil
+}
+
+// testBinaryArgs returns the flags passed to the compiled test binary
+func testBinaryArgs(opts *TestOptions) []string {
+	// go test が渡すものと同じく -test.paniconexit0 を指定
+	args := []string{"-test.v", "-test.paniconexit0"}
+	if opts == nil {
+		return args
+	}
+	if opts.Run != "" {
+		args = append(args, "-test.run="+opts.Run)
+	}
+	if opts.Bench != "" {
+		args = append(args, "-test.bench="+opts.Bench)
+	}
+	if opts.Benchtime != "" {
+		args = append(args, "-test.benchtime="+opts.Benchtime)
+	}
+	if opts.Count > 0 {
+		args = append(args, "-test.count="+strconv.Itoa(opts.Count))
+	}
+	if opts.Benchmem {
+		args = append(args, "-test.benchmem")
+	}
+	if opts.Short {
+		args = append(args, "-test.short")
+	}
+	return args
+}
+
+// testPackage returns the package to test.
+// Without an explicit pkg the only directory containing _test.go files is used,
+// preferring the root directory when there are several.
+func testPackage(files map[string][]byte, pkg string) (string, error) {
+	if pkg != "" {
+		return explicitPackage(pkg)
+	}
+
+	candidates := make(map[string]bool)
+	for name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			candidates[path.Dir(name)] = true
+		}
+	}
+	return choosePackage(candidates, "テストファイル（_test.go）が見つかりません", "テスト対象のパッケージが複数あります")
+}
+
+// test2jsonEvent is a line of "go tool test2json" output
+type test2jsonEvent struct {
+	Action  string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// parseTestOutput converts verbose test binary output into a TestReport
+// using the toolchain's test2json converter.
+func parseTestOutput(ctx context.Context, config *VersionConfig, output string) (*TestReport, error) {
+	// #nosec G204 - config.Path is from trusted configuration
+	cmd := exec.CommandContext(ctx, config.Path, "tool", "test2json")
+	cmd.Stdin = strings.NewReader(output)
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	converted, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("テスト結果の変換エラー: %w", err)
+	}
+
+	report := &TestReport{Tests: []TestResult{}}
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(converted))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var event test2jsonEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if event.Test == "" {
+			// パッケージ全体の結果
+			if event.Action == "pass" || event.Action == "fail" {
+				report.Passed = event.Action == "pass"
+			}
+			continue
+		}
+		// ベンチマークは出力行から別途解析する
+		if strings.HasPrefix(event.Test, "Benchmark") {
+			continue
+		}
+
+		// -count で同じテストが複数回実行された場合は実行ごとに別の結果とする
+		i, ok := index[event.Test]
+		if !ok || event.Action == "run" {
+			i = len(report.Tests)
+			index[event.Test] = i
+			report.Tests = append(report.Tests, TestResult{Name: event.Test, Status: "running"})
+		}
+		test := &report.Tests[i]
+		switch event.Action {
+		case "output":
+			test.Output += event.Output
+		case "pass", "fail", "skip":
+			test.Status = event.Action
+			test.Elapsed = event.Elapsed
+		}
+	}
+
+	for _, test := range report.Tests {
+		switch test.Status {
+		case "pass":
+			report.Summary.Pass++
+		case "fail":
+			report.Summary.Fail++
+		case "skip":
+			report.Summary.Skip++
+		}
+	}
+	report.Benchmarks = parseBenchmarks(output)
+	return report, nil
+}
+
+// benchmarkLinePattern matches "BenchmarkName-8   1000   1234 ns/op ..."
+var benchmarkLinePattern = regexp.MustCompile(`^(Benchmark\S*)\s+(\d+)\s+(\S.*)$`)
+
+// benchmarkProcsPattern matches the GOMAXPROCS suffix of a benchmark name
+var benchmarkProcsPattern = regexp.MustCompile(`^(.+)-(\d+)$`)
+
+// parseBenchmarks extracts benchmark result lines from test output
+func parseBenchmarks(output string) []BenchmarkResult {
+	var results []BenchmarkResult
+	for _, line := range strings.Split(output, "\n") {
+		m := benchmarkLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		iterations, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(m[3])
+		if len(fields) < 2 || len(fields)%2 != 0 {
+			continue
+		}
+
+		result := BenchmarkResult{Name: m[1], Iterations: iterations}
+		if pm := benchmarkProcsPattern.FindStringSubmatch(m[1]); pm != nil {
+			result.Name = pm[1]
+			result.Procs, _ = strconv.Atoi(pm[2])
+		}
+
+		valid := true
+		for i := 0; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			switch unit := fields[i+1]; unit {
+			case "ns/op":
+				result.NsPerOp = value
+			case "B/op":
+				result.BytesPerOp = &value
+			case "allocs/op":
+				result.AllocsPerOp = &value
+			default:
+				if result.Metrics == nil {
+					result.Metrics = make(map[string]float64)
+				}
+				result.Metrics[unit] = value
+			}
+		}
+		if valid {
+			results = append(results, result)
+		}
+	}
+	return results
+}
@@ -0,0 +1,352 @@
+// Package version - gofmt and go vet with a specific Go version
+//
+// Formatting and vetting use the tools of the selected toolchain, so the
+// result matches what that Go release would print (e.g. new vet analyzers or
+// the "go vet -fix" modernizers of Go 1.26+). Positions are reported with the
+// request's own file names, like build diagnostics.
+package version
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vetFixMinVersion is the first Go release whose "go vet" accepts -fix
+const vetFixMinVersion = "1.26"
+
+// defaultToolTimeout bounds gofmt / go vet when the request has no timeout
+const defaultToolTimeout = 30 * time.Second
+
+// FormatResult is the result of formatting a request with gofmt
+type FormatResult struct {
+	Code        string            `json:"code,omitempty"`        // 整形後の Code
+	Files       map[string]string `json:"files,omitempty"`       // 整形後の Files（Goソースのみ）
+	Changed     bool              `json:"changed"`               // いずれかのファイルが変更されたか
+	GoVersion   string            `json:"go_version"`            // 使用したGoの完全バージョン
+	UsedVersion string            `json:"used_version"`          // 使用したGoバージョン（例: 1.22）
+	Diagnostics []Diagnostic      `json:"diagnostics,omitempty"` // 構文エラー（整形できなかったファイル）
+}
+
+// VetResult is the result of running go vet on a request
+type VetResult struct {
+	Findings    []Diagnostic      `json:"findings"`              // アナライザーの指摘（Category にアナライザー名）
+	Diagnostics []Diagnostic      `json:"diagnostics,omitempty"` // 型エラーなど解析前に失敗した箇所
+	Fixed       bool              `json:"fixed,omitempty"`       // -fix によりソースが書き換えられたか
+	Code        string            `json:"code,omitempty"`        // -fix 後の Code
+	Files       map[string]string `json:"files,omitempty"`       // -fix 後の Files（Goソースのみ）
+	Output      string            `json:"output,omitempty"`      // JSON以外の go vet の出力
+	GoVersion   string            `json:"go_version"`
+	UsedVersion string            `json:"used_version"`
+}
+
+// vetJSONDiagnostic is a single finding of "go vet -json"
+type vetJSONDiagnostic struct {
+	Posn    string `json:"posn"`
+	Message string `json:"message"`
+}
+
+// toolConfig resolves the toolchain for a format / vet request
+func (e *Executor) toolConfig(req ExecutionRequest) (*VersionConfig, error) {
+	targetVersion, err := e.determineVersion(req)
+	if err != nil {
+		return nil, fmt.Errorf("バージョン決定エラー: %w", err)
+	}
+	config, err := e.manager.GetVersionConfig(targetVersion)
+	if err != nil {
+		return nil, fmt.Errorf("バージョン設定エラー: %w", err)
+	}
+	return config, nil
+}
+
+// Format runs the selected toolchain's gofmt (with -s when simplify is set) on every Go source of the request
+func (e *Executor) Format(ctx context.Context, req ExecutionRequest, simplify bool) (*FormatResult, error) {
+	config, err := e.toolConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := goSources(req)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("Goのソースファイルが含まれていません")
+	}
+
+	if req.Timeout == 0 {
+		req.Timeout = defaultToolTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, req.Timeout)
+	defer cancel()
+
+	// gofmt は go コマンドと同じ bin ディレクトリにある
+	gofmt := filepath.Join(filepath.Dir(config.Path), "gofmt")
+	args := []string{}
+	if simplify {
+		args = append(args, "-s")
+	}
+
+	result := &FormatResult{GoVersion: config.FullVersion, UsedVersion: config.Version}
+	formatted := make(map[string]string, len(sources))
+	for _, name := range sortedKeys(sources) {
+		// #nosec G204 - gofmt is next to the trusted config.Path and the source is passed on stdin
+		cmd := exec.CommandContext(ctx, gofmt, args...)
+		cmd.Stdin = strings.NewReader(sources[name])
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("gofmt がタイムアウトしました (%v)", req.Timeout)
+			}
+			// 構文エラーは "<standard input>:3:1: ..." の形式なのでファイル名に置き換える
+			output := strings.ReplaceAll(stderr.String(), "<standard input>", name)
+			diagnostics := parseDiagnostics(output, "", DiagnosticBuild, config.FullVersion)
+			if len(diagnostics) == 0 {
+				return nil, fmt.Errorf("gofmt の実行に失敗しました (%s): %v: %s", name, err, strings.TrimSpace(stderr.String()))
+			}
+			result.Diagnostics = append(result.Diagnostics, diagnostics...)
+			formatted[name] = sources[name]
+			continue
+		}
+		formatted[name] = stdout.String()
+		if formatted[name] != sources[name] {
+			result.Changed = true
+		}
+	}
+
+	result.Code, result.Files = splitSources(req, formatted)
+	return result, nil
+}
+
+// Vet runs the selected toolchain's go vet on the request's packages.
+// With fix, suggested fixes are applied first ("go vet -fix", Go 1.26+) and the rewritten sources are returned.
+func (e *Executor) Vet(ctx context.Context, req ExecutionRequest, fix bool) (*VetResult, error) {
+	config, err := e.toolConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	// 判定は実際のツールチェーンのバージョンで行う
+	if fix && compareGoVersions(config.FullVersion, vetFixMinVersion) < 0 {
+		return nil, fmt.Errorf("go vet -fix はGo %s以降で利用できます（選択: %s）", vetFixMinVersion, config.FullVersion)
+	}
+
+	ws, err := moduleWorkspace(req, config.Version)
+	if err != nil {
+		return nil, err
+	}
+	target := "./..."
+	if req.Package != "" {
+		if target, err = explicitPackage(req.Package); err != nil {
+			return nil, err
+		}
+	}
+
+	workDir, err := os.MkdirTemp("", "govet_")
+	if err != nil {
+		return nil, fmt.Errorf("作業ディレクトリ作成エラー: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Printf("[WARN] Vet: failed to remove temp dir %s: %v", workDir, err)
+		}
+	}()
+	srcDir := sourceDir(workDir)
+	if err := writeWorkspace(srcDir, ws.Files); err != nil {
+		return nil, fmt.Errorf("コードファイル作成エラー: %w", err)
+	}
+
+	if req.Timeout == 0 {
+		req.Timeout = defaultToolTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, req.Timeout)
+	defer cancel()
+
+	env := buildEnvironment(userEnvironment(req), ws)
+	runVet := func(args ...string) ([]byte, error) {
+		// #nosec G204 - config.Path is from trusted configuration and paths are in a private temp dir
+		// "--" 以降はフラグとして解釈されない
+		cmd := exec.CommandContext(ctx, config.Path, append(append([]string{"vet"}, args...), "--", target)...)
+		cmd.Dir = srcDir
+		cmd.Env = env
+		output, err := cmd.CombinedOutput()
+		if ctx.Err() != nil {
+			return output, fmt.Errorf("go vet がタイムアウトしました (%v)", req.Timeout)
+		}
+		return output, err
+	}
+
+	result := &VetResult{Findings: []Diagnostic{}, GoVersion: config.FullVersion, UsedVersion: config.Version}
+
+	if fix {
+		output, err := runVet("-fix")
+		if err != nil {
+			result.Diagnostics = parseDiagnostics(string(output), srcDir, DiagnosticVet, config.FullVersion)
+			if len(result.Diagnostics) == 0 {
+				return nil, fmt.Errorf("go vet -fix の実行に失敗しました: %v: %s", err, strings.TrimSpace(string(output)))
+			}
+			return result, nil
+		}
+
+		sources := goSources(req)
+		fixed := make(map[string]string, len(sources))
+		for name, original := range sources {
+			content, err := os.ReadFile(filepath.Join(srcDir, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, fmt.Errorf("修正後のファイル読み込みエラー: %w", err)
+			}
+			fixed[name] = string(content)
+			if fixed[name] != original {
+				result.Fixed = true
+			}
+		}
+		result.Code, result.Files = splitSources(req, fixed)
+	}
+
+	// 指摘があっても終了コードは0。型エラーなどで解析できない場合のみ失敗する
+	output, err := runVet("-json")
+	findings, rest := parseVetJSON(string(output), srcDir, config.FullVersion)
+	result.Findings = append(result.Findings, findings...)
+	result.Output = strings.TrimSpace(rest)
+	if err != nil {
+		result.Diagnostics = parseDiagnostics(rest, srcDir, DiagnosticVet, config.FullVersion)
+		if len(result.Diagnostics) == 0 {
+			return nil, fmt.Errorf("go vet の実行に失敗しました: %v: %s", err, result.Output)
+		}
+	}
+	return result, nil
+}
+
+// parseVetJSON extracts the findings of "go vet -json" output.
+// Each package prints "# pkg" followed by a JSON object {"pkg": {"analyzer": [...]}};
+// lines outside the objects are returned as rest.
+func parseVetJSON(output, srcDir, toolchain string) ([]Diagnostic, string) {
+	var (
+		findings []Diagnostic
+		rest     strings.Builder
+		block    []string
+	)
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case block == nil && line == "{":
+			block = []string{line}
+		case block != nil:
+			block = append(block, line)
+			if line == "}" {
+				findings = append(findings, decodeVetJSON(strings.Join(block, "\n"), srcDir, toolchain)...)
+				block = nil
+			}
+		default:
+			if strings.HasPrefix(line, "# ") || line == "{}" {
+				continue // パッケージ名の見出しと指摘なしの結果
+			}
+			rest.WriteString(line)
+			rest.WriteString("\n")
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return findings, rest.String()
+}
+
+// decodeVetJSON converts one JSON object of "go vet -json" into diagnostics
+func decodeVetJSON(data, srcDir, toolchain string) []Diagnostic {
+	var packages map[string]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &packages); err != nil {
+		log.Printf("[WARN] decodeVetJSON: %v", err)
+		return nil
+	}
+
+	var findings []Diagnostic
+	for _, analyzers := range packages {
+		for analyzer, raw := range analyzers {
+			// アナライザー自体のエラーは {"error": "..."} になる
+			var entries []vetJSONDiagnostic
+			if err := json.Unmarshal(raw, &entries); err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				file, line, column := splitPosition(entry.Posn)
+				findings = append(findings, Diagnostic{
+					File:      requestFileName(file, srcDir),
+					Line:      line,
+					Column:    column,
+					Message:   entry.Message,
+					Source:    DiagnosticVet,
+					Category:  analyzer,
+					Toolchain: toolchain,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// splitPosition splits "file:line[:column]" as printed by go/token
+func splitPosition(posn string) (string, int, int) {
+	file, last, ok := cutLast(posn)
+	if !ok {
+		return posn, 0, 0
+	}
+	n, err := strconv.Atoi(last)
+	if err != nil {
+		return posn, 0, 0
+	}
+	if rest, middle, ok := cutLast(file); ok {
+		if line, err := strconv.Atoi(middle); err == nil {
+			return rest, line, n
+		}
+	}
+	return file, n, 0
+}
+
+// cutLast slices s around the last colon
+func cutLast(s string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, "", false
+}
+
+// splitSources separates rewritten sources back into the request's Code and Files
+func splitSources(req ExecutionRequest, sources map[string]string) (string, map[string]string) {
+	var code string
+	var files map[string]string
+	for name, content := range sources {
+		if req.Code != "" && name == codeFileName(req) {
+			code = content
+			continue
+		}
+		if files == nil {
+			files = make(map[string]string)
+		}
+		files[name] = content
+	}
+	return code, files
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+// Package version - Execution trace capture
+//
+// A run can record a runtime/trace execution trace of the whole program, or
+// on Go 1.25+ keep only the most recent part of it with the flight recorder
+// and write that snapshot when main returns. The trace is captured through
+// the main wrapper in capture.go and summarized by SummarizeTrace.
+package version
+
+import (
+	"fmt"
+)
+
+// Trace modes of ExecutionRequest.Trace
+const (
+	TraceModeFull   = "trace"  // runtime/trace.Start で実行全体を記録
+	TraceModeFlight = "flight" // フライトレコーダーで終了直前の区間のみ記録（Go 1.25以降）
+)
+
+const (
+	// CaptureTrace is the capture kind of an execution trace
+	CaptureTrace = "trace"
+
+	// flightRecorderMinVersion is the first Go release with runtime/trace.FlightRecorder
+	flightRecorderMinVersion = "1.25"
+)
+
+// traceHook returns the main wrapper code recording a trace in the given mode
+func traceHook(mode string, config *VersionConfig) (captureHook, error) {
+	hook := captureHook{Kind: CaptureTrace, Imports: []string{"runtime/trace"}}
+	switch mode {
+	case TraceModeFull:
+		hook.Setup = `
+if err := trace.Start(f); err != nil {
+	println("trace:", err.Error())
+} else {
+	defer trace.Stop()
+}`
+	case TraceModeFlight:
+		if compareGoVersions(config.FullVersion, flightRecorderMinVersion) < 0 {
+			return captureHook{}, fmt.Errorf("フライトレコーダーはGo %s以降で利用できます（選択: %s）", flightRecorderMinVersion, config.FullVersion)
+		}
+		hook.Setup = `
+fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{MaxBytes: 16 << 20})
+if err := fr.Start(); err != nil {
+	println("flight recorder:", err.Error())
+} else {
+	defer func() {
+		if _, err := fr.WriteTo(f); err != nil {
+			println("flight recorder:", err.Error())
+		}
+		fr.Stop()
+	}()
+}`
+	default:
+		return captureHook{}, fmt.Errorf("不明なトレースモードです: %q（%q または %q）", mode, TraceModeFull, TraceModeFlight)
+	}
+	return hook, nil
+}
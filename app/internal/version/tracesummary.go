@@ -0,0 +1,748 @@
+// Package version - Execution trace summary
+//
+// A small reader for the Go 1.22+ execution trace format (the format written
+// by runtime/trace and the flight recorder), so traces can be summarized
+// without `go tool trace`. The trace is a sequence of batches: per-M batches
+// of timed events, plus string, stack and clock-frequency tables per
+// generation. Timed events are decoded with their argument counts, put on a
+// common time axis and replayed to derive goroutine counts, GC cycles and
+// stop-the-world pauses, blocking reasons and per-P execution timelines.
+//
+// Unlike the runtime's own parser the events are ordered by timestamp only
+// (sequence numbers are not checked), which is accurate enough for a summary.
+package version
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Event types of the trace format (internal/trace/tracev2). New types are only appended.
+const (
+	traceEvEventBatch         = 1
+	traceEvStacks             = 2
+	traceEvStack              = 3
+	traceEvStrings            = 4
+	traceEvString             = 5
+	traceEvCPUSamples         = 6
+	traceEvFrequency          = 8
+	traceEvProcsChange        = 9
+	traceEvProcStart          = 10
+	traceEvProcStop           = 11
+	traceEvProcSteal          = 12
+	traceEvProcStatus         = 13
+	traceEvGoCreate           = 14
+	traceEvGoCreateSyscall    = 15
+	traceEvGoStart            = 16
+	traceEvGoDestroy          = 17
+	traceEvGoDestroySyscall   = 18
+	traceEvGoStop             = 19
+	traceEvGoBlock            = 20
+	traceEvGoUnblock          = 21
+	traceEvGoSyscallEndBlock  = 24
+	traceEvGoStatus           = 25
+	traceEvSTWBegin           = 26
+	traceEvSTWEnd             = 27
+	traceEvGCActive           = 28
+	traceEvGCBegin            = 29
+	traceEvGCEnd              = 30
+	traceEvHeapAlloc          = 37
+	traceEvGoSwitch           = 45
+	traceEvGoSwitchDestroy    = 46
+	traceEvGoCreateBlocked    = 47
+	traceEvGoStatusStack      = 48
+	traceEvExperimentalBatch  = 49
+	traceEvSync               = 50
+	traceEvClockSnapshot      = 51
+	traceEvEndOfGeneration    = 52
+	traceMaxBatchSize         = 64 << 10
+	traceMinSupportedMinorVer = 22
+)
+
+// traceEventArgs is the number of arguments (including the timestamp delta) of each timed event type
+var traceEventArgs = map[byte]int{
+	9: 3, 10: 3, 11: 1, 12: 4, 13: 3, // Procs
+	14: 4, 15: 2, 16: 3, 17: 1, 18: 1, 19: 3, 20: 3, 21: 4, 22: 3, 23: 1, 24: 1, 25: 4, // Goroutines
+	26: 3, 27: 1, // STW
+	28: 2, 29: 3, 30: 2, 31: 2, 32: 2, 33: 3, 34: 2, 35: 2, 36: 1, 37: 2, 38: 2, // GC
+	39: 2, 40: 5, 41: 3, 42: 4, 43: 4, 44: 5, // Annotations
+	45: 3, 46: 3, 47: 4, 48: 5, // Go 1.23+
+}
+
+// Goroutine and P statuses of GoStatus / ProcStatus events
+const (
+	traceGoRunning   = 2
+	traceGoSyscall   = 3
+	traceProcRunning = 1
+	traceProcSyscall = 3
+)
+
+const (
+	// maxTraceSegments limits the timeline segments returned per P
+	maxTraceSegments = 2000
+	// maxTraceSpans limits the GC cycles and pauses returned
+	maxTraceSpans = 500
+	// traceTopGoroutines is the number of goroutines listed (by running time)
+	traceTopGoroutines = 20
+)
+
+// TraceSummary is an overview of an execution trace for a simple timeline view
+type TraceSummary struct {
+	Format       string             `json:"format"`   // 例: "go 1.25 trace"
+	Duration     time.Duration      `json:"duration"` // 最初から最後のイベントまで（ナノ秒）
+	Generations  int                `json:"generations"`
+	Events       int                `json:"events"`
+	GOMAXPROCS   int                `json:"gomaxprocs,omitempty"`
+	MaxHeapAlloc uint64             `json:"max_heap_alloc,omitempty"` // ヒープ使用量の最大値（バイト）
+	Goroutines   TraceGoroutines    `json:"goroutines"`
+	GC           TraceGC            `json:"gc"`
+	Blocking     []TraceBlockReason `json:"blocking"` // ブロック理由ごとの集計（合計時間の長い順）
+	Procs        []TraceProc        `json:"procs"`    // P ごとの実行区間
+	Truncated    bool               `json:"truncated,omitempty"`
+	Warning      string             `json:"warning,omitempty"` // 途中で読めなくなった場合の理由
+}
+
+// TraceGoroutines counts goroutines over the trace
+type TraceGoroutines struct {
+	Created  int              `json:"created"`
+	Ended    int              `json:"ended"`
+	MaxAlive int              `json:"max_alive"` // 同時に存在したgoroutineの最大数
+	Top      []TraceGoroutine `json:"top"`       // 実行時間の長い順
+}
+
+// TraceGoroutine is the activity of one goroutine
+type TraceGoroutine struct {
+	ID        uint64        `json:"id"`
+	Function  string        `json:"function,omitempty"` // 開始関数（例: "main.worker"）
+	Running   time.Duration `json:"running"`
+	Blocked   time.Duration `json:"blocked"`
+	Blocks    int           `json:"blocks"`
+	Scheduled int           `json:"scheduled"` // 実行開始回数
+}
+
+// TraceGC summarizes garbage collection
+type TraceGC struct {
+	Cycles     int           `json:"cycles"`
+	Time       time.Duration `json:"time"` // GC が動いていた時間の合計
+	Pauses     int           `json:"pauses"`
+	TotalPause time.Duration `json:"total_pause"`
+	MaxPause   time.Duration `json:"max_pause"`
+	Spans      []TraceSpan   `json:"spans"`       // GC サイクル
+	PauseSpans []TraceSpan   `json:"pause_spans"` // stop-the-world
+}
+
+// TraceSpan is a time range relative to the start of the trace
+type TraceSpan struct {
+	Start    time.Duration `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Label    string        `json:"label,omitempty"`
+}
+
+// TraceBlockReason aggregates blocking events with the same reason
+type TraceBlockReason struct {
+	Reason string        `json:"reason"` // 例: "chan receive", "sync", "sleep"
+	Count  int           `json:"count"`
+	Total  time.Duration `json:"total"`
+}
+
+// TraceProc is the timeline of one P
+type TraceProc struct {
+	ID       int            `json:"id"`
+	Busy     time.Duration  `json:"busy"`
+	Segments []TraceSegment `json:"segments"`
+}
+
+// TraceSegment is a goroutine running on a P
+type TraceSegment struct {
+	Start     time.Duration `json:"start"`
+	Duration  time.Duration `json:"duration"`
+	Goroutine uint64        `json:"g"`
+}
+
+// traceEvent is a decoded timed event
+type traceEvent struct {
+	time int64 // ナノ秒（トレース内の共通の時間軸）
+	gen  uint64
+	m    uint64
+	typ  byte
+	args [4]uint64 // タイムスタンプ差分以外の引数
+}
+
+// traceTables holds the per generation string, stack and frequency tables
+type traceTables struct {
+	strings map[[2]uint64]string
+	stacks  map[[2]uint64][]uint64 // スタックID -> 各フレームの関数名の文字列ID
+	freq    map[uint64]float64     // 世代 -> 1ティックあたりのナノ秒
+}
+
+// traceBatch is an event batch of one M
+type traceBatch struct {
+	gen, m, time uint64
+	data         []byte
+}
+
+// SummarizeTrace parses an execution trace (Go 1.22+) and summarizes it.
+// A truncated trace is summarized up to the last complete batch.
+func SummarizeTrace(data []byte) (*TraceSummary, error) {
+	format, minor, body, err := traceHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	summary := &TraceSummary{Format: format, Blocking: []TraceBlockReason{}, Procs: []TraceProc{}}
+
+	tables := &traceTables{
+		strings: make(map[[2]uint64]string),
+		stacks:  make(map[[2]uint64][]uint64),
+		freq:    make(map[uint64]float64),
+	}
+	batches, generations, err := readTraceBatches(body, minor, tables)
+	if err != nil {
+		if len(batches) == 0 {
+			return nil, err
+		}
+		summary.Truncated = true
+		summary.Warning = err.Error()
+	}
+	summary.Generations = generations
+
+	events, err := decodeTraceEvents(batches, tables)
+	if err != nil {
+		summary.Truncated = true
+		summary.Warning = err.Error()
+	}
+	summary.Events = len(events)
+	if len(events) == 0 {
+		return summary, nil
+	}
+	newTraceReplay(summary, tables).run(events)
+	return summary, nil
+}
+
+// traceHeader checks the "go 1.N trace\x00\x00\x00" header
+func traceHeader(data []byte) (string, int, []byte, error) {
+	const prefix, suffix = "go 1.", " trace\x00\x00\x00"
+	end := bytes.Index(data, []byte(suffix))
+	if !bytes.HasPrefix(data, []byte(prefix)) || end < 0 || end > 16 {
+		return "", 0, nil, errors.New("Goの実行トレースではありません")
+	}
+	minor, err := strconv.Atoi(string(data[len(prefix):end]))
+	if err != nil {
+		return "", 0, nil, errors.New("Goの実行トレースではありません")
+	}
+	if minor < traceMinSupportedMinorVer {
+		return "", 0, nil, fmt.Errorf("Go 1.%d のトレース形式には対応していません（Go 1.%d以降）", minor, traceMinSupportedMinorVer)
+	}
+	return string(data[:end+len(" trace")]), minor, data[end+len(suffix):], nil
+}
+
+// readTraceBatches splits the trace into batches, filling the tables from the structural ones.
+// It returns the event batches read so far together with the first error.
+func readTraceBatches(data []byte, minor int, tables *traceTables) ([]traceBatch, int, error) {
+	var batches []traceBatch
+	generations := make(map[uint64]bool)
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		typ, _ := r.ReadByte()
+		switch typ {
+		case traceEvEndOfGeneration:
+			continue
+		case traceEvEventBatch, traceEvExperimentalBatch:
+		default:
+			return batches, len(generations), fmt.Errorf("不正なバッチです（イベント %d）", typ)
+		}
+		if typ == traceEvExperimentalBatch {
+			if _, err := r.ReadByte(); err != nil {
+				return batches, len(generations), errTraceTruncated
+			}
+		}
+
+		var header [4]uint64 // gen, M, timestamp, size
+		for i := range header {
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return batches, len(generations), errTraceTruncated
+			}
+			header[i] = v
+		}
+		size := header[3]
+		if size > traceMaxBatchSize {
+			return batches, len(generations), fmt.Errorf("不正なバッチサイズです: %d", size)
+		}
+		if uint64(r.Len()) < size {
+			return batches, len(generations), errTraceTruncated
+		}
+		b := make([]byte, size)
+		if _, err := r.Read(b); err != nil {
+			return batches, len(generations), errTraceTruncated
+		}
+		if typ == traceEvExperimentalBatch || len(b) == 0 {
+			continue
+		}
+
+		gen := header[0]
+		generations[gen] = true
+		batch := traceBatch{gen: gen, m: header[1], time: header[2], data: b}
+		var err error
+		switch {
+		case b[0] == traceEvStrings:
+			err = tables.addStrings(gen, b[1:])
+		case b[0] == traceEvStacks:
+			err = tables.addStacks(gen, b[1:])
+		case b[0] == traceEvCPUSamples:
+		case b[0] == traceEvSync && minor >= 25, b[0] == traceEvFrequency && minor < 25:
+			err = tables.addSync(gen, b)
+		default:
+			batches = append(batches, batch)
+		}
+		if err != nil {
+			return batches, len(generations), err
+		}
+	}
+	return batches, len(generations), nil
+}
+
+var errTraceTruncated = errors.New("トレースが途中で切れています")
+
+// addStrings reads EvString entries: [ID, length, bytes]
+func (t *traceTables) addStrings(gen uint64, b []byte) error {
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		if typ, _ := r.ReadByte(); typ != traceEvString {
+			return fmt.Errorf("文字列テーブルが不正です")
+		}
+		id, err := binary.ReadUvarint(r)
+		if err != nil {
+			return errTraceTruncated
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil || uint64(r.Len()) < n {
+			return errTraceTruncated
+		}
+		s := make([]byte, n)
+		r.Read(s)
+		t.strings[[2]uint64{gen, id}] = string(s)
+	}
+	return nil
+}
+
+// addStacks reads EvStack entries: [ID, frame count, {PC, func string ID, file string ID, line}...]
+func (t *traceTables) addStacks(gen uint64, b []byte) error {
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		if typ, _ := r.ReadByte(); typ != traceEvStack {
+			return fmt.Errorf("スタックテーブルが不正です")
+		}
+		id, err := binary.ReadUvarint(r)
+		if err != nil {
+			return errTraceTruncated
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > 1024 {
+			return errTraceTruncated
+		}
+		funcs := make([]uint64, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var frame [4]uint64
+			for j := range frame {
+				if frame[j], err = binary.ReadUvarint(r); err != nil {
+					return errTraceTruncated
+				}
+			}
+			funcs = append(funcs, frame[1])
+		}
+		t.stacks[[2]uint64{gen, id}] = funcs
+	}
+	return nil
+}
+
+// addSync reads the clock frequency (ticks per second) of a generation.
+// Go 1.25+ wraps it in an EvSync batch together with a clock snapshot.
+func (t *traceTables) addSync(gen uint64, b []byte) error {
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		typ, _ := r.ReadByte()
+		switch typ {
+		case traceEvSync:
+		case traceEvFrequency:
+			freq, err := binary.ReadUvarint(r)
+			if err != nil || freq == 0 {
+				return errTraceTruncated
+			}
+			t.freq[gen] = 1e9 / float64(freq)
+		case traceEvClockSnapshot:
+			for range 4 {
+				if _, err := binary.ReadUvarint(r); err != nil {
+					return errTraceTruncated
+				}
+			}
+		default:
+			return fmt.Errorf("同期バッチが不正です（イベント %d）", typ)
+		}
+	}
+	return nil
+}
+
+// stackFunc returns the innermost function of a stack
+func (t *traceTables) stackFunc(gen, stack uint64) string {
+	funcs := t.stacks[[2]uint64{gen, stack}]
+	if len(funcs) == 0 {
+		return ""
+	}
+	return t.strings[[2]uint64{gen, funcs[0]}]
+}
+
+// decodeTraceEvents decodes the timed events of all batches and orders them by time
+func decodeTraceEvents(batches []traceBatch, tables *traceTables) ([]traceEvent, error) {
+	var fallback float64
+	for _, f := range tables.freq {
+		fallback = f
+		break
+	}
+	if fallback == 0 {
+		return nil, errors.New("クロック周波数の情報がありません")
+	}
+
+	var (
+		events   []traceEvent
+		firstErr error
+	)
+	for _, batch := range batches {
+		freq, ok := tables.freq[batch.gen]
+		if !ok {
+			freq = fallback
+		}
+		ticks := batch.time
+		r := bytes.NewReader(batch.data)
+		for r.Len() > 0 {
+			typ, _ := r.ReadByte()
+			n, ok := traceEventArgs[typ]
+			if !ok {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("未知のイベントです: %d", typ)
+				}
+				break
+			}
+			event := traceEvent{gen: batch.gen, m: batch.m, typ: typ}
+			var err error
+			for i := 0; i < n && err == nil; i++ {
+				var v uint64
+				if v, err = binary.ReadUvarint(r); err != nil {
+					break
+				}
+				if i == 0 {
+					ticks += v
+				} else if i <= len(event.args) {
+					event.args[i-1] = v
+				}
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = errTraceTruncated
+				}
+				break
+			}
+			event.time = int64(float64(ticks) * freq)
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].time < events[j].time })
+	return events, firstErr
+}
+
+// traceReplay derives the summary by replaying the events in time order
+type traceReplay struct {
+	summary    *TraceSummary
+	tables     *traceTables
+	start      int64
+	ms         map[uint64]*traceM
+	goroutines map[uint64]*traceG
+	procs      map[int]*TraceProc
+	blocking   map[string]*TraceBlockReason
+	alive      int
+	gcStart    int64 // -1: GC 中でない
+}
+
+// traceM is what an M (thread) is doing
+type traceM struct {
+	g        uint64 // 実行中のgoroutine（0: なし）
+	p        int    // 保持しているP（-1: なし）
+	runStart int64
+	stwStart int64
+	stwKind  string
+}
+
+// traceG is the state of a goroutine
+type traceG struct {
+	stats        TraceGoroutine
+	alive        bool
+	blockedAt    int64 // -1: ブロックしていない
+	blockReason  string
+	segmentStart int64
+}
+
+func newTraceReplay(summary *TraceSummary, tables *traceTables) *traceReplay {
+	return &traceReplay{
+		summary:    summary,
+		tables:     tables,
+		ms:         make(map[uint64]*traceM),
+		goroutines: make(map[uint64]*traceG),
+		procs:      make(map[int]*TraceProc),
+		blocking:   make(map[string]*TraceBlockReason),
+		gcStart:    -1,
+	}
+}
+
+func (r *traceReplay) m(id uint64) *traceM {
+	m, ok := r.ms[id]
+	if !ok {
+		m = &traceM{p: -1}
+		r.ms[id] = m
+	}
+	return m
+}
+
+func (r *traceReplay) g(id uint64) *traceG {
+	g, ok := r.goroutines[id]
+	if !ok {
+		g = &traceG{stats: TraceGoroutine{ID: id}, blockedAt: -1}
+		r.goroutines[id] = g
+	}
+	return g
+}
+
+// setAlive tracks the number of existing goroutines
+func (r *traceReplay) setAlive(g *traceG, alive bool) {
+	if g.alive == alive {
+		return
+	}
+	g.alive = alive
+	if alive {
+		r.alive++
+		r.summary.Goroutines.MaxAlive = max(r.summary.Goroutines.MaxAlive, r.alive)
+	} else {
+		r.alive--
+	}
+}
+
+// rel converts an event time to the offset from the start of the trace
+func (r *traceReplay) rel(t int64) time.Duration {
+	return time.Duration(t - r.start)
+}
+
+// startRunning starts goroutine id on M m
+func (r *traceReplay) startRunning(m *traceM, id uint64, t int64) {
+	if m.g != 0 {
+		r.stopRunning(m, t)
+	}
+	g := r.g(id)
+	r.setAlive(g, true)
+	r.unblock(g, t)
+	g.stats.Scheduled++
+	m.g = id
+	m.runStart = t
+}
+
+// stopRunning ends the goroutine running on M m and records the segment on its P
+func (r *traceReplay) stopRunning(m *traceM, t int64) *traceG {
+	if m.g == 0 {
+		return nil
+	}
+	g := r.g(m.g)
+	g.stats.Running += time.Duration(t - m.runStart)
+	if m.p >= 0 {
+		proc, ok := r.procs[m.p]
+		if !ok {
+			proc = &TraceProc{ID: m.p, Segments: []TraceSegment{}}
+			r.procs[m.p] = proc
+		}
+		proc.Busy += time.Duration(t - m.runStart)
+		if len(proc.Segments) < maxTraceSegments {
+			proc.Segments = append(proc.Segments, TraceSegment{Start: r.rel(m.runStart), Duration: time.Duration(t - m.runStart), Goroutine: m.g})
+		} else {
+			r.summary.Truncated = true
+		}
+	}
+	m.g = 0
+	return g
+}
+
+// unblock ends a blocked period of g
+func (r *traceReplay) unblock(g *traceG, t int64) {
+	if g.blockedAt < 0 {
+		return
+	}
+	d := time.Duration(t - g.blockedAt)
+	g.stats.Blocked += d
+	reason := r.blocking[g.blockReason]
+	reason.Total += d
+	g.blockedAt = -1
+}
+
+// run replays the events and fills the summary
+func (r *traceReplay) run(events []traceEvent) {
+	r.start = events[0].time
+	end := events[len(events)-1].time
+
+	for _, ev := range events {
+		m := r.m(ev.m)
+		switch ev.typ {
+		case traceEvProcsChange:
+			r.summary.GOMAXPROCS = int(ev.args[0])
+		case traceEvProcStart:
+			m.p = int(ev.args[0])
+		case traceEvProcStop:
+			r.stopRunning(m, ev.time)
+			m.p = -1
+		case traceEvProcSteal:
+			if victim, ok := r.ms[ev.args[2]]; ok && victim.p == int(ev.args[0]) {
+				victim.p = -1
+			}
+		case traceEvProcStatus:
+			if status := ev.args[1]; status == traceProcRunning || status == traceProcSyscall {
+				m.p = int(ev.args[0])
+			}
+
+		case traceEvGoCreate, traceEvGoCreateBlocked, traceEvGoCreateSyscall:
+			g := r.g(ev.args[0])
+			if ev.typ != traceEvGoCreateSyscall {
+				g.stats.Function = r.tables.stackFunc(ev.gen, ev.args[1])
+			}
+			r.setAlive(g, true)
+			r.summary.Goroutines.Created++
+		case traceEvGoStart:
+			r.startRunning(m, ev.args[0], ev.time)
+		case traceEvGoDestroy, traceEvGoDestroySyscall:
+			if g := r.stopRunning(m, ev.time); g != nil {
+				r.setAlive(g, false)
+				r.summary.Goroutines.Ended++
+			}
+		case traceEvGoStop, traceEvGoSyscallEndBlock:
+			r.stopRunning(m, ev.time)
+		case traceEvGoBlock:
+			if g := r.stopRunning(m, ev.time); g != nil {
+				reason := r.tables.strings[[2]uint64{ev.gen, ev.args[0]}]
+				if reason == "" {
+					reason = "unknown"
+				}
+				if _, ok := r.blocking[reason]; !ok {
+					r.blocking[reason] = &TraceBlockReason{Reason: reason}
+				}
+				r.blocking[reason].Count++
+				g.stats.Blocks++
+				g.blockedAt = ev.time
+				g.blockReason = reason
+			}
+		case traceEvGoUnblock:
+			r.unblock(r.g(ev.args[0]), ev.time)
+		case traceEvGoSwitch, traceEvGoSwitchDestroy:
+			if g := r.stopRunning(m, ev.time); g != nil && ev.typ == traceEvGoSwitchDestroy {
+				r.setAlive(g, false)
+				r.summary.Goroutines.Ended++
+			}
+			r.startRunning(m, ev.args[0], ev.time)
+		case traceEvGoStatus, traceEvGoStatusStack:
+			g := r.g(ev.args[0])
+			r.setAlive(g, true)
+			if status := ev.args[2]; status == traceGoRunning || status == traceGoSyscall {
+				if owner := r.m(ev.args[1]); owner.g != ev.args[0] {
+					owner.g = ev.args[0]
+					owner.runStart = ev.time
+				}
+			}
+
+		case traceEvSTWBegin:
+			m.stwStart = ev.time
+			m.stwKind = r.tables.strings[[2]uint64{ev.gen, ev.args[0]}]
+		case traceEvSTWEnd:
+			d := time.Duration(ev.time - m.stwStart)
+			gc := &r.summary.GC
+			gc.Pauses++
+			gc.TotalPause += d
+			gc.MaxPause = max(gc.MaxPause, d)
+			if len(gc.PauseSpans) < maxTraceSpans {
+				gc.PauseSpans = append(gc.PauseSpans, TraceSpan{Start: r.rel(m.stwStart), Duration: d, Label: m.stwKind})
+			}
+		case traceEvGCActive, traceEvGCBegin:
+			if r.gcStart < 0 {
+				r.gcStart = ev.time
+			}
+		case traceEvGCEnd:
+			if r.gcStart >= 0 {
+				r.endGC(ev.time)
+			}
+		case traceEvHeapAlloc:
+			r.summary.MaxHeapAlloc = max(r.summary.MaxHeapAlloc, ev.args[0])
+		}
+	}
+
+	// トレース終了時点で続いている状態を閉じる
+	for _, m := range r.ms {
+		r.stopRunning(m, end)
+	}
+	for _, g := range r.goroutines {
+		r.unblock(g, end)
+	}
+	if r.gcStart >= 0 {
+		r.endGC(end)
+	}
+	r.finish(end)
+}
+
+// endGC records a GC cycle ending at t
+func (r *traceReplay) endGC(t int64) {
+	gc := &r.summary.GC
+	d := time.Duration(t - r.gcStart)
+	gc.Cycles++
+	gc.Time += d
+	if len(gc.Spans) < maxTraceSpans {
+		gc.Spans = append(gc.Spans, TraceSpan{Start: r.rel(r.gcStart), Duration: d})
+	}
+	r.gcStart = -1
+}
+
+// finish sorts the collected data into the summary
+func (r *traceReplay) finish(end int64) {
+	s := r.summary
+	s.Duration = r.rel(end)
+	if s.GC.Spans == nil {
+		s.GC.Spans = []TraceSpan{}
+	}
+	if s.GC.PauseSpans == nil {
+		s.GC.PauseSpans = []TraceSpan{}
+	}
+
+	for _, reason := range r.blocking {
+		s.Blocking = append(s.Blocking, *reason)
+	}
+	sort.Slice(s.Blocking, func(i, j int) bool {
+		if s.Blocking[i].Total != s.Blocking[j].Total {
+			return s.Blocking[i].Total > s.Blocking[j].Total
+		}
+		return s.Blocking[i].Reason < s.Blocking[j].Reason
+	})
+
+	for _, proc := range r.procs {
+		s.Procs = append(s.Procs, *proc)
+	}
+	sort.Slice(s.Procs, func(i, j int) bool { return s.Procs[i].ID < s.Procs[j].ID })
+
+	top := make([]TraceGoroutine, 0, len(r.goroutines))
+	for _, g := range r.goroutines {
+		top = append(top, g.stats)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Running != top[j].Running {
+			return top[i].Running > top[j].Running
+		}
+		return top[i].ID < top[j].ID
+	})
+	if len(top) > traceTopGoroutines {
+		top = top[:traceTopGoroutines]
+	}
+	s.Goroutines.Top = top
+}
@@ -0,0 +1,225 @@
+package version
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Helpers encoding the subset of the trace format read by SummarizeTrace (Go 1.23 layout)
+
+func traceUvarints(values ...uint64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.AppendUvarint(b, v)
+	}
+	return b
+}
+
+// traceBatchBytes encodes an event batch of M m in generation 1 starting at tick t
+func traceBatchBytes(m, t uint64, data []byte) []byte {
+	b := append([]byte{traceEvEventBatch}, traceUvarints(1, m, t, uint64(len(data)))...)
+	return append(b, data...)
+}
+
+// traceEv encodes a timed event; the first argument is the timestamp delta
+func traceEv(typ byte, args ...uint64) []byte {
+	return append([]byte{typ}, traceUvarints(args...)...)
+}
+
+const (
+	traceStrWorker = iota + 1
+	traceStrChan
+	traceStrSTW
+)
+
+// testTraceEvents returns the events of M 1: goroutine 2 (main.worker) runs 100ns, blocks 200ns
+// on a channel, runs 100ns more and exits, followed by a GC cycle with a 20ns pause
+func testTraceEvents() []byte {
+	var events []byte
+	for _, ev := range [][]byte{
+		traceEv(traceEvProcsChange, 0, 2, 0),
+		traceEv(traceEvProcStart, 0, 0, 1),
+		traceEv(traceEvGoCreate, 50, 2, 1, 0),
+		traceEv(traceEvGoStart, 50, 2, 1), // t=100
+		traceEv(traceEvGoBlock, 100, traceStrChan, 0),
+		traceEv(traceEvGoUnblock, 200, 2, 2, 0),
+		traceEv(traceEvGoStart, 100, 2, 3), // t=500
+		traceEv(traceEvGoDestroy, 100),
+		traceEv(traceEvGCBegin, 100, 1, 0), // t=700
+		traceEv(traceEvSTWBegin, 50, traceStrSTW, 0),
+		traceEv(traceEvSTWEnd, 20),
+		traceEv(traceEvGCEnd, 30, 2), // t=800
+		traceEv(traceEvHeapAlloc, 50, 4096),
+	} {
+		events = append(events, ev...)
+	}
+	return events
+}
+
+// testTraceBatches returns the header and batches of a trace with the events of testTraceEvents
+func testTraceBatches() [][]byte {
+	var strs []byte
+	for id, s := range map[uint64]string{traceStrWorker: "main.worker", traceStrChan: "chan receive", traceStrSTW: "GC mark termination"} {
+		strs = append(strs, traceEvString)
+		strs = append(strs, traceUvarints(id, uint64(len(s)))...)
+		strs = append(strs, s...)
+	}
+	stacks := append([]byte{traceEvStacks, traceEvStack}, traceUvarints(1, 1, 0x1000, traceStrWorker, 0, 10)...)
+
+	return [][]byte{
+		[]byte("go 1.23 trace\x00\x00\x00"),
+		traceBatchBytes(0, 0, append([]byte{traceEvFrequency}, traceUvarints(1e9)...)),
+		traceBatchBytes(0, 0, append([]byte{traceEvStrings}, strs...)),
+		traceBatchBytes(0, 0, stacks),
+		traceBatchBytes(1, 1000, testTraceEvents()),
+	}
+}
+
+func TestSummarizeTrace(t *testing.T) {
+	summary, err := SummarizeTrace(bytes.Join(testTraceBatches(), nil))
+	if err != nil {
+		t.Fatalf("SummarizeTrace: %v", err)
+	}
+	if summary.Format != "go 1.23 trace" || summary.Generations != 1 || summary.Events != 13 || summary.Truncated || summary.Warning != "" {
+		t.Errorf("summary = %q, %d generations, %d events, truncated %v %q", summary.Format, summary.Generations, summary.Events, summary.Truncated, summary.Warning)
+	}
+	if summary.Duration != 850 || summary.GOMAXPROCS != 2 || summary.MaxHeapAlloc != 4096 {
+		t.Errorf("duration %v, GOMAXPROCS %d, heap %d", summary.Duration, summary.GOMAXPROCS, summary.MaxHeapAlloc)
+	}
+
+	goroutines := summary.Goroutines
+	if goroutines.Created != 1 || goroutines.Ended != 1 || goroutines.MaxAlive != 1 || len(goroutines.Top) != 1 {
+		t.Fatalf("goroutines = %+v", goroutines)
+	}
+	want := TraceGoroutine{ID: 2, Function: "main.worker", Running: 200, Blocked: 200, Blocks: 1, Scheduled: 2}
+	if goroutines.Top[0] != want {
+		t.Errorf("goroutine = %+v, want %+v", goroutines.Top[0], want)
+	}
+	if len(summary.Blocking) != 1 || summary.Blocking[0] != (TraceBlockReason{Reason: "chan receive", Count: 1, Total: 200}) {
+		t.Errorf("blocking = %+v", summary.Blocking)
+	}
+
+	gc := summary.GC
+	if gc.Cycles != 1 || gc.Time != 100 || gc.Pauses != 1 || gc.TotalPause != 20 || gc.MaxPause != 20 {
+		t.Errorf("gc = %+v", gc)
+	}
+	if len(gc.PauseSpans) != 1 || gc.PauseSpans[0] != (TraceSpan{Start: 750, Duration: 20, Label: "GC mark termination"}) {
+		t.Errorf("pause spans = %+v", gc.PauseSpans)
+	}
+
+	if len(summary.Procs) != 1 || summary.Procs[0].Busy != 200 || len(summary.Procs[0].Segments) != 2 {
+		t.Fatalf("procs = %+v", summary.Procs)
+	}
+	if seg := summary.Procs[0].Segments[1]; seg != (TraceSegment{Start: 500, Duration: 100, Goroutine: 2}) {
+		t.Errorf("second segment = %+v", seg)
+	}
+}
+
+func TestSummarizeTraceDamaged(t *testing.T) {
+	batches := testTraceBatches()
+	header, events := batches[0], batches[len(batches)-1]
+	valid := bytes.Join(batches, nil)
+	// 2つ目の M のバッチ（1イベント）
+	second := traceBatchBytes(2, 2000, traceEv(traceEvProcStart, 0, 1, 1))
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantErr   string // SummarizeTrace のエラー
+		warning   string // 途中まで集計した場合の警告
+		minEvents int
+	}{
+		{name: "not a trace", data: []byte("hello"), wantErr: "実行トレースではありません"},
+		{name: "old format", data: []byte("go 1.21 trace\x00\x00\x00"), wantErr: "Go 1.21"},
+		{name: "bad version", data: []byte("go 1.x trace\x00\x00\x00"), wantErr: "実行トレースではありません"},
+		{name: "header only", data: header, warning: "クロック周波数"},
+		{name: "unknown batch", data: append(append([]byte(nil), header...), 7), wantErr: "不正なバッチ"},
+		{name: "oversized batch", data: append(append([]byte(nil), header...), append([]byte{traceEvEventBatch}, traceUvarints(1, 1, 0, traceMaxBatchSize+1)...)...), wantErr: "バッチサイズ"},
+		{name: "truncated only batch", data: valid[:len(valid)-3], wantErr: "途中で切れています"},
+		{name: "truncated batch header", data: append(append([]byte(nil), valid...), traceEvEventBatch, 1), warning: "途中で切れています", minEvents: 13},
+		{name: "truncated second batch", data: append(append([]byte(nil), valid...), second[:len(second)-1]...), warning: "途中で切れています", minEvents: 13},
+		{name: "second batch", data: append(append([]byte(nil), valid...), second...), minEvents: 14},
+		{name: "unknown event", data: bytes.Join(append(batches[:len(batches)-1:len(batches)-1],
+			traceBatchBytes(1, 1000, append(testTraceEvents(), 200, 0))), nil), warning: "未知のイベントです: 200", minEvents: 13},
+		{name: "truncated event", data: bytes.Join(append(batches[:len(batches)-1:len(batches)-1],
+			traceBatchBytes(1, 1000, traceEv(traceEvGoCreate, 0, 2)), second), nil), warning: "途中で切れています", minEvents: 1},
+		{name: "no frequency", data: bytes.Join([][]byte{header, events}, nil), warning: "クロック周波数"},
+		{name: "bad string table", data: bytes.Join([][]byte{header, traceBatchBytes(0, 0, []byte{traceEvStrings, traceEvStack}), events}, nil), wantErr: "文字列テーブル"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := SummarizeTrace(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SummarizeTrace: %v", err)
+			}
+			if !strings.Contains(summary.Warning, tt.warning) || (tt.warning != "") != summary.Truncated {
+				t.Errorf("warning = %q (truncated %v), want %q", summary.Warning, summary.Truncated, tt.warning)
+			}
+			if summary.Events < tt.minEvents {
+				t.Errorf("events = %d, want at least %d", summary.Events, tt.minEvents)
+			}
+		})
+	}
+
+	// プログラムが書いたファイルは信頼できない: どこで切れても、どのバイトが壊れても panic しない
+	for i := range valid {
+		SummarizeTrace(valid[:i])
+		corrupted := append([]byte(nil), valid...)
+		corrupted[i] ^= 0xff
+		SummarizeTrace(corrupted)
+	}
+}
+
+func TestSummarizeTraceRuntime(t *testing.T) {
+	// runtime/trace が出力した実際のトレース
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("trace.Start: %v", err)
+	}
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range ch {
+				_ = make([]byte, 64<<10+v+i)
+			}
+		}()
+	}
+	for i := range 100 {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+	time.Sleep(time.Millisecond)
+	runtime.GC()
+	trace.Stop()
+
+	summary, err := SummarizeTrace(buf.Bytes())
+	if err != nil {
+		t.Fatalf("SummarizeTrace: %v", err)
+	}
+	if summary.Truncated || summary.Warning != "" {
+		t.Errorf("summary of a complete trace is truncated: %q", summary.Warning)
+	}
+	if !strings.HasPrefix(summary.Format, "go 1.") || summary.Events == 0 || summary.Duration <= 0 || summary.GOMAXPROCS == 0 {
+		t.Errorf("summary = %q, %d events, duration %v, GOMAXPROCS %d", summary.Format, summary.Events, summary.Duration, summary.GOMAXPROCS)
+	}
+	if summary.Goroutines.Created < 4 || summary.GC.Cycles == 0 || len(summary.Procs) == 0 || len(summary.Blocking) == 0 {
+		t.Errorf("goroutines %+v, gc cycles %d, procs %d, blocking %v",
+			summary.Goroutines.Created, summary.GC.Cycles, len(summary.Procs), summary.Blocking)
+	}
+}
@@ -0,0 +1,217 @@
+// Package version - WebAssembly builds for running snippets in the browser
+//
+// Instead of running a snippet on the server, it can be built with the
+// selected toolchain for GOOS=js GOARCH=wasm and executed by the browser
+// with that toolchain's own wasm_exec.js. Code that needs what a browser
+// cannot provide (processes, sockets, signals, files, standard input) is
+// detected before building so the client can fall back to server execution.
+package version
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CaptureWasm is the artifact kind of a WebAssembly build
+const CaptureWasm = "wasm"
+
+// wasmUnsupportedPackages are imports that cannot work under GOOS=js in a browser
+var wasmUnsupportedPackages = map[string]string{
+	"C":                 "cgo はWebAssemblyでは使用できません",
+	"net":               "ブラウザではソケットを使用できません",
+	"net/http":          "ブラウザではHTTPサーバーを起動できず、クライアントもCORSの制限を受けます",
+	"net/http/httptest": "ブラウザではHTTPサーバーを起動できません",
+	"net/rpc":           "ブラウザではソケットを使用できません",
+	"net/smtp":          "ブラウザではソケットを使用できません",
+	"os/exec":           "ブラウザではプロセスを起動できません",
+	"os/signal":         "ブラウザではシグナルを受け取れません",
+	"os/user":           "ブラウザではユーザー情報を取得できません",
+	"plugin":            "ブラウザではプラグインを読み込めません",
+	"syscall":           "GOOS=js では多くのシステムコールが使用できません",
+}
+
+// wasmExecPaths are the locations of wasm_exec.js in GOROOT (lib/wasm since Go 1.24, misc/wasm before)
+var wasmExecPaths = []string{"lib/wasm/wasm_exec.js", "misc/wasm/wasm_exec.js"}
+
+// WasmUnsupported is a reason why a request has to run on the server
+type WasmUnsupported struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Feature string `json:"feature"` // 例: "os/exec", "os.Stdin", "data.txt"
+	Reason  string `json:"reason"`
+}
+
+// WasmBuild is the result of building a request for the browser
+type WasmBuild struct {
+	Version     string            `json:"version"`
+	GoVersion   string            `json:"go_version"`
+	Supported   bool              `json:"supported"`             // false ならサーバーで実行する
+	Unsupported []WasmUnsupported `json:"unsupported,omitempty"` // ブラウザで実行できない理由
+	Wasm        []byte            `json:"-"`
+	Size        int64             `json:"size,omitempty"`
+	CacheHit    bool              `json:"cache_hit"`
+	CompileTime time.Duration     `json:"compile_time"`
+	BuildOutput string            `json:"build_output,omitempty"`
+	Diagnostics []Diagnostic      `json:"diagnostics,omitempty"`
+	Error       string            `json:"error,omitempty"` // ビルドエラー
+}
+
+// BuildWasm builds the request for GOOS=js GOARCH=wasm with the selected toolchain.
+// Requests using features a browser cannot provide are reported as unsupported without building.
+func (e *Executor) BuildWasm(ctx context.Context, req ExecutionRequest) (*WasmBuild, error) {
+	config, err := e.toolConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := requestWorkspace(req, config.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WasmBuild{Version: config.Version, GoVersion: config.FullVersion}
+	result.Unsupported = wasmUnsupportedFeatures(req, ws)
+	if _, err := e.WasmExecScript(config.FullVersion); err != nil {
+		result.Unsupported = append(result.Unsupported, WasmUnsupported{Feature: "wasm_exec.js", Reason: err.Error()})
+	}
+	if len(result.Unsupported) > 0 {
+		return result, nil
+	}
+	result.Supported = true
+
+	workDir, err := os.MkdirTemp("", "gowasm_")
+	if err != nil {
+		return nil, fmt.Errorf("作業ディレクトリ作成エラー: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(workDir); err != nil {
+			log.Printf("[WARN] BuildWasm: failed to remove temp dir %s: %v", workDir, err)
+		}
+	}()
+	if err := writeWorkspace(sourceDir(workDir), ws.Files); err != nil {
+		return nil, fmt.Errorf("コードファイル作成エラー: %w", err)
+	}
+
+	if req.Timeout == 0 {
+		req.Timeout = defaultToolTimeout
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, req.Timeout, errExecutionTimeout)
+	defer cancel()
+
+	// 後に指定した値が優先されるため、env_vars の GOOS/GOARCH より js/wasm が使われる
+	env := append(userEnvironment(req), "GOOS=js", "GOARCH=wasm")
+	compileStart := time.Now()
+	rec := newOutputRecorder(req.MaxOutputBytes, nil)
+	binaryPath, release, cacheHit, build := e.buildBinary(ctx, config, workDir, ws, env, nil, rec, func(string) {})
+	result.CacheHit = cacheHit
+	result.CompileTime = time.Since(compileStart)
+	result.BuildOutput = rec.Snapshot().Combined
+	result.Diagnostics = parseDiagnostics(result.BuildOutput, sourceDir(workDir), DiagnosticBuild, config.FullVersion)
+	if build.Err != nil {
+		if build.Status == StatusTimeout || errors.Is(context.Cause(ctx), errExecutionTimeout) {
+			return nil, fmt.Errorf("ビルドがタイムアウトしました (%v)", req.Timeout)
+		}
+		result.Error = build.Err.Error()
+		if len(result.Diagnostics) > 0 {
+			result.Error = buildErrorMessage(result.Diagnostics)
+		}
+		return result, nil
+	}
+	defer release()
+
+	result.Wasm, err = os.ReadFile(binaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("WebAssemblyファイルの読み込みエラー: %w", err)
+	}
+	result.Size = int64(len(result.Wasm))
+	return result, nil
+}
+
+// WasmExecScript returns the path of the wasm_exec.js shipped with the toolchain of a Go version
+func (e *Executor) WasmExecScript(goVersion string) (string, error) {
+	config, err := e.manager.GetVersionConfig(goVersion)
+	if err != nil {
+		return "", err
+	}
+	goroot, err := toolchainGOROOT(config.Path)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range wasmExecPaths {
+		script := filepath.Join(goroot, filepath.FromSlash(name))
+		if _, err := os.Stat(script); err == nil {
+			return script, nil
+		}
+	}
+	return "", fmt.Errorf("Go %s のツールチェーンに wasm_exec.js がありません", config.FullVersion)
+}
+
+// wasmUnsupportedFeatures lists what keeps the request from running in a browser
+func wasmUnsupportedFeatures(req ExecutionRequest, ws *workspace) []WasmUnsupported {
+	var unsupported []WasmUnsupported
+	if ws.Test {
+		unsupported = append(unsupported, WasmUnsupported{Feature: "mode: test", Reason: "テストはサーバーで実行します"})
+	}
+	if req.FakeTime {
+		unsupported = append(unsupported, WasmUnsupported{Feature: "fake_time", Reason: "仮想時間はサーバーでのみ使用できます"})
+	}
+	if req.Trace != "" || len(req.Profile) > 0 {
+		unsupported = append(unsupported, WasmUnsupported{Feature: "trace/profile", Reason: "トレース・プロファイルはサーバーでのみ取得できます"})
+	}
+
+	names := make([]string, 0, len(ws.Files))
+	for name := range ws.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch base := path.Base(name); {
+		case base == "go.mod" || base == "go.sum" || base == "go.work" || base == "go.work.sum":
+			continue
+		case !isGoSource(name):
+			// ブラウザの wasm_exec.js はファイルシステムを提供しない
+			unsupported = append(unsupported, WasmUnsupported{File: name, Feature: name, Reason: "ブラウザではデータファイルを読み込めません"})
+			continue
+		}
+
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, name, ws.Files[name], parser.SkipObjectResolution)
+		if err != nil {
+			continue // 構文エラーはビルドで位置付きで報告する
+		}
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if reason, ok := wasmUnsupportedPackages[importPath]; ok {
+				position := fset.Position(spec.Pos())
+				unsupported = append(unsupported, WasmUnsupported{File: name, Line: position.Line, Column: position.Column, Feature: importPath, Reason: reason})
+			}
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Stdin" {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == "os" {
+				position := fset.Position(sel.Pos())
+				unsupported = append(unsupported, WasmUnsupported{File: name, Line: position.Line, Column: position.Column, Feature: "os.Stdin", Reason: "ブラウザでは標準入力を使用できません"})
+			}
+			return true
+		})
+	}
+	return unsupported
+}
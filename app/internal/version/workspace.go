@@ -0,0 +1,307 @@
+// Package version - Multi-file requests materialized as a temporary module
+//
+// A request may carry a set of files (several packages, go.mod, go.work,
+// _test.go and data files) instead of a single Code string. The files are
+// written into a private directory; when neither go.mod nor go.work is
+// supplied a go.mod for module "tour" is generated so that packages can be
+// imported as "tour/<dir>".
+package version
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultModulePath is the module path of the generated go.mod
+	defaultModulePath = "tour"
+	// maxRequestFiles limits the number of files in a request
+	maxRequestFiles = 64
+	// MaxRequestBytes limits the total size of all files in a request
+	MaxRequestBytes = 4 << 20
+)
+
+// workspace is the set of files to build and the package to run
+type workspace struct {
+	Files   map[string][]byte // スラッシュ区切りの相対パス -> 内容
+	Target  string            // go build / go test に渡すパッケージ（例: ".", "./cmd/app"）
+	HasWork bool              // go.work を含むか
+	Test    bool              // go test -c でテストバイナリをビルドするか
+}
+
+// requestWorkspace collects the files of a request and decides the main package.
+// goVersion (e.g. "1.25") is used for the go directive of a generated go.mod.
+func requestWorkspace(req ExecutionRequest, goVersion string) (*workspace, error) {
+	ws, err := moduleWorkspace(req, goVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Mode == ModeTest {
+		ws.Test = true
+		ws.Target, err = testPackage(ws.Files, req.Package)
+	} else {
+		ws.Target, err = mainPackage(ws.Files, req.Package)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// moduleWorkspace collects the files of a request, generating go.mod when needed, without choosing a package
+func moduleWorkspace(req ExecutionRequest, goVersion string) (*workspace, error) {
+	files, err := requestFiles(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &workspace{Files: files}
+	_, hasMod := files["go.mod"]
+	_, ws.HasWork = files["go.work"]
+	if !hasMod && !ws.HasWork {
+		files["go.mod"] = []byte(fmt.Sprintf("module %s\n\ngo %s\n", defaultModulePath, goVersion))
+	}
+	return ws, nil
+}
+
+// requestFiles returns the validated files of a request.
+// Code is added as main.go (main_test.go in test mode) unless the request already contains that file.
+func requestFiles(req ExecutionRequest) (map[string][]byte, error) {
+	if len(req.Files) > maxRequestFiles {
+		return nil, fmt.Errorf("ファイル数が多すぎます（%d件、上限%d件）", len(req.Files), maxRequestFiles)
+	}
+
+	files := make(map[string][]byte, len(req.Files)+2)
+	total := 0
+	for name, content := range req.Files {
+		if err := validateFileName(name); err != nil {
+			return nil, err
+		}
+		if err := validateFileKind(name, content); err != nil {
+			return nil, err
+		}
+		total += len(content)
+		files[name] = []byte(content)
+	}
+	if req.Code != "" {
+		name := codeFileName(req)
+		if _, exists := files[name]; exists {
+			return nil, fmt.Errorf("code と files の %s は同時に指定できません", name)
+		}
+		total += len(req.Code)
+		files[name] = []byte(req.Code)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("空のコードは実行できません")
+	}
+	if total > MaxRequestBytes {
+		return nil, fmt.Errorf("ファイルの合計サイズが大きすぎます（%dバイト、上限%dバイト）", total, MaxRequestBytes)
+	}
+
+	// ディレクトリとファイルの名前の衝突（"a" と "a/b.go"）を検出
+	for name := range files {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if _, exists := files[dir]; exists {
+				return nil, fmt.Errorf("ファイル %q とディレクトリ %q が衝突しています", dir, path.Dir(name))
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// validateFileName accepts clean, relative, slash separated paths only
+func validateFileName(name string) error {
+	switch {
+	case name == "" || name == ".":
+		return fmt.Errorf("ファイル名が空です")
+	case strings.Contains(name, `\`) || strings.ContainsRune(name, 0):
+		return fmt.Errorf("不正なファイル名です: %q", name)
+	case path.IsAbs(name) || path.Clean(name) != name:
+		return fmt.Errorf("ファイル名は正規化された相対パスで指定してください: %q", name)
+	case name == ".." || strings.HasPrefix(name, "../"):
+		return fmt.Errorf("作業ディレクトリ外のファイルは指定できません: %q", name)
+	}
+	return nil
+}
+
+// nonGoSourceExts are files the go command would assemble, compile with cgo
+// or link into the binary. Only .go files are checked against the policy,
+// so these are rejected outright.
+var nonGoSourceExts = map[string]bool{
+	".s": true, ".S": true, ".sx": true, ".syso": true,
+	".c": true, ".cc": true, ".cpp": true, ".cxx": true,
+	".h": true, ".hh": true, ".hpp": true, ".hxx": true,
+	".m": true, ".f": true, ".F": true, ".for": true, ".f90": true,
+	".swig": true, ".swigcxx": true,
+}
+
+// validateFileKind rejects assembly, object and C-family files, and
+// go.mod/go.work files that point outside the workspace
+func validateFileKind(name, content string) error {
+	if nonGoSourceExts[path.Ext(name)] {
+		return fmt.Errorf("アセンブリ・オブジェクト・C系のファイルは指定できません: %q", name)
+	}
+	switch path.Base(name) {
+	case "go.mod", "go.work":
+		return validateModuleFile(name, content)
+	}
+	return nil
+}
+
+// validateModuleFile rejects replace directives (and go.work use directives)
+// whose target is a filesystem path outside the workspace, so a request
+// cannot compile host directories into the binary.
+func validateModuleFile(name, content string) error {
+	block := ""
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		verb, args := block, fields
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+			continue
+		case block == "" && len(fields) >= 2 && fields[len(fields)-1] == "(":
+			block = fields[0]
+			continue
+		case block == "":
+			verb, args = fields[0], fields[1:]
+		}
+
+		var target string
+		switch verb {
+		case "replace":
+			for i, arg := range args {
+				if arg == "=>" && i+1 < len(args) {
+					target = args[i+1]
+				}
+			}
+		case "use":
+			if len(args) > 0 {
+				target = args[0]
+			}
+		default:
+			continue
+		}
+		if unquoted, err := strconv.Unquote(target); err == nil {
+			target = unquoted
+		}
+		if !isFilesystemPath(target) {
+			continue
+		}
+		resolved := path.Join(path.Dir(name), target)
+		if path.IsAbs(target) || strings.Contains(target, `\`) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return fmt.Errorf("%s の %s に作業ディレクトリ外のパスは指定できません: %q", name, verb, target)
+		}
+	}
+	return nil
+}
+
+// isFilesystemPath reports whether a replace/use target is a directory
+// rather than a module path (same rule as the go command)
+func isFilesystemPath(target string) bool {
+	return target == "." || target == ".." ||
+		strings.HasPrefix(target, "./") || strings.HasPrefix(target, "../") ||
+		strings.HasPrefix(target, "/") || strings.HasPrefix(target, `.\`) || strings.HasPrefix(target, `..\`) ||
+		(len(target) >= 2 && target[1] == ':')
+}
+
+// isGoSource reports whether name is a Go file compiled into the package (not a test)
+func isGoSource(name string) bool {
+	return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go")
+}
+
+// mainPackage returns the package to build.
+// Without an explicit pkg the only directory declaring package main is used,
+// preferring the root directory when there are several.
+func mainPackage(files map[string][]byte, pkg string) (string, error) {
+	if pkg != "" {
+		return explicitPackage(pkg)
+	}
+
+	candidates := make(map[string]bool)
+	fset := token.NewFileSet()
+	for name, content := range files {
+		if !isGoSource(name) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, content, parser.PackageClauseOnly)
+		// 構文エラーはコンパイラに報告させるため候補として扱う
+		if err != nil || f.Name.Name == "main" {
+			candidates[path.Dir(name)] = true
+		}
+	}
+	return choosePackage(candidates, "mainパッケージが見つかりません", "複数のmainパッケージがあります")
+}
+
+// explicitPackage converts a user supplied package directory (or "dir/..." pattern) to a build target
+func explicitPackage(pkg string) (string, error) {
+	if strings.HasPrefix(pkg, "-") {
+		return "", fmt.Errorf("パッケージの指定が不正です: %q", pkg)
+	}
+	pkg = strings.TrimPrefix(pkg, "./")
+	if pkg == "." || pkg == "" {
+		return ".", nil
+	}
+	if err := validateFileName(pkg); err != nil {
+		return "", err
+	}
+	return "./" + pkg, nil
+}
+
+// choosePackage picks the root directory or the only candidate directory
+func choosePackage(candidates map[string]bool, noneMessage, ambiguousMessage string) (string, error) {
+	switch {
+	case candidates["."]:
+		return ".", nil
+	case len(candidates) == 1:
+		for dir := range candidates {
+			return "./" + dir, nil
+		}
+	case len(candidates) == 0:
+		return "", fmt.Errorf("%s", noneMessage)
+	}
+
+	dirs := make([]string, 0, len(candidates))
+	for dir := range candidates {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return "", fmt.Errorf("%s（%s）。package で対象のパッケージを指定してください", ambiguousMessage, strings.Join(dirs, ", "))
+}
+
+// goSources returns the Go files of a request for validation, keyed by file name
+func goSources(req ExecutionRequest) map[string]string {
+	sources := make(map[string]string)
+	for name, content := range req.Files {
+		if strings.HasSuffix(name, ".go") {
+			sources[name] = content
+		}
+	}
+	if req.Code != "" {
+		sources[codeFileName(req)] = req.Code
+	}
+	return sources
+}
+
+// codeFileName is the file name under which req.Code is written
+func codeFileName(req ExecutionRequest) string {
+	if req.Mode == ModeTest {
+		return testCodeFileName
+	}
+	return "main.go"
+}
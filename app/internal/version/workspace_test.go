@@ -0,0 +1,38 @@
+package version
+
+import "testing"
+
+func TestExplicitPackage(t *testing.T) {
+	tests := []struct {
+		pkg     string
+		want    string
+		wantErr bool
+	}{
+		{pkg: "", want: "."},
+		{pkg: ".", want: "."},
+		{pkg: "./", want: "."},
+		{pkg: "greet", want: "./greet"},
+		{pkg: "./greet", want: "./greet"},
+		{pkg: "./...", want: "./..."},
+		{pkg: "internal/...", want: "./internal/..."},
+		{pkg: "-vettool=/bin/sh", wantErr: true},
+		{pkg: "-json", wantErr: true},
+		{pkg: "../outside", wantErr: true},
+		{pkg: "./../outside", wantErr: true},
+		{pkg: "/etc", wantErr: true},
+		{pkg: "a//b", wantErr: true},
+		{pkg: `a\b`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := explicitPackage(tt.pkg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("explicitPackage(%q) = %q, want error", tt.pkg, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("explicitPackage(%q) = %q, %v; want %q", tt.pkg, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Package websocket - Minimal RFC 6455 WebSocket server implementation
+//
+// This package implements just enough of the WebSocket protocol for the
+// streaming execution endpoint: the opening handshake, text/binary
+// messages (including fragmented ones), ping/pong and the close handshake.
+// Only the standard library is used.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1" // #nosec G505 - SHA-1 is mandated by RFC 6455 for Sec-WebSocket-Accept
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message types (frame opcodes)
+const (
+	ContinuationMessage = 0
+	TextMessage         = 1
+	BinaryMessage       = 2
+	CloseMessage        = 8
+	PingMessage         = 9
+	PongMessage         = 10
+)
+
+// Close status codes
+const (
+	CloseNormalClosure   = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+	defaultMaxMessageLen = 1 << 20
+	defaultWriteTimeout  = 10 * time.Second
+	closeWriteTimeout    = time.Second
+)
+
+// acceptGUID is the fixed GUID from RFC 6455 section 1.3
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed is returned when the peer closed the connection
+var ErrClosed = errors.New("websocket: connection closed")
+
+// Conn is a server-side WebSocket connection
+type Conn struct {
+	conn          net.Conn
+	reader        *bufio.Reader
+	writeMu       sync.Mutex
+	closeOnce     sync.Once
+	MaxMessageLen int64
+	WriteTimeout  time.Duration // 1フレームの送信の上限（受信しないクライアントで送信側が止まらないように）
+}
+
+// Upgrade performs the opening handshake and hijacks the HTTP connection.
+// Cross-origin requests are rejected.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("websocket: method %s not allowed", r.Method)
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusBadRequest)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "Cross-origin WebSocket request", http.StatusForbidden)
+		return nil, errors.New("websocket: cross-origin request")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+
+	// http.ServerのRead/WriteTimeoutによるデッドラインを解除
+	if err := netConn.SetDeadline(time.Time{}); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: reset deadline: %w", err)
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: handshake: %w", err)
+	}
+
+	return &Conn{
+		conn:          netConn,
+		reader:        rw.Reader,
+		MaxMessageLen: defaultMaxMessageLen,
+		WriteTimeout:  defaultWriteTimeout,
+	}, nil
+}
+
+// acceptKey computes Sec-WebSocket-Accept for a client key
+func acceptKey(key string) string {
+	// #nosec G401 - required by the protocol, not used for security
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContainsToken reports whether a comma separated header contains token
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin accepts requests without Origin (non-browser) or from the same host
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// ReadMessage reads the next complete data message.
+// Ping frames are answered automatically; a close frame returns ErrClosed.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		messageType int
+		payload     []byte
+	)
+	for {
+		fin, opcode, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, data); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			_ = c.WriteClose(CloseNormalClosure, "")
+			return 0, nil, ErrClosed
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				_ = c.WriteClose(CloseProtocolError, "unexpected data frame")
+				return 0, nil, errors.New("websocket: unexpected data frame in fragmented message")
+			}
+			messageType = opcode
+		case ContinuationMessage:
+			if messageType == 0 {
+				_ = c.WriteClose(CloseProtocolError, "unexpected continuation frame")
+				return 0, nil, errors.New("websocket: unexpected continuation frame")
+			}
+		default:
+			_ = c.WriteClose(CloseProtocolError, "unknown opcode")
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", opcode)
+		}
+
+		if int64(len(payload)+len(data)) > c.MaxMessageLen {
+			_ = c.WriteClose(CloseMessageTooBig, "message too big")
+			return 0, nil, errors.New("websocket: message too big")
+		}
+		payload = append(payload, data...)
+
+		if fin {
+			return messageType, payload, nil
+		}
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		_ = c.WriteClose(CloseProtocolError, "reserved bits set")
+		return false, 0, nil, errors.New("websocket: reserved bits set")
+	}
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	if !masked {
+		_ = c.WriteClose(CloseProtocolError, "client frames must be masked")
+		return false, 0, nil, errors.New("websocket: unmasked client frame")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode >= CloseMessage && (length > 125 || !fin) {
+		_ = c.WriteClose(CloseProtocolError, "invalid control frame")
+		return false, 0, nil, errors.New("websocket: invalid control frame")
+	}
+	if length > uint64(c.MaxMessageLen) {
+		_ = c.WriteClose(CloseMessageTooBig, "message too big")
+		return false, 0, nil, errors.New("websocket: frame too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage writes a single unfragmented frame within WriteTimeout. It is safe for concurrent use.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	return c.writeFrame(messageType, data, c.WriteTimeout)
+}
+
+// writeFrame writes a single unfragmented frame with a write deadline
+func (c *Conn) writeFrame(messageType int, data []byte, timeout time.Duration) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if timeout > 0 {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+
+	frame := make([]byte, 0, len(data)+10)
+	frame = append(frame, 0x80|byte(messageType))
+	switch {
+	case len(data) <= 125:
+		frame = append(frame, byte(len(data)))
+	case len(data) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(data)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(data)))
+	}
+	frame = append(frame, data...)
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// WriteJSON encodes v as JSON and sends it as a text message
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SetReadDeadline sets the deadline for reading messages; a zero value disables it
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// WriteClose sends a close frame with the given status code and reason
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	return c.writeFrame(CloseMessage, payload, closeWriteTimeout)
+}
+
+// Close closes the underlying network connection
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,378 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPipe returns a server connection and the client end of an in-memory pipe
+func newPipe(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return &Conn{
+		conn:          server,
+		reader:        bufio.NewReader(server),
+		MaxMessageLen: defaultMaxMessageLen,
+		WriteTimeout:  time.Second,
+	}, client
+}
+
+// clientFrame encodes a client frame; client frames must be masked
+func clientFrame(fin bool, opcode int, payload []byte, masked bool) []byte {
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// serverFrame is a frame read by the client
+type serverFrame struct {
+	fin     bool
+	opcode  int
+	payload []byte
+}
+
+// readServerFrame reads an unmasked server frame
+func readServerFrame(r io.Reader) (serverFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return serverFrame{}, err
+	}
+	if header[1]&0x80 != 0 {
+		return serverFrame{}, errors.New("server frame is masked")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return serverFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return serverFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return serverFrame{}, err
+	}
+	return serverFrame{fin: header[0]&0x80 != 0, opcode: int(header[0] & 0x0f), payload: payload}, nil
+}
+
+// exchange writes frames from the client while collecting the server's replies until the pipe closes
+func exchange(t *testing.T, client net.Conn, frames ...[]byte) <-chan []serverFrame {
+	t.Helper()
+	go func() {
+		for _, frame := range frames {
+			if _, err := client.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+	replies := make(chan []serverFrame, 1)
+	go func() {
+		var got []serverFrame
+		for {
+			frame, err := readServerFrame(client)
+			if err != nil {
+				replies <- got
+				return
+			}
+			got = append(got, frame)
+		}
+	}()
+	return replies
+}
+
+func closeCode(t *testing.T, frames []serverFrame) int {
+	t.Helper()
+	for _, frame := range frames {
+		if frame.opcode == CloseMessage && len(frame.payload) >= 2 {
+			return int(binary.BigEndian.Uint16(frame.payload))
+		}
+	}
+	t.Fatalf("no close frame in %v", frames)
+	return 0
+}
+
+func TestReadMessagePayloadLengths(t *testing.T) {
+	for _, size := range []int{0, 5, 125, 126, 0xffff, 0x10000, 70000} {
+		conn, client := newPipe(t)
+		payload := bytes.Repeat([]byte("x"), size)
+		exchange(t, client, clientFrame(true, BinaryMessage, payload, true))
+
+		messageType, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("size %d: ReadMessage: %v", size, err)
+		}
+		if messageType != BinaryMessage || !bytes.Equal(got, payload) {
+			t.Errorf("size %d: got type %d, %d bytes", size, messageType, len(got))
+		}
+	}
+}
+
+func TestReadMessageFragmentedWithPing(t *testing.T) {
+	conn, client := newPipe(t)
+	replies := exchange(t, client,
+		clientFrame(false, TextMessage, []byte("hel"), true),
+		clientFrame(true, PingMessage, []byte("p"), true),
+		clientFrame(false, ContinuationMessage, []byte("lo "), true),
+		clientFrame(true, ContinuationMessage, []byte("world"), true),
+	)
+
+	messageType, got, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if messageType != TextMessage || string(got) != "hello world" {
+		t.Errorf("got type %d %q, want text \"hello world\"", messageType, got)
+	}
+
+	conn.Close()
+	frames := <-replies
+	if len(frames) != 1 || frames[0].opcode != PongMessage || string(frames[0].payload) != "p" {
+		t.Errorf("replies = %v, want a single pong", frames)
+	}
+}
+
+func TestReadMessageProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLen   int64
+		frames   [][]byte
+		wantCode int
+	}{
+		{"unmasked frame", 0, [][]byte{clientFrame(true, TextMessage, []byte("hi"), false)}, CloseProtocolError},
+		{"reserved bits", 0, [][]byte{append([]byte{0xc1}, clientFrame(true, TextMessage, []byte("hi"), true)[1:]...)}, CloseProtocolError},
+		{"unknown opcode", 0, [][]byte{clientFrame(true, 3, []byte("hi"), true)}, CloseProtocolError},
+		{"fragmented control frame", 0, [][]byte{clientFrame(false, PingMessage, nil, true)}, CloseProtocolError},
+		{"long control frame", 0, [][]byte{clientFrame(true, PingMessage, bytes.Repeat([]byte("x"), 126), true)}, CloseProtocolError},
+		{"continuation without start", 0, [][]byte{clientFrame(true, ContinuationMessage, []byte("hi"), true)}, CloseProtocolError},
+		{"data frame inside fragmented message", 0, [][]byte{
+			clientFrame(false, TextMessage, []byte("a"), true),
+			clientFrame(true, TextMessage, []byte("b"), true),
+		}, CloseProtocolError},
+		{"frame too big", 4, [][]byte{clientFrame(true, TextMessage, []byte("hello"), true)}, CloseMessageTooBig},
+		{"message too big", 4, [][]byte{
+			clientFrame(false, TextMessage, []byte("abc"), true),
+			clientFrame(true, ContinuationMessage, []byte("de"), true),
+		}, CloseMessageTooBig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, client := newPipe(t)
+			if tt.maxLen > 0 {
+				conn.MaxMessageLen = tt.maxLen
+			}
+			replies := exchange(t, client, tt.frames...)
+
+			if _, _, err := conn.ReadMessage(); err == nil {
+				t.Fatal("ReadMessage succeeded, want error")
+			}
+			conn.Close()
+			if code := closeCode(t, <-replies); code != tt.wantCode {
+				t.Errorf("close code = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	conn, client := newPipe(t)
+	payload := binary.BigEndian.AppendUint16(nil, CloseGoingAway)
+	replies := exchange(t, client, clientFrame(true, CloseMessage, payload, true))
+
+	if _, _, err := conn.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("ReadMessage = %v, want ErrClosed", err)
+	}
+	conn.Close()
+	if code := closeCode(t, <-replies); code != CloseNormalClosure {
+		t.Errorf("close code = %d, want %d", code, CloseNormalClosure)
+	}
+}
+
+func TestWriteMessageFraming(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xffff, 0x10000} {
+		conn, client := newPipe(t)
+		replies := exchange(t, client)
+
+		payload := bytes.Repeat([]byte("y"), size)
+		if err := conn.WriteMessage(TextMessage, payload); err != nil {
+			t.Fatalf("size %d: WriteMessage: %v", size, err)
+		}
+		conn.Close()
+		frames := <-replies
+		if len(frames) != 1 || !frames[0].fin || frames[0].opcode != TextMessage || !bytes.Equal(frames[0].payload, payload) {
+			t.Errorf("size %d: frames = %d, want one text frame of %d bytes", size, len(frames), size)
+		}
+	}
+}
+
+func TestWriteMessageTimeout(t *testing.T) {
+	conn, _ := newPipe(t) // クライアントは読み取らない
+	conn.WriteTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err := conn.WriteMessage(TextMessage, []byte("blocked"))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("WriteMessage = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("WriteMessage returned after %v", elapsed)
+	}
+}
+
+func TestReadMessageDeadline(t *testing.T) {
+	conn, client := newPipe(t) // クライアントは何も送らない
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("ReadMessage = %v, want deadline exceeded", err)
+	}
+
+	// 解除後は待ち続ける
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		client.Write(clientFrame(true, TextMessage, []byte("late"), true))
+	}()
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "late" {
+		t.Errorf("ReadMessage after clearing the deadline = %q, %v", data, err)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = conn.WriteMessage(TextMessage, append([]byte("echo: "), data...))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	tests := []struct {
+		name       string
+		header     map[string]string
+		wantStatus int
+	}{
+		{"handshake", map[string]string{}, http.StatusSwitchingProtocols},
+		{"same origin", map[string]string{"Origin": server.URL}, http.StatusSwitchingProtocols},
+		{"cross origin", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"unsupported version", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusBadRequest},
+		{"missing key", map[string]string{"Sec-WebSocket-Key": ""}, http.StatusBadRequest},
+		{"not an upgrade", map[string]string{"Upgrade": ""}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			netConn, err := net.Dial("tcp", host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer netConn.Close()
+			netConn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			header := map[string]string{
+				"Host":                  host,
+				"Connection":            "Upgrade",
+				"Upgrade":               "websocket",
+				"Sec-WebSocket-Version": "13",
+				"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+			}
+			for key, value := range tt.header {
+				header[key] = value
+			}
+			var request strings.Builder
+			request.WriteString("GET /ws HTTP/1.1\r\n")
+			for key, value := range header {
+				if value != "" {
+					request.WriteString(key + ": " + value + "\r\n")
+				}
+			}
+			request.WriteString("\r\n")
+			if _, err := netConn.Write([]byte(request.String())); err != nil {
+				t.Fatal(err)
+			}
+
+			reader := bufio.NewReader(netConn)
+			resp, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				return
+			}
+			// RFC 6455 1.3 の例
+			if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+				t.Errorf("Sec-WebSocket-Accept = %q", accept)
+			}
+
+			if _, err := netConn.Write(clientFrame(true, TextMessage, []byte("hi"), true)); err != nil {
+				t.Fatal(err)
+			}
+			frame, err := readServerFrame(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.opcode != TextMessage || string(frame.payload) != "echo: hi" {
+				t.Errorf("reply = %d %q", frame.opcode, frame.payload)
+			}
+		})
+	}
+}
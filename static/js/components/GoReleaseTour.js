@@ -18,6 +18,7 @@ class GoReleaseTour {
         if (versionSelect && versionSelect.value) {
             this.currentVersion = versionSelect.value;
         }
+        this.renderPatchSelector(this.currentVersion);
 
         // 最初にイベントリスナーを設定
         this.setupEventListeners();
@@ -30,6 +31,12 @@ class GoReleaseTour {
         // デフォルトでウェルカム画面を表示
         this.showWelcomeScreen();
 
+        // 共有URL（/s/{id}）で開かれた場合は共有コードを読み込む
+        const sharedMatch = window.location.pathname.match(/^\/s\/([0-9a-f]{16})$/);
+        if (sharedMatch) {
+            this.openSharedSnippet(sharedMatch[1]);
+        }
+
         console.log('Initialization complete');
     }
 
@@ -62,6 +62,9 @@ class ApiClient {
         console.log('Debug: selectedVersion =', selectedVersion);
         console.log('Debug: lessonPath =', lessonPath);
 
+        // 前回の仮想時間の再生を中止
+        this.stopReplay();
+
         // ローディング状態を表示
         runBtn.disabled = true;
         runBtn.textContent = '▶ 実行中...';
@@ -71,6 +74,8 @@ class ApiClient {
         }
         output.textContent = '実行中...';
         output.className = '';
+        this.tour.showTrace([]);
+        this.tour.hideProfile();
 
         try {
             // バージョン検出ロジック - 簡素化
@@ -81,9 +86,9 @@ class ApiClient {
             console.log('lessonPath:', lessonPath);
             console.log('code preview:', code.substring(0, 100));
 
-            // 1. バージョンセレクターから取得
+            // 1. バージョンセレクターから取得（パッチが選択されていればそのパッチ）
             if (selectedVersion && selectedVersion.trim()) {
-                detectedVersion = selectedVersion.trim();
+                detectedVersion = this.tour.selectedRunVersion(selectedVersion.trim());
                 console.log('✓ Using version from selector:', detectedVersion);
             }
 
@@ -124,10 +129,17 @@ class ApiClient {
             const envVarsInput = document.getElementById('env-vars');
             const envVars = envVarsInput ? envVarsInput.value.trim() : '';
 
+            // 仮想時間モード（time.Sleep が即座に進み、出力は仮想時刻付きで返る）
+            const fakeTimeInput = document.getElementById('fake-time');
+            // 実行トレースの取得（"trace" / "flight"）
+            const traceSelect = document.getElementById('trace-mode');
+
             const payload = {
                 code: code,
                 version: detectedVersion,
-                env_vars: envVars
+                env_vars: envVars,
+                fake_time: fakeTimeInput ? fakeTimeInput.checked : false,
+                trace: traceSelect ? traceSelect.value : ''
             };
 
             // ペイロード検証
@@ -137,40 +149,61 @@ class ApiClient {
 
             console.log('Debug: Final payload =', JSON.stringify(payload, null, 2));
 
-            // バージョン対応のAPIエンドポイントを使用
-            const response = await fetch('/api/run', {
-                method: 'POST',
-                headers: {
-                    'Content-Type': 'application/json',
-                },
-                body: JSON.stringify(payload),
-            });
+            // ブラウザで実行（WebAssembly）。対応していないコード・失敗時はサーバーで実行する
+            let result = null;
+            let fallbackNote = '';
+            const wasmInput = document.getElementById('wasm-mode');
+            if (wasmInput && wasmInput.checked && typeof WasmRunner !== 'undefined' && WasmRunner.isSupported()) {
+                try {
+                    const wasmResult = await this.tour.getWasmRunner().run(payload, output);
+                    if (wasmResult.fallback) {
+                        const reasons = wasmResult.fallback.map(item => `${item.file ? `${item.file}:${item.line || 0} ` : ''}${item.feature}: ${item.reason}`);
+                        fallbackNote = `ℹ ブラウザでは実行できないため、サーバーで実行しました\n${reasons.map(reason => `  - ${reason}`).join('\n')}\n\n`;
+                    } else {
+                        result = wasmResult;
+                    }
+                } catch (wasmError) {
+                    console.warn('WebAssembly execution failed, falling back to the server:', wasmError);
+                    fallbackNote = `ℹ ブラウザでの実行に失敗したため、サーバーで実行しました: ${wasmError.message}\n\n`;
+                }
+            }
 
-            if (!response.ok) {
-                throw new Error(`HTTP ${response.status}`);
+            // WebSocketが使える場合はストリーミング実行（失敗時は通常実行にフォールバック）
+            // 仮想時間モードは一瞬で終わるため通常実行の結果を再生する
+            if (!result && !payload.fake_time && typeof StreamRunner !== 'undefined' && StreamRunner.isSupported()) {
+                try {
+                    result = await this.runCodeStream(payload, output);
+                } catch (streamError) {
+                    console.warn('Streaming execution failed, falling back to /api/run:', streamError);
+                }
             }
 
-            const result = await response.json();
+            if (!result) {
+                // バージョン対応のAPIエンドポイントを使用
+                const response = await fetch('/api/run', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify(payload),
+                });
 
-            // バージョン情報を表示
-            let versionInfo = '';
-            if (result.used_version || result.go_version) {
-                versionInfo = `実行環境: Go ${result.go_version || result.used_version}`;
-                if (result.detected_version && result.detected_version !== result.used_version) {
-                    versionInfo += ` (検出: ${result.detected_version})`;
+                if (response.status === 429) {
+                    // 実行キューが満杯（Retry-After秒後に再試行を促す）
+                    const retryAfter = response.headers.get('Retry-After');
+                    const rejected = await response.json().catch(() => ({}));
+                    throw new Error(`${rejected.error || '実行キューが満杯です'}${retryAfter ? `（約${retryAfter}秒後）` : ''}`);
                 }
-                if (result.execution_time) {
-                    versionInfo += ` | 実行時間: ${result.execution_time}`;
+                if (!response.ok) {
+                    throw new Error(`HTTP ${response.status}`);
                 }
-                versionInfo += '\n' + '='.repeat(50) + '\n';
+
+                result = await response.json();
             }
 
-            if (result.error) {
-                output.textContent = versionInfo + `エラー: ${result.error}\n\n出力:\n${result.output}`;
-                output.className = 'error';
-            } else {
-                output.textContent = versionInfo + (result.output || '実行完了（出力なし）');
-                output.className = '';
+            this.renderResult(result, output);
+            if (fallbackNote) {
+                output.textContent = fallbackNote + output.textContent;
             }
         } catch (error) {
             console.error('Execution error:', error);
@@ -184,6 +217,94 @@ class ApiClient {
             }
         }
     }
+
+    async runCodeStream(payload, output) {
+        const runner = this.tour.getStreamRunner();
+        let streamed = '';
+        let started = false;
+
+        const result = await runner.run(payload, {
+            onQueued: (position) => {
+                output.textContent = `実行待ち: ${position}番目`;
+            },
+            onStatus: (phase) => {
+                output.textContent = phase === 'compiling' ? 'コンパイル中...' : '実行中...\n';
+            },
+            onOutput: (stream, data) => {
+                if (!started) {
+                    output.textContent = '';
+                    started = true;
+                }
+                streamed += data;
+                output.textContent += data;
+            },
+        });
+
+        result.output = streamed;
+        return result;
+    }
+
+    renderResult(result, output) {
+        // コードポリシー違反・ビルドエラーの行をエディターで強調表示
+        this.tour.markProblems(result.violations || [], result.diagnostics || []);
+
+        // 実行トレースを取得した場合はタイムラインを表示
+        this.tour.showTrace(result.artifacts);
+
+        // バージョン情報を表示
+        let versionInfo = '';
+        if (result.used_version || result.go_version) {
+            versionInfo = `実行環境: Go ${result.go_version || result.used_version}`;
+            if (result.detected_version && result.detected_version !== result.used_version) {
+                versionInfo += ` (検出: ${result.detected_version})`;
+            }
+            if (result.execution_time) {
+                versionInfo += ` | 実行時間: ${result.execution_time}`;
+            }
+            if (result.queue_wait) {
+                versionInfo += ` | 実行待ち: ${result.queue_wait}`;
+            }
+            if (result.compile_time) {
+                versionInfo += result.cache_hit
+                    ? ` (ビルドキャッシュ利用, 実行: ${result.run_time})`
+                    : ` (コンパイル: ${result.compile_time}, 実行: ${result.run_time})`;
+            }
+            versionInfo += '\n' + '='.repeat(50) + '\n';
+        }
+
+        if (result.status === 'timeout') {
+            output.textContent = versionInfo + `⏱ タイムアウト: ${result.error}\n\nタイムアウトまでの出力:\n${result.output || '（出力なし）'}`;
+            output.className = 'error';
+        } else if (result.error) {
+            const buildOutput = result.build_output ? `\n\nビルド出力:\n${result.build_output}` : '';
+            output.textContent = versionInfo + `エラー: ${result.error}${buildOutput}\n\n出力:\n${result.output}`;
+            output.className = 'error';
+        } else if (result.timed_events && result.timed_events.length > 0) {
+            output.textContent = versionInfo + `仮想時間: ${result.virtual_time}（元の間隔で再生中）\n`;
+            output.className = '';
+            this.replayTimedEvents(result.timed_events, output);
+            return;
+        } else {
+            output.textContent = versionInfo + (result.output || '実行完了（出力なし）');
+            output.className = '';
+        }
+
+        if (result.truncated) {
+            output.textContent += '\n\n⚠ 出力サイズの上限に達したため、出力は切り詰められています';
+        }
+    }
+
+    // 仮想時間モードの出力を、各出力の仮想時刻（ナノ秒）どおりの間隔で表示
+    replayTimedEvents(events, output) {
+        this.replayTimers = events.map(event => setTimeout(() => {
+            output.textContent += event.data;
+        }, event.offset / 1e6));
+    }
+
+    stopReplay() {
+        (this.replayTimers || []).forEach(timer => clearTimeout(timer));
+        this.replayTimers = [];
+    }
 }
 
 // ApiClientをGoReleaseTourに統合
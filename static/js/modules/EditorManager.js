@@ -96,6 +96,33 @@ class EditorManager {
         }
     }
 
+    markProblems(violations, diagnostics) {
+        const editor = this.tour.codeEditor;
+        if (!editor) return;
+
+        // 前回の強調表示とメッセージを解除
+        (this.problemLines || []).forEach(handle => {
+            editor.removeLineClass(handle, 'background', 'problem-line');
+        });
+        (this.problemWidgets || []).forEach(widget => widget.clear());
+        this.problemLines = [];
+        this.problemWidgets = [];
+
+        // エディターのコードは main.go（テストモードでは main_test.go）として実行される
+        const problems = [...violations, ...diagnostics]
+            .filter(p => p.file === 'main.go' || p.file === 'main_test.go');
+        problems.forEach(p => {
+            const handle = editor.getLineHandle(p.line - 1);
+            if (!handle) return;
+            editor.addLineClass(handle, 'background', 'problem-line');
+            const message = document.createElement('div');
+            message.className = 'problem-message';
+            message.textContent = p.column ? `${p.column}: ${p.message}` : p.message;
+            this.problemWidgets.push(editor.addLineWidget(handle, message));
+            this.problemLines.push(handle);
+        });
+    }
+
     setupTextareaFallback() {
         // コードエディターの改善（CodeMirrorが使用できない場合のフォールバック）
         if (!this.tour.codeEditor) {
@@ -125,6 +152,13 @@ GoReleaseTour.prototype.initCodeEditor = function() {
     this.editorManager.initCodeEditor();
 };
 
+GoReleaseTour.prototype.markProblems = function(violations, diagnostics) {
+    if (!this.editorManager) {
+        this.editorManager = new EditorManager(this);
+    }
+    this.editorManager.markProblems(violations, diagnostics);
+};
+
 GoReleaseTour.prototype.loadCodeIntoEditor = function(lesson) {
     if (!this.editorManager) {
         this.editorManager = new EditorManager(this);
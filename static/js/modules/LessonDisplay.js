@@ -21,6 +21,9 @@ class LessonDisplay {
             lessonDescription.innerHTML = `<p>${lesson.description}</p>`;
         }
 
+        // 検証したパッチを表示
+        this.tour.showValidatedPatch(lesson);
+
         // 参考リンクを表示
         this.displayLessonLinks(lesson);
 
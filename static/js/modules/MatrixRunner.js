@@ -0,0 +1,98 @@
+// 複数バージョンでの比較実行クライアント
+class MatrixRunner {
+    constructor(tour) {
+        this.tour = tour;
+    }
+
+    // インストール済みのバージョンを古い順に取得
+    async availableVersions() {
+        const response = await fetch('/api/version-info');
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        const info = await response.json();
+        return Object.values(info.versions || {})
+            .filter((config) => config.available)
+            .map((config) => config.version)
+            .sort((a, b) => Number(a.split('.')[1]) - Number(b.split('.')[1]));
+    }
+
+    async compare() {
+        const code = this.tour.codeEditor ? this.tour.codeEditor.getValue() : document.getElementById('code-editor').value;
+        const output = document.getElementById('output');
+        const compareBtn = document.getElementById('compare-btn');
+
+        if (!code.trim()) {
+            this.tour.showError('コードを入力してください');
+            return;
+        }
+
+        // 環境変数が入力されている場合は「なし」と「あり」を比較
+        const envVarsInput = document.getElementById('env-vars');
+        const envVars = envVarsInput ? envVarsInput.value.trim() : '';
+        const envPresets = envVars ? [{ name: '環境変数なし' }, { name: envVars, env_vars: envVars }] : [];
+
+        compareBtn.disabled = true;
+        output.textContent = '全バージョンで比較実行中...';
+        output.className = '';
+
+        try {
+            const versions = await this.availableVersions();
+            const response = await fetch('/api/run/matrix', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ code, versions, env_presets: envPresets }),
+            });
+            const result = await response.json();
+            if (!response.ok || result.error) {
+                throw new Error(result.error || `HTTP ${response.status}`);
+            }
+            this.render(result, output);
+        } catch (error) {
+            console.error('Matrix execution error:', error);
+            this.tour.showError(`比較実行に失敗しました: ${error.message}`);
+        } finally {
+            compareBtn.disabled = false;
+        }
+    }
+
+    render(result, output) {
+        const lines = [
+            result.identical
+                ? `全${result.cells.length}件の出力は同一です`
+                : `出力は${result.groups}種類に分かれました（基準: ${result.baseline}）`,
+            '',
+        ];
+
+        for (const cell of result.cells) {
+            const preset = cell.preset === 'default' ? '' : ` [${cell.preset}]`;
+            const timing = cell.result.run_time ? ` | 実行: ${cell.result.run_time}` : '';
+            lines.push(`=== Go ${cell.version}${preset} (グループ${cell.group})${timing} ===`);
+
+            if (cell.same_as_baseline || !cell.diff) {
+                const cellOutput = (cell.result.build_output || '') + cell.result.output;
+                lines.push(cellOutput.replace(/\n$/, '') || '（出力なし）');
+                if (cell.result.error) {
+                    lines.push(`エラー: ${cell.result.error}`);
+                }
+            } else {
+                lines.push('基準との差分:');
+                for (const line of cell.diff) {
+                    const mark = line.op === 'insert' ? '+ ' : line.op === 'delete' ? '- ' : '  ';
+                    lines.push(mark + line.text);
+                }
+            }
+            lines.push('');
+        }
+
+        output.textContent = lines.join('\n');
+        output.className = result.identical ? '' : 'matrix-diff';
+    }
+}
+
+GoReleaseTour.prototype.compareVersions = function() {
+    if (!this.matrixRunner) {
+        this.matrixRunner = new MatrixRunner(this);
+    }
+    return this.matrixRunner.compare();
+};
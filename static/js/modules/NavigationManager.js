@@ -10,6 +10,7 @@ class NavigationManager {
         if (versionSelect) {
             versionSelect.addEventListener('change', (e) => {
                 this.tour.currentVersion = e.target.value;
+                this.tour.renderPatchSelector(this.tour.currentVersion);
                 this.tour.loadLessons(this.tour.currentVersion).then(() => {
                     this.tour.renderLessonList();
 
@@ -47,6 +48,58 @@ class NavigationManager {
             });
         }
 
+        // バージョン比較ボタン
+        const compareBtn = document.getElementById('compare-btn');
+        if (compareBtn) {
+            compareBtn.addEventListener('click', () => {
+                this.tour.compareVersions();
+            });
+        }
+
+        // 整形・vet ボタン
+        const formatBtn = document.getElementById('format-btn');
+        if (formatBtn) {
+            formatBtn.addEventListener('click', () => {
+                this.tour.formatCode();
+            });
+        }
+
+        const vetBtn = document.getElementById('vet-btn');
+        if (vetBtn) {
+            vetBtn.addEventListener('click', () => {
+                this.tour.vetCode();
+            });
+        }
+
+        const insightBtn = document.getElementById('insight-btn');
+        if (insightBtn) {
+            insightBtn.addEventListener('click', () => {
+                this.tour.showCompilerInsight();
+            });
+        }
+
+        const sizeBtn = document.getElementById('size-btn');
+        if (sizeBtn) {
+            sizeBtn.addEventListener('click', () => {
+                this.tour.compareBinarySizes();
+            });
+        }
+
+        const profileBtn = document.getElementById('profile-btn');
+        if (profileBtn) {
+            profileBtn.addEventListener('click', () => {
+                this.tour.profileCode();
+            });
+        }
+
+        // 共有ボタン
+        const shareBtn = document.getElementById('share-btn');
+        if (shareBtn) {
+            shareBtn.addEventListener('click', () => {
+                this.tour.shareCode();
+            });
+        }
+
         // 環境変数プリセットボタン
         const presetJsonV2Btn = document.getElementById('preset-jsonv2');
         if (presetJsonV2Btn) {
@@ -0,0 +1,122 @@
+// パッチバージョンの選択と、レッスンを検証したパッチの表示
+class PatchSelector {
+    constructor(tour) {
+        this.tour = tour;
+        this.info = null; // /api/version-info の versions と patches
+    }
+
+    async load() {
+        if (this.info) {
+            return this.info;
+        }
+        try {
+            const response = await fetch('/api/version-info');
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            const info = await response.json();
+            this.info = { versions: info.versions || {}, patches: info.patches || {} };
+        } catch (error) {
+            console.warn('Failed to load patch versions:', error);
+            this.info = { versions: {}, patches: {} };
+        }
+        return this.info;
+    }
+
+    // マイナーバージョンのインストール済みパッチ（古い順）
+    async patchesFor(version) {
+        const info = await this.load();
+        return Object.values(info.patches)
+            .filter((config) => config.available && config.version === version)
+            .map((config) => config.full_version)
+            .sort((a, b) => this.compare(a, b));
+    }
+
+    compare(a, b) {
+        const pa = a.split(/[.a-z]+/).map(Number);
+        const pb = b.split(/[.a-z]+/).map(Number);
+        for (let i = 0; i < Math.max(pa.length, pb.length); i++) {
+            const diff = (pa[i] || 0) - (pb[i] || 0);
+            if (diff !== 0) {
+                return diff;
+            }
+        }
+        return 0;
+    }
+
+    // バージョン選択に合わせてパッチの選択肢を作り直す（selected は選択状態にする完全バージョン）
+    async render(version, selected = '') {
+        const patchSelect = document.getElementById('patch-select');
+        if (!patchSelect) {
+            return;
+        }
+        const info = await this.load();
+        const patches = await this.patchesFor(version);
+        const defaultConfig = info.versions[version];
+
+        const options = [new Option(defaultConfig && defaultConfig.available ? `既定 (Go ${defaultConfig.full_version})` : '既定のパッチ', '')];
+        patches.forEach((patch) => options.push(new Option(`Go ${patch}`, patch)));
+        patchSelect.replaceChildren(...options);
+        patchSelect.value = patches.includes(selected) ? selected : '';
+        patchSelect.disabled = patches.length < 2 && !selected;
+    }
+
+    // 実行に使うバージョン: パッチが選択されていればその完全バージョン、なければマイナーバージョン
+    selectedVersion(version) {
+        const patchSelect = document.getElementById('patch-select');
+        return (patchSelect && patchSelect.value) || version;
+    }
+
+    // レッスンを検証したパッチを表示し、インストール済みならそのパッチを選べるようにする
+    async showValidated(lesson) {
+        const validated = document.getElementById('current-lesson-validated');
+        if (!validated) {
+            return;
+        }
+        validated.replaceChildren();
+        if (!lesson || !lesson.validated_with) {
+            return;
+        }
+
+        const label = document.createElement('span');
+        label.textContent = `Go ${lesson.validated_with} で検証済み`;
+        validated.appendChild(label);
+
+        const patches = await this.patchesFor(lesson.version);
+        if (!patches.includes(lesson.validated_with)) {
+            label.textContent += '（このパッチはインストールされていません）';
+            label.title = '既定のパッチで実行するため、結果が異なる場合があります';
+            return;
+        }
+        const useBtn = document.createElement('button');
+        useBtn.className = 'tool-btn';
+        useBtn.textContent = 'このパッチで実行';
+        useBtn.addEventListener('click', () => {
+            const patchSelect = document.getElementById('patch-select');
+            if (patchSelect) {
+                patchSelect.disabled = false;
+                patchSelect.value = lesson.validated_with;
+            }
+        });
+        validated.appendChild(useBtn);
+    }
+}
+
+GoReleaseTour.prototype.patchSelector = function() {
+    if (!this.patchSelectorInstance) {
+        this.patchSelectorInstance = new PatchSelector(this);
+    }
+    return this.patchSelectorInstance;
+};
+
+GoReleaseTour.prototype.renderPatchSelector = function(version, selected) {
+    return this.patchSelector().render(version, selected);
+};
+
+GoReleaseTour.prototype.selectedRunVersion = function(version) {
+    return this.patchSelector().selectedVersion(version);
+};
+
+GoReleaseTour.prototype.showValidatedPatch = function(lesson) {
+    return this.patchSelector().showValidated(lesson);
+};
@@ -0,0 +1,184 @@
+// CPU・ヒーププロファイル（/api/profile/{id}）をバージョンごとに表示
+class ProfileViewer {
+    constructor(tour) {
+        this.tour = tour;
+    }
+
+    // インストール済みの全バージョンでCPU・ヒーププロファイルを取得して比較
+    async profile() {
+        const code = this.tour.codeEditor ? this.tour.codeEditor.getValue() : document.getElementById('code-editor').value;
+        const output = document.getElementById('output');
+        const profileBtn = document.getElementById('profile-btn');
+        const container = document.getElementById('profile-viewer');
+
+        if (!code.trim()) {
+            this.tour.showError('コードを入力してください');
+            return;
+        }
+
+        const envVarsInput = document.getElementById('env-vars');
+        const envVars = envVarsInput ? envVarsInput.value.trim() : '';
+
+        profileBtn.disabled = true;
+        this.hide();
+        this.tour.showTrace([]);
+        output.textContent = '全バージョンでプロファイルを取得中...';
+        output.className = '';
+        try {
+            if (!this.tour.matrixRunner) {
+                this.tour.matrixRunner = new MatrixRunner(this.tour);
+            }
+            const versions = await this.tour.matrixRunner.availableVersions();
+            const response = await fetch('/api/run/matrix', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ code, versions, env_vars: envVars, profile: ['cpu', 'heap'] }),
+            });
+            const result = await response.json();
+            if (!response.ok || result.error) {
+                throw new Error(result.error || `HTTP ${response.status}`);
+            }
+
+            const lines = [];
+            container.innerHTML = '';
+            for (const cell of result.cells) {
+                const run = cell.result;
+                lines.push(`Go ${run.go_version || cell.version}: ${run.error ? `エラー: ${run.error}` : `実行時間 ${run.run_time}`}`);
+                const section = document.createElement('div');
+                section.className = 'profile-version';
+                const title = document.createElement('h5');
+                title.textContent = `Go ${run.go_version || cell.version}`;
+                section.appendChild(title);
+                for (const artifact of run.artifacts || []) {
+                    section.appendChild(await this.renderArtifact(artifact));
+                }
+                if (!run.artifacts || run.artifacts.length === 0) {
+                    const empty = document.createElement('p');
+                    empty.textContent = 'プロファイルがありません（ビルドエラー、または os.Exit で終了した可能性があります）';
+                    section.appendChild(empty);
+                }
+                container.appendChild(section);
+            }
+            container.hidden = false;
+            output.textContent = lines.join('\n');
+            output.className = result.cells.some(cell => cell.result.error) ? 'error' : '';
+        } catch (error) {
+            console.error('Profile error:', error);
+            this.tour.showError(`プロファイルの取得に失敗しました: ${error.message}`);
+        } finally {
+            profileBtn.disabled = false;
+        }
+    }
+
+    hide() {
+        const container = document.getElementById('profile-viewer');
+        if (container) {
+            container.innerHTML = '';
+            container.hidden = true;
+        }
+    }
+
+    // 1つのプロファイルの上位関数とフレームグラフ
+    async renderArtifact(artifact) {
+        const block = document.createElement('div');
+        block.className = 'profile-block';
+        const header = document.createElement('div');
+        header.className = 'trace-header';
+        const title = document.createElement('strong');
+        const download = document.createElement('a');
+        download.href = artifact.url;
+        download.textContent = `${artifact.kind}.pprof をダウンロード`;
+        download.title = 'go tool pprof で詳細を表示できます';
+        header.append(title, download);
+        block.appendChild(header);
+
+        const response = await fetch(artifact.summary_url);
+        const summary = await response.json();
+        if (!response.ok || summary.error) {
+            title.textContent = artifact.kind;
+            const error = document.createElement('p');
+            error.textContent = `解析エラー: ${summary.error || `HTTP ${response.status}`}`;
+            block.appendChild(error);
+            return block;
+        }
+
+        const format = (value) => this.formatValue(value, summary.unit);
+        title.textContent = `${artifact.kind === 'cpu' ? 'CPU' : 'ヒープ'} (${summary.sample_type}) 合計 ${format(summary.total)}`;
+
+        const lines = [`${'flat'.padStart(10)} ${'flat%'.padStart(7)} ${'cum'.padStart(10)} ${'cum%'.padStart(7)}  関数`];
+        for (const entry of summary.top.slice(0, 10)) {
+            lines.push(`${format(entry.flat).padStart(10)} ${entry.flat_percent.toFixed(1).padStart(6)}% ${format(entry.cum).padStart(10)} ${entry.cum_percent.toFixed(1).padStart(6)}%  ${entry.function}`);
+        }
+        for (const warning of summary.warnings || []) {
+            lines.push(`⚠ ${warning}`);
+        }
+        const table = document.createElement('pre');
+        table.className = 'trace-stats';
+        table.textContent = lines.join('\n');
+        block.appendChild(table);
+
+        if (summary.total > 0) {
+            block.appendChild(this.renderFlame(summary.flame, format));
+        }
+        return block;
+    }
+
+    // 呼び出しツリーを上から下へのアイシクル図として描画（1%未満のノードは省略）
+    renderFlame(root, format) {
+        const flame = document.createElement('div');
+        flame.className = 'profile-flame';
+        const maxDepth = 16;
+        let deepest = 0;
+        const addNode = (node, depth, left) => {
+            if (depth > maxDepth || node.value / root.value < 0.01) {
+                return;
+            }
+            deepest = Math.max(deepest, depth);
+            const bar = document.createElement('div');
+            bar.className = `profile-frame trace-g${depth % 8}`;
+            bar.style.left = `${(left / root.value) * 100}%`;
+            bar.style.width = `${(node.value / root.value) * 100}%`;
+            bar.style.top = `${depth * 18}px`;
+            bar.textContent = node.name;
+            bar.title = `${node.name}: ${format(node.value)} (${((node.value / root.value) * 100).toFixed(1)}%)`;
+            flame.appendChild(bar);
+
+            let offset = left;
+            for (const child of node.children || []) {
+                addNode(child, depth + 1, offset);
+                offset += child.value;
+            }
+        };
+        let offset = 0;
+        for (const child of root.children || []) {
+            addNode(child, 0, offset);
+            offset += child.value;
+        }
+        flame.style.height = `${(deepest + 1) * 18}px`;
+        return flame;
+    }
+
+    formatValue(value, unit) {
+        if (unit === 'nanoseconds') {
+            return `${(value / 1e6).toFixed(value < 1e7 ? 2 : 0)}ms`;
+        }
+        if (unit === 'bytes') {
+            return value >= 1024 * 1024 ? `${(value / 1024 / 1024).toFixed(2)}MB` : `${(value / 1024).toFixed(1)}KB`;
+        }
+        return String(value);
+    }
+}
+
+GoReleaseTour.prototype.profileCode = function() {
+    if (!this.profileViewer) {
+        this.profileViewer = new ProfileViewer(this);
+    }
+    return this.profileViewer.profile();
+};
+
+GoReleaseTour.prototype.hideProfile = function() {
+    if (!this.profileViewer) {
+        this.profileViewer = new ProfileViewer(this);
+    }
+    return this.profileViewer.hide();
+};
@@ -0,0 +1,149 @@
+// コード共有（パーマリンク）の作成と読み込み
+class ShareManager {
+    constructor(tour) {
+        this.tour = tour;
+    }
+
+    // 現在のコード・バージョン・環境変数・実行オプションを共有し、URLを表示してクリップボードにコピー
+    async share() {
+        const code = this.tour.codeEditor ? this.tour.codeEditor.getValue() : document.getElementById('code-editor').value;
+        const output = document.getElementById('output');
+        const shareBtn = document.getElementById('share-btn');
+
+        if (!code.trim()) {
+            this.tour.showError('コードを入力してください');
+            return;
+        }
+
+        const versionSelect = document.getElementById('version-select');
+        const envVarsInput = document.getElementById('env-vars');
+        const fakeTimeInput = document.getElementById('fake-time');
+        const traceSelect = document.getElementById('trace-mode');
+        const payload = {
+            code,
+            version: this.tour.selectedRunVersion((versionSelect && versionSelect.value) || this.tour.currentVersion || '1.25'),
+            env_vars: envVarsInput ? envVarsInput.value.trim() : '',
+            fake_time: fakeTimeInput ? fakeTimeInput.checked : false,
+            trace: traceSelect ? traceSelect.value : '',
+        };
+
+        shareBtn.disabled = true;
+        try {
+            const response = await fetch('/api/share', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(payload),
+            });
+            const result = await response.json();
+            if (!response.ok || result.error) {
+                throw new Error(result.error || `HTTP ${response.status}`);
+            }
+
+            const url = window.location.origin + result.url;
+            let copied = false;
+            if (navigator.clipboard) {
+                try {
+                    await navigator.clipboard.writeText(url);
+                    copied = true;
+                } catch (error) {
+                    console.warn('Clipboard write failed:', error);
+                }
+            }
+            output.textContent = `共有URL${copied ? '（クリップボードにコピーしました）' : ''}:\n${url}\n\nGo ${result.go_version} で固定されています`;
+            output.className = '';
+        } catch (error) {
+            console.error('Share error:', error);
+            this.tour.showError(`共有に失敗しました: ${error.message}`);
+        } finally {
+            shareBtn.disabled = false;
+        }
+    }
+
+    // /s/{id} で開かれた場合に共有コードとバージョンを復元
+    async open(id) {
+        const output = document.getElementById('output');
+        try {
+            const response = await fetch(`/api/share/${encodeURIComponent(id)}`);
+            const snippet = await response.json();
+            if (!response.ok || snippet.error) {
+                throw new Error(snippet.error || `HTTP ${response.status}`);
+            }
+
+            // マイナーバージョンを選び、共有時のパッチがインストールされていればそのパッチで実行する
+            const minorVersion = snippet.version.split('.').slice(0, 2).join('.');
+            this.tour.currentVersion = minorVersion;
+            this.tour.currentLesson = null;
+
+            const versionSelect = document.getElementById('version-select');
+            if (versionSelect) {
+                versionSelect.value = minorVersion;
+            }
+            this.tour.renderPatchSelector(minorVersion, snippet.installed_go_version || '');
+            this.tour.showValidatedPatch(null);
+            const envVarsInput = document.getElementById('env-vars');
+            if (envVarsInput) {
+                envVarsInput.value = snippet.env_vars || '';
+            }
+            // 実行オプションも共有時の状態に戻す
+            const fakeTimeInput = document.getElementById('fake-time');
+            if (fakeTimeInput) {
+                fakeTimeInput.checked = !!snippet.fake_time;
+            }
+            const traceSelect = document.getElementById('trace-mode');
+            if (traceSelect) {
+                traceSelect.value = snippet.trace || '';
+            }
+
+            const welcomeScreen = document.getElementById('welcome-screen');
+            const lessonView = document.getElementById('lesson-view');
+            if (welcomeScreen) {
+                welcomeScreen.style.display = 'none';
+            }
+            if (lessonView) {
+                lessonView.style.display = 'block';
+            }
+
+            document.getElementById('current-lesson-title').textContent = `共有コード（Go ${snippet.version}）`;
+            document.getElementById('current-lesson-stars').textContent = '';
+            const linksContainer = document.getElementById('lesson-links');
+            if (linksContainer) {
+                linksContainer.style.display = 'none';
+            }
+
+            const description = document.getElementById('lesson-description');
+            const info = document.createElement('p');
+            info.textContent = `Go ${snippet.go_version} で共有されたコードです。`;
+            if (snippet.toolchain_changed) {
+                info.textContent += `現在のツールチェーンは Go ${snippet.installed_go_version} のため、結果が異なる場合があります。`;
+            }
+            description.replaceChildren(info);
+
+            this.tour.loadCodeIntoEditor({ code: snippet.code });
+
+            // サイドバーには同じバージョンのレッスンを表示
+            this.tour.loadLessons(minorVersion).then(() => {
+                this.tour.renderLessonList();
+            });
+        } catch (error) {
+            console.error('Shared snippet load error:', error);
+            if (output) {
+                output.textContent = `共有コードを読み込めませんでした: ${error.message}`;
+                output.className = 'error';
+            }
+        }
+    }
+}
+
+GoReleaseTour.prototype.shareCode = function() {
+    if (!this.shareManager) {
+        this.shareManager = new ShareManager(this);
+    }
+    return this.shareManager.share();
+};
+
+GoReleaseTour.prototype.openSharedSnippet = function(id) {
+    if (!this.shareManager) {
+        this.shareManager = new ShareManager(this);
+    }
+    return this.shareManager.open(id);
+};
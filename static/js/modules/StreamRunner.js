@@ -0,0 +1,128 @@
+// WebSocketによるストリーミング実行クライアント
+class StreamRunner {
+    constructor(tour) {
+        this.tour = tour;
+        this.socket = null;
+    }
+
+    static isSupported() {
+        return typeof WebSocket !== 'undefined';
+    }
+
+    // payload: /api/run と同じ { code, version, env_vars }
+    // handlers: { onQueued(position), onStatus(phase), onOutput(stream, data), onExit(result) }
+    run(payload, handlers) {
+        return new Promise((resolve, reject) => {
+            const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+            const socket = new WebSocket(`${protocol}//${window.location.host}/api/run/ws`);
+            this.socket = socket;
+            let finished = false;
+
+            socket.onopen = () => {
+                socket.send(JSON.stringify({ type: 'run', ...payload }));
+                this.setInputEnabled(true);
+            };
+
+            socket.onmessage = (event) => {
+                const message = JSON.parse(event.data);
+                switch (message.type) {
+                    case 'queued':
+                        handlers.onQueued?.(message.position);
+                        break;
+                    case 'status':
+                        handlers.onStatus?.(message.phase);
+                        break;
+                    case 'stdout':
+                    case 'stderr':
+                        handlers.onOutput?.(message.type, message.data);
+                        break;
+                    case 'exit':
+                        finished = true;
+                        handlers.onExit?.(message.result);
+                        resolve(message.result);
+                        break;
+                    case 'error':
+                        finished = true;
+                        if (message.violations) {
+                            // コードポリシー違反は実行結果として表示する（/api/run へのフォールバック不要）
+                            resolve({ status: 'error', error: message.error, violations: message.violations });
+                        } else {
+                            reject(new Error(message.error));
+                        }
+                        break;
+                }
+            };
+
+            socket.onerror = () => {
+                if (!finished) {
+                    finished = true;
+                    reject(new Error('WebSocket接続エラー'));
+                }
+            };
+
+            socket.onclose = () => {
+                this.socket = null;
+                this.setInputEnabled(false);
+                if (!finished) {
+                    finished = true;
+                    reject(new Error('WebSocket接続が切断されました'));
+                }
+            };
+        });
+    }
+
+    sendStdin(line) {
+        if (this.socket && this.socket.readyState === WebSocket.OPEN) {
+            this.socket.send(JSON.stringify({ type: 'stdin', data: line + '\n' }));
+        }
+    }
+
+    stop() {
+        if (this.socket && this.socket.readyState === WebSocket.OPEN) {
+            this.socket.send(JSON.stringify({ type: 'stop' }));
+        }
+    }
+
+    setInputEnabled(enabled) {
+        const stdinInput = document.getElementById('stdin-input');
+        const stopBtn = document.getElementById('stop-btn');
+        if (stdinInput) {
+            stdinInput.disabled = !enabled;
+            if (!enabled) {
+                stdinInput.value = '';
+            }
+        }
+        if (stopBtn) {
+            stopBtn.disabled = !enabled;
+        }
+    }
+
+    bindControls() {
+        const stdinInput = document.getElementById('stdin-input');
+        const stopBtn = document.getElementById('stop-btn');
+        if (stdinInput) {
+            stdinInput.addEventListener('keydown', (event) => {
+                if (event.key === 'Enter') {
+                    event.preventDefault();
+                    const output = document.getElementById('output');
+                    if (output) {
+                        output.textContent += stdinInput.value + '\n';
+                    }
+                    this.sendStdin(stdinInput.value);
+                    stdinInput.value = '';
+                }
+            });
+        }
+        if (stopBtn) {
+            stopBtn.addEventListener('click', () => this.stop());
+        }
+    }
+}
+
+GoReleaseTour.prototype.getStreamRunner = function() {
+    if (!this.streamRunner) {
+        this.streamRunner = new StreamRunner(this);
+        this.streamRunner.bindControls();
+    }
+    return this.streamRunner;
+};
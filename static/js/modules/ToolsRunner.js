@@ -0,0 +1,279 @@
+// 選択中のバージョンの gofmt / go vet を呼び出すクライアント
+class ToolsRunner {
+    constructor(tour) {
+        this.tour = tour;
+    }
+
+    currentCode() {
+        return this.tour.codeEditor ? this.tour.codeEditor.getValue() : document.getElementById('code-editor').value;
+    }
+
+    setCode(code) {
+        if (this.tour.codeEditor) {
+            this.tour.codeEditor.setValue(code);
+        } else {
+            document.getElementById('code-editor').value = code;
+        }
+    }
+
+    // 実行時と同じくバージョンセレクター（パッチが選択されていればそのパッチ）の値を使用
+    currentVersion() {
+        const versionSelect = document.getElementById('version-select');
+        const selected = versionSelect ? versionSelect.value.trim() : '';
+        return this.tour.selectedRunVersion(selected || '1.25');
+    }
+
+    async post(url, payload) {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(payload),
+        });
+        const result = await response.json();
+        if (!response.ok && !result.diagnostics && !result.violations) {
+            throw new Error(result.error || `HTTP ${response.status}`);
+        }
+        return result;
+    }
+
+    async format() {
+        const code = this.currentCode();
+        const output = document.getElementById('output');
+        const formatBtn = document.getElementById('format-btn');
+
+        if (!code.trim()) {
+            this.tour.showError('コードを入力してください');
+            return;
+        }
+
+        formatBtn.disabled = true;
+        try {
+            const result = await this.post('/api/format', { code, version: this.currentVersion(), simplify: true });
+            this.tour.markProblems([], result.diagnostics || []);
+            if (result.error) {
+                output.textContent = result.error;
+                output.className = 'error';
+                return;
+            }
+            if (result.changed) {
+                this.setCode(result.code);
+            }
+            output.textContent = result.changed
+                ? `gofmt -s (Go ${result.go_version}) で整形しました`
+                : `整形済みです (Go ${result.go_version})`;
+            output.className = '';
+        } catch (error) {
+            console.error('Format error:', error);
+            this.tour.showError(`整形に失敗しました: ${error.message}`);
+        } finally {
+            formatBtn.disabled = false;
+        }
+    }
+
+    async vet() {
+        const code = this.currentCode();
+        const output = document.getElementById('output');
+        const vetBtn = document.getElementById('vet-btn');
+
+        if (!code.trim()) {
+            this.tour.showError('コードを入力してください');
+            return;
+        }
+
+        vetBtn.disabled = true;
+        output.textContent = 'go vet 実行中...';
+        output.className = '';
+        try {
+            const result = await this.post('/api/vet', { code, version: this.currentVersion() });
+            const findings = result.findings || [];
+            this.tour.markProblems(result.violations || [], [...(result.diagnostics || []), ...findings]);
+            if (result.error) {
+                output.textContent = result.error;
+                output.className = 'error';
+                return;
+            }
+
+            const lines = [`go vet (Go ${result.go_version}): ${findings.length ? `${findings.length}件の指摘` : '指摘はありません'}`];
+            for (const finding of findings) {
+                lines.push(`${finding.file}:${finding.line}:${finding.column}: [${finding.category}] ${finding.message}`);
+            }
+            output.textContent = lines.join('\n');
+            output.className = findings.length ? 'error' : '';
+        } catch (error) {
+            console.error('Vet error:', error);
+            this.tour.showError(`go vet に失敗しました: ${error.message}`);
+        } finally {
+            vetBtn.disabled = false;
+        }
+    }
+
+    async insight() {
+        const code = this.currentCode();
+        const output = document.getElementById('output');
+        const insightBtn = document.getElementById('insight-btn');
+
+        if (!code.trim()) {
+            this.tour.showError('コードを入力してください');
+            return;
+        }
+
+        const envVarsInput = document.getElementById('env-vars');
+        const envVars = envVarsInput ? envVarsInput.value.trim() : '';
+
+        insightBtn.disabled = true;
+        output.textContent = 'コンパイル中...';
+        output.className = '';
+        try {
+            const result = await this.post('/api/compile/insight', { code, version: this.currentVersion(), env_vars: envVars });
+            this.tour.markProblems(result.violations || [], (result.base && result.base.diagnostics) || []);
+            if (result.error) {
+                output.textContent = result.error;
+                output.className = 'error';
+                return;
+            }
+            output.textContent = this.renderInsight(result.base);
+        } catch (error) {
+            console.error('Compiler insight error:', error);
+            this.tour.showError(`コンパイラ情報の取得に失敗しました: ${error.message}`);
+        } finally {
+            insightBtn.disabled = false;
+        }
+    }
+
+    // 最適化メモとアセンブリをソース行ごとにまとめて表示
+    renderInsight(insight) {
+        const lines = [`コンパイラ: Go ${insight.go_version} (${insight.arch})`, ''];
+
+        lines.push('--- 最適化（-m / 境界チェック） ---');
+        for (const note of insight.notes) {
+            lines.push(`${note.file}:${note.line}:${note.column} [${note.kind}] ${note.message}`);
+        }
+        if (insight.notes.length === 0) {
+            lines.push('（なし）');
+        }
+
+        for (const fn of insight.functions) {
+            lines.push('', `--- ${fn.name} (${fn.file}:${fn.line}, ${fn.size} bytes) ---`);
+            let previous = '';
+            for (const inst of fn.instructions) {
+                const position = `${inst.file}:${inst.line}`;
+                lines.push(`${position === previous ? ''.padEnd(12) : position.padEnd(12)} ${inst.text}`);
+                previous = position;
+            }
+        }
+        if (insight.truncated) {
+            lines.push('', '⚠ 出力サイズの上限に達したため、アセンブリは途中までです');
+        }
+        return lines.join('\n');
+    }
+
+    // インストール済みの全バージョンでビルドし、最も古いバージョンを基準にサイズを比較
+    async size() {
+        const code = this.currentCode();
+        const output = document.getElementById('output');
+        const sizeBtn = document.getElementById('size-btn');
+
+        if (!code.trim()) {
+            this.tour.showError('コードを入力してください');
+            return;
+        }
+
+        const envVarsInput = document.getElementById('env-vars');
+        const envVars = envVarsInput ? envVarsInput.value.trim() : '';
+
+        sizeBtn.disabled = true;
+        output.textContent = '全バージョンでビルド中...';
+        output.className = '';
+        try {
+            if (!this.tour.matrixRunner) {
+                this.tour.matrixRunner = new MatrixRunner(this.tour);
+            }
+            const versions = await this.tour.matrixRunner.availableVersions();
+            const result = await this.post('/api/build/size', { code, versions, env_vars: envVars });
+            if (result.error) {
+                output.textContent = result.error;
+                output.className = 'error';
+                return;
+            }
+            const failed = result.reports.find((report) => report.error);
+            this.tour.markProblems((failed && failed.violations) || [], (failed && failed.diagnostics) || []);
+            output.textContent = this.renderSize(result);
+            output.className = failed ? 'error' : '';
+        } catch (error) {
+            console.error('Binary size error:', error);
+            this.tour.showError(`バイナリサイズの取得に失敗しました: ${error.message}`);
+        } finally {
+            sizeBtn.disabled = false;
+        }
+    }
+
+    renderSize(result) {
+        const kb = (bytes) => `${(bytes / 1024).toFixed(1)} KiB`;
+        const change = (delta) => {
+            const sign = delta.delta > 0 ? '+' : '';
+            const percent = delta.delta_percent !== undefined ? ` (${sign}${delta.delta_percent.toFixed(1)}%)` : '';
+            return `${sign}${delta.delta} B${percent}`;
+        };
+        const lines = [`バイナリサイズ (${result.arch}) 基準: Go ${result.baseline}`, ''];
+
+        for (const report of result.reports) {
+            if (report.error) {
+                lines.push(`=== Go ${report.version} ===`, `エラー: ${report.error}`, '');
+                continue;
+            }
+            lines.push(`=== Go ${report.version} (${report.go_version}) ===`);
+            lines.push(`合計: ${kb(report.total)} / ストリップ (-s -w): ${kb(report.stripped)}`);
+            lines.push('セクション:');
+            for (const section of report.sections.slice(0, 8)) {
+                lines.push(`  ${section.name.padEnd(20)} ${kb(section.size)}`);
+            }
+            lines.push('パッケージ:');
+            for (const pkg of report.packages.slice(0, 10)) {
+                lines.push(`  ${pkg.package.padEnd(40)} ${kb(pkg.size)} (${pkg.symbols} シンボル)`);
+            }
+            lines.push('シンボル:');
+            for (const symbol of report.symbols.slice(0, 10)) {
+                lines.push(`  ${symbol.name.padEnd(40)} ${symbol.size} B [${symbol.type}]`);
+            }
+            lines.push('');
+        }
+
+        for (const diff of result.diffs || []) {
+            lines.push(`--- Go ${result.baseline} → Go ${diff.version} ---`);
+            lines.push(`合計: ${change(diff.total)} / ストリップ: ${change(diff.stripped)}`);
+            for (const pkg of diff.packages.slice(0, 10)) {
+                lines.push(`  ${pkg.name.padEnd(40)} ${change(pkg)}`);
+            }
+            lines.push('');
+        }
+        return lines.join('\n');
+    }
+}
+
+GoReleaseTour.prototype.showCompilerInsight = function() {
+    if (!this.toolsRunner) {
+        this.toolsRunner = new ToolsRunner(this);
+    }
+    return this.toolsRunner.insight();
+};
+
+GoReleaseTour.prototype.formatCode = function() {
+    if (!this.toolsRunner) {
+        this.toolsRunner = new ToolsRunner(this);
+    }
+    return this.toolsRunner.format();
+};
+
+GoReleaseTour.prototype.vetCode = function() {
+    if (!this.toolsRunner) {
+        this.toolsRunner = new ToolsRunner(this);
+    }
+    return this.toolsRunner.vet();
+};
+
+GoReleaseTour.prototype.compareBinarySizes = function() {
+    if (!this.toolsRunner) {
+        this.toolsRunner = new ToolsRunner(this);
+    }
+    return this.toolsRunner.size();
+};
@@ -0,0 +1,124 @@
+// 実行トレースの要約（/api/trace/{id}）をタイムラインとして表示
+class TraceViewer {
+    constructor(tour) {
+        this.tour = tour;
+    }
+
+    // 実行結果に含まれるトレースの要約を取得して表示（トレースがなければ非表示）
+    async show(artifacts) {
+        const container = document.getElementById('trace-viewer');
+        if (!container) {
+            return;
+        }
+        const trace = (artifacts || []).find(artifact => artifact.kind === 'trace');
+        container.innerHTML = '';
+        container.hidden = !trace;
+        if (!trace) {
+            return;
+        }
+
+        container.textContent = 'トレースを解析中...';
+        try {
+            const response = await fetch(trace.summary_url);
+            const summary = await response.json();
+            if (!response.ok || summary.error) {
+                throw new Error(summary.error || `HTTP ${response.status}`);
+            }
+            this.render(container, trace, summary);
+        } catch (error) {
+            console.error('Trace summary error:', error);
+            container.textContent = `トレースの解析に失敗しました: ${error.message}`;
+        }
+    }
+
+    hide() {
+        const container = document.getElementById('trace-viewer');
+        if (container) {
+            container.innerHTML = '';
+            container.hidden = true;
+        }
+    }
+
+    render(container, trace, summary) {
+        const ms = (ns) => `${(ns / 1e6).toFixed(2)}ms`;
+        container.innerHTML = '';
+
+        const header = document.createElement('div');
+        header.className = 'trace-header';
+        const title = document.createElement('strong');
+        title.textContent = `実行トレース (${summary.format}, ${ms(summary.duration)})`;
+        const download = document.createElement('a');
+        download.href = trace.url;
+        download.textContent = `trace.out をダウンロード (${(trace.size / 1024).toFixed(1)} KiB)`;
+        download.title = 'go tool trace trace.out で詳細を表示できます';
+        header.append(title, download);
+        container.appendChild(header);
+
+        const stats = [
+            `GOMAXPROCS: ${summary.gomaxprocs || '-'} / イベント: ${summary.events}`,
+            `goroutine: 作成 ${summary.goroutines.created} / 終了 ${summary.goroutines.ended} / 最大同時 ${summary.goroutines.max_alive}`,
+            `GC: ${summary.gc.cycles}回 (${ms(summary.gc.time)}) / STW: ${summary.gc.pauses}回 合計 ${ms(summary.gc.total_pause)} 最大 ${ms(summary.gc.max_pause)}`,
+        ];
+        if (summary.max_heap_alloc) {
+            stats.push(`ヒープ最大: ${(summary.max_heap_alloc / 1024 / 1024).toFixed(1)} MiB`);
+        }
+        if (trace.truncated || summary.truncated) {
+            stats.push(`⚠ トレースは途中までです${summary.warning ? `（${summary.warning}）` : ''}`);
+        }
+        const statsEl = document.createElement('pre');
+        statsEl.className = 'trace-stats';
+        statsEl.textContent = stats.join('\n');
+        container.appendChild(statsEl);
+
+        // P ごとのタイムライン（goroutine の実行区間）と GC・STW の区間
+        const timeline = document.createElement('div');
+        timeline.className = 'trace-timeline';
+        const duration = summary.duration || 1;
+        const addRow = (label, spans, className, describe) => {
+            const row = document.createElement('div');
+            row.className = 'trace-row';
+            const name = document.createElement('span');
+            name.className = 'trace-label';
+            name.textContent = label;
+            const lane = document.createElement('div');
+            lane.className = 'trace-lane';
+            for (const span of spans) {
+                const bar = document.createElement('div');
+                bar.className = `trace-bar ${className(span)}`;
+                bar.style.left = `${(span.start / duration) * 100}%`;
+                bar.style.width = `${Math.max((span.duration / duration) * 100, 0.2)}%`;
+                bar.title = describe(span);
+                lane.appendChild(bar);
+            }
+            row.append(name, lane);
+            timeline.appendChild(row);
+        };
+        for (const proc of summary.procs) {
+            addRow(`P${proc.id}`, proc.segments, segment => `trace-g${segment.g % 8}`,
+                segment => `G${segment.g} ${ms(segment.start)} +${ms(segment.duration)}`);
+        }
+        addRow('GC', summary.gc.spans, () => 'trace-gc', span => `GC ${ms(span.start)} +${ms(span.duration)}`);
+        addRow('STW', summary.gc.pause_spans, () => 'trace-stw', span => `${span.label} ${ms(span.start)} +${ms(span.duration)}`);
+        container.appendChild(timeline);
+
+        const lines = ['ブロック理由:'];
+        for (const reason of summary.blocking.slice(0, 8)) {
+            lines.push(`  ${reason.reason.padEnd(28)} ${String(reason.count).padStart(5)}回 ${ms(reason.total)}`);
+        }
+        lines.push('', 'goroutine（実行時間順）:');
+        for (const g of summary.goroutines.top.slice(0, 10)) {
+            lines.push(`  G${String(g.id).padEnd(5)} ${(g.function || '-').padEnd(40)} 実行 ${ms(g.running)} / ブロック ${ms(g.blocked)}`);
+        }
+        const details = document.createElement('pre');
+        details.className = 'trace-stats';
+        details.textContent = lines.join('\n');
+        container.appendChild(details);
+    }
+}
+
+GoReleaseTour.prototype.showTrace = function(artifacts) {
+    if (!this.traceViewer) {
+        this.traceViewer = new TraceViewer(this);
+    }
+    return this.traceViewer.show(artifacts);
+};
@@ -0,0 +1,126 @@
+// ブラウザでの実行: サーバーで GOOS=js GOARCH=wasm にビルドし、同じツールチェーンの wasm_exec.js で実行
+class WasmRunner {
+    constructor(tour) {
+        this.tour = tour;
+        this.worker = null;
+        this.timeoutMs = 30000;
+    }
+
+    static isSupported() {
+        return typeof WebAssembly !== 'undefined' && typeof Worker !== 'undefined';
+    }
+
+    // payload: /api/run と同じ。ブラウザで実行できないコードは { fallback: [理由...] } を返す
+    async run(payload, output) {
+        output.textContent = 'WebAssembly にビルド中...';
+        const response = await fetch('/api/run/wasm', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(payload),
+        });
+        const build = await response.json().catch(() => ({}));
+        if (response.status === 429) {
+            throw new Error(build.error || '実行キューが満杯です');
+        }
+        if (build.supported === false) {
+            return { fallback: build.unsupported || [] };
+        }
+
+        const result = {
+            go_version: build.go_version,
+            used_version: build.used_version,
+            detected_version: payload.version,
+            sandbox: 'browser-wasm',
+            cache_hit: build.cache_hit,
+            compile_time: this.formatDuration(build.compile_time || 0),
+            build_output: build.build_output,
+            diagnostics: build.diagnostics,
+            violations: build.violations,
+        };
+        if (build.error || !response.ok) {
+            return { ...result, status: 'error', exit_code: 1, error: build.error || `HTTP ${response.status}`, output: '' };
+        }
+
+        output.textContent = '実行中（ブラウザ）...\n';
+        const started = performance.now();
+        const run = await this.execute(build.exec_url, build.wasm_url, (stream, data) => {
+            if (result.output === undefined) {
+                output.textContent = '';
+                result.output = '';
+                result.stdout = '';
+                result.stderr = '';
+            }
+            result.output += data;
+            result[stream] += data;
+            output.textContent += data;
+        });
+        const elapsed = performance.now() - started;
+
+        result.output = result.output || '';
+        result.stdout = result.stdout || '';
+        result.stderr = result.stderr || '';
+        result.exit_code = run.code;
+        result.status = run.status;
+        result.run_time = this.formatDuration(elapsed * 1e6);
+        result.execution_time = result.run_time;
+        if (run.status === 'timeout') {
+            result.error = `ブラウザでの実行がタイムアウトしました (${this.timeoutMs / 1000}s)`;
+        } else if (run.error) {
+            result.error = run.error;
+        } else if (run.code !== 0) {
+            result.error = `exit status ${run.code}`;
+        }
+        return result;
+    }
+
+    // Web Worker で実行し、終了・エラー・タイムアウトまで待つ
+    execute(execURL, wasmURL, onOutput) {
+        this.stop();
+        return new Promise((resolve) => {
+            const worker = new Worker('/static/js/wasm-worker.js');
+            this.worker = worker;
+            const finish = (run) => {
+                clearTimeout(timer);
+                worker.terminate();
+                if (this.worker === worker) {
+                    this.worker = null;
+                }
+                resolve(run);
+            };
+            const timer = setTimeout(() => finish({ status: 'timeout', code: -1 }), this.timeoutMs);
+
+            worker.onmessage = (event) => {
+                const message = event.data;
+                if (message.type === 'output') {
+                    onOutput(message.stream, message.data);
+                } else if (message.type === 'exit') {
+                    finish({ status: message.code === 0 ? 'success' : 'error', code: message.code });
+                } else if (message.type === 'error') {
+                    finish({ status: 'error', code: 1, error: message.message });
+                }
+            };
+            worker.onerror = (event) => {
+                finish({ status: 'error', code: 1, error: event.message });
+            };
+            worker.postMessage({ execURL, wasmURL });
+        });
+    }
+
+    stop() {
+        if (this.worker) {
+            this.worker.terminate();
+            this.worker = null;
+        }
+    }
+
+    formatDuration(ns) {
+        return ns >= 1e9 ? `${(ns / 1e9).toFixed(2)}s` : `${(ns / 1e6).toFixed(1)}ms`;
+    }
+}
+
+GoReleaseTour.prototype.getWasmRunner = function() {
+    if (!this.wasmRunner) {
+        this.wasmRunner = new WasmRunner(this);
+    }
+    return this.wasmRunner;
+};
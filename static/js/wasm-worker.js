@@ -0,0 +1,33 @@
+// ブラウザでの WebAssembly 実行（WasmRunner から起動される Web Worker）
+// メッセージ: { execURL, wasmURL } を受け取り、{ type: 'output' | 'exit' | 'error' } を返す
+self.onmessage = async (event) => {
+    const { execURL, wasmURL } = event.data;
+    try {
+        // ビルドに使用したツールチェーンの wasm_exec.js（Go クラスと fs のスタブを定義）
+        importScripts(execURL);
+
+        // 標準出力・標準エラー出力を行単位ではなくチャンクごとにメインスレッドへ送る
+        const decoders = { 1: new TextDecoder(), 2: new TextDecoder() };
+        globalThis.fs.writeSync = (fd, buf) => {
+            const decoder = decoders[fd] || decoders[1];
+            self.postMessage({ type: 'output', stream: fd === 2 ? 'stderr' : 'stdout', data: decoder.decode(buf, { stream: true }) });
+            return buf.length;
+        };
+
+        const go = new Go();
+        let exitCode = 0;
+        go.exit = (code) => {
+            exitCode = code;
+        };
+
+        const response = await fetch(wasmURL);
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        const { instance } = await WebAssembly.instantiate(await response.arrayBuffer(), go.importObject);
+        await go.run(instance);
+        self.postMessage({ type: 'exit', code: exitCode });
+    } catch (error) {
+        self.postMessage({ type: 'error', message: error.message });
+    }
+};
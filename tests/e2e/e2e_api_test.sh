@@ -156,6 +156,53 @@ run_api_error_test() {
     return 0
 }
 
+# files（複数ファイル）のリクエストでエラーが期待される場合のテスト関数
+run_api_files_error_test() {
+    local test_name="$1"
+    local version="$2"
+    local files="$3"
+    local expected_error_pattern="$4"
+
+    echo "Testing: $test_name (Go $version) - Expected Error"
+
+    # テスト用ペイロード作成（files はファイル名 -> 内容のJSONオブジェクト）
+    local payload=$(jq -n \
+        --argjson files "$files" \
+        --arg version "$version" \
+        '{
+            "files": $files,
+            "version": $version,
+            "auto_detect": false
+        }')
+
+    local start_time=$(date +%s.%3N)
+
+    local response=$(curl -s -X POST "$BASE_URL/api/run" \
+        -H "Content-Type: application/json" \
+        -d "$payload" || echo '{"error": "Request failed"}')
+
+    local end_time=$(date +%s.%3N)
+    local execution_time=$(echo "$end_time - $start_time" | bc)
+
+    local api_error=$(echo "$response" | jq -r '.error // empty')
+
+    if [ -z "$api_error" ]; then
+        echo "FAILED: Expected error but got success"
+        record_test "$test_name" "$version" "FAILED" "${execution_time}s" "Expected error but got success"
+        return 1
+    fi
+
+    if [ -n "$expected_error_pattern" ] && [[ "$api_error" != *"$expected_error_pattern"* ]]; then
+        echo "FAILED: Expected error containing '$expected_error_pattern', got: $api_error"
+        record_test "$test_name" "$version" "FAILED" "${execution_time}s" "Error pattern mismatch"
+        return 1
+    fi
+
+    echo "PASSED: Error correctly returned - ${execution_time}s"
+    record_test "$test_name" "$version" "PASSED" "${execution_time}s" "Error correctly handled: $api_error"
+    return 0
+}
+
 # サーバー接続確認
 echo "Checking server availability..."
 if ! curl -s "$BASE_URL/" > /dev/null; then
@@ -284,6 +331,41 @@ func main() {
 }' \
 "サポートされていないGoバージョン"
 
+# コードポリシー: 別名を付けた unsafe の import
+run_api_error_test "Policy: Aliased unsafe" "1.25" \
+'package main
+
+import u "unsafe"
+
+func main() {
+    _ = u.Pointer(nil)
+}' \
+"パッケージ 'unsafe' は使用できません"
+
+# コードポリシー: 2つ目のファイルでの cgo（import "C"）
+run_api_files_error_test "Policy: cgo in second file" "1.25" \
+'{
+    "main.go": "package main\n\nfunc main() { hello() }\n",
+    "hello.go": "package main\n\n// #include <stdio.h>\nimport \"C\"\n\nfunc hello() {}\n"
+}' \
+"hello.go:4:8"
+
+# アセンブリファイルは拒否
+run_api_files_error_test "Reject assembly file" "1.25" \
+'{
+    "main.go": "package main\n\nfunc main() {}\n",
+    "asm_amd64.s": "TEXT ·f(SB),0,$0\n\tRET\n"
+}' \
+"アセンブリ・オブジェクト・C系のファイルは指定できません"
+
+# go.mod の replace でホストのディレクトリを指定することは拒否
+run_api_files_error_test "Reject replace with host path" "1.25" \
+'{
+    "main.go": "package main\n\nfunc main() {}\n",
+    "go.mod": "module tour\n\ngo 1.25\n\nreplace example.com/x => /etc\n"
+}' \
+"作業ディレクトリ外のパスは指定できません"
+
 # バージョン指定なし
 echo "Testing: No Version Specified"
 response=$(curl -s -X POST "$BASE_URL/api/run" \